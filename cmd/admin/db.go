@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+// migrate only reports the result, migrations run whenever the database is opened
+func migrate(c *cli, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	result := map[string]any{"database": c.Config.Database.Database, "migrated": true}
+	c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Database %s is up to date\n", c.Config.Database.Database)
+	})
+	return nil
+}
+
+// seedResult is printed by the seed command
+type seedResult struct {
+	Roles []string    `json:"roles"`           // Roles that were created
+	Admin *userResult `json:"admin,omitempty"` // Set when the first admin was created
+}
+
+// seed creates the roles known to the application and, unless an admin exists, the first admin.
+// It can be run repeatedly.
+func seed(c *cli, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	username := fs.String("username", "admin", "username of the first admin")
+	email := fs.String("email", "admin@example.com", "email address of the first admin")
+	password := fs.String("password", "", "password of the first admin, generated if empty")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	result := &seedResult{Roles: []string{}}
+	for _, name := range slices.Sorted(maps.Keys(domain.RolePermissions)) {
+		role, err := c.RoleRepo.GetByName(c.ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to get role: %w", err)
+		}
+		if role != nil {
+			continue
+		}
+		if err := c.RoleRepo.Create(c.ctx, &domain.Role{Name: name}); err != nil {
+			return fmt.Errorf("failed to create role: %w", err)
+		}
+		result.Roles = append(result.Roles, name)
+	}
+
+	admins, err := c.UserService.ListUsers(c.ctx, &domain.UserQuery{Role: "admin", Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(admins.Items) == 0 {
+		if result.Admin, err = createUser(c, *username, *email, *password, true); err != nil {
+			return err
+		}
+	}
+
+	c.print(result, func(w io.Writer) {
+		for _, name := range result.Roles {
+			fmt.Fprintf(w, "Created role %s\n", name)
+		}
+		if result.Admin == nil {
+			fmt.Fprintln(w, "An admin already exists")
+			return
+		}
+		fmt.Fprintln(w, "Created admin:")
+		c.printUser(result.Admin)
+	})
+	return nil
+}
+
+// dbBackup writes a consistent copy of the database while the server may keep running
+func dbBackup(c *cli, args []string) error {
+	fs := flag.NewFlagSet("db backup", flag.ContinueOnError)
+	positional, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	path, err := filepath.Abs(positional[0])
+	if err != nil {
+		return err
+	}
+	// VACUUM INTO refuses to overwrite, fail early with a clearer message
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file %s already exists", path)
+	}
+	if _, err := c.DB.ExecContext(c.ctx, `VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	result := map[string]any{"file": path, "size": info.Size()}
+	c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Backed up %s to %s (%d bytes)\n", c.Config.Database.Database, path, info.Size())
+	})
+	return nil
+}
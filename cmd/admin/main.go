@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	_ "github.com/luxixing/fx-gin/internal/infra/blob"
+	_ "github.com/luxixing/fx-gin/internal/infra/db"
+	_ "github.com/luxixing/fx-gin/internal/infra/mail"
+	_ "github.com/luxixing/fx-gin/internal/infra/signing"
+	_ "github.com/luxixing/fx-gin/internal/repo"
+	_ "github.com/luxixing/fx-gin/internal/service"
+	_ "github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/validation"
+	"github.com/rs/xid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const usage = `Usage: admin [-env file] [-json] [-v] <command> [flags] [args]
+
+Commands:
+  user create -username name -email address [-password secret] [-admin]
+  user list [-status n] [-role name] [-q text] [-deleted] [-limit n] [-cursor c]
+  user lock <id|username>
+  user unlock <id|username>
+  user reset-password [-password secret] <id|username>
+  role list
+  role assign <id|username> <role>
+  role revoke <id|username> <role>
+  migrate
+  seed [-username name] [-email address] [-password secret]
+  db backup <file>
+
+Generated passwords are printed once. Flags must precede arguments.
+`
+
+// deps are the parts of the application graph used by the commands
+type deps struct {
+	fx.In
+
+	Config         *config.Config
+	DB             *sql.DB
+	UserService    domain.UserService
+	AccountService domain.AccountService
+	Auditor        domain.Auditor
+	UserRepo       domain.UserRepo
+	RoleRepo       domain.RoleRepo
+}
+
+// cli carries the application graph and output settings into the commands
+type cli struct {
+	deps
+	ctx    context.Context
+	json   bool
+	stdout io.Writer
+}
+
+// command runs one subcommand with its remaining arguments
+type command func(c *cli, args []string) error
+
+var commands = map[string]command{
+	"user create":         userCreate,
+	"user list":           userList,
+	"user lock":           userLock,
+	"user unlock":         userUnlock,
+	"user reset-password": userResetPassword,
+	"role list":           roleList,
+	"role assign":         roleAssign,
+	"role revoke":         roleRevoke,
+	"migrate":             migrate,
+	"seed":                seed,
+	"db backup":           dbBackup,
+}
+
+func main() {
+	envFile := flag.String("env", ".env", "path to the env file, default is .env")
+	jsonOutput := flag.Bool("json", false, "print results as JSON")
+	verbose := flag.Bool("v", false, "print application logs")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	name, run, args := lookupCommand(flag.Args())
+	if run == nil {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(*envFile); err != nil && *verbose {
+		fmt.Fprintf(os.Stderr, "warning: failed to load env file: %v\n", err)
+	}
+	// Logs go to stderr, only errors are shown unless asked for
+	if !*verbose {
+		zap.ReplaceGlobals(zap.L().WithOptions(zap.IncreaseLevel(zap.ErrorLevel)))
+	}
+
+	c := &cli{json: *jsonOutput, stdout: os.Stdout}
+	app := fx.New(
+		registry.GetModules(),
+		fx.NopLogger,
+		fx.Invoke(func(d deps) { c.deps = d }),
+	)
+	if err := app.Err(); err != nil {
+		fail(c, err)
+	}
+	defer c.DB.Close()
+
+	// Register custom validation rules, requests are validated like HTTP requests
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := validation.Setup(v); err != nil {
+			fail(c, err)
+		}
+	}
+
+	// The audit log attributes the changes to this invocation
+	c.ctx = context.WithValue(context.Background(), domain.TraceKey, &domain.TraceInfo{
+		RequestID: xid.New().String(),
+		StartTime: time.Now(),
+		Method:    "CLI",
+		Path:      name,
+	})
+
+	if err := run(c, args); err != nil {
+		c.DB.Close()
+		fail(c, err)
+	}
+}
+
+// lookupCommand finds the command named by the first one or two arguments
+func lookupCommand(args []string) (string, command, []string) {
+	if len(args) >= 2 {
+		name := args[0] + " " + args[1]
+		if run, ok := commands[name]; ok {
+			return name, run, args[2:]
+		}
+	}
+	if len(args) >= 1 {
+		if run, ok := commands[args[0]]; ok {
+			return args[0], run, args[1:]
+		}
+	}
+	return "", nil, nil
+}
+
+// print writes a result as JSON, or in its text form
+func (c *cli) print(v any, text func(w io.Writer)) {
+	if c.json {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(v)
+		return
+	}
+	text(c.stdout)
+}
+
+// fail reports an error and exits. Application errors keep their code so scripts can match on it.
+func fail(c *cli, err error) {
+	code := "error"
+	var appErr *domain.Error
+	if errors.As(err, &appErr) {
+		code = appErr.Code
+	}
+
+	if c.json {
+		json.NewEncoder(os.Stderr).Encode(map[string]string{"code": code, "error": err.Error()})
+	} else {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	os.Exit(1)
+}
+
+// Helper function: Parse command flags, reporting usage errors as errors
+func parseFlags(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != positional {
+		return nil, fmt.Errorf("%s expects %d argument(s), got %d", fs.Name(), positional, fs.NArg())
+	}
+	return fs.Args(), nil
+}
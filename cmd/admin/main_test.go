@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/infra/db"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/validation"
+	"go.uber.org/fx"
+)
+
+var setupValidation sync.Once
+
+// newTestCLI builds the application graph on a migrated database in a temporary directory.
+// The connection of the application is shared by the process, so the graph gets its own.
+// Commands print JSON into the returned buffer.
+func newTestCLI(t *testing.T) (*cli, *bytes.Buffer) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "admin.db")
+	t.Setenv("DATABASE_DATABASE", path)
+	t.Setenv("MAIL_OUTBOX_DIR", filepath.Join(dir, "outbox"))
+	t.Setenv("BLOB_LOCAL_DIR", filepath.Join(dir, "blobs"))
+	t.Setenv("OAUTH_SIGNING_KEY_FILE", filepath.Join(dir, "signing_key.pem"))
+
+	database := openDB(t, path)
+	if err := db.RunMigrations(db.MigrationConfig{DB: database}); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+
+	var out bytes.Buffer
+	c := &cli{json: true, stdout: &out}
+	app := fx.New(
+		registry.GetModules(),
+		fx.Replace(database),
+		fx.NopLogger,
+		fx.Invoke(func(d deps) { c.deps = d }),
+	)
+	if err := app.Err(); err != nil {
+		t.Fatalf("build application: %v", err)
+	}
+
+	setupValidation.Do(func() {
+		if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+			if err := validation.Setup(v); err != nil {
+				t.Fatalf("set up validation: %v", err)
+			}
+		}
+	})
+
+	c.ctx = context.WithValue(context.Background(), domain.TraceKey, &domain.TraceInfo{
+		RequestID: "cli-test",
+		StartTime: time.Now(),
+		Method:    "CLI",
+	})
+	return c, &out
+}
+
+// openDB opens a SQLite database that is closed with the test
+func openDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+
+	database, err := sql.Open("sqlite3", db.DataSourceName(path))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// run runs a command line and decodes its JSON output into v
+func run(t *testing.T, c *cli, out *bytes.Buffer, v any, args ...string) error {
+	t.Helper()
+
+	_, cmd, rest := lookupCommand(args)
+	if cmd == nil {
+		t.Fatalf("unknown command %v", args)
+	}
+	out.Reset()
+	if err := cmd(c, rest); err != nil {
+		return err
+	}
+	if v != nil {
+		if err := json.Unmarshal(out.Bytes(), v); err != nil {
+			t.Fatalf("decode output of %v: %v\n%s", args, err, out.String())
+		}
+	}
+	return nil
+}
+
+// mustRun runs a command line that is expected to succeed
+func mustRun(t *testing.T, c *cli, out *bytes.Buffer, v any, args ...string) {
+	t.Helper()
+
+	if err := run(t, c, out, v, args...); err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	c, out := newTestCLI(t)
+
+	var first seedResult
+	mustRun(t, c, out, &first, "seed", "-username", "root", "-email", "root@example.com")
+	if first.Admin == nil || first.Admin.User.Username != "root" || first.Admin.Password == "" {
+		t.Fatalf("admin = %+v, want root with a generated password", first.Admin)
+	}
+	if first.Admin.User.Status != domain.UserStatusActive || !slices.Contains(first.Admin.Roles, "admin") {
+		t.Errorf("admin is %s with roles %v, want active with admin", statusName(first.Admin.User.Status), first.Admin.Roles)
+	}
+	if _, err := c.UserService.Login(c.ctx, &domain.LoginRequest{Username: "root", Password: first.Admin.Password}); err != nil {
+		t.Errorf("login with the generated password: %v", err)
+	}
+
+	// Seeding again finds the roles and the admin
+	var second seedResult
+	mustRun(t, c, out, &second, "seed")
+	if len(second.Roles) != 0 || second.Admin != nil {
+		t.Errorf("second seed = %+v, want no changes", second)
+	}
+}
+
+func TestUserCommands(t *testing.T) {
+	c, out := newTestCLI(t)
+
+	var created userResult
+	mustRun(t, c, out, &created, "user", "create", "-username", "alice", "-email", "alice@example.com", "-password", "Passw0rd1")
+	if created.User.Status != domain.UserStatusActive || !slices.Equal(created.Roles, []string{"user"}) || created.Password != "" {
+		t.Errorf("created %s with roles %v and password %q, want active with user and no password",
+			statusName(created.User.Status), created.Roles, created.Password)
+	}
+	id := strconv.FormatInt(created.User.ID, 10)
+
+	err := run(t, c, out, nil, "user", "create", "-username", "alice", "-email", "other@example.com")
+	if !errors.Is(err, domain.ErrUsernameExists) {
+		t.Errorf("create duplicate: err = %v, want %v", err, domain.ErrUsernameExists)
+	}
+	if err := run(t, c, out, nil, "user", "create", "-username", "bob", "-email", "not-an-email"); !errors.Is(err, domain.ErrInvalidRequest) {
+		t.Errorf("create with invalid email: err = %v, want %v", err, domain.ErrInvalidRequest)
+	}
+	mustRun(t, c, out, nil, "user", "create", "-username", "carol", "-email", "carol@example.com", "-admin")
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"all", []string{"user", "list"}, []string{"alice", "carol"}},
+		{"by role", []string{"user", "list", "-role", "admin"}, []string{"carol"}},
+		{"by search", []string{"user", "list", "-q", "al"}, []string{"alice"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var list domain.UserList
+			mustRun(t, c, out, &list, tc.args...)
+			got := []string{}
+			for _, user := range list.Items {
+				got = append(got, user.Username)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("users = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// Users are found by username or ID
+	var result userResult
+	mustRun(t, c, out, &result, "user", "lock", "alice")
+	if result.User.Status != domain.UserStatusLocked {
+		t.Errorf("lock: status = %s, want locked", statusName(result.User.Status))
+	}
+	mustRun(t, c, out, &result, "user", "unlock", id)
+	if result.User.Status != domain.UserStatusActive {
+		t.Errorf("unlock: status = %s, want active", statusName(result.User.Status))
+	}
+	if err := run(t, c, out, nil, "user", "lock", "nobody"); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("lock unknown user: err = %v, want %v", err, domain.ErrUserNotFound)
+	}
+	if err := run(t, c, out, nil, "user", "lock"); err == nil {
+		t.Errorf("lock without a user: want an error")
+	}
+}
+
+func TestRoleCommands(t *testing.T) {
+	c, out := newTestCLI(t)
+	mustRun(t, c, out, nil, "user", "create", "-username", "alice", "-email", "alice@example.com")
+
+	var roles []*domain.Role
+	mustRun(t, c, out, &roles, "role", "list")
+	if len(roles) == 0 {
+		t.Fatalf("role list is empty")
+	}
+
+	var result userResult
+	mustRun(t, c, out, &result, "role", "assign", "alice", "admin")
+	if !slices.Equal(result.Roles, []string{"admin", "user"}) && !slices.Equal(result.Roles, []string{"user", "admin"}) {
+		t.Errorf("after assign: roles = %v, want user and admin", result.Roles)
+	}
+	mustRun(t, c, out, &result, "role", "revoke", "alice", "user")
+	if !slices.Equal(result.Roles, []string{"admin"}) {
+		t.Errorf("after revoke: roles = %v, want [admin]", result.Roles)
+	}
+	if err := run(t, c, out, nil, "role", "assign", "alice", "nonexistent"); err == nil {
+		t.Errorf("assign unknown role: want an error")
+	}
+}
+
+func TestResetPasswordEndsSessions(t *testing.T) {
+	c, out := newTestCLI(t)
+	var created userResult
+	mustRun(t, c, out, &created, "user", "create", "-username", "alice", "-email", "alice@example.com", "-password", "Passw0rd1")
+
+	if _, err := c.UserService.Login(c.ctx, &domain.LoginRequest{Username: "alice", Password: "Passw0rd1"}); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if _, err := c.DB.Exec(`INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		created.User.ID, domain.TokenPurposeAccess, "access-hash", time.Now().Add(time.Hour), time.Now()); err != nil {
+		t.Fatalf("create access token: %v", err)
+	}
+
+	if err := run(t, c, out, nil, "user", "reset-password", "-password", "short", "alice"); !errors.Is(err, domain.ErrInvalidRequest) {
+		t.Errorf("reset to an invalid password: err = %v, want %v", err, domain.ErrInvalidRequest)
+	}
+
+	var result userResult
+	mustRun(t, c, out, &result, "user", "reset-password", "alice")
+	if result.Password == "" || !slices.Equal(result.Roles, []string{"user"}) {
+		t.Fatalf("result = %+v, want a generated password and the user role", result)
+	}
+
+	var tokens int
+	if err := c.DB.QueryRow(`SELECT COUNT(*) FROM user_tokens WHERE user_id = ? AND purpose = ?`, created.User.ID, domain.TokenPurposeAccess).Scan(&tokens); err != nil {
+		t.Fatalf("count access tokens: %v", err)
+	}
+	if tokens != 0 {
+		t.Errorf("%d access tokens survived the reset", tokens)
+	}
+	if _, err := c.UserService.Login(c.ctx, &domain.LoginRequest{Username: "alice", Password: "Passw0rd1"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Errorf("login with the old password: err = %v, want %v", err, domain.ErrInvalidCredentials)
+	}
+	if _, err := c.UserService.Login(c.ctx, &domain.LoginRequest{Username: "alice", Password: result.Password}); err != nil {
+		t.Errorf("login with the new password: %v", err)
+	}
+}
+
+func TestDBBackup(t *testing.T) {
+	c, out := newTestCLI(t)
+	mustRun(t, c, out, nil, "user", "create", "-username", "alice", "-email", "alice@example.com")
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	var result struct {
+		File string `json:"file"`
+		Size int64  `json:"size"`
+	}
+	mustRun(t, c, out, &result, "db", "backup", path)
+	if info, err := os.Stat(path); err != nil || info.Size() != result.Size || result.Size == 0 {
+		t.Errorf("backup = %+v, stat err = %v, want the written file", result, err)
+	}
+
+	// The backup is a usable copy of the database
+	var users int
+	if err := openDB(t, path).QueryRow(`SELECT COUNT(*) FROM users WHERE username = 'alice'`).Scan(&users); err != nil || users != 1 {
+		t.Errorf("users in backup = %d, err = %v, want alice", users, err)
+	}
+
+	if err := run(t, c, out, nil, "db", "backup", path); err == nil {
+		t.Errorf("backup over an existing file: want an error")
+	}
+}
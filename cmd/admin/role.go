@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+func roleList(c *cli, args []string) error {
+	fs := flag.NewFlagSet("role list", flag.ContinueOnError)
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	roles, err := c.RoleRepo.List(c.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list roles: %w", err)
+	}
+	if roles == nil {
+		roles = []*domain.Role{}
+	}
+
+	c.print(roles, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tPERMISSIONS\tDESCRIPTION")
+		for _, role := range roles {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", role.ID, role.Name,
+				strings.Join(domain.RolePermissions[role.Name], ","), role.Description)
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+func roleAssign(c *cli, args []string) error {
+	return changeRoles(c, "role assign", args, func(roles []string, role string) []string {
+		if slices.Contains(roles, role) {
+			return roles
+		}
+		return append(roles, role)
+	})
+}
+
+func roleRevoke(c *cli, args []string) error {
+	return changeRoles(c, "role revoke", args, func(roles []string, role string) []string {
+		return slices.DeleteFunc(roles, func(name string) bool { return name == role })
+	})
+}
+
+// changeRoles replaces the roles of the user named by the first argument with
+// the result of applying change to the role named by the second
+func changeRoles(c *cli, name string, args []string, change func(roles []string, role string) []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	positional, err := parseFlags(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.findUser(positional[0])
+	if err != nil {
+		return err
+	}
+	current, err := c.UserService.GetUserWithRoles(c.ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	roles := make([]string, 0, len(current.Roles))
+	for _, role := range current.Roles {
+		roles = append(roles, role.Name)
+	}
+
+	updated, err := c.patchUser(user.ID, map[string]any{"roles": change(roles, positional[1])})
+	if err != nil {
+		return err
+	}
+	c.printUser(updated)
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/jsonpatch"
+	"github.com/luxixing/fx-gin/pkg/validation"
+)
+
+// operator is the principal commands act as, it holds every permission
+var operator = &domain.Principal{
+	Roles:       []string{"admin"},
+	Permissions: []string{domain.PermissionAll},
+	Method:      "cli",
+}
+
+// userResult is printed by commands that change a user
+type userResult struct {
+	User     *domain.User `json:"user"`
+	Roles    []string     `json:"roles"`
+	Password string       `json:"password,omitempty"` // Only set when it was generated
+}
+
+func userCreate(c *cli, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	username := fs.String("username", "", "username")
+	email := fs.String("email", "", "email address")
+	password := fs.String("password", "", "password, generated if empty")
+	admin := fs.Bool("admin", false, "grant the admin role")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	result, err := createUser(c, *username, *email, *password, *admin)
+	if err != nil {
+		return err
+	}
+	c.printUser(result)
+	return nil
+}
+
+// createUser registers an active user, optionally with the admin role
+func createUser(c *cli, username, email, password string, admin bool) (*userResult, error) {
+	result := &userResult{}
+	if password == "" {
+		generated, err := generatePassword()
+		if err != nil {
+			return nil, err
+		}
+		password, result.Password = generated, generated
+	}
+
+	req := &domain.UserRequest{Username: username, Email: email, Password: password}
+	if err := validation.Struct(req); err != nil {
+		return nil, domain.ErrInvalidRequest.Wrap(err)
+	}
+	user, err := c.UserService.Register(c.ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Accounts created by an operator do not wait for email verification
+	patch := map[string]any{"status": domain.UserStatusActive}
+	if admin {
+		patch["roles"] = []string{"user", "admin"}
+	}
+	updated, err := c.patchUser(user.ID, patch)
+	if err != nil {
+		return nil, err
+	}
+	result.User, result.Roles = updated.User, updated.Roles
+	return result, nil
+}
+
+func userList(c *cli, args []string) error {
+	fs := flag.NewFlagSet("user list", flag.ContinueOnError)
+	status := fs.Int("status", -1, "filter by status: 0 inactive, 1 active, 2 locked")
+	var query domain.UserQuery
+	fs.StringVar(&query.Role, "role", "", "filter by role name")
+	fs.StringVar(&query.Search, "q", "", "prefix search on username, email and nickname")
+	fs.StringVar(&query.Sort, "sort", "", "sort field, prefixed with - for descending order")
+	fs.BoolVar(&query.Deleted, "deleted", false, "list soft deleted users")
+	fs.IntVar(&query.Limit, "limit", domain.MaxPageSize, "users per page")
+	fs.StringVar(&query.Cursor, "cursor", "", "cursor of the page to fetch")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *status >= 0 {
+		query.Status = status
+	}
+
+	list, err := c.UserService.ListUsers(c.ctx, &query)
+	if err != nil {
+		return err
+	}
+
+	c.print(list, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSERNAME\tEMAIL\tSTATUS\tCREATED")
+		for _, user := range list.Items {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", user.ID, user.Username, user.Email,
+				statusName(user.Status), user.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		tw.Flush()
+		if list.Pagination.HasMore {
+			fmt.Fprintf(w, "\nMore users follow, continue with -cursor %s\n", list.Pagination.NextCursor)
+		}
+	})
+	return nil
+}
+
+func userLock(c *cli, args []string) error {
+	return setStatus(c, "user lock", args, domain.UserStatusLocked)
+}
+
+func userUnlock(c *cli, args []string) error {
+	return setStatus(c, "user unlock", args, domain.UserStatusActive)
+}
+
+// setStatus changes the status of the user named by the only argument
+func setStatus(c *cli, name string, args []string, status int) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	positional, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.findUser(positional[0])
+	if err != nil {
+		return err
+	}
+	updated, err := c.patchUser(user.ID, map[string]any{"status": status})
+	if err != nil {
+		return err
+	}
+	c.printUser(&userResult{User: updated.User, Roles: updated.Roles})
+	return nil
+}
+
+func userResetPassword(c *cli, args []string) error {
+	fs := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	password := fs.String("password", "", "new password, generated if empty")
+	positional, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.findUser(positional[0])
+	if err != nil {
+		return err
+	}
+	result := &userResult{}
+	if *password == "" {
+		if *password, err = generatePassword(); err != nil {
+			return err
+		}
+		result.Password = *password
+	}
+
+	if err := validation.Struct(&passwordRequest{Password: *password}); err != nil {
+		return domain.ErrInvalidRequest.Wrap(err)
+	}
+
+	// Unlike a patch, setting the password ends the sessions of the user
+	if err := c.AccountService.SetPassword(c.ctx, user, *password); err != nil {
+		return err
+	}
+	c.Auditor.Record(c.ctx, &domain.AuditEvent{
+		Action:     domain.AuditUserPasswordReset,
+		TargetType: domain.AuditTargetUser,
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		Detail:     "reset by operator",
+	})
+
+	updated, err := c.UserService.GetUserWithRoles(c.ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	result.User, result.Roles = &updated.User, make([]string, 0, len(updated.Roles))
+	for _, role := range updated.Roles {
+		result.Roles = append(result.Roles, role.Name)
+	}
+	c.printUser(result)
+	return nil
+}
+
+// passwordRequest validates a password set by an operator with the rules of the API
+type passwordRequest struct {
+	Password string `json:"password" binding:"required,min=6,password"`
+}
+
+// findUser resolves a user by ID or username
+func (c *cli) findUser(ref string) (*domain.User, error) {
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return c.UserService.GetUserByID(c.ctx, id)
+	}
+
+	user, err := c.UserRepo.GetByUsername(c.ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// patchUser applies a merge patch to a user document, the same way PATCH /api/v1/users/{id} does
+func (c *cli) patchUser(id int64, patch map[string]any) (*userResult, error) {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := c.UserService.PatchUser(c.ctx, operator, id, 0, &domain.Patch{
+		ContentType: jsonpatch.MergePatchContentType,
+		Body:        body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &userResult{User: &updated.User, Roles: make([]string, 0, len(updated.Roles))}
+	for _, role := range updated.Roles {
+		result.Roles = append(result.Roles, role.Name)
+	}
+	return result, nil
+}
+
+// printUser prints a changed user
+func (c *cli) printUser(result *userResult) {
+	c.print(result, func(w io.Writer) {
+		user := result.User
+		fmt.Fprintf(w, "id:       %d\n", user.ID)
+		fmt.Fprintf(w, "username: %s\n", user.Username)
+		fmt.Fprintf(w, "email:    %s\n", user.Email)
+		fmt.Fprintf(w, "status:   %s\n", statusName(user.Status))
+		fmt.Fprintf(w, "roles:    %s\n", strings.Join(result.Roles, ", "))
+		if result.Password != "" {
+			fmt.Fprintf(w, "password: %s\n", result.Password)
+		}
+	})
+}
+
+// Helper function: Name a user status
+func statusName(status int) string {
+	switch status {
+	case domain.UserStatusInactive:
+		return "inactive"
+	case domain.UserStatusActive:
+		return "active"
+	case domain.UserStatusLocked:
+		return "locked"
+	}
+	return strconv.Itoa(status)
+}
+
+// Helper function: Generate a random password that satisfies the password rule
+func generatePassword() (string, error) {
+	for {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("failed to generate password: %w", err)
+		}
+		password := base64.RawURLEncoding.EncodeToString(buf)
+		if strings.IndexFunc(password, unicode.IsLetter) >= 0 && strings.IndexFunc(password, unicode.IsDigit) >= 0 {
+			return password, nil
+		}
+	}
+}
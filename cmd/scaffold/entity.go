@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Entity describes the module to generate
+type Entity struct {
+	Name        string // Go type name, e.g. ProductCategory
+	Var         string // Go variable name, e.g. productCategory
+	File        string // File name without extension, e.g. product_category
+	Table       string // SQL table, e.g. product_categories
+	Path        string // URL path segment, e.g. product-categories
+	Human       string // Lower case words, e.g. product category
+	HumanPlural string
+	Fields      []Field
+}
+
+// Field is a column of the entity
+type Field struct {
+	Name    string // Go field name, e.g. ReleasedAt
+	Column  string // SQL column and JSON name, e.g. released_at
+	Type    string // Type as given on the command line
+	GoType  string
+	SQLType string
+	Binding string // Validator rules of the request field
+}
+
+// fieldTypes maps the supported field types to their Go and SQLite types
+var fieldTypes = map[string][2]string{
+	"string": {"string", "TEXT NOT NULL DEFAULT ''"},
+	"int":    {"int", "INTEGER NOT NULL DEFAULT 0"},
+	"int64":  {"int64", "INTEGER NOT NULL DEFAULT 0"},
+	"float":  {"float64", "REAL NOT NULL DEFAULT 0"},
+	"bool":   {"bool", "INTEGER NOT NULL DEFAULT 0"},
+	"time":   {"*time.Time", "TIMESTAMP"},
+}
+
+// reservedColumns are generated for every entity
+var reservedColumns = map[string]bool{"id": true, "version": true, "created_at": true, "updated_at": true}
+
+var identPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// parseEntity builds an entity from its name and field specs
+func parseEntity(name string, specs []string) (*Entity, error) {
+	if !identPattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid entity name %q", name)
+	}
+	words := splitWords(name)
+	plural := append(append([]string{}, words[:len(words)-1]...), pluralize(words[len(words)-1]))
+
+	entity := &Entity{
+		Name:        camel(words, true),
+		Var:         camel(words, false),
+		File:        strings.Join(words, "_"),
+		Table:       strings.Join(plural, "_"),
+		Path:        strings.Join(plural, "-"),
+		Human:       strings.Join(words, " "),
+		HumanPlural: strings.Join(plural, " "),
+	}
+	if token.IsKeyword(entity.Var) {
+		return nil, fmt.Errorf("entity name %q is a Go keyword", name)
+	}
+
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) < 2 || !identPattern.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid field %q, expected name:type[:binding]", spec)
+		}
+		types, ok := fieldTypes[parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %q of field %s", parts[1], parts[0])
+		}
+
+		fieldWords := splitWords(parts[0])
+		field := Field{
+			Name:    camel(fieldWords, true),
+			Column:  strings.Join(fieldWords, "_"),
+			Type:    parts[1],
+			GoType:  types[0],
+			SQLType: types[1],
+		}
+		if len(parts) == 3 {
+			field.Binding = parts[2]
+		}
+		if reservedColumns[field.Column] || seen[field.Column] {
+			return nil, fmt.Errorf("duplicate or reserved field %s", field.Column)
+		}
+		seen[field.Column] = true
+		entity.Fields = append(entity.Fields, field)
+	}
+	return entity, nil
+}
+
+// HasType reports whether a field has the type, e.g. to decide on imports
+func (e *Entity) HasType(typ string) bool {
+	for _, field := range e.Fields {
+		if field.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Columns lists the SQL columns of the fields, separated by commas
+func (e *Entity) Columns() string {
+	columns := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		columns[i] = field.Column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// Placeholders returns comma separated SQL placeholders for the fields and extra columns
+func (e *Entity) Placeholders(extra int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", len(e.Fields)+extra), ", ")
+}
+
+// TitlePlural names the entity in the plural with a capital letter, e.g. Product categories
+func (e *Entity) TitlePlural() string {
+	return strings.ToUpper(e.HumanPlural[:1]) + e.HumanPlural[1:]
+}
+
+// Assignments lists the SQL assignments of the fields for an update
+func (e *Entity) Assignments() string {
+	assignments := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		assignments[i] = field.Column + " = ?"
+	}
+	return strings.Join(assignments, ", ")
+}
+
+var funcs = template.FuncMap{
+	// sample returns a Go expression of a field value that differs by the variable n, used in tests
+	"sample": func(field Field) string {
+		switch field.Type {
+		case "string":
+			return fmt.Sprintf("%q + strconv.Itoa(n)", field.Column+" ")
+		case "int":
+			return "n"
+		case "int64":
+			return "int64(n)"
+		case "float":
+			return "float64(n) + 0.5"
+		case "bool":
+			return "n%2 == 1"
+		case "time":
+			return "timePtr(time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC))"
+		}
+		return ""
+	},
+}
+
+// Helper function: Split an identifier in camel or snake case into lower case words
+func splitWords(name string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = nil
+			continue
+		case unicode.IsUpper(r) && len(word) > 0:
+			// A capital starts a new word, except inside acronyms like ID or URL
+			if !unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// initialisms are written in upper case in Go names
+var initialisms = map[string]bool{"id": true, "url": true, "uri": true, "ip": true, "api": true, "http": true, "json": true, "sku": true}
+
+// Helper function: Join words in camel case
+func camel(words []string, exported bool) string {
+	var b strings.Builder
+	for i, word := range words {
+		switch {
+		case i == 0 && !exported:
+			b.WriteString(word)
+		case initialisms[word]:
+			b.WriteString(strings.ToUpper(word))
+		default:
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// Helper function: Pluralize an English noun
+func pluralize(word string) string {
+	switch {
+	case strings.HasSuffix(word, "y") && len(word) > 1 && !strings.ContainsRune("aeiou", rune(word[len(word)-2])):
+		return word[:len(word)-1] + "ies"
+	case strings.HasSuffix(word, "s"), strings.HasSuffix(word, "x"), strings.HasSuffix(word, "z"),
+		strings.HasSuffix(word, "ch"), strings.HasSuffix(word, "sh"):
+		return word + "es"
+	}
+	return word + "s"
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+const usage = `Usage: go run ./cmd/scaffold [-force] [-dry-run] <Entity> <field:type[:binding]>...
+
+Generates the domain model, repository, service, HTTP handler, migration and repository
+tests of a module and registers its routes and migration.
+
+Field types: string, int, int64, float, bool, time. The optional binding is a validator
+rule list as used in binding tags, e.g. name:string:required,max=100 price:float:gt=0
+
+Example:
+  go run ./cmd/scaffold Product name:string:required,max=100 price:float:gt=0 stock:int released_at:time
+`
+
+// outputs maps templates to the files they generate, relative to the repository root
+var outputs = []struct {
+	template string
+	path     string
+}{
+	{"domain.go.tmpl", "internal/domain/{{.File}}.go"},
+	{"repo.go.tmpl", "internal/repo/{{.File}}.go"},
+	{"repo_test.go.tmpl", "internal/repo/{{.File}}_test.go"},
+	{"service.go.tmpl", "internal/service/{{.File}}.go"},
+	{"handler.go.tmpl", "internal/transport/http/handler/{{.File}}.go"},
+	{"migration.go.tmpl", "internal/infra/db/migration_{{.File}}.go"},
+}
+
+// insertions add registrations before marker comments in existing files
+var insertions = []struct {
+	path     string
+	marker   string
+	template string
+}{
+	{"internal/transport/http/router.go", "// scaffold:handlers", "router_params.tmpl"},
+	{"internal/transport/http/router.go", "// scaffold:routes", "router_routes.tmpl"},
+	{"internal/infra/db/migration.go", "// scaffold:migrations", "migration_call.tmpl"},
+}
+
+func main() {
+	force := flag.Bool("force", false, "overwrite existing files")
+	dryRun := flag.Bool("dry-run", false, "print the files that would be written")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	entity, err := parseEntity(flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if err := generate(entity, *force, *dryRun); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if !*dryRun {
+		fmt.Println("Module generated, run make swagger to document its endpoints")
+	}
+}
+
+// generate renders all files first, so nothing is written when a template or check fails
+func generate(entity *Entity, force, dryRun bool) error {
+	tmpl, err := template.New("").Funcs(funcs).ParseFS(templates, "templates/*.tmpl")
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]byte{}
+	var order []string
+	for _, out := range outputs {
+		path := render(out.path, entity)
+		if _, err := os.Stat(path); err == nil && !force {
+			return fmt.Errorf("%s already exists, use -force to overwrite it", path)
+		}
+		src, err := execute(tmpl, out.template, entity)
+		if err != nil {
+			return err
+		}
+		files[path] = src
+		order = append(order, path)
+	}
+
+	for _, ins := range insertions {
+		src, ok := files[ins.path]
+		if !ok {
+			if src, err = os.ReadFile(ins.path); err != nil {
+				return err
+			}
+			files[ins.path] = src
+			order = append(order, ins.path)
+		}
+		snippet, err := execute(tmpl, ins.template, entity)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(src, bytes.TrimSpace(snippet)) {
+			continue
+		}
+
+		i := bytes.Index(src, []byte(ins.marker))
+		if i < 0 {
+			return fmt.Errorf("%s has no %q marker", ins.path, ins.marker)
+		}
+		// Insert at the start of the marker line to keep its indentation
+		i = bytes.LastIndexByte(src[:i], '\n') + 1
+		files[ins.path] = append(append(append([]byte{}, src[:i]...), snippet...), src[i:]...)
+	}
+
+	for _, path := range order {
+		src, err := format.Source(files[path])
+		if err != nil {
+			return fmt.Errorf("failed to format %s: %w", path, err)
+		}
+		if dryRun {
+			fmt.Printf("==> %s <==\n%s\n", path, src)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, src, 0o644); err != nil {
+			return err
+		}
+		fmt.Println("wrote", path)
+	}
+	return nil
+}
+
+// execute renders a named template
+func execute(tmpl *template.Template, name string, entity *Entity) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, entity); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// render expands an output path pattern
+func render(pattern string, entity *Entity) string {
+	var buf strings.Builder
+	template.Must(template.New("path").Parse(pattern)).Execute(&buf, entity)
+	return buf.String()
+}
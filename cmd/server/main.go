@@ -11,11 +11,18 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/luxixing/fx-gin/internal/config"
+	_ "github.com/luxixing/fx-gin/internal/infra/blob"
 	_ "github.com/luxixing/fx-gin/internal/infra/db"
+	_ "github.com/luxixing/fx-gin/internal/infra/mail"
+	_ "github.com/luxixing/fx-gin/internal/infra/signing"
 	_ "github.com/luxixing/fx-gin/internal/repo"
 	_ "github.com/luxixing/fx-gin/internal/service"
+	_ "github.com/luxixing/fx-gin/internal/transport/gateway"
+	_ "github.com/luxixing/fx-gin/internal/transport/graphql"
+	_ "github.com/luxixing/fx-gin/internal/transport/grpc"
 	_ "github.com/luxixing/fx-gin/internal/transport/http"
 	_ "github.com/luxixing/fx-gin/internal/transport/http/handler"
+	"github.com/luxixing/fx-gin/internal/transport/listener"
 	_ "github.com/luxixing/fx-gin/pkg/logger"
 	"github.com/luxixing/fx-gin/pkg/registry"
 
@@ -39,18 +46,25 @@ func main() {
 				cfg *config.Config,
 				db *sql.DB,
 				router *gin.Engine,
+				listeners *listener.Listeners,
 			) {
+				// Accept HTTP/2 without TLS (h2c) next to HTTP/1.1, on a port shared with gRPC
+				// it goes to the gRPC server instead
+				protocols := new(http.Protocols)
+				protocols.SetHTTP1(true)
+				protocols.SetUnencryptedHTTP2(true)
+				srv := &http.Server{
+					Addr:      fmt.Sprintf("%s:%d", cfg.App.Host, cfg.App.Port),
+					Handler:   router,
+					Protocols: protocols,
+				}
 				lc.Append(fx.Hook{
 					OnStart: func(ctx context.Context) error {
 						zap.L().Info("Starting application...")
 						zap.S().Infow("Getting config...", "config", cfg)
-						srv := &http.Server{
-							Addr:    fmt.Sprintf("%s:%d", cfg.App.Host, cfg.App.Port),
-							Handler: router,
-						}
 						//start server
 						go func() {
-							if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+							if err := srv.Serve(listeners.HTTP()); err != nil && err != http.ErrServerClosed && !listener.IsClosed(err) {
 								zap.S().Fatalw("Listening failed", "error", err)
 							}
 						}()
@@ -59,7 +73,9 @@ func main() {
 					},
 					OnStop: func(ctx context.Context) error {
 						zap.S().Info("Stopping server...")
-						//todo
+						if err := srv.Shutdown(ctx); err != nil {
+							zap.S().Errorw("Failed to shut down server", "error", err)
+						}
 						db.Close()
 						zap.S().Sync()
 						return nil
@@ -1,25 +1,122 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
-	"os/exec"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/swaggo/swag"
+	"github.com/swaggo/swag/gen"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputDir = "./docs/swagger"
+	searchDir = "./cmd/swagger,./internal/transport/http/handler" // Include handler directory
 )
 
+// generatedFiles are compared by the check mode
+var generatedFiles = []string{"docs.go", "swagger.json", "swagger.yaml", "openapi.json", "openapi.yaml"}
+
 func main() {
-	// Run swag command to generate swagger documentation
-	cmd := exec.Command("swag", "init",
-		"--generalInfo", "swagger.go",
-		"--dir", "./cmd/swagger,./internal/transport/http/handler", // Include handler directory
-		"--output", "./docs/swagger",
-		"--parseDependency",
-	)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
+	check := flag.Bool("check", false, "fail if the documentation in "+outputDir+" is out of date instead of writing it")
+	verbose := flag.Bool("v", false, "print parser progress")
+	flag.Parse()
+
+	debugger := log.New(io.Discard, "", 0)
+	if *verbose {
+		debugger = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	dir := outputDir
+	if *check {
+		tmp, err := os.MkdirTemp("", "swagger")
+		if err != nil {
+			fmt.Printf("Failed to create temporary directory: %s\n", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	if err := generate(dir, debugger); err != nil {
 		fmt.Printf("Failed to generate Swagger documentation: %s\n", err)
-		fmt.Printf("Output: %s\n", output)
+		os.Exit(1)
+	}
+
+	if !*check {
+		fmt.Println("Swagger documentation generated successfully!")
 		return
 	}
+	stale, err := compare(dir, outputDir)
+	if err != nil {
+		fmt.Printf("Failed to check Swagger documentation: %s\n", err)
+		os.Exit(1)
+	}
+	if len(stale) > 0 {
+		fmt.Printf("Swagger documentation is out of date, run make swagger: %v\n", stale)
+		os.Exit(1)
+	}
+	fmt.Println("Swagger documentation is up to date")
+}
+
+// generate writes the Swagger 2.0 documentation and its OpenAPI 3.1 conversion to dir
+func generate(dir string, debugger swag.Debugger) error {
+	err := gen.New().Build(&gen.Config{
+		SearchDir:          searchDir,
+		MainAPIFile:        "swagger.go",
+		PropNamingStrategy: swag.CamelCase,
+		OutputDir:          dir,
+		OutputTypes:        []string{"go", "json", "yaml"},
+		ParseDependency:    swag.ParseModels,
+		ParseDepth:         100,
+		ParseGoList:        true,
+		OverridesFile:      gen.DefaultOverridesFile,
+		CollectionFormat:   "csv",
+		PackageName:        filepath.Base(outputDir),
+		Debugger:           debugger,
+	})
+	if err != nil {
+		return err
+	}
+
+	doc, err := os.ReadFile(filepath.Join(dir, "swagger.json"))
+	if err != nil {
+		return err
+	}
+	openapi, err := convertToOpenAPI31(doc)
+	if err != nil {
+		return fmt.Errorf("failed to convert to OpenAPI 3.1: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "openapi.json"), openapi, 0o644); err != nil {
+		return err
+	}
+	openapiYAML, err := yaml.JSONToYAML(openapi)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "openapi.yaml"), openapiYAML, 0o644)
+}
 
-	fmt.Println("Swagger documentation generated successfully!")
+// compare lists the generated files that differ from the checked in ones
+func compare(generated, current string) ([]string, error) {
+	var stale []string
+	for _, name := range generatedFiles {
+		want, err := os.ReadFile(filepath.Join(generated, name))
+		if err != nil {
+			return nil, err
+		}
+		got, err := os.ReadFile(filepath.Join(current, name))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if !bytes.Equal(got, want) {
+			stale = append(stale, name)
+		}
+	}
+	return stale, nil
 }
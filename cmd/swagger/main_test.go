@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCheckDetectsDrift(t *testing.T) {
+	// The search directories are relative to the module root
+	t.Chdir("../..")
+
+	generated := t.TempDir()
+	if err := generate(generated, log.New(io.Discard, "", 0)); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	stale, err := compare(generated, outputDir)
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	if len(stale) > 0 {
+		t.Fatalf("checked in documentation is out of date: %v", stale)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		drift func(dir string) error
+		want  []string
+	}{
+		{"unchanged", func(string) error { return nil }, nil},
+		{
+			name: "edited",
+			drift: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "swagger.yaml"), []byte("swagger: \"2.0\"\n"), 0o644)
+			},
+			want: []string{"swagger.yaml"},
+		},
+		{
+			name: "missing",
+			drift: func(dir string) error {
+				return os.Remove(filepath.Join(dir, "openapi.json"))
+			},
+			want: []string{"openapi.json"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			current := t.TempDir()
+			for _, name := range generatedFiles {
+				data, err := os.ReadFile(filepath.Join(outputDir, name))
+				if err != nil {
+					t.Fatalf("read %s: %v", name, err)
+				}
+				if err := os.WriteFile(filepath.Join(current, name), data, 0o644); err != nil {
+					t.Fatalf("copy %s: %v", name, err)
+				}
+			}
+			if err := tc.drift(current); err != nil {
+				t.Fatalf("change documentation: %v", err)
+			}
+
+			stale, err := compare(generated, current)
+			if err != nil {
+				t.Fatalf("compare: %v", err)
+			}
+			if !slices.Equal(stale, tc.want) {
+				t.Errorf("stale = %v, want %v", stale, tc.want)
+			}
+		})
+	}
+}
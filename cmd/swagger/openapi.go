@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// convertToOpenAPI31 converts a Swagger 2.0 document to OpenAPI 3.1. Body and form parameters
+// become request bodies, definitions become component schemas and response schemas are
+// listed per produced media type.
+func convertToOpenAPI31(doc []byte) ([]byte, error) {
+	// References are rewritten before decoding, the schemas are otherwise compatible
+	doc = bytes.ReplaceAll(doc, []byte(`"#/definitions/`), []byte(`"#/components/schemas/`))
+
+	var swagger map[string]any
+	if err := json.Unmarshal(doc, &swagger); err != nil {
+		return nil, err
+	}
+
+	openapi := map[string]any{
+		"openapi": "3.1.0",
+		"info":    swagger["info"],
+	}
+	if host, ok := swagger["host"].(string); ok && host != "" {
+		schemes, _ := swagger["schemes"].([]any)
+		if len(schemes) == 0 {
+			schemes = []any{"http"}
+		}
+		basePath, _ := swagger["basePath"].(string)
+		var servers []any
+		for _, scheme := range schemes {
+			servers = append(servers, map[string]any{"url": scheme.(string) + "://" + host + basePath})
+		}
+		openapi["servers"] = servers
+	}
+	for _, key := range []string{"tags", "security", "externalDocs"} {
+		if value, ok := swagger[key]; ok {
+			openapi[key] = value
+		}
+	}
+
+	consumes := stringList(swagger["consumes"], "application/json")
+	produces := stringList(swagger["produces"], "application/json")
+	paths := map[string]any{}
+	for path, item := range asMap(swagger["paths"]) {
+		operations := map[string]any{}
+		for method, op := range asMap(item) {
+			if method == "parameters" {
+				operations[method] = convertParameters(op.([]any))
+				continue
+			}
+			operations[method] = convertOperation(asMap(op), consumes, produces)
+		}
+		paths[path] = operations
+	}
+	openapi["paths"] = paths
+
+	components := map[string]any{}
+	if definitions := asMap(swagger["definitions"]); len(definitions) > 0 {
+		schemas := map[string]any{}
+		for name, schema := range definitions {
+			schemas[name] = convertSchema(schema)
+		}
+		components["schemas"] = schemas
+	}
+	if definitions := asMap(swagger["securityDefinitions"]); len(definitions) > 0 {
+		schemes := map[string]any{}
+		for name, definition := range definitions {
+			schemes[name] = convertSecurityScheme(asMap(definition))
+		}
+		components["securitySchemes"] = schemes
+	}
+	if len(components) > 0 {
+		openapi["components"] = components
+	}
+
+	return json.MarshalIndent(openapi, "", "    ")
+}
+
+// convertOperation moves body and form parameters into the request body and
+// response schemas into content
+func convertOperation(op map[string]any, consumes, produces []string) map[string]any {
+	converted := map[string]any{}
+	for key, value := range op {
+		switch key {
+		case "consumes", "produces", "parameters", "responses", "schemes":
+		default:
+			converted[key] = value
+		}
+	}
+	consumes = stringList(op["consumes"], consumes...)
+	produces = stringList(op["produces"], produces...)
+
+	var parameters []any
+	var formProperties = map[string]any{}
+	var formRequired []any
+	for _, p := range asSlice(op["parameters"]) {
+		param := asMap(p)
+		switch param["in"] {
+		case "body":
+			body := map[string]any{"content": mediaTypes(consumes, convertSchema(param["schema"]))}
+			if description, ok := param["description"]; ok {
+				body["description"] = description
+			}
+			if required, ok := param["required"]; ok {
+				body["required"] = required
+			}
+			converted["requestBody"] = body
+		case "formData":
+			name := param["name"].(string)
+			formProperties[name] = parameterSchema(param)
+			if required, _ := param["required"].(bool); required {
+				formRequired = append(formRequired, name)
+			}
+		default:
+			parameters = append(parameters, convertParameter(param))
+		}
+	}
+	if len(parameters) > 0 {
+		converted["parameters"] = parameters
+	}
+	if len(formProperties) > 0 {
+		schema := map[string]any{"type": "object", "properties": formProperties}
+		if len(formRequired) > 0 {
+			schema["required"] = formRequired
+		}
+		converted["requestBody"] = map[string]any{"content": mediaTypes(consumes, schema), "required": len(formRequired) > 0}
+	}
+
+	responses := map[string]any{}
+	for code, r := range asMap(op["responses"]) {
+		response := asMap(r)
+		convertedResponse := map[string]any{"description": response["description"]}
+		if schema, ok := response["schema"]; ok {
+			convertedResponse["content"] = mediaTypes(produces, convertSchema(schema))
+		}
+		if headers := asMap(response["headers"]); len(headers) > 0 {
+			convertedHeaders := map[string]any{}
+			for name, h := range headers {
+				header := asMap(h)
+				convertedHeader := map[string]any{"schema": parameterSchema(header)}
+				if description, ok := header["description"]; ok {
+					convertedHeader["description"] = description
+				}
+				convertedHeaders[name] = convertedHeader
+			}
+			convertedResponse["headers"] = convertedHeaders
+		}
+		responses[code] = convertedResponse
+	}
+	converted["responses"] = responses
+
+	return converted
+}
+
+// convertParameters converts a list of path, query or header parameters
+func convertParameters(params []any) []any {
+	converted := make([]any, 0, len(params))
+	for _, p := range params {
+		converted = append(converted, convertParameter(asMap(p)))
+	}
+	return converted
+}
+
+// convertParameter moves the type of a path, query or header parameter into its schema
+func convertParameter(param map[string]any) map[string]any {
+	converted := map[string]any{"schema": parameterSchema(param)}
+	for _, key := range []string{"name", "in", "description", "required"} {
+		if value, ok := param[key]; ok {
+			converted[key] = value
+		}
+	}
+	return converted
+}
+
+// parameterSchemaKeys are the JSON Schema keywords allowed on Swagger 2.0 parameters and headers
+var parameterSchemaKeys = []string{
+	"type", "format", "items", "default", "enum", "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum",
+	"minLength", "maxLength", "pattern", "minItems", "maxItems", "uniqueItems", "multipleOf",
+}
+
+// parameterSchema builds the schema of a non-body parameter or header
+func parameterSchema(param map[string]any) map[string]any {
+	if param["type"] == "file" {
+		return map[string]any{"type": "string", "contentMediaType": "application/octet-stream"}
+	}
+
+	schema := map[string]any{}
+	for _, key := range parameterSchemaKeys {
+		if value, ok := param[key]; ok {
+			schema[key] = value
+		}
+	}
+	return convertSchema(schema).(map[string]any)
+}
+
+// convertSchema rewrites the Swagger 2.0 schema keywords that changed in JSON Schema 2020-12
+func convertSchema(schema any) any {
+	switch s := schema.(type) {
+	case map[string]any:
+		converted := make(map[string]any, len(s))
+		for key, value := range s {
+			converted[key] = convertSchema(value)
+		}
+		if example, ok := converted["example"]; ok {
+			delete(converted, "example")
+			converted["examples"] = []any{example}
+		}
+		if nullable, _ := converted["x-nullable"].(bool); nullable {
+			delete(converted, "x-nullable")
+			if typ, ok := converted["type"].(string); ok {
+				converted["type"] = []any{typ, "null"}
+			}
+		}
+		// Boolean exclusive bounds became numbers
+		for bound, limit := range map[string]string{"exclusiveMinimum": "minimum", "exclusiveMaximum": "maximum"} {
+			if exclusive, ok := converted[bound].(bool); ok {
+				delete(converted, bound)
+				if exclusive {
+					converted[bound] = converted[limit]
+					delete(converted, limit)
+				}
+			}
+		}
+		return converted
+	case []any:
+		converted := make([]any, len(s))
+		for i, value := range s {
+			converted[i] = convertSchema(value)
+		}
+		return converted
+	}
+	return schema
+}
+
+// convertSecurityScheme converts a security definition to a security scheme
+func convertSecurityScheme(definition map[string]any) map[string]any {
+	converted := map[string]any{}
+	if description, ok := definition["description"]; ok {
+		converted["description"] = description
+	}
+
+	switch definition["type"] {
+	case "basic":
+		converted["type"] = "http"
+		converted["scheme"] = "basic"
+	case "apiKey":
+		converted["type"] = "apiKey"
+		converted["name"] = definition["name"]
+		converted["in"] = definition["in"]
+	case "oauth2":
+		flow := map[string]any{"scopes": definition["scopes"]}
+		if flow["scopes"] == nil {
+			flow["scopes"] = map[string]any{}
+		}
+		for _, key := range []string{"authorizationUrl", "tokenUrl"} {
+			if value, ok := definition[key]; ok {
+				flow[key] = value
+			}
+		}
+		name := map[string]string{
+			"implicit":    "implicit",
+			"password":    "password",
+			"application": "clientCredentials",
+			"accessCode":  "authorizationCode",
+		}[definition["flow"].(string)]
+		converted["type"] = "oauth2"
+		converted["flows"] = map[string]any{name: flow}
+	}
+	return converted
+}
+
+// mediaTypes lists the schema under every media type
+func mediaTypes(types []string, schema any) map[string]any {
+	content := map[string]any{}
+	for _, typ := range types {
+		content[typ] = map[string]any{"schema": schema}
+	}
+	return content
+}
+
+// stringList returns a list of strings, or the defaults if it is empty
+func stringList(value any, defaults ...string) []string {
+	var list []string
+	for _, item := range asSlice(value) {
+		if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+			list = append(list, s)
+		}
+	}
+	if len(list) == 0 {
+		return defaults
+	}
+	return list
+}
+
+func asMap(value any) map[string]any {
+	m, _ := value.(map[string]any)
+	return m
+}
+
+func asSlice(value any) []any {
+	s, _ := value.([]any)
+	return s
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/luxixing/fx-gin/pkg/registry"
@@ -38,8 +39,22 @@ func NewConfig() (*Config, error) {
 
 type Config struct {
 	App      *AppConfig      `env:",init" envPrefix:"APP_"`
+	HTTP     *HTTPConfig     `env:",init" envPrefix:"HTTP_"`
+	GRPC     *GRPCConfig     `env:",init" envPrefix:"GRPC_"`
+	GraphQL  *GraphQLConfig  `env:",init" envPrefix:"GRAPHQL_"`
 	Logger   *LoggerConfig   `env:",init" envPrefix:"LOGGER_"`
 	Database *DatabaseConfig `env:",init" envPrefix:"DATABASE_"`
+	MFA      *MFAConfig      `env:",init" envPrefix:"MFA_"`
+	Mail     *MailConfig     `env:",init" envPrefix:"MAIL_"`
+	Account  *AccountConfig  `env:",init" envPrefix:"ACCOUNT_"`
+	Auth     *AuthConfig     `env:",init" envPrefix:"AUTH_"`
+	OAuth    *OAuthConfig    `env:",init" envPrefix:"OAUTH_"`
+	OIDC     *OIDCConfig     `env:",init" envPrefix:"OIDC_"`
+	Blob     *BlobConfig     `env:",init" envPrefix:"BLOB_"`
+	Profile  *ProfileConfig  `env:",init" envPrefix:"PROFILE_"`
+	User     *UserConfig     `env:",init" envPrefix:"USER_"`
+	Events   *EventsConfig   `env:",init" envPrefix:"EVENTS_"`
+	Webhooks *WebhooksConfig `env:",init" envPrefix:"WEBHOOKS_"`
 	//todo more
 }
 
@@ -51,6 +66,31 @@ type AppConfig struct {
 	Env     string `env:"ENV" envDefault:"dev"`
 }
 
+type HTTPConfig struct {
+	TrustedProxies    []string `env:"TRUSTED_PROXIES" envDefault:"127.0.0.1,::1"` // IPs or CIDRs of proxies whose X-Forwarded-For and X-Real-IP headers give the client IP
+	RequireIfMatch    bool     `env:"REQUIRE_IF_MATCH" envDefault:"false"`        // Reject updates and deletes of users and profiles without If-Match
+	ValidateRequests  string   `env:"VALIDATE_REQUESTS" envDefault:"off"`         // Check requests against the OpenAPI spec: off, warn or enforce
+	ValidateResponses string   `env:"VALIDATE_RESPONSES" envDefault:"off"`        // Check responses against the OpenAPI spec: off, warn or enforce, only in dev and test environments
+}
+
+// GRPCConfig configures the gRPC server, which listens on the application host
+type GRPCConfig struct {
+	Enabled    bool `env:"ENABLED" envDefault:"true"`
+	Port       int  `env:"PORT" envDefault:"39090"`
+	Reflection bool `env:"REFLECTION" envDefault:"true"`   // Let clients like grpcurl discover the services
+	SharedPort bool `env:"SHARED_PORT" envDefault:"false"` // Serve gRPC on APP_PORT next to HTTP instead of on PORT
+	Gateway    bool `env:"GATEWAY" envDefault:"false"`     // Expose the gRPC services as JSON REST endpoints under /gateway
+}
+
+// GraphQLConfig configures the GraphQL endpoint at /graphql
+type GraphQLConfig struct {
+	Enabled       bool `env:"ENABLED" envDefault:"true"`
+	MaxDepth      int  `env:"MAX_DEPTH" envDefault:"6"`         // Deepest selection a query may have
+	MaxComplexity int  `env:"MAX_COMPLEXITY" envDefault:"1000"` // Highest cost a query may have, list fields cost their page size times their selection
+	Introspection bool `env:"INTROSPECTION" envDefault:"true"`  // Let clients query the schema
+	Playground    bool `env:"PLAYGROUND" envDefault:"false"`    // Serve the GraphiQL playground at GET /graphql
+}
+
 type DatabaseConfig struct {
 	DSN          string `env:"DSN"`
 	Database     string `env:"DATABASE" envDefault:"fx-gin.db"`
@@ -63,4 +103,112 @@ type LoggerConfig struct {
 	Level string `env:"LEVEL" envDefault:"info"`
 }
 
+type MFAConfig struct {
+	Issuer            string        `env:"ISSUER" envDefault:"fx-gin"`
+	ChallengeTTL      time.Duration `env:"CHALLENGE_TTL" envDefault:"5m"`
+	MaxAttempts       int           `env:"MAX_ATTEMPTS" envDefault:"5"`
+	Skew              int           `env:"SKEW" envDefault:"1"`
+	RecoveryCodeCount int           `env:"RECOVERY_CODE_COUNT" envDefault:"10"`
+}
+
+type MailConfig struct {
+	Driver    string `env:"DRIVER" envDefault:"file"` // smtp, file or memory
+	From      string `env:"FROM" envDefault:"fx-gin <no-reply@localhost>"`
+	OutboxDir string `env:"OUTBOX_DIR" envDefault:"tmp/outbox"`
+	Host      string `env:"SMTP_HOST"`
+	Port      int    `env:"SMTP_PORT" envDefault:"587"`
+	Username  string `env:"SMTP_USERNAME"`
+	Password  string `env:"SMTP_PASSWORD" secret:"true"`
+}
+
+type AccountConfig struct {
+	BaseURL                  string        `env:"BASE_URL" envDefault:"http://localhost:38080"`
+	RequireEmailVerification bool          `env:"REQUIRE_EMAIL_VERIFICATION" envDefault:"false"`
+	VerificationTTL          time.Duration `env:"VERIFICATION_TTL" envDefault:"24h"`
+	PasswordResetTTL         time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+}
+
+type AuthConfig struct {
+	TokenTTL            time.Duration `env:"TOKEN_TTL" envDefault:"24h"`
+	APIKeyPrefix        string        `env:"API_KEY_PREFIX" envDefault:"fxg"`
+	APIKeyTouchInterval time.Duration `env:"API_KEY_TOUCH_INTERVAL" envDefault:"1m"` // Minimum interval between last-used updates
+}
+
+type OAuthConfig struct {
+	Issuer          string        `env:"ISSUER" envDefault:"http://localhost:38080"`
+	SigningKeyFile  string        `env:"SIGNING_KEY_FILE" envDefault:"oauth_signing_key.pem"` // Generated on first start if missing
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"1h"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"720h"`
+	CodeTTL         time.Duration `env:"CODE_TTL" envDefault:"1m"`
+}
+
+// OIDCConfig configures login with external OpenID Connect providers.
+// Providers are configured as OIDC_PROVIDERS_0_NAME, OIDC_PROVIDERS_0_ISSUER, ...
+type OIDCConfig struct {
+	BaseURL   string               `env:"BASE_URL" envDefault:"http://localhost:38080"` // Used to build the default callback URL
+	StateTTL  time.Duration        `env:"STATE_TTL" envDefault:"10m"`
+	Providers []OIDCProviderConfig `envPrefix:"PROVIDERS"`
+}
+
+type OIDCProviderConfig struct {
+	Name          string            `env:"NAME"`
+	DisplayName   string            `env:"DISPLAY_NAME"`
+	Issuer        string            `env:"ISSUER"`
+	ClientID      string            `env:"CLIENT_ID"`
+	ClientSecret  string            `env:"CLIENT_SECRET" secret:"true"`
+	RedirectURL   string            `env:"REDIRECT_URL"` // Defaults to {BASE_URL}/api/v1/auth/oidc/{name}/callback
+	Scopes        []string          `env:"SCOPES" envDefault:"openid,email,profile"`
+	AutoProvision bool              `env:"AUTO_PROVISION" envDefault:"true"` // Create users on first login
+	LinkByEmail   bool              `env:"LINK_BY_EMAIL" envDefault:"false"` // Link to existing users with the same verified email
+	RoleClaim     string            `env:"ROLE_CLAIM" envDefault:"groups"`
+	RoleMapping   map[string]string `env:"ROLE_MAPPING"` // Claim value to role name, e.g. "engineering:admin,staff:user"
+}
+
+type BlobConfig struct {
+	Driver    string        `env:"DRIVER" envDefault:"local"` // local or s3
+	URLTTL    time.Duration `env:"URL_TTL" envDefault:"1h"`   // Lifetime of download URLs
+	LocalDir  string        `env:"LOCAL_DIR" envDefault:"tmp/blobs"`
+	BaseURL   string        `env:"BASE_URL" envDefault:"http://localhost:38080"` // Used to build download URLs for the local driver
+	URLSecret string        `env:"URL_SECRET" secret:"true"`                     // Signs local download URLs, a random secret is used when empty
+
+	S3Endpoint        string `env:"S3_ENDPOINT" envDefault:"s3.amazonaws.com"` // Host and optional port of an S3-compatible service
+	S3Region          string `env:"S3_REGION" envDefault:"us-east-1"`
+	S3Bucket          string `env:"S3_BUCKET"`
+	S3AccessKeyID     string `env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `env:"S3_SECRET_ACCESS_KEY" secret:"true"`
+	S3UseSSL          bool   `env:"S3_USE_SSL" envDefault:"true"`
+	S3PathStyle       bool   `env:"S3_PATH_STYLE" envDefault:"false"` // Required by most self-hosted services such as MinIO
+}
+
+type ProfileConfig struct {
+	AvatarMaxSize        int64 `env:"AVATAR_MAX_SIZE" envDefault:"5242880"`       // Maximum upload size in bytes
+	AvatarMaxDimension   int   `env:"AVATAR_MAX_DIMENSION" envDefault:"1024"`     // Larger avatars are scaled down
+	AvatarThumbnailSizes []int `env:"AVATAR_THUMBNAIL_SIZES" envDefault:"256,64"` // Square thumbnails generated on upload
+}
+
+// UserConfig configures the removal of deleted users
+type UserConfig struct {
+	DeletedRetention   time.Duration `env:"DELETED_RETENTION" envDefault:"720h"`    // Deleted users can be restored until they are purged after this period
+	PurgeInterval      time.Duration `env:"PURGE_INTERVAL" envDefault:"1h"`         // Zero disables purging
+	ReleaseIdentifiers bool          `env:"RELEASE_IDENTIFIERS" envDefault:"false"` // Free usernames and emails on deletion instead of on purge
+}
+
+// EventsConfig configures the delivery of domain events stored in the outbox
+type EventsConfig struct {
+	RelayInterval time.Duration `env:"RELAY_INTERVAL" envDefault:"1s"` // How often the outbox is checked for events to deliver, zero disables delivery
+	MaxAttempts   int           `env:"MAX_ATTEMPTS" envDefault:"10"`   // Delivery of an event is given up after this many failed attempts
+	Retention     time.Duration `env:"RETENTION" envDefault:"168h"`    // Delivered events are removed from the outbox after this period, zero keeps them
+}
+
+// WebhooksConfig configures the delivery of events to webhook subscriptions
+type WebhooksConfig struct {
+	PollInterval         time.Duration `env:"POLL_INTERVAL" envDefault:"5s"`             // How often pending deliveries are checked, zero disables delivery
+	Concurrency          int           `env:"CONCURRENCY" envDefault:"4"`                // Number of deliveries sent at the same time
+	Timeout              time.Duration `env:"TIMEOUT" envDefault:"10s"`                  // Timeout of a delivery request
+	MaxAttempts          int           `env:"MAX_ATTEMPTS" envDefault:"10"`              // A delivery is dead after this many failed attempts
+	RetryDelay           time.Duration `env:"RETRY_DELAY" envDefault:"1m"`               // Wait before the first retry, doubled after every attempt
+	Retention            time.Duration `env:"RETENTION" envDefault:"720h"`               // Completed deliveries are removed after this period, zero keeps them
+	AllowPrivateNetworks bool          `env:"ALLOW_PRIVATE_NETWORKS" envDefault:"false"` // Allow URLs resolving to loopback and private addresses
+}
+
 //todo more
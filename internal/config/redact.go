@@ -0,0 +1,62 @@
+package config
+
+import (
+	"reflect"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// redacted replaces the values of secret fields when the configuration is logged
+const redacted = "******"
+
+// MarshalLogObject logs the configuration with the fields tagged `secret:"true"` masked,
+// so that logging the whole configuration does not expose passwords and keys
+func (c *Config) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := range v.NumField() {
+		if err := enc.AddReflected(v.Type().Field(i).Name, redact(v.Field(i)).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redact returns a copy of a configuration value with its non-empty secret fields masked
+func redact(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(v.Elem().Type())
+		p.Elem().Set(redact(v.Elem()))
+		return p
+	case reflect.Struct:
+		s := reflect.New(v.Type()).Elem()
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if field.Tag.Get("secret") == "true" && field.Type.Kind() == reflect.String {
+				if v.Field(i).String() != "" {
+					s.Field(i).SetString(redacted)
+				}
+				continue
+			}
+			s.Field(i).Set(redact(v.Field(i)))
+		}
+		return s
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			s.Index(i).Set(redact(v.Index(i)))
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestConfigLogRedactsSecrets(t *testing.T) {
+	cfg := &Config{
+		App:  &AppConfig{Name: "fx-gin"},
+		Mail: &MailConfig{Username: "mailer", Password: "smtp-password"},
+	}
+
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{})
+	buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{{Key: "config", Type: zapcore.ObjectMarshalerType, Interface: cfg}})
+	if err != nil {
+		t.Fatalf("encode config: %v", err)
+	}
+	out := buf.String()
+
+	if strings.Contains(out, "smtp-password") {
+		t.Errorf("log contains the SMTP password: %s", out)
+	}
+	if !strings.Contains(out, `"Password":"******"`) || !strings.Contains(out, `"Username":"mailer"`) {
+		t.Errorf("log does not contain the masked configuration: %s", out)
+	}
+	if cfg.Mail.Password != "smtp-password" {
+		t.Errorf("logging changed the configuration")
+	}
+}
+
+func TestConfigLogRedactsProviderSecrets(t *testing.T) {
+	cfg := &Config{
+		OIDC: &OIDCConfig{Providers: []OIDCProviderConfig{{Name: "corp", ClientSecret: "oidc-secret"}}},
+	}
+
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{})
+	buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{{Key: "config", Type: zapcore.ObjectMarshalerType, Interface: cfg}})
+	if err != nil {
+		t.Fatalf("encode config: %v", err)
+	}
+	if out := buf.String(); strings.Contains(out, "oidc-secret") || !strings.Contains(out, `"Name":"corp"`) {
+		t.Errorf("log does not mask the client secret of providers: %s", out)
+	}
+	if cfg.OIDC.Providers[0].ClientSecret != "oidc-secret" {
+		t.Errorf("logging changed the configuration")
+	}
+}
+
+func TestConfigLogRedactsBlobSecrets(t *testing.T) {
+	cfg := &Config{
+		Blob: &BlobConfig{URLSecret: "url-secret", S3AccessKeyID: "access-key", S3SecretAccessKey: "s3-secret"},
+	}
+
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{})
+	buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{{Key: "config", Type: zapcore.ObjectMarshalerType, Interface: cfg}})
+	if err != nil {
+		t.Fatalf("encode config: %v", err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"url-secret", "s3-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log contains %q: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, `"S3AccessKeyID":"access-key"`) {
+		t.Errorf("log does not contain the access key ID: %s", out)
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Settings returns the configuration as environment variable names and their values,
+// e.g. "MAIL_SMTP_HOST". Secret values are masked, so a secret only shows as set or not
+// set and replacing it changes nothing.
+func (c *Config) Settings() map[string]any {
+	settings := make(map[string]any)
+	collectSettings(settings, "", reflect.ValueOf(c).Elem())
+	return settings
+}
+
+// Helper function: Add the settings of a configuration struct under a prefix
+func collectSettings(settings map[string]any, prefix string, v reflect.Value) {
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		value := v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+
+		switch {
+		case value.Kind() == reflect.Struct:
+			collectSettings(settings, prefix+field.Tag.Get("envPrefix"), value)
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct:
+			for j := range value.Len() {
+				collectSettings(settings, fmt.Sprintf("%s%s_%d_", prefix, field.Tag.Get("envPrefix"), j), value.Index(j))
+			}
+		default:
+			name, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+			if name == "" {
+				continue
+			}
+			switch {
+			case field.Tag.Get("secret") == "true":
+				if value.String() != "" {
+					settings[prefix+name] = redacted
+				}
+			case value.Type() == reflect.TypeOf(time.Duration(0)):
+				settings[prefix+name] = value.Interface().(time.Duration).String()
+			default:
+				settings[prefix+name] = value.Interface()
+			}
+		}
+	}
+}
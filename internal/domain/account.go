@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// User token purposes
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeAccess            = "access"
+)
+
+// UserToken represents a single-use, time-limited token sent to a user
+type UserToken struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"` // Only the hash is stored
+	Email     string     `json:"-"` // Address the token was sent to, empty for access tokens
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MailMessage represents an outgoing email
+type MailMessage struct {
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text"`
+	HTML    string   `json:"html,omitempty"`
+}
+
+// EmailRequest represents a request carrying an email address
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// VerifyEmailRequest represents the request for confirming an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResetPasswordRequest represents the request for setting a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6,password"`
+}
+
+// Mailer defines the interface for sending emails
+type Mailer interface {
+	Send(ctx context.Context, msg *MailMessage) error
+}
+
+// UserTokenRepo defines the interface for user token repository operations
+type UserTokenRepo interface {
+	Create(ctx context.Context, token *UserToken) error
+	GetByHash(ctx context.Context, purpose, tokenHash string) (*UserToken, error)
+	Use(ctx context.Context, id int64) (bool, error)
+	DeleteByUser(ctx context.Context, userID int64, purpose string) error
+}
+
+// AccountService defines the interface for email verification and password recovery
+type AccountService interface {
+	SendVerificationEmail(ctx context.Context, user *User) error
+	ResendVerificationEmail(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, req *ResetPasswordRequest) error
+	// SetPassword stores the user with a new password and revokes its access and refresh tokens
+	SetPassword(ctx context.Context, user *User, password string) error
+}
@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditUserRegister         = "user.register"
+	AuditUserLogin            = "user.login"
+	AuditUserLoginChallenge   = "user.login_challenge" // Password or external login accepted, the second factor is pending
+	AuditUserLoginFailed      = "user.login_failed"
+	AuditUserUpdate           = "user.update"
+	AuditUserRoles            = "user.roles_change"
+	AuditUserDelete           = "user.delete"
+	AuditUserRestore          = "user.restore"
+	AuditUserPurge            = "user.purge"
+	AuditUserPasswordReset    = "user.password_reset"
+	AuditUserMFAEnable        = "user.mfa_enable"
+	AuditUserMFADisable       = "user.mfa_disable"
+	AuditUserMFARecoveryCodes = "user.mfa_recovery_codes"
+	AuditUserIdentityLink     = "user.identity_link"
+	AuditUserIdentityUnlink   = "user.identity_unlink"
+
+	AuditAPIKeyCreate        = "api_key.create"
+	AuditAPIKeyUpdate        = "api_key.update"
+	AuditAPIKeyDelete        = "api_key.delete"
+	AuditOAuthClientRegister = "oauth_client.register"
+	AuditOAuthClientDelete   = "oauth_client.delete"
+	AuditWebhookCreate       = "webhook.create"
+	AuditWebhookUpdate       = "webhook.update"
+	AuditWebhookDelete       = "webhook.delete"
+	AuditWebhookRedeliver    = "webhook.redeliver"
+	AuditConfigChange        = "config.change"
+)
+
+// Audit target types
+const (
+	AuditTargetUser        = "user"
+	AuditTargetAPIKey      = "api_key"
+	AuditTargetOAuthClient = "oauth_client"
+	AuditTargetWebhook     = "webhook"
+	AuditTargetConfig      = "config"
+)
+
+// AuditEvent records a security-relevant or administrative action. Every event stores
+// the hash of its predecessor, so modifying or removing an event breaks the chain.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	ActorID    int64           `json:"actor_id"` // Authenticated user, zero for anonymous requests, service accounts and jobs
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Changes    json.RawMessage `json:"changes,omitempty" swaggertype:"object"` // Changed fields as {"field": {"before": ..., "after": ...}}
+	Detail     string          `json:"detail,omitempty"`                       // E.g. the error code of a failed login
+	ClientIP   string          `json:"client_ip"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// AuditChange is the value of a field before and after an action
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditQuery filters the audit log, newest events first
+type AuditQuery struct {
+	ActorID    int64      `form:"actor_id"`
+	Action     string     `form:"action"`
+	TargetType string     `form:"target_type"`
+	TargetID   string     `form:"target_id"`
+	Since      *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until      *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit      int        `form:"limit" binding:"omitempty,min=1"`
+	Cursor     string     `form:"cursor"`
+}
+
+// AuditList is a page of audit events
+type AuditList struct {
+	Items      []*AuditEvent `json:"items"`
+	Pagination Pagination    `json:"pagination"`
+}
+
+// AuditVerification is the result of checking the audit hash chain
+type AuditVerification struct {
+	Valid    bool  `json:"valid"`
+	Checked  int   `json:"checked"`             // Number of events checked
+	BrokenAt int64 `json:"broken_at,omitempty"` // First event whose hash does not match
+}
+
+// AuditRepo defines the interface for audit log repository operations
+type AuditRepo interface {
+	Create(ctx context.Context, event *AuditEvent) error
+	// Last returns the most recent event, or nil if the log is empty
+	Last(ctx context.Context) (*AuditEvent, error)
+	// List returns events matching the query ordered by descending ID, starting
+	// below beforeID unless it is zero
+	List(ctx context.Context, query *AuditQuery, beforeID int64, limit int) ([]*AuditEvent, error)
+	// ListAfter returns events with an ID above afterID in ascending order
+	ListAfter(ctx context.Context, afterID int64, limit int) ([]*AuditEvent, error)
+}
+
+// Auditor records and queries the audit log
+type Auditor interface {
+	// Record appends an event, taking the actor, client IP and request ID from the
+	// request trace. Failures are logged and never fail the audited operation.
+	Record(ctx context.Context, event *AuditEvent)
+	List(ctx context.Context, query *AuditQuery) (*AuditList, error)
+	// Verify recomputes the hash chain from the first event
+	Verify(ctx context.Context) (*AuditVerification, error)
+	// RecordConfig compares a configuration, given as setting names and values, with the
+	// one recorded by the previous config.change event, and records the changed settings
+	RecordConfig(ctx context.Context, settings map[string]any) error
+}
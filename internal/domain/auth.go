@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// PrincipalKey is the key for the authenticated principal in context
+	PrincipalKey = "principal"
+)
+
+// Authentication errors
+var (
+	ErrUnauthorized = NewUnauthorizedError("unauthorized", "authentication required")
+	ErrForbidden    = NewForbiddenError("forbidden", "permission denied")
+)
+
+// Authentication methods
+const (
+	AuthMethodBearer = "bearer"
+	AuthMethodAPIKey = "api_key"
+)
+
+// Permissions
+const (
+	PermissionAll           = "*"
+	PermissionUsersRead     = "users:read"
+	PermissionUsersWrite    = "users:write"
+	PermissionUsersDelete   = "users:delete"
+	PermissionRolesRead     = "roles:read"
+	PermissionRolesWrite    = "roles:write"
+	PermissionAPIKeysManage = "api_keys:manage" // Manage keys of other users and service accounts
+
+	PermissionOAuthClientsManage = "oauth_clients:manage"
+	PermissionAuditRead          = "audit:read"
+	PermissionWebhooksManage     = "webhooks:manage"
+)
+
+// Permissions lists all known permissions
+var Permissions = []string{
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionUsersDelete,
+	PermissionRolesRead,
+	PermissionRolesWrite,
+	PermissionAPIKeysManage,
+	PermissionOAuthClientsManage,
+	PermissionAuditRead,
+	PermissionWebhooksManage,
+}
+
+// RolePermissions maps role names to the permissions they grant.
+// Users can always read and update their own account regardless of role.
+var RolePermissions = map[string][]string{
+	"admin": {PermissionAll},
+	"user":  {},
+}
+
+// Principal represents the authenticated caller of a request
+type Principal struct {
+	UserID         int64    `json:"user_id,omitempty"`         // Zero for service account API keys
+	ServiceAccount string   `json:"service_account,omitempty"` // Set for service account API keys
+	Roles          []string `json:"roles"`
+	Permissions    []string `json:"permissions"`
+	Method         string   `json:"method"`
+	APIKeyID       int64    `json:"api_key_id,omitempty"`
+	ClientID       string   `json:"client_id,omitempty"` // Set for OAuth2 access tokens
+	Locale         string   `json:"locale,omitempty"`    // Preferred locale from the profile of the user, empty to follow the request
+}
+
+// HasPermission reports whether the principal was granted the permission
+func (p *Principal) HasPermission(permission string) bool {
+	for _, granted := range p.Permissions {
+		if granted == PermissionAll || granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUser reports whether the principal is the given user
+func (p *Principal) IsUser(userID int64) bool {
+	return p.UserID != 0 && p.UserID == userID
+}
+
+// APIKey represents an API key used by service-to-service clients
+type APIKey struct {
+	ID             int64      `json:"id"`
+	Name           string     `json:"name"`
+	Prefix         string     `json:"prefix"` // Visible part of the key used for lookup
+	KeyHash        string     `json:"-"`
+	UserID         *int64     `json:"user_id" extensions:"x-nullable"` // Owner user, nil for service accounts
+	ServiceAccount string     `json:"service_account"`                 // Owner service account name
+	Scopes         []string   `json:"scopes"`
+	ExpiresAt      *time.Time `json:"expires_at" extensions:"x-nullable"`
+	LastUsedAt     *time.Time `json:"last_used_at" extensions:"x-nullable"`
+	LastUsedIP     string     `json:"last_used_ip"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// APIKeyRequest represents the request for creating an API key
+type APIKeyRequest struct {
+	Name           string     `json:"name" binding:"required,max=100"`
+	Scopes         []string   `json:"scopes"`
+	ExpiresAt      *time.Time `json:"expires_at" extensions:"x-nullable"`
+	UserID         *int64     `json:"user_id" extensions:"x-nullable"` // Create the key for another user (requires api_keys:manage)
+	ServiceAccount string     `json:"service_account"`                 // Create a service account key (requires api_keys:manage)
+}
+
+// APIKeyUpdateRequest represents the request for updating an API key
+type APIKeyUpdateRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at" extensions:"x-nullable"`
+}
+
+// APIKeyResponse represents a newly created API key. The key is shown only once.
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyRepo defines the interface for API key repository operations
+type APIKeyRepo interface {
+	Create(ctx context.Context, key *APIKey) error
+	GetByID(ctx context.Context, id int64) (*APIKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	Update(ctx context.Context, key *APIKey) error
+	Delete(ctx context.Context, id int64) error
+	ListByUser(ctx context.Context, userID int64) ([]*APIKey, error)
+	List(ctx context.Context) ([]*APIKey, error)
+	TouchLastUsed(ctx context.Context, id int64, at time.Time, ip string) error
+}
+
+// APIKeyService defines the interface for API key management
+type APIKeyService interface {
+	Create(ctx context.Context, principal *Principal, req *APIKeyRequest) (*APIKeyResponse, error)
+	Get(ctx context.Context, principal *Principal, id int64) (*APIKey, error)
+	List(ctx context.Context, principal *Principal, all bool) ([]*APIKey, error)
+	Update(ctx context.Context, principal *Principal, id int64, req *APIKeyUpdateRequest) (*APIKey, error)
+	Delete(ctx context.Context, principal *Principal, id int64) error
+
+	Authenticate(ctx context.Context, key, clientIP string) (*Principal, error)
+}
+
+// AuthService defines the interface for authenticating requests
+type AuthService interface {
+	// Authenticate resolves a bearer token or API key into a principal
+	Authenticate(ctx context.Context, credential, clientIP string) (*Principal, error)
+	// PrincipalForUser builds a principal with the permissions of the user's roles
+	PrincipalForUser(ctx context.Context, userID int64, method string) (*Principal, error)
+}
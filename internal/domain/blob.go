@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Blob describes stored content. Blobs are addressed by the SHA-256 hash of
+// their content, so identical uploads share one stored object.
+type Blob struct {
+	ID          int64     `json:"id"`
+	Key         string    `json:"key"`
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	RefCount    int       `json:"ref_count"` // Number of references, the object is deleted when it drops to zero
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BlobStore is a storage backend for binary objects under slash separated keys
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the content of a blob, or ErrBlobNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// URL returns an address clients can download the blob from until ttl has passed
+	URL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// BlobURLVerifier is implemented by blob stores whose downloads are served by
+// the application instead of the storage backend
+type BlobURLVerifier interface {
+	// VerifyURL checks the expiry and signature of a download URL
+	VerifyURL(key, expires, signature string) error
+}
+
+// BlobRepo defines the interface for blob metadata repository operations
+type BlobRepo interface {
+	GetByKey(ctx context.Context, key string) (*Blob, error)
+	// Acquire records the blob or adds a reference to an existing blob with the
+	// same key. It reports whether the blob is new.
+	Acquire(ctx context.Context, blob *Blob) (bool, error)
+	// Release removes a reference and deletes the record when none are left.
+	// It returns the number of remaining references.
+	Release(ctx context.Context, key string) (int, error)
+}
+
+// BlobService defines the interface for storing deduplicated content
+type BlobService interface {
+	// Save stores content below prefix under a key derived from its hash. Saving
+	// content that already exists adds a reference instead of a copy.
+	Save(ctx context.Context, prefix string, r io.Reader, contentType string) (*Blob, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, *Blob, error)
+	// Release drops a reference obtained from Save
+	Release(ctx context.Context, key string) error
+	// URL returns a time-limited download URL
+	URL(ctx context.Context, key string) (string, error)
+	VerifyURL(key, expires, signature string) error
+}
+
+// Blob errors
+var (
+	ErrBlobNotFound   = NewNotFoundError("blob_not_found", "file not found")
+	ErrInvalidBlobURL = NewForbiddenError("invalid_blob_url", "download link is invalid or has expired")
+)
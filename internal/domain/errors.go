@@ -0,0 +1,216 @@
+package domain
+
+import "errors"
+
+// ErrorKind classifies an error and determines the HTTP status it maps to
+type ErrorKind string
+
+// Error kinds
+const (
+	KindNotFound             ErrorKind = "not_found"
+	KindConflict             ErrorKind = "conflict"
+	KindValidation           ErrorKind = "validation"
+	KindUnauthorized         ErrorKind = "unauthorized"
+	KindForbidden            ErrorKind = "forbidden"
+	KindTooLarge             ErrorKind = "too_large"
+	KindUnsupported          ErrorKind = "unsupported"
+	KindPrecondition         ErrorKind = "precondition"
+	KindPreconditionRequired ErrorKind = "precondition_required"
+	KindInternal             ErrorKind = "internal"
+)
+
+// Error is a typed application error. Code and Message are safe to return to
+// clients; the wrapped cause is only logged.
+type Error struct {
+	Kind    ErrorKind
+	Code    string // Stable machine readable code, e.g. "user_not_found"
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error with the same code, so sentinel errors
+// match even when they were wrapped with a cause
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of the error with the cause attached
+func (e *Error) Wrap(err error) *Error {
+	return &Error{Kind: e.Kind, Code: e.Code, Message: e.Message, Err: err}
+}
+
+// NewNotFoundError creates an error for a missing resource
+func NewNotFoundError(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+// NewConflictError creates an error for a conflict with the current state, e.g. a duplicate
+func NewConflictError(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+// NewValidationError creates an error for invalid input
+func NewValidationError(code, message string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message}
+}
+
+// NewUnauthorizedError creates an error for missing or invalid credentials
+func NewUnauthorizedError(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+// NewForbiddenError creates an error for an authenticated caller lacking access
+func NewForbiddenError(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+// NewTooLargeError creates an error for a request body or upload exceeding a size limit
+func NewTooLargeError(code, message string) *Error {
+	return &Error{Kind: KindTooLarge, Code: code, Message: message}
+}
+
+// NewUnsupportedError creates an error for content in a format that is not accepted
+func NewUnsupportedError(code, message string) *Error {
+	return &Error{Kind: KindUnsupported, Code: code, Message: message}
+}
+
+// NewPreconditionError creates an error for a conditional request whose precondition does not hold
+func NewPreconditionError(code, message string) *Error {
+	return &Error{Kind: KindPrecondition, Code: code, Message: message}
+}
+
+// NewPreconditionRequiredError creates an error for a request that must be conditional
+func NewPreconditionRequiredError(code, message string) *Error {
+	return &Error{Kind: KindPreconditionRequired, Code: code, Message: message}
+}
+
+// NewInternalError wraps an unexpected error. Its details are never returned to clients.
+func NewInternalError(err error) *Error {
+	return &Error{Kind: KindInternal, Code: "internal_error", Message: "internal server error", Err: err}
+}
+
+// AsError extracts a typed error from err. Untyped errors are treated as internal.
+func AsError(err error) *Error {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed
+	}
+	return NewInternalError(err)
+}
+
+// Common errors
+var (
+	ErrUserNotFound        = NewNotFoundError("user_not_found", "user not found")
+	ErrUsernameExists      = NewConflictError("username_exists", "username already exists")
+	ErrEmailRegistered     = NewConflictError("email_registered", "email already registered")
+	ErrInvalidCredentials  = NewUnauthorizedError("invalid_credentials", "invalid username or password")
+	ErrInvalidToken        = NewUnauthorizedError("invalid_token", "invalid or expired token")
+	ErrEmailNotVerified    = NewForbiddenError("email_not_verified", "email address has not been verified")
+	ErrAccountInactive     = NewForbiddenError("account_inactive", "account is not active or has been locked")
+	ErrInvalidRequest      = NewValidationError("invalid_request", "Invalid request parameters")
+	ErrInvalidUserID       = NewValidationError("invalid_user_id", "Invalid user ID")
+	ErrInvalidAccountToken = NewValidationError("invalid_account_token", "invalid or expired token")
+)
+
+// Two-factor authentication errors
+var (
+	ErrMFAAlreadyEnabled       = NewConflictError("mfa_already_enabled", "two-factor authentication is already enabled")
+	ErrMFANotEnabled           = NewConflictError("mfa_not_enabled", "two-factor authentication is not enabled")
+	ErrMFAEnrollmentNotStarted = NewConflictError("mfa_enrollment_not_started", "two-factor authentication enrollment not started")
+	ErrInvalidChallenge        = NewUnauthorizedError("invalid_challenge", "invalid or expired challenge")
+	ErrTooManyAttempts         = NewUnauthorizedError("too_many_attempts", "too many failed attempts")
+	ErrInvalidVerificationCode = NewValidationError("invalid_verification_code", "invalid verification code")
+)
+
+// API key and OAuth client errors
+var (
+	ErrAPIKeyNotFound      = NewNotFoundError("api_key_not_found", "api key not found")
+	ErrOAuthClientNotFound = NewNotFoundError("oauth_client_not_found", "oauth client not found")
+	ErrInvalidExpiry       = NewValidationError("invalid_expiry", "expires_at must be in the future")
+)
+
+// Webhook errors
+var (
+	ErrWebhookNotFound         = NewNotFoundError("webhook_not_found", "webhook not found")
+	ErrWebhookDeliveryNotFound = NewNotFoundError("webhook_delivery_not_found", "webhook delivery not found")
+	ErrInvalidWebhookURL       = NewValidationError("invalid_webhook_url", "webhook url must be an http or https url of a public host")
+)
+
+// External login errors
+var (
+	ErrUnknownProvider     = NewNotFoundError("unknown_provider", "unknown identity provider")
+	ErrIdentityNotFound    = NewNotFoundError("identity_not_found", "identity not found")
+	ErrInvalidLoginState   = NewValidationError("invalid_login_state", "invalid or expired login state")
+	ErrInvalidIDToken      = NewUnauthorizedError("invalid_id_token", "invalid id token")
+	ErrExternalLoginFailed = NewUnauthorizedError("external_login_failed", "external login failed")
+)
+
+// Profile errors
+var (
+	ErrInvalidBirthday   = NewValidationError("invalid_birthday", "birthday must be a past date in YYYY-MM-DD format")
+	ErrInvalidAvatar     = NewValidationError("invalid_avatar", "avatar is not a valid image")
+	ErrAvatarTooLarge    = NewTooLargeError("avatar_too_large", "avatar exceeds the maximum size")
+	ErrUnsupportedAvatar = NewUnsupportedError("unsupported_avatar_type", "avatar must be a JPEG, PNG, GIF or WebP image")
+)
+
+// Concurrency errors
+var (
+	ErrPreconditionFailed   = NewPreconditionError("precondition_failed", "the resource was modified, fetch it again and retry")
+	ErrPreconditionRequired = NewPreconditionRequiredError("precondition_required", "If-Match header is required")
+)
+
+// Listing errors
+var (
+	ErrInvalidSort   = NewValidationError("invalid_sort", "unsupported sort field")
+	ErrInvalidCursor = NewValidationError("invalid_cursor", "invalid pagination cursor")
+)
+
+// Patch errors
+var (
+	ErrInvalidPatch     = NewValidationError("invalid_patch", "invalid patch document")
+	ErrPatchTestFailed  = NewConflictError("patch_test_failed", "patch test operation failed")
+	ErrUnsupportedPatch = NewUnsupportedError("unsupported_patch_type", "patch must be application/merge-patch+json or application/json-patch+json")
+)
+
+// API contract errors, reported when validation against the OpenAPI spec is enabled
+var (
+	ErrRequestContract  = NewValidationError("request_contract_violation", "request does not match the API specification")
+	ErrResponseContract = &Error{Kind: KindInternal, Code: "response_contract_violation", Message: "response does not match the API specification"}
+)
+
+// NewFieldNotAllowedError reports a field the caller is not allowed to modify
+func NewFieldNotAllowedError(field string) *Error {
+	return NewForbiddenError("field_not_allowed", "cannot modify field "+field)
+}
+
+// NewUnknownRoleError reports a role that does not exist
+func NewUnknownRoleError(role string) *Error {
+	return NewValidationError("unknown_role", "unknown role: "+role)
+}
+
+// NewUnknownScopeError reports a scope that is not defined
+func NewUnknownScopeError(scope string) *Error {
+	return NewValidationError("unknown_scope", "unknown scope: "+scope)
+}
+
+// NewUnknownEventError reports an event name that is not defined
+func NewUnknownEventError(event string) *Error {
+	return NewValidationError("unknown_event", "unknown event: "+event)
+}
+
+// NewScopeNotAllowedError reports a scope the caller is not allowed to grant
+func NewScopeNotAllowedError(scope string) *Error {
+	return NewForbiddenError("scope_not_allowed", "cannot grant scope "+scope)
+}
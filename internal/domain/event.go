@@ -0,0 +1,204 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Event names
+const (
+	EventUserRegistered = "user.registered"
+	EventUserUpdated    = "user.updated"
+	EventUserDeleted    = "user.deleted"
+	EventUserRestored   = "user.restored"
+)
+
+// Event is something that happened in the domain, published on the event bus after the
+// change it describes. Events are values serialized as JSON.
+type Event interface {
+	EventName() string
+}
+
+// UserRegistered is published when a user has registered, was created by an admin or was
+// provisioned from an external identity
+type UserRegistered struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Status   int    `json:"status"`
+}
+
+// EventName returns the name of the event
+func (UserRegistered) EventName() string { return EventUserRegistered }
+
+// UserUpdated is published when the username, email, password, status or roles of a user
+// have changed
+type UserUpdated struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Status   int    `json:"status"`
+}
+
+// EventName returns the name of the event
+func (UserUpdated) EventName() string { return EventUserUpdated }
+
+// UserDeleted is published when a user has been soft deleted
+type UserDeleted struct {
+	UserID int64 `json:"user_id"`
+}
+
+// EventName returns the name of the event
+func (UserDeleted) EventName() string { return EventUserDeleted }
+
+// UserRestored is published when a soft deleted user has been restored
+type UserRestored struct {
+	UserID int64 `json:"user_id"`
+}
+
+// EventName returns the name of the event
+func (UserRestored) EventName() string { return EventUserRestored }
+
+// eventDecoders read the events stored in the outbox by name
+var eventDecoders = map[string]func(payload []byte) (Event, error){
+	EventUserRegistered: decodeEvent[UserRegistered],
+	EventUserUpdated:    decodeEvent[UserUpdated],
+	EventUserDeleted:    decodeEvent[UserDeleted],
+	EventUserRestored:   decodeEvent[UserRestored],
+}
+
+// EventNames lists the names of all events
+var EventNames = []string{
+	EventUserRegistered,
+	EventUserUpdated,
+	EventUserDeleted,
+	EventUserRestored,
+}
+
+// DecodeEvent reads an event from its name and JSON payload
+func DecodeEvent(name string, payload []byte) (Event, error) {
+	decode, ok := eventDecoders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown event %q", name)
+	}
+	return decode(payload)
+}
+
+// Helper function: Read the JSON payload of an event type
+func decodeEvent[E Event](payload []byte) (Event, error) {
+	var event E
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// EventOccurrence identifies a published event for its subscribers
+type EventOccurrence struct {
+	// ID is the same for every delivery of the event. Stored events keep the ID of their
+	// outbox entry across retries of the relay.
+	ID         string
+	OccurredAt time.Time
+}
+
+// eventOccurrenceKey is the context key of the event being delivered
+type eventOccurrenceKey struct{}
+
+// WithEventOccurrence returns a context for delivering the given event occurrence
+func WithEventOccurrence(ctx context.Context, occurrence EventOccurrence) context.Context {
+	return context.WithValue(ctx, eventOccurrenceKey{}, occurrence)
+}
+
+// EventOccurrenceFromContext returns the occurrence of the event delivered with the
+// context, if any
+func EventOccurrenceFromContext(ctx context.Context) (EventOccurrence, bool) {
+	occurrence, ok := ctx.Value(eventOccurrenceKey{}).(EventOccurrence)
+	return occurrence, ok
+}
+
+// EventSubscriber receives events from the event bus. Subscribers are provided to the
+// "event_subscribers" value group. Events may be delivered more than once, so handlers
+// must be idempotent.
+type EventSubscriber struct {
+	Name   string   // Identifies the subscriber in logs and in the progress of outbox events, unique and without spaces
+	Events []string // Names of the events to receive, every event when empty
+	Async  bool     // Deliver events published outside a transaction in the background, at most once
+	Handle func(ctx context.Context, event Event) error
+}
+
+// Receives reports whether the subscriber wants an event
+func (s *EventSubscriber) Receives(name string) bool {
+	return len(s.Events) == 0 || slices.Contains(s.Events, name)
+}
+
+// Subscribe creates a subscriber of one event type
+func Subscribe[E Event](name string, async bool, handle func(ctx context.Context, event E) error) EventSubscriber {
+	var zero E
+	return EventSubscriber{
+		Name:   name,
+		Events: []string{zero.EventName()},
+		Async:  async,
+		Handle: func(ctx context.Context, event Event) error {
+			typed, ok := event.(E)
+			if !ok {
+				return fmt.Errorf("unexpected event type %T", event)
+			}
+			return handle(ctx, typed)
+		},
+	}
+}
+
+// OutboxEvent is an event stored in the outbox in the transaction of its change, and
+// delivered to subscribers once the transaction has committed
+type OutboxEvent struct {
+	ID            int64
+	Name          string
+	Payload       json.RawMessage
+	ActorID       int64  // Authenticated user of the request that published the event
+	RequestID     string // Request that published the event, delivery continues its trace
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	HandledBy     []string   // Names of the subscribers that have handled the event
+	PublishedAt   *time.Time // Set once every subscriber has handled the event
+	FailedAt      *time.Time // Set when delivery is given up after the last attempt
+}
+
+// EventOutboxRepo defines the interface for event outbox repository operations
+type EventOutboxRepo interface {
+	// Create stores an event, in the transaction of ctx if there is one
+	Create(ctx context.Context, event *OutboxEvent) error
+	// ListDue returns pending events whose next attempt is due, oldest first
+	ListDue(ctx context.Context, now time.Time, limit int) ([]*OutboxEvent, error)
+	// UpdateDelivery stores the attempts, error, next attempt, progress and outcome of an event
+	UpdateDelivery(ctx context.Context, event *OutboxEvent) error
+	// DeletePublished removes events published before the given time
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Transactor runs changes of several repositories in one database transaction
+type Transactor interface {
+	// InTx runs fn in a transaction, committed when fn succeeds and rolled back otherwise.
+	// Repositories called with the context passed to fn take part in the transaction.
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// AfterCommit registers fn to run once the transaction of ctx has committed. It
+	// reports false, without registering fn, when ctx has no transaction.
+	AfterCommit(ctx context.Context, fn func()) bool
+}
+
+// EventBus delivers domain events to the subscribers
+type EventBus interface {
+	// Publish delivers events to the subscribers. Inside a transaction of the Transactor
+	// they are stored in the outbox and delivered once it commits, so they are published
+	// if and only if the change is. Every subscriber, synchronous or not, receives them at
+	// least once: the relay calls the subscribers in turn and retries those that failed.
+	//
+	// Outside a transaction events are delivered right away and errors of synchronous
+	// subscribers are returned. Asynchronous subscribers then receive them at most once,
+	// their errors are only logged.
+	Publish(ctx context.Context, events ...Event) error
+}
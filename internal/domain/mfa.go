@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// UserMFA represents the TOTP second factor of a user
+type UserMFA struct {
+	UserID       int64      `json:"user_id"`
+	Secret       string     `json:"-"` // Secret is never exposed after enrollment
+	Enabled      bool       `json:"enabled"`
+	LastUsedStep int64      `json:"-"` // Last accepted TOTP step, used to reject replays
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode represents a single-use MFA recovery code
+type RecoveryCode struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MFAChallenge represents a pending second-factor login step
+type MFAChallenge struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	TokenHash string     `json:"-"`
+	Attempts  int        `json:"attempts"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MFAEnrollResponse represents the response for starting TOTP enrollment
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRPayload  string `json:"qr_payload"` // Content to encode as a QR code
+}
+
+// MFACodeRequest represents a request carrying a TOTP code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAConfirmResponse represents the response for confirming TOTP enrollment
+type MFAConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"` // Shown only once
+}
+
+// MFALoginRequest represents the request for completing an MFA challenge
+type MFALoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // TOTP code or recovery code
+}
+
+// MFARepo defines the interface for MFA repository operations
+type MFARepo interface {
+	GetByUserID(ctx context.Context, userID int64) (*UserMFA, error)
+	Save(ctx context.Context, mfa *UserMFA) error
+	Delete(ctx context.Context, userID int64) error
+
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+
+	CreateChallenge(ctx context.Context, challenge *MFAChallenge) error
+	GetChallenge(ctx context.Context, tokenHash string) (*MFAChallenge, error)
+	IncrementChallengeAttempts(ctx context.Context, id int64) error
+	UseChallenge(ctx context.Context, id int64) (bool, error)
+}
+
+// MFAService defines the interface for TOTP two-factor authentication
+type MFAService interface {
+	Enroll(ctx context.Context, userID int64) (*MFAEnrollResponse, error)
+	Confirm(ctx context.Context, userID int64, code string) (*MFAConfirmResponse, error)
+	Disable(ctx context.Context, userID int64, code string) error
+	// Reset removes the factor without a code, for admins helping users who lost it
+	Reset(ctx context.Context, userID int64) error
+	RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) (*MFAConfirmResponse, error)
+
+	CompleteLogin(ctx context.Context, req *MFALoginRequest) (*TokenResponse, error)
+}
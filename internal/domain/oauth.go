@@ -0,0 +1,211 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// OAuth2 grant types
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+// AuthMethodOAuth is the authentication method for OAuth2 access tokens
+const AuthMethodOAuth = "oauth"
+
+// OAuthError represents an OAuth2 error response (RFC 6749 section 5.2)
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// NewOAuthError creates a new OAuth2 error
+func NewOAuthError(status int, code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description, Status: status}
+}
+
+// AsOAuthError extracts an OAuth2 error from err
+func AsOAuthError(err error) (*OAuthError, bool) {
+	var oauthErr *OAuthError
+	ok := errors.As(err, &oauthErr)
+	return oauthErr, ok
+}
+
+// OAuthClient represents a registered OAuth2 client
+type OAuthClient struct {
+	ID           int64     `json:"id"`
+	ClientID     string    `json:"client_id"`
+	SecretHash   string    `json:"-"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"` // Public clients (SPAs) have no secret and must use PKCE
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// OAuthAuthorizationCode represents an issued authorization code
+type OAuthAuthorizationCode struct {
+	ID                  int64      `json:"id"`
+	CodeHash            string     `json:"-"`
+	ClientID            string     `json:"client_id"`
+	UserID              int64      `json:"user_id"`
+	RedirectURI         string     `json:"redirect_uri"`
+	Scope               string     `json:"scope"`
+	CodeChallenge       string     `json:"-"`
+	CodeChallengeMethod string     `json:"-"`
+	ExpiresAt           time.Time  `json:"expires_at"`
+	UsedAt              *time.Time `json:"used_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// OAuthRefreshToken represents an issued refresh token
+type OAuthRefreshToken struct {
+	ID        int64      `json:"id"`
+	TokenHash string     `json:"-"`
+	ClientID  string     `json:"client_id"`
+	UserID    int64      `json:"user_id"`
+	Scope     string     `json:"scope"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// OAuthConsent represents the scopes a user granted to a client
+type OAuthConsent struct {
+	UserID    int64     `json:"user_id"`
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OAuthClientRequest represents the request for registering an OAuth2 client
+type OAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types" binding:"required,min=1"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+// OAuthClientResponse represents a newly registered client. The secret is shown only once.
+type OAuthClientResponse struct {
+	OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// AuthorizeRequest represents an authorization request (RFC 6749 section 4.1.1, RFC 7636)
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type" binding:"required"`
+	ClientID            string `form:"client_id" json:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+	Approve             *bool  `form:"-" json:"approve"` // Consent decision, only set when posting the consent form
+}
+
+// AuthorizeResponse represents the outcome of an authorization request
+type AuthorizeResponse struct {
+	ConsentRequired bool     `json:"consent_required"`
+	Client          string   `json:"client,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
+	RedirectTo      string   `json:"redirect_to,omitempty"`
+}
+
+// TokenRequest represents a token request (RFC 6749 section 4)
+type TokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// OAuthTokenResponse represents a successful token response (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// IntrospectionResponse represents a token introspection response (RFC 7662)
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+// TokenSigner defines the interface for signing and verifying JWTs issued by this server
+type TokenSigner interface {
+	Sign(claims map[string]any) (string, error)
+	Verify(token string) (map[string]any, error)
+	JWKS() map[string]any
+}
+
+// OAuthRepo defines the interface for OAuth2 repository operations
+type OAuthRepo interface {
+	CreateClient(ctx context.Context, client *OAuthClient) error
+	GetClient(ctx context.Context, clientID string) (*OAuthClient, error)
+	ListClients(ctx context.Context) ([]*OAuthClient, error)
+	DeleteClient(ctx context.Context, clientID string) error
+
+	CreateAuthorizationCode(ctx context.Context, code *OAuthAuthorizationCode) error
+	GetAuthorizationCode(ctx context.Context, codeHash string) (*OAuthAuthorizationCode, error)
+	UseAuthorizationCode(ctx context.Context, id int64) (bool, error)
+
+	CreateRefreshToken(ctx context.Context, token *OAuthRefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*OAuthRefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, id int64) (bool, error)
+	RevokeRefreshTokensByClientUser(ctx context.Context, clientID string, userID int64) error
+	RevokeRefreshTokensByUser(ctx context.Context, userID int64) error
+
+	GetConsent(ctx context.Context, userID int64, clientID string) (*OAuthConsent, error)
+	SaveConsent(ctx context.Context, consent *OAuthConsent) error
+	DeleteConsent(ctx context.Context, userID int64, clientID string) error
+
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// OAuthService defines the interface for the OAuth2 authorization server
+type OAuthService interface {
+	RegisterClient(ctx context.Context, principal *Principal, req *OAuthClientRequest) (*OAuthClientResponse, error)
+	ListClients(ctx context.Context) ([]*OAuthClient, error)
+	DeleteClient(ctx context.Context, clientID string) error
+
+	Authorize(ctx context.Context, principal *Principal, req *AuthorizeRequest) (*AuthorizeResponse, error)
+	Token(ctx context.Context, req *TokenRequest) (*OAuthTokenResponse, error)
+	Introspect(ctx context.Context, clientID, clientSecret, token string) (*IntrospectionResponse, error)
+	Revoke(ctx context.Context, clientID, clientSecret, token string) error
+	RevokeConsent(ctx context.Context, userID int64, clientID string) error
+
+	// ValidateAccessToken verifies a signed access token and resolves its principal
+	ValidateAccessToken(ctx context.Context, token string) (*Principal, error)
+	JWKS() map[string]any
+	Metadata() map[string]any
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"` // The "sub" claim, unique per provider
+	Email       string    `json:"email"`
+	LastLoginAt time.Time `json:"last_login_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// OIDCLoginState represents a pending login at an external identity provider
+type OIDCLoginState struct {
+	ID           int64     `json:"id"`
+	StateHash    string    `json:"-"`
+	Provider     string    `json:"provider"`
+	Nonce        string    `json:"-"`
+	CodeVerifier string    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OIDCProvider represents a configured external identity provider
+type OIDCProvider struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+// OIDCCallbackRequest represents the authorization response from an identity provider
+type OIDCCallbackRequest struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+// IdentityRepo defines the interface for external identity repository operations
+type IdentityRepo interface {
+	Create(ctx context.Context, identity *UserIdentity) error
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	ListByUser(ctx context.Context, userID int64) ([]*UserIdentity, error)
+	Update(ctx context.Context, identity *UserIdentity) error
+	Delete(ctx context.Context, userID, id int64) (bool, error)
+
+	CreateState(ctx context.Context, state *OIDCLoginState) error
+	// ConsumeState retrieves and deletes a login state so it can be used only once
+	ConsumeState(ctx context.Context, stateHash string) (*OIDCLoginState, error)
+}
+
+// OIDCService defines the interface for login with external OpenID Connect providers
+type OIDCService interface {
+	Providers() []*OIDCProvider
+	// AuthorizationURL starts a login and returns the provider URL to redirect the user to
+	AuthorizationURL(ctx context.Context, provider string) (string, error)
+	Callback(ctx context.Context, provider string, req *OIDCCallbackRequest) (*TokenResponse, error)
+
+	ListIdentities(ctx context.Context, userID int64) ([]*UserIdentity, error)
+	Unlink(ctx context.Context, userID, identityID int64) error
+}
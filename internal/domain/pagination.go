@@ -0,0 +1,16 @@
+package domain
+
+// Page sizes of list endpoints
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100
+)
+
+// Pagination describes the position of a page within a list
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Page       int    `json:"page,omitempty"`        // Set for offset pagination
+	NextCursor string `json:"next_cursor,omitempty"` // Pass as cursor to fetch the following page
+	HasMore    bool   `json:"has_more"`
+	Total      *int   `json:"total,omitempty"` // Only counted when requested
+}
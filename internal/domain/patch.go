@@ -0,0 +1,8 @@
+package domain
+
+// Patch is a partial update in JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902)
+// format, selected by its content type
+type Patch struct {
+	ContentType string
+	Body        []byte
+}
@@ -0,0 +1,23 @@
+package domain
+
+// ProblemContentType is the media type of problem details responses
+const ProblemContentType = "application/problem+json"
+
+// Problem represents an RFC 7807 problem details response
+type Problem struct {
+	Type      string       `json:"type" example:"about:blank"`
+	Title     string       `json:"title" example:"Not Found"`
+	Status    int          `json:"status" example:"404"`
+	Detail    string       `json:"detail,omitempty" example:"user not found"`
+	Instance  string       `json:"instance,omitempty" example:"/api/v1/users/42"`
+	Code      string       `json:"code,omitempty" example:"user_not_found"` // Stable machine readable error code
+	RequestID string       `json:"request_id,omitempty" example:"cq9h1vbp4ufc73a0g0og"`
+	Errors    []FieldError `json:"errors,omitempty"` // Field-level validation errors
+}
+
+// FieldError describes why a single request field failed validation
+type FieldError struct {
+	Field   string `json:"field" example:"email"`
+	Rule    string `json:"rule" example:"email"`
+	Message string `json:"message" example:"email must be a valid email address"`
+}
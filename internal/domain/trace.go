@@ -15,5 +15,6 @@ type TraceInfo struct {
 	StartTime     time.Time `json:"-"`              // Request start time
 	Method        string    `json:"method"`         // HTTP method
 	Path          string    `json:"path"`           // Request path
-	//todo add user info
+	UserID        int64     `json:"user_id"`        // Authenticated user ID, zero if anonymous
+	Locale        string    `json:"locale"`         // Negotiated locale for response messages
 }
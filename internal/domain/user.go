@@ -7,13 +7,16 @@ import (
 
 // User represents a user entity
 type User struct {
-	ID        int64     `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` // Password is not exposed in JSON
-	Status    int       `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              int64      `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"` // Password is not exposed in JSON
+	Status          int        `json:"status"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at" extensions:"x-nullable"` // Nil until the email address is confirmed
+	Version         int64      `json:"version"`                                   // Incremented on every update, used as ETag
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"` // Set while the user is soft deleted
 }
 
 // Profile represents a user profile entity
@@ -21,13 +24,19 @@ type Profile struct {
 	ID        int64     `json:"id"`
 	UserID    int64     `json:"user_id"`
 	Nickname  string    `json:"nickname"`
-	Avatar    string    `json:"avatar"`
+	Avatar    string    `json:"avatar"` // Download URL of the uploaded avatar
+	AvatarKey string    `json:"-"`      // Blob key of the uploaded avatar
 	Bio       string    `json:"bio"`
 	Phone     string    `json:"phone"`
 	Gender    int       `json:"gender"` // 0:Unknown 1:Male 2:Female
 	Birthday  string    `json:"birthday"`
+	Locale    string    `json:"locale"`  // Preferred locale for messages and emails, empty to follow the request
+	Version   int64     `json:"version"` // Incremented on every update, used as ETag
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	AvatarThumbnails    map[string]string `json:"avatar_thumbnails,omitempty"` // Thumbnail download URLs by size in pixels
+	AvatarThumbnailKeys map[string]string `json:"-"`                           // Thumbnail blob keys by size in pixels
 }
 
 // Role represents a role entity
@@ -35,6 +44,7 @@ type Role struct {
 	ID          int64     `json:"id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
+	Version     int64     `json:"version"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -69,19 +79,30 @@ type UserWithRoles struct {
 
 // UserRequest represents the request for creating/updating a user
 type UserRequest struct {
-	Username string `json:"username" binding:"required,min=3,max=50"`
+	Username string `json:"username" binding:"required,min=3,max=50,username"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required,min=6,password"`
 }
 
-// ProfileRequest represents the request for creating/updating a user profile
+// ProfileRequest represents the request for replacing a user profile.
+// The avatar is managed through the avatar upload endpoint.
 type ProfileRequest struct {
-	Nickname string `json:"nickname"`
-	Avatar   string `json:"avatar"`
-	Bio      string `json:"bio"`
-	Phone    string `json:"phone"`
-	Gender   int    `json:"gender"`
-	Birthday string `json:"birthday"`
+	Nickname string `json:"nickname" binding:"max=50"`
+	Bio      string `json:"bio" binding:"max=500"`
+	Phone    string `json:"phone" binding:"omitempty,phone"`
+	Gender   int    `json:"gender" binding:"oneof=0 1 2"`
+	Birthday string `json:"birthday" binding:"omitempty,datetime=2006-01-02"` // YYYY-MM-DD
+	Locale   string `json:"locale" binding:"omitempty,oneof=en zh"`
+}
+
+// UserDocument is the representation of a user that PATCH requests are applied to.
+// Changing status requires users:write and changing roles requires roles:write.
+type UserDocument struct {
+	Username string   `json:"username" binding:"required,min=3,max=50,username"`
+	Email    string   `json:"email" binding:"required,email"`
+	Password string   `json:"password,omitempty" binding:"omitempty,min=6,password"` // Write only
+	Status   int      `json:"status" binding:"oneof=0 1 2"`
+	Roles    []string `json:"roles" binding:"dive,required"` // Role names
 }
 
 // LoginRequest represents the request for user login
@@ -90,10 +111,14 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// TokenResponse represents the response for user login
+// TokenResponse represents the response for user login.
+// When the account has two-factor authentication enabled, Token is empty and
+// MFARequired is set; the ChallengeToken must then be completed via the MFA login endpoint.
 type TokenResponse struct {
-	Token     string `json:"token"`
-	ExpiresAt int64  `json:"expires_at"`
+	Token          string `json:"token,omitempty"`
+	ExpiresAt      int64  `json:"expires_at"`
+	MFARequired    bool   `json:"mfa_required,omitempty"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
 }
 
 // UserWithProfile represents a user with their profile information
@@ -102,22 +127,61 @@ type UserWithProfile struct {
 	Profile Profile `json:"profile"`
 }
 
+// UserQuery filters, sorts and paginates the user list
+type UserQuery struct {
+	Status        *int       `form:"status" binding:"omitempty,oneof=0 1 2"`
+	Role          string     `form:"role"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Search        string     `form:"q" binding:"max=100"` // Prefix search on username, email and nickname
+	Sort          string     `form:"sort"`                // One of id, username, email, created_at or updated_at, prefixed with - for descending order
+	Limit         int        `form:"limit" binding:"omitempty,min=1"`
+	Page          int        `form:"page" binding:"omitempty,min=1"` // Offset pagination, ignored when Cursor is set
+	Cursor        string     `form:"cursor"`
+	WithTotal     bool       `form:"total"`
+	Deleted       bool       `form:"deleted"` // List soft deleted users instead
+}
+
+// UserList is a page of users
+type UserList struct {
+	Items      []*User    `json:"items"`
+	Pagination Pagination `json:"pagination"`
+}
+
 // UserRepo defines the interface for user repository operations
 type UserRepo interface {
 	Create(ctx context.Context, user *User) error
 	GetByID(ctx context.Context, id int64) (*User, error)
+	// GetByIDs retrieves the users with the given IDs, IDs without a user are left out
+	GetByIDs(ctx context.Context, ids []int64) ([]*User, error)
 	GetByUsername(ctx context.Context, username string) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	Update(ctx context.Context, user *User) error
-	Delete(ctx context.Context, id int64) error
-	List(ctx context.Context, offset, limit int) ([]*User, error)
-	Count(ctx context.Context) (int, error)
+	// Delete soft deletes a user, which is then hidden from all other methods except
+	// GetDeletedByID. Released identifiers can be taken by other users right away.
+	Delete(ctx context.Context, id int64, releaseIdentifiers bool) error
+	GetDeletedByID(ctx context.Context, id int64) (*User, error)
+	// IsUsernameTaken and IsEmailTaken include deleted users holding the identifier
+	IsUsernameTaken(ctx context.Context, username string) (bool, error)
+	IsEmailTaken(ctx context.Context, email string) (bool, error)
+	Restore(ctx context.Context, user *User) error
+	ListDeletedIDs(ctx context.Context, before time.Time, limit int) ([]int64, error)
+	// Purge permanently deletes a soft deleted user and all rows belonging to it
+	Purge(ctx context.Context, id int64) error
+	// List returns the users matching the query and the cursor of the following page,
+	// which is empty on the last page
+	List(ctx context.Context, query *UserQuery) ([]*User, string, error)
+	// Count returns the number of users matching the filters of the query
+	Count(ctx context.Context, query *UserQuery) (int, error)
 }
 
 // ProfileRepo defines the interface for user profile repository operations
 type ProfileRepo interface {
 	Create(ctx context.Context, profile *Profile) error
 	GetByUserID(ctx context.Context, userID int64) (*Profile, error)
+	// GetByUserIDs retrieves the profiles of the given users, users without one are left out
+	GetByUserIDs(ctx context.Context, userIDs []int64) ([]*Profile, error)
+	GetDeletedByUserID(ctx context.Context, userID int64) (*Profile, error)
 	Update(ctx context.Context, profile *Profile) error
 	Delete(ctx context.Context, id int64) error
 }
@@ -133,18 +197,51 @@ type RoleRepo interface {
 	AddRoleToUser(ctx context.Context, userID, roleID int64) error
 	RemoveRoleFromUser(ctx context.Context, userID, roleID int64) error
 	GetUserRoles(ctx context.Context, userID int64) ([]*Role, error)
+	// GetRolesByUserIDs retrieves the roles of the given users by user ID
+	GetRolesByUserIDs(ctx context.Context, userIDs []int64) (map[int64][]*Role, error)
+}
+
+// ProfileService defines the interface for user profile business logic
+type ProfileService interface {
+	// GetProfile returns the profile of a user, creating an empty one if missing
+	GetProfile(ctx context.Context, userID int64) (*Profile, error)
+	// GetProfiles returns the profiles of existing users by user ID, creating missing ones
+	GetProfiles(ctx context.Context, userIDs []int64) (map[int64]*Profile, error)
+	// UpdateProfile and PatchProfile fail with ErrPreconditionFailed unless version is zero
+	// or matches the current profile version
+	UpdateProfile(ctx context.Context, userID, version int64, req *ProfileRequest) (*Profile, error)
+	// PatchProfile applies a patch to the ProfileRequest representation of the profile
+	PatchProfile(ctx context.Context, userID, version int64, patch *Patch) (*Profile, error)
+	// UploadAvatar validates and resizes an image and stores it with its thumbnails
+	UploadAvatar(ctx context.Context, userID int64, data []byte) (*Profile, error)
+	DeleteAvatar(ctx context.Context, userID int64) (*Profile, error)
+	// PurgeProfile permanently deletes the profile of a deleted user and releases its avatar
+	PurgeProfile(ctx context.Context, userID int64) error
 }
 
 type UserService interface {
 	Register(ctx context.Context, req *UserRequest) (*User, error)
 	GetUserByID(ctx context.Context, id int64) (*User, error)
-	UpdateUser(ctx context.Context, id int64, req *UserRequest) error
-	DeleteUser(ctx context.Context, id int64) error
-	ListUsers(ctx context.Context, page, pageSize int) ([]*User, int, error)
+	// UpdateUser, PatchUser and DeleteUser fail with ErrPreconditionFailed unless version
+	// is zero or matches the current user version
+	UpdateUser(ctx context.Context, id, version int64, req *UserRequest) (*User, error)
+	// PatchUser applies a patch to the UserDocument of a user, checking the principal may change each modified field
+	PatchUser(ctx context.Context, principal *Principal, id, version int64, patch *Patch) (*UserWithRoles, error)
+	// DeleteUser soft deletes a user, it can be restored until it is purged
+	DeleteUser(ctx context.Context, id, version int64) error
+	RestoreUser(ctx context.Context, id int64) (*User, error)
+	// PurgeDeletedUsers permanently deletes users deleted before the given time and
+	// returns their number
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int, error)
+	ListUsers(ctx context.Context, query *UserQuery) (*UserList, error)
 
 	Login(ctx context.Context, req *LoginRequest) (*TokenResponse, error)
 	ValidateToken(ctx context.Context, token string) (int64, error)
 
 	GetUserWithProfile(ctx context.Context, id int64) (*UserWithProfile, error)
 	GetUserWithRoles(ctx context.Context, id int64) (*UserWithRoles, error)
+	// GetUsersByIDs and GetRolesByUserIDs load many users at once, users that do not exist
+	// are left out
+	GetUsersByIDs(ctx context.Context, ids []int64) ([]*User, error)
+	GetRolesByUserIDs(ctx context.Context, ids []int64) (map[int64][]*Role, error)
 }
@@ -0,0 +1,157 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"   // Waiting for its first or next attempt
+	WebhookDeliverySucceeded = "succeeded" // The receiver answered with a 2xx status
+	WebhookDeliveryDead      = "dead"      // Given up after the last attempt, can be redelivered manually
+)
+
+// Headers of webhook requests
+const (
+	WebhookHeaderID        = "X-Webhook-Id"        // ID of the event, the same for every delivery of it
+	WebhookHeaderEvent     = "X-Webhook-Event"     // Name of the event
+	WebhookHeaderDelivery  = "X-Webhook-Delivery"  // ID of the delivery
+	WebhookHeaderTimestamp = "X-Webhook-Timestamp" // Unix time of the attempt, part of the signed content
+	WebhookHeaderSignature = "X-Webhook-Signature" // "v1=" and the hex HMAC-SHA256 of "<timestamp>.<body>"
+)
+
+// Webhook is a subscription of a partner system to domain events, delivered as signed
+// HTTP POST requests to its URL
+type Webhook struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"` // Inactive webhooks receive no new deliveries and pending ones wait
+	Secret      string    `json:"-"`      // Signing secret, shown only when the webhook is created
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Receives reports whether the webhook is subscribed to an event
+func (w *Webhook) Receives(name string) bool {
+	return slices.Contains(w.Events, name)
+}
+
+// WebhookRequest represents the request for creating a webhook
+type WebhookRequest struct {
+	URL         string   `json:"url" binding:"required,url,max=2048"`
+	Description string   `json:"description" binding:"max=255"`
+	Events      []string `json:"events" binding:"required,min=1"`
+}
+
+// WebhookUpdateRequest represents the request for updating a webhook
+type WebhookUpdateRequest struct {
+	WebhookRequest
+	Active bool `json:"active"`
+}
+
+// WebhookResponse represents a newly created webhook. The secret is shown only once.
+type WebhookResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookPayload is the body of a webhook request
+type WebhookPayload struct {
+	ID        string          `json:"id"` // ID of the event, receivers can use it to ignore repeated deliveries
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+// WebhookDelivery is the delivery of an event to a webhook, attempted until the receiver
+// accepts it or the last attempt has failed
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     int64           `json:"webhook_id"`
+	EventID       string          `json:"event_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload" swaggertype:"object"` // Body of the requests
+	Status        string          `json:"status" enums:"pending,succeeded,dead"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code"` // Status of the last response, zero when none was received
+	NextAttemptAt *time.Time      `json:"next_attempt_at" extensions:"x-nullable"`
+	Redelivery    bool            `json:"redelivery"` // Created by a manual redelivery
+	CreatedAt     time.Time       `json:"created_at"`
+	CompletedAt   *time.Time      `json:"completed_at" extensions:"x-nullable"` // When it succeeded or was given up
+
+	AttemptLog []*WebhookAttempt `json:"attempt_log,omitempty"` // Only returned for a single delivery
+}
+
+// WebhookAttempt records one request of a delivery
+type WebhookAttempt struct {
+	ID           int64     `json:"id"`
+	DeliveryID   int64     `json:"delivery_id"`
+	ResponseCode int       `json:"response_code"` // Zero when no response was received
+	ResponseBody string    `json:"response_body"` // Beginning of the response body
+	Error        string    `json:"error"`         // Why the attempt failed
+	Duration     int64     `json:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// WebhookDeliveryQuery filters the deliveries of a webhook, newest first
+type WebhookDeliveryQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending succeeded dead"`
+	Event  string `form:"event"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1"`
+	Cursor string `form:"cursor"`
+}
+
+// WebhookDeliveryList is a page of webhook deliveries
+type WebhookDeliveryList struct {
+	Items      []*WebhookDelivery `json:"items"`
+	Pagination Pagination         `json:"pagination"`
+}
+
+// WebhookRepo defines the interface for webhook repository operations
+type WebhookRepo interface {
+	Create(ctx context.Context, webhook *Webhook) error
+	GetByID(ctx context.Context, id int64) (*Webhook, error)
+	Update(ctx context.Context, webhook *Webhook) error
+	// Delete removes a webhook with its deliveries
+	Delete(ctx context.Context, id int64) error
+	List(ctx context.Context) ([]*Webhook, error)
+	// ListActive returns the webhooks subscribed to an event that are active
+	ListActive(ctx context.Context, event string) ([]*Webhook, error)
+
+	// CreateDelivery stores a delivery. It reports false, without storing it, when the
+	// webhook already has a delivery of the event that is not a redelivery.
+	CreateDelivery(ctx context.Context, delivery *WebhookDelivery) (bool, error)
+	GetDelivery(ctx context.Context, webhookID, id int64) (*WebhookDelivery, error)
+	// ListDeliveries returns deliveries matching the query ordered by descending ID,
+	// starting below beforeID unless it is zero
+	ListDeliveries(ctx context.Context, webhookID int64, query *WebhookDeliveryQuery, beforeID int64, limit int) ([]*WebhookDelivery, error)
+	// ListDue returns pending deliveries of active webhooks whose next attempt is due, oldest first
+	ListDue(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error)
+	// RecordAttempt stores an attempt with the resulting state of its delivery
+	RecordAttempt(ctx context.Context, delivery *WebhookDelivery, attempt *WebhookAttempt) error
+	ListAttempts(ctx context.Context, deliveryID int64) ([]*WebhookAttempt, error)
+	// DeleteCompleted removes deliveries completed before the given time with their attempts
+	DeleteCompleted(ctx context.Context, before time.Time) (int64, error)
+}
+
+// WebhookService defines the interface for webhook management
+type WebhookService interface {
+	Create(ctx context.Context, req *WebhookRequest) (*WebhookResponse, error)
+	Get(ctx context.Context, id int64) (*Webhook, error)
+	List(ctx context.Context) ([]*Webhook, error)
+	Update(ctx context.Context, id int64, req *WebhookUpdateRequest) (*Webhook, error)
+	Delete(ctx context.Context, id int64) error
+
+	ListDeliveries(ctx context.Context, webhookID int64, query *WebhookDeliveryQuery) (*WebhookDeliveryList, error)
+	GetDelivery(ctx context.Context, webhookID, id int64) (*WebhookDelivery, error)
+	// Redeliver sends the event of a delivery again as a new delivery
+	Redeliver(ctx context.Context, webhookID, id int64) (*WebhookDelivery, error)
+
+	// Enqueue creates deliveries of an event to the active webhooks subscribed to it
+	Enqueue(ctx context.Context, event Event) error
+}
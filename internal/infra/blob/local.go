@@ -0,0 +1,151 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+// localStore stores blobs as files below a directory. Blobs are downloaded
+// through the /blobs route of the application with signed, expiring URLs.
+type localStore struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocalStore creates a blob store writing to dir. Download URLs are signed with secret.
+func NewLocalStore(dir, baseURL string, secret []byte) (domain.BlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &localStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}, nil
+}
+
+// Put writes the blob to a temporary file and moves it into place, so readers
+// never see partially written content
+func (s *localStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// Open opens the blob file
+func (s *localStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, domain.ErrBlobNotFound
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, domain.ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// Delete removes the blob file, deleting a missing blob is not an error
+func (s *localStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// URL returns a signed download URL served by the application
+func (s *localStore) URL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {s.sign(key, expires)},
+	}
+	return s.baseURL + "/blobs/" + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+// VerifyURL checks that a download URL was signed by this store and has not expired
+func (s *localStore) VerifyURL(key, expires, signature string) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return domain.ErrInvalidBlobURL
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(key, expires))) {
+		return domain.ErrInvalidBlobURL
+	}
+	return nil
+}
+
+// sign computes the URL signature of a key and expiry time
+func (s *localStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// path maps a key to a file below the store directory
+func (s *localStore) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// randomSecret generates a URL signing secret
+func randomSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate blob URL secret: %w", err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,120 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Options configures a store backed by an S3-compatible service
+type S3Options struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+	PathStyle       bool
+}
+
+// s3Store stores blobs as objects in a bucket. Downloads use presigned URLs
+// pointing to the storage service.
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Store creates a blob store for an S3-compatible service such as AWS S3 or MinIO
+func NewS3Store(opts S3Options) (domain.BlobStore, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("BLOB_S3_BUCKET is required for the s3 blob store")
+	}
+
+	lookup := minio.BucketLookupAuto
+	if opts.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(opts.AccessKeyID, opts.SecretAccessKey, ""),
+		Secure:       opts.UseSSL,
+		Region:       opts.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return &s3Store{
+		client: client,
+		bucket: opts.Bucket,
+	}, nil
+}
+
+// Put uploads the blob as an object
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// Open downloads the object
+func (s *s3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, domain.ErrBlobNotFound
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	// GetObject is lazy, Stat performs the request so missing objects are reported here
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s.mapError(err)
+	}
+	return object, nil
+}
+
+// Delete removes the object, deleting a missing object is not an error
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// URL returns a presigned download URL
+func (s *s3Store) URL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	presigned, err := s.client.PresignedGetObject(ctx, s.bucket, key, ttl, nil)
+	if err != nil {
+		return "", err
+	}
+	return presigned.String(), nil
+}
+
+// mapError translates missing objects to ErrBlobNotFound
+func (s *s3Store) mapError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return domain.ErrBlobNotFound
+	}
+	return err
+}
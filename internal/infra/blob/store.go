@@ -0,0 +1,72 @@
+package blob
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewBlobStore),
+	)
+}
+
+// Blob store driver names
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+// BlobStoreParams represents the parameters required for blob store initialization
+type BlobStoreParams struct {
+	fx.In
+
+	Config *config.Config
+}
+
+// NewBlobStore creates the blob store selected by BLOB_DRIVER
+func NewBlobStore(p BlobStoreParams) (domain.BlobStore, error) {
+	cfg := p.Config.Blob
+	zap.S().Infow("Using blob store driver", "driver", cfg.Driver)
+
+	switch cfg.Driver {
+	case DriverLocal:
+		secret := []byte(cfg.URLSecret)
+		if len(secret) == 0 {
+			zap.S().Warn("BLOB_URL_SECRET is not set, download URLs are only valid until the server restarts")
+			var err error
+			if secret, err = randomSecret(); err != nil {
+				return nil, err
+			}
+		}
+		return NewLocalStore(cfg.LocalDir, cfg.BaseURL, secret)
+	case DriverS3:
+		return NewS3Store(S3Options{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			UseSSL:          cfg.S3UseSSL,
+			PathStyle:       cfg.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob store driver: %s", cfg.Driver)
+	}
+}
+
+// cleanKey normalizes a blob key and rejects keys escaping the store root
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("invalid blob key: %q", key)
+	}
+	return cleaned, nil
+}
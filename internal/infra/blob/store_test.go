@@ -0,0 +1,368 @@
+package blob_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/infra/blob"
+	"github.com/luxixing/fx-gin/internal/infra/db"
+	"github.com/luxixing/fx-gin/internal/repo"
+	"github.com/luxixing/fx-gin/internal/service"
+)
+
+// blobBackend is a store under test together with a way to download its URLs
+type blobBackend struct {
+	name     string
+	newStore func(t *testing.T) domain.BlobStore
+	// download fetches the content behind a download URL as a client would
+	download func(store domain.BlobStore, rawURL string) ([]byte, error)
+}
+
+var blobBackends = []blobBackend{
+	{
+		name: "local",
+		newStore: func(t *testing.T) domain.BlobStore {
+			store, err := blob.NewLocalStore(t.TempDir(), "http://localhost:38080", []byte("url-secret"))
+			if err != nil {
+				t.Fatalf("create local store: %v", err)
+			}
+			return store
+		},
+		download: func(store domain.BlobStore, rawURL string) ([]byte, error) {
+			// The /blobs route verifies the URL and opens the blob
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				return nil, err
+			}
+			key := strings.TrimPrefix(u.Path, "/blobs/")
+			if err := store.(domain.BlobURLVerifier).VerifyURL(key, u.Query().Get("expires"), u.Query().Get("signature")); err != nil {
+				return nil, err
+			}
+			content, err := store.Open(context.Background(), key)
+			if err != nil {
+				return nil, err
+			}
+			defer content.Close()
+			return io.ReadAll(content)
+		},
+	},
+	{
+		name: "s3",
+		newStore: func(t *testing.T) domain.BlobStore {
+			fake := newFakeS3(t)
+			store, err := blob.NewS3Store(blob.S3Options{
+				Endpoint:        strings.TrimPrefix(fake.URL, "http://"),
+				Region:          "us-east-1",
+				Bucket:          "blobs",
+				AccessKeyID:     "access-key",
+				SecretAccessKey: "secret-key",
+				PathStyle:       true,
+			})
+			if err != nil {
+				t.Fatalf("create s3 store: %v", err)
+			}
+			return store
+		},
+		download: func(store domain.BlobStore, rawURL string) ([]byte, error) {
+			resp, err := http.Get(rawURL)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("download: %s", resp.Status)
+			}
+			return io.ReadAll(resp.Body)
+		},
+	},
+}
+
+func TestBlobStore(t *testing.T) {
+	for _, backend := range blobBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Run("put, open and delete", func(t *testing.T) {
+				testPutOpenDelete(t, backend.newStore(t))
+			})
+			t.Run("invalid keys", func(t *testing.T) {
+				testInvalidKeys(t, backend.newStore(t))
+			})
+			t.Run("download URLs", func(t *testing.T) {
+				testDownloadURLs(t, backend, backend.newStore(t))
+			})
+			t.Run("shared content", func(t *testing.T) {
+				testSharedContent(t, backend.newStore(t))
+			})
+		})
+	}
+}
+
+func testPutOpenDelete(t *testing.T, store domain.BlobStore) {
+	ctx := context.Background()
+
+	if _, err := store.Open(ctx, "avatars/missing"); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("open missing blob: err = %v, want %v", err, domain.ErrBlobNotFound)
+	}
+
+	for _, content := range []string{"first", "second version"} {
+		if err := store.Put(ctx, "avatars/ab/abc", strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+		if got := readBlob(t, store, "avatars/ab/abc"); got != content {
+			t.Errorf("content = %q, want %q", got, content)
+		}
+	}
+
+	if err := store.Delete(ctx, "avatars/ab/abc"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := store.Open(ctx, "avatars/ab/abc"); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("open deleted blob: err = %v, want %v", err, domain.ErrBlobNotFound)
+	}
+	if err := store.Delete(ctx, "avatars/ab/abc"); err != nil {
+		t.Errorf("delete missing blob: %v", err)
+	}
+}
+
+func testInvalidKeys(t *testing.T, store domain.BlobStore) {
+	ctx := context.Background()
+
+	for _, key := range []string{"", "../escape", "avatars/../../escape", "avatars//double", "avatars/"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("put %q: key was accepted", key)
+		}
+		if _, err := store.URL(ctx, key, time.Minute); err == nil {
+			t.Errorf("url %q: key was accepted", key)
+		}
+	}
+}
+
+func testDownloadURLs(t *testing.T, backend blobBackend, store domain.BlobStore) {
+	ctx := context.Background()
+	if err := store.Put(ctx, "avatars/ab/abc", strings.NewReader("content"), 7, "text/plain"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	valid, err := store.URL(ctx, "avatars/ab/abc", time.Minute)
+	if err != nil {
+		t.Fatalf("url: %v", err)
+	}
+	if content, err := backend.download(store, valid); err != nil || string(content) != "content" {
+		t.Errorf("download = %q, %v, want the content", content, err)
+	}
+
+	// S3 presigned URLs last at least a second
+	expiring, err := store.URL(ctx, "avatars/ab/abc", time.Second)
+	if err != nil {
+		t.Fatalf("url: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+	if _, err := backend.download(store, expiring); err == nil {
+		t.Errorf("expired URL was accepted")
+	}
+}
+
+func testSharedContent(t *testing.T, store domain.BlobStore) {
+	ctx := context.Background()
+	database, err := sql.Open("sqlite3", db.DataSourceName(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.RunMigrations(db.MigrationConfig{DB: database}); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+	s := service.NewBlobService(service.BlobServiceParams{
+		Config:    &config.Config{Blob: &config.BlobConfig{URLTTL: time.Minute}},
+		BlobRepo:  repo.NewBlobRepo(repo.BlobRepoParams{DB: database}),
+		BlobStore: store,
+	})
+
+	first, err := s.Save(ctx, "avatars", strings.NewReader("same"), "text/plain")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	second, err := s.Save(ctx, "avatars", strings.NewReader("same"), "text/plain")
+	if err != nil {
+		t.Fatalf("save again: %v", err)
+	}
+	if first.Key != second.Key || second.RefCount != 2 {
+		t.Fatalf("second save = %s with %d references, want %s with 2", second.Key, second.RefCount, first.Key)
+	}
+
+	// Content stays until the last reference is released
+	if err := s.Release(ctx, first.Key); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if got := readBlob(t, store, first.Key); got != "same" {
+		t.Errorf("content after first release = %q, want %q", got, "same")
+	}
+	if err := s.Release(ctx, first.Key); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, err := store.Open(ctx, first.Key); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("open released blob: err = %v, want %v", err, domain.ErrBlobNotFound)
+	}
+	if _, _, err := s.Open(ctx, first.Key); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("open released blob through the service: err = %v, want %v", err, domain.ErrBlobNotFound)
+	}
+}
+
+// readBlob reads the content of a blob
+func readBlob(t *testing.T, store domain.BlobStore, key string) string {
+	t.Helper()
+
+	content, err := store.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("open %s: %v", key, err)
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return string(data)
+}
+
+// fakeS3 serves the object operations of a path-style S3 bucket from memory. Signatures
+// are not checked, but presigned URLs expire.
+type fakeS3 struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+// fakeObject is a stored object
+type fakeObject struct {
+	content     []byte
+	contentType string
+	modified    time.Time
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+
+	fake := &fakeS3{objects: make(map[string]fakeObject)}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(name, "/") {
+		s3Error(w, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		content, err := readPayload(r)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[name] = fakeObject{content: content, contentType: r.Header.Get("Content-Type"), modified: time.Now()}
+		w.Header().Set("ETag", etag(content))
+	case http.MethodGet, http.MethodHead:
+		if expired(r.URL.Query()) {
+			s3Error(w, http.StatusForbidden, "AccessDenied")
+			return
+		}
+		object, ok := f.objects[name]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.content)))
+		w.Header().Set("ETag", etag(object.content))
+		w.Header().Set("Last-Modified", object.modified.UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(object.content)
+		}
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// readPayload reads an upload, decoding the aws-chunked encoding clients use without TLS
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var content bytes.Buffer
+	body := bufio.NewReader(r.Body)
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return content.Bytes(), nil
+		}
+		if _, err := io.CopyN(&content, body, size); err != nil {
+			return nil, err
+		}
+		if _, err := body.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// expired reports whether a presigned URL has expired
+func expired(query url.Values) bool {
+	if query.Get("X-Amz-Date") == "" {
+		return false
+	}
+	signedAt, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return true
+	}
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return true
+	}
+	return time.Now().After(signedAt.Add(time.Duration(seconds) * time.Second))
+}
+
+func etag(content []byte) string {
+	sum := md5.Sum(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
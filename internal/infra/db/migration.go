@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 
 	"go.uber.org/zap"
 )
@@ -25,6 +26,7 @@ func RunMigrations(cfg MigrationConfig) error {
 			email TEXT NOT NULL UNIQUE,
 			password TEXT NOT NULL,
 			status INTEGER DEFAULT 1,
+			email_verified_at TIMESTAMP,
 			created_at TIMESTAMP NOT NULL,
 			updated_at TIMESTAMP NOT NULL
 		)
@@ -33,6 +35,27 @@ func RunMigrations(cfg MigrationConfig) error {
 		zap.S().Error("Failed to create users table", "error", err)
 		return err
 	}
+	if err = addColumnIfNotExists(db, "users", "email_verified_at", "TIMESTAMP"); err != nil {
+		zap.S().Errorw("Failed to add users.email_verified_at column", "error", err)
+		return err
+	}
+	if err = addColumnIfNotExists(db, "users", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		zap.S().Errorw("Failed to add users.version column", "error", err)
+		return err
+	}
+	if err = addColumnIfNotExists(db, "users", "deleted_at", "TIMESTAMP"); err != nil {
+		zap.S().Errorw("Failed to add users.deleted_at column", "error", err)
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+		CREATE INDEX IF NOT EXISTS idx_users_status ON users (status);
+		CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create users indexes", "error", err)
+		return err
+	}
 
 	// User profiles table
 	_, err = db.Exec(`
@@ -54,6 +77,22 @@ func RunMigrations(cfg MigrationConfig) error {
 		zap.S().Error("Failed to create profiles table", "error", err)
 		return err
 	}
+	if err = addColumnIfNotExists(db, "profiles", "locale", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		zap.S().Errorw("Failed to add profiles.locale column", "error", err)
+		return err
+	}
+	if err = addColumnIfNotExists(db, "profiles", "avatar_thumbnails", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		zap.S().Errorw("Failed to add profiles.avatar_thumbnails column", "error", err)
+		return err
+	}
+	if err = addColumnIfNotExists(db, "profiles", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		zap.S().Errorw("Failed to add profiles.version column", "error", err)
+		return err
+	}
+	if err = addColumnIfNotExists(db, "profiles", "deleted_at", "TIMESTAMP"); err != nil {
+		zap.S().Errorw("Failed to add profiles.deleted_at column", "error", err)
+		return err
+	}
 
 	// Roles table
 	_, err = db.Exec(`
@@ -69,6 +108,10 @@ func RunMigrations(cfg MigrationConfig) error {
 		zap.S().Error("Failed to create roles table", "error", err)
 		return err
 	}
+	if err = addColumnIfNotExists(db, "roles", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		zap.S().Errorw("Failed to add roles.version column", "error", err)
+		return err
+	}
 
 	// User roles association table
 	_, err = db.Exec(`
@@ -86,6 +129,372 @@ func RunMigrations(cfg MigrationConfig) error {
 		return err
 	}
 
+	// User MFA table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_mfa (
+			user_id INTEGER PRIMARY KEY,
+			secret TEXT NOT NULL,
+			enabled INTEGER NOT NULL DEFAULT 0,
+			last_used_step INTEGER NOT NULL DEFAULT 0,
+			confirmed_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create user_mfa table", "error", err)
+		return err
+	}
+
+	// MFA recovery codes table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			code_hash TEXT NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create mfa_recovery_codes table", "error", err)
+		return err
+	}
+
+	// MFA login challenges table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS mfa_challenges (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create mfa_challenges table", "error", err)
+		return err
+	}
+
+	// One-time user tokens (email verification, password reset)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			purpose TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create user_tokens table", "error", err)
+		return err
+	}
+	if err = addColumnIfNotExists(db, "user_tokens", "email", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		zap.S().Errorw("Failed to add user_tokens.email column", "error", err)
+		return err
+	}
+
+	// API keys table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL UNIQUE,
+			key_hash TEXT NOT NULL,
+			user_id INTEGER,
+			service_account TEXT NOT NULL DEFAULT '',
+			scopes TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMP,
+			last_used_at TIMESTAMP,
+			last_used_ip TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create api_keys table", "error", err)
+		return err
+	}
+
+	// OAuth2 clients table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_clients (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			client_id TEXT NOT NULL UNIQUE,
+			secret_hash TEXT NOT NULL DEFAULT '',
+			name TEXT NOT NULL,
+			redirect_uris TEXT NOT NULL DEFAULT '',
+			grant_types TEXT NOT NULL DEFAULT '',
+			scopes TEXT NOT NULL DEFAULT '',
+			confidential INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create oauth_clients table", "error", err)
+		return err
+	}
+
+	// OAuth2 authorization codes table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code_hash TEXT NOT NULL UNIQUE,
+			client_id TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			redirect_uri TEXT NOT NULL DEFAULT '',
+			scope TEXT NOT NULL DEFAULT '',
+			code_challenge TEXT NOT NULL DEFAULT '',
+			code_challenge_method TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (client_id) REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create oauth_authorization_codes table", "error", err)
+		return err
+	}
+
+	// OAuth2 refresh tokens table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_refresh_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token_hash TEXT NOT NULL UNIQUE,
+			client_id TEXT NOT NULL,
+			user_id INTEGER NOT NULL DEFAULT 0,
+			scope TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (client_id) REFERENCES oauth_clients(client_id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create oauth_refresh_tokens table", "error", err)
+		return err
+	}
+
+	// OAuth2 consents table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_consents (
+			user_id INTEGER NOT NULL,
+			client_id TEXT NOT NULL,
+			scope TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, client_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (client_id) REFERENCES oauth_clients(client_id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create oauth_consents table", "error", err)
+		return err
+	}
+
+	// OAuth2 revoked access tokens table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_revoked_tokens (
+			jti TEXT PRIMARY KEY,
+			expires_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create oauth_revoked_tokens table", "error", err)
+		return err
+	}
+
+	// External identities linked to users (OIDC login)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT NOT NULL DEFAULT '',
+			last_login_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			UNIQUE (provider, subject),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create user_identities table", "error", err)
+		return err
+	}
+
+	// Pending OIDC logins (state, nonce and PKCE verifier)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oidc_login_states (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			state_hash TEXT NOT NULL UNIQUE,
+			provider TEXT NOT NULL,
+			nonce TEXT NOT NULL,
+			code_verifier TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create oidc_login_states table", "error", err)
+		return err
+	}
+
+	// Stored blobs, deduplicated by content hash
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS blobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			blob_key TEXT NOT NULL UNIQUE,
+			sha256 TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			content_type TEXT NOT NULL,
+			ref_count INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create blobs table", "error", err)
+		return err
+	}
+
+	// Audit log, every event stores the hash of the previous one
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor_id INTEGER NOT NULL DEFAULT 0,
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			changes TEXT NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT '',
+			client_ip TEXT NOT NULL DEFAULT '',
+			request_id TEXT NOT NULL DEFAULT '',
+			prev_hash TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events (actor_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events (target_type, target_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create audit_events table", "error", err)
+		return err
+	}
+	// Every event has its own successor, so two events chained to the same predecessor
+	// (a fork of the chain) cannot be stored
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_events_prev_hash ON audit_events (prev_hash)`)
+	if err != nil {
+		zap.S().Errorw("Failed to create unique index of audit_events.prev_hash, the hash chain has forked", "error", err)
+		return fmt.Errorf("audit log hash chain has forked: %w", err)
+	}
+
+	// Outbox of domain events, written in the transaction of the change they describe
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS event_outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			actor_id INTEGER NOT NULL DEFAULT 0,
+			request_id TEXT NOT NULL DEFAULT '',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			published_at TIMESTAMP,
+			failed_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_event_outbox_pending ON event_outbox (next_attempt_at) WHERE published_at IS NULL AND failed_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_event_outbox_published_at ON event_outbox (published_at)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create event_outbox table", "error", err)
+		return err
+	}
+	if err = addColumnIfNotExists(db, "event_outbox", "handled_by", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		zap.S().Errorw("Failed to add event_outbox.handled_by column", "error", err)
+		return err
+	}
+
+	// Webhook subscriptions of partner systems
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			url TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			events TEXT NOT NULL DEFAULT '',
+			active INTEGER NOT NULL DEFAULT 1,
+			secret TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create webhooks table", "error", err)
+		return err
+	}
+
+	// Deliveries of events to webhooks and their attempts
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id INTEGER NOT NULL,
+			event_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_code INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP,
+			redelivery INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL,
+			completed_at TIMESTAMP,
+			FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_completed_at ON webhook_deliveries (completed_at);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id) WHERE redelivery = 0;
+		CREATE TABLE IF NOT EXISTS webhook_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			delivery_id INTEGER NOT NULL,
+			response_code INTEGER NOT NULL DEFAULT 0,
+			response_body TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_attempts_delivery_id ON webhook_attempts (delivery_id)
+	`)
+	if err != nil {
+		zap.S().Errorw("Failed to create webhook_deliveries table", "error", err)
+		return err
+	}
+
+	// scaffold:migrations
+
+	// Full-text index for user search, optional as FTS5 depends on how SQLite was built
+	if err = createUserSearchIndex(db); err != nil {
+		zap.S().Warnw("Full-text search is not available, user search falls back to LIKE", "error", err)
+	}
+
 	// Initialize default roles
 	_, err = db.Exec(`
 		INSERT OR IGNORE INTO roles (name, description, created_at, updated_at)
@@ -100,3 +509,66 @@ func RunMigrations(cfg MigrationConfig) error {
 	zap.S().Info("Database migration completed")
 	return nil
 }
+
+// addColumnIfNotExists adds a column to an existing table, used to upgrade databases
+// created before the column was introduced
+func addColumnIfNotExists(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// createUserSearchIndex creates the users_fts FTS5 table over username, email and
+// profile nickname, the triggers keeping it in sync and indexes existing users
+func createUserSearchIndex(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5 (username, email, nickname);
+
+		CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+			INSERT INTO users_fts (rowid, username, email, nickname) VALUES (new.id, new.username, new.email, '');
+		END;
+		CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE OF username, email ON users BEGIN
+			UPDATE users_fts SET username = new.username, email = new.email WHERE rowid = new.id;
+		END;
+		CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+			DELETE FROM users_fts WHERE rowid = old.id;
+		END;
+		CREATE TRIGGER IF NOT EXISTS users_fts_profile_insert AFTER INSERT ON profiles BEGIN
+			UPDATE users_fts SET nickname = COALESCE(new.nickname, '') WHERE rowid = new.user_id;
+		END;
+		CREATE TRIGGER IF NOT EXISTS users_fts_profile_update AFTER UPDATE OF nickname ON profiles BEGIN
+			UPDATE users_fts SET nickname = COALESCE(new.nickname, '') WHERE rowid = new.user_id;
+		END;
+
+		INSERT INTO users_fts (rowid, username, email, nickname)
+		SELECT u.id, u.username, u.email, COALESCE((SELECT nickname FROM profiles WHERE user_id = u.id LIMIT 1), '')
+		FROM users u
+		WHERE u.id NOT IN (SELECT rowid FROM users_fts);
+	`)
+	return err
+}
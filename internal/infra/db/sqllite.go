@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"strings"
 	"sync"
 
 	"github.com/luxixing/fx-gin/internal/config"
@@ -33,7 +34,7 @@ type SQLiteConnectionParams struct {
 func NewSQLiteConnection(p SQLiteConnectionParams) (*sql.DB, error) {
 	var err error
 	sqliteOnce.Do(func() {
-		sqliteDBInstance, err = sql.Open("sqlite3", p.Config.Database.Database)
+		sqliteDBInstance, err = sql.Open("sqlite3", DataSourceName(p.Config.Database.Database))
 		if err != nil {
 			zap.S().Fatalw("failed to open SQLite database", "error", err)
 			return
@@ -56,3 +57,17 @@ func NewSQLiteConnection(p SQLiteConnectionParams) (*sql.DB, error) {
 
 	return sqliteDBInstance, err
 }
+
+// DataSourceName returns the data source name of a database file. Transactions take the
+// write lock when they begin (BEGIN IMMEDIATE), so a transaction that reads and then
+// writes, like appending to the audit hash chain, cannot interleave with one of another
+// connection or process. Lock modes set in the file name are kept.
+func DataSourceName(database string) string {
+	if strings.Contains(database, "_txlock=") {
+		return database
+	}
+	if strings.Contains(database, "?") {
+		return database + "&_txlock=immediate"
+	}
+	return database + "?_txlock=immediate"
+}
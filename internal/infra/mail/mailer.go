@@ -0,0 +1,87 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/rs/xid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewMailer),
+	)
+}
+
+// Mail driver names
+const (
+	DriverSMTP   = "smtp"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+)
+
+// MailerParams represents the parameters required for mailer initialization
+type MailerParams struct {
+	fx.In
+
+	Config *config.Config
+}
+
+// NewMailer creates the mailer selected by MAIL_DRIVER
+func NewMailer(p MailerParams) (domain.Mailer, error) {
+	cfg := p.Config.Mail
+	zap.S().Infow("Using mail driver", "driver", cfg.Driver)
+
+	switch cfg.Driver {
+	case DriverSMTP:
+		return NewSMTPMailer(cfg), nil
+	case DriverFile:
+		return NewFileOutbox(cfg.From, cfg.OutboxDir)
+	case DriverMemory:
+		return NewMemoryOutbox(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
+
+// buildMessage renders a message in RFC 5322 format
+func buildMessage(from string, msg *domain.MailMessage) []byte {
+	var buf bytes.Buffer
+	boundary := xid.New().String()
+
+	writeHeader := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+	writeHeader("From", from)
+	writeHeader("To", strings.Join(msg.To, ", "))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("Message-ID", fmt.Sprintf("<%s@fx-gin>", xid.New().String()))
+	writeHeader("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		writeHeader("Content-Type", "text/plain; charset=utf-8")
+		buf.WriteString("\r\n")
+		buf.WriteString(msg.Text)
+		return buf.Bytes()
+	}
+
+	writeHeader("Content-Type", "multipart/alternative; boundary="+boundary)
+	buf.WriteString("\r\n")
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(msg.Text + "\r\n")
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	buf.WriteString(msg.HTML + "\r\n")
+	buf.WriteString("--" + boundary + "--\r\n")
+	return buf.Bytes()
+}
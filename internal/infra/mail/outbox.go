@@ -0,0 +1,85 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+// FileOutbox writes each message as an .eml file, for local development
+type FileOutbox struct {
+	from string
+	dir  string
+}
+
+// NewFileOutbox creates a new file outbox, creating the directory if needed
+func NewFileOutbox(from, dir string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+	return &FileOutbox{from: from, dir: dir}, nil
+}
+
+// Send writes the message to the outbox directory
+func (o *FileOutbox) Send(ctx context.Context, msg *domain.MailMessage) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), xid.New().String())
+	path := filepath.Join(o.dir, name)
+
+	if err := os.WriteFile(path, buildMessage(o.from, msg), 0o644); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+
+	zap.S().Infow("Mail written to outbox", "path", path, "to", msg.To, "subject", msg.Subject)
+	return nil
+}
+
+// MemoryOutbox keeps messages in memory, for tests
+type MemoryOutbox struct {
+	mu       sync.Mutex
+	messages []domain.MailMessage
+}
+
+// NewMemoryOutbox creates a new in-memory outbox
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+// Send records the message
+func (o *MemoryOutbox) Send(ctx context.Context, msg *domain.MailMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of all recorded messages
+func (o *MemoryOutbox) Messages() []domain.MailMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]domain.MailMessage(nil), o.messages...)
+}
+
+// Last returns the most recently recorded message, or nil if there is none
+func (o *MemoryOutbox) Last() *domain.MailMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.messages) == 0 {
+		return nil
+	}
+	msg := o.messages[len(o.messages)-1]
+	return &msg
+}
+
+// Reset removes all recorded messages
+func (o *MemoryOutbox) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = nil
+}
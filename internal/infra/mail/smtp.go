@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	cfg *config.MailConfig
+}
+
+// NewSMTPMailer creates a new SMTP mailer
+func NewSMTPMailer(cfg *config.MailConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send delivers the message. STARTTLS is used automatically when the server supports it.
+func (m *SMTPMailer) Send(ctx context.Context, msg *domain.MailMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	if err := smtp.SendMail(addr, auth, from.Address, msg.To, buildMessage(m.cfg.From, msg)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package signing
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewSigner),
+	)
+}
+
+// keySize is the size of generated RSA keys in bits
+const keySize = 2048
+
+// SignerParams represents the parameters required for signer initialization
+type SignerParams struct {
+	fx.In
+
+	Config *config.Config
+}
+
+// rsaSigner signs tokens issued by this server with an RS256 key
+type rsaSigner struct {
+	issuer     string
+	kid        string
+	privateKey *rsa.PrivateKey
+}
+
+// NewSigner loads the signing key from OAUTH_SIGNING_KEY_FILE, generating and
+// saving a new key when the file does not exist
+func NewSigner(p SignerParams) (domain.TokenSigner, error) {
+	path := p.Config.OAuth.SigningKeyFile
+
+	privateKey, err := loadKey(path)
+	if errors.Is(err, os.ErrNotExist) {
+		zap.S().Warnw("Signing key not found, generating a new one", "path", path)
+		privateKey, err = generateKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+
+	return &rsaSigner{
+		issuer:     p.Config.OAuth.Issuer,
+		kid:        base64.RawURLEncoding.EncodeToString(sum[:])[:16],
+		privateKey: privateKey,
+	}, nil
+}
+
+// Sign signs the claims as an RS256 JWT, setting the issuer
+func (s *rsaSigner) Sign(claims map[string]any) (string, error) {
+	mapClaims := jwt.MapClaims(claims)
+	mapClaims["iss"] = s.issuer
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, mapClaims)
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.privateKey)
+}
+
+// Verify checks the signature, issuer and expiry of a token and returns its claims
+func (s *rsaSigner) Verify(tokenString string) (map[string]any, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		if kid, _ := token.Header["kid"].(string); kid != s.kid {
+			return nil, errors.New("unknown signing key")
+		}
+		return &s.privateKey.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set (RFC 7517)
+func (s *rsaSigner) JWKS() map[string]any {
+	pub := s.privateKey.PublicKey
+	return map[string]any{
+		"keys": []map[string]any{
+			{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": jwt.SigningMethodRS256.Alg(),
+				"kid": s.kid,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			},
+		},
+	}
+}
+
+// loadKey reads a PEM encoded RSA private key
+func loadKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("signing key is not an RSA key")
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
+
+// generateKey creates a new RSA key and writes it to path
+func generateKey(path string) (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
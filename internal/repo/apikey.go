@@ -0,0 +1,215 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewAPIKeyRepo),
+	)
+}
+
+// APIKeyRepoParams represents the parameters required for API key repository initialization
+type APIKeyRepoParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// apiKeyRepo implements the API key repository interface
+type apiKeyRepo struct {
+	db *sql.DB
+}
+
+// NewAPIKeyRepo creates a new API key repository instance
+func NewAPIKeyRepo(p APIKeyRepoParams) domain.APIKeyRepo {
+	return &apiKeyRepo{
+		db: p.DB,
+	}
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanAPIKey scans an API key row, decoding the space separated scopes
+func scanAPIKey(row rowScanner) (*domain.APIKey, error) {
+	var key domain.APIKey
+	var scopes string
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.UserID,
+		&key.ServiceAccount,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	return &key, nil
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, user_id, service_account, scopes, expires_at,
+              last_used_at, last_used_ip, created_at, updated_at`
+
+// Create creates a new API key
+func (r *apiKeyRepo) Create(ctx context.Context, key *domain.APIKey) error {
+	now := time.Now()
+	key.CreatedAt = now
+	key.UpdatedAt = now
+
+	query := `INSERT INTO api_keys (name, prefix, key_hash, user_id, service_account, scopes, expires_at, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		key.UserID,
+		key.ServiceAccount,
+		strings.Join(key.Scopes, " "),
+		key.ExpiresAt,
+		key.CreatedAt,
+		key.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	key.ID = id
+	return nil
+}
+
+// GetByID retrieves an API key by ID
+func (r *apiKeyRepo) GetByID(ctx context.Context, id int64) (*domain.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = ?`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GetByPrefix retrieves an API key by its visible prefix
+func (r *apiKeyRepo) GetByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = ?`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, prefix))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Update updates the name, scopes and expiry of an API key
+func (r *apiKeyRepo) Update(ctx context.Context, key *domain.APIKey) error {
+	key.UpdatedAt = time.Now()
+
+	query := `UPDATE api_keys SET name = ?, scopes = ?, expires_at = ?, updated_at = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query,
+		key.Name,
+		strings.Join(key.Scopes, " "),
+		key.ExpiresAt,
+		key.UpdatedAt,
+		key.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete deletes an API key
+func (r *apiKeyRepo) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM api_keys WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListByUser retrieves all API keys owned by a user
+func (r *apiKeyRepo) ListByUser(ctx context.Context, userID int64) ([]*domain.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = ? ORDER BY id DESC`
+
+	return r.list(ctx, query, userID)
+}
+
+// List retrieves all API keys
+func (r *apiKeyRepo) List(ctx context.Context) ([]*domain.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id DESC`
+
+	return r.list(ctx, query)
+}
+
+// TouchLastUsed records when and from where a key was last used
+func (r *apiKeyRepo) TouchLastUsed(ctx context.Context, id int64, at time.Time, ip string) error {
+	query := `UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, at, ip, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepo) list(ctx context.Context, query string, args ...any) ([]*domain.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*domain.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewAuditRepo),
+	)
+}
+
+// AuditRepoParams represents the parameters required for audit repository initialization
+type AuditRepoParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// auditRepo implements the audit repository interface
+type auditRepo struct {
+	db *sql.DB
+}
+
+// NewAuditRepo creates a new audit repository instance
+func NewAuditRepo(p AuditRepoParams) domain.AuditRepo {
+	return &auditRepo{
+		db: p.DB,
+	}
+}
+
+const auditEventColumns = `id, actor_id, action, target_type, target_id, changes, detail, client_ip, request_id,
+              prev_hash, hash, created_at`
+
+// scanAuditEvent scans an audit event row
+func scanAuditEvent(row rowScanner) (*domain.AuditEvent, error) {
+	var event domain.AuditEvent
+	var changes string
+	err := row.Scan(
+		&event.ID,
+		&event.ActorID,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&changes,
+		&event.Detail,
+		&event.ClientIP,
+		&event.RequestID,
+		&event.PrevHash,
+		&event.Hash,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if changes != "" {
+		event.Changes = []byte(changes)
+	}
+	return &event, nil
+}
+
+// Create appends an audit event, CreatedAt and the hashes are set by the caller
+func (r *auditRepo) Create(ctx context.Context, event *domain.AuditEvent) error {
+	query := `INSERT INTO audit_events (actor_id, action, target_type, target_id, changes, detail, client_ip, request_id,
+              prev_hash, hash, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		string(event.Changes),
+		event.Detail,
+		event.ClientIP,
+		event.RequestID,
+		event.PrevHash,
+		event.Hash,
+		event.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	event.ID = id
+	return nil
+}
+
+// Last retrieves the most recent audit event
+func (r *auditRepo) Last(ctx context.Context) (*domain.AuditEvent, error) {
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events ORDER BY id DESC LIMIT 1`
+
+	event, err := scanAuditEvent(conn(ctx, r.db).QueryRowContext(ctx, query))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// List retrieves audit events matching a query, newest first
+func (r *auditRepo) List(ctx context.Context, q *domain.AuditQuery, beforeID int64, limit int) ([]*domain.AuditEvent, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if beforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, beforeID)
+	}
+	if q.ActorID != 0 {
+		where = append(where, "actor_id = ?")
+		args = append(args, q.ActorID)
+	}
+	if q.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, q.Action)
+	}
+	if q.TargetType != "" {
+		where = append(where, "target_type = ?")
+		args = append(args, q.TargetType)
+	}
+	if q.TargetID != "" {
+		where = append(where, "target_id = ?")
+		args = append(args, q.TargetID)
+	}
+	if q.Since != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, *q.Since)
+	}
+	if q.Until != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, *q.Until)
+	}
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	return r.list(ctx, query, args...)
+}
+
+// ListAfter retrieves audit events following afterID in insertion order
+func (r *auditRepo) ListAfter(ctx context.Context, afterID int64, limit int) ([]*domain.AuditEvent, error) {
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE id > ? ORDER BY id LIMIT ?`
+
+	return r.list(ctx, query, afterID, limit)
+}
+
+func (r *auditRepo) list(ctx context.Context, query string, args ...any) ([]*domain.AuditEvent, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewBlobRepo),
+	)
+}
+
+// BlobRepoParams represents the parameters required for blob repository initialization
+type BlobRepoParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// blobRepo implements the blob repository interface
+type blobRepo struct {
+	db *sql.DB
+}
+
+// NewBlobRepo creates a new blob repository instance
+func NewBlobRepo(p BlobRepoParams) domain.BlobRepo {
+	return &blobRepo{
+		db: p.DB,
+	}
+}
+
+const blobColumns = `id, blob_key, sha256, size, content_type, ref_count, created_at, updated_at`
+
+// scanBlob scans a blob row
+func scanBlob(row rowScanner) (*domain.Blob, error) {
+	var blob domain.Blob
+	err := row.Scan(
+		&blob.ID,
+		&blob.Key,
+		&blob.SHA256,
+		&blob.Size,
+		&blob.ContentType,
+		&blob.RefCount,
+		&blob.CreatedAt,
+		&blob.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blob, nil
+}
+
+// GetByKey retrieves a blob by its key
+func (r *blobRepo) GetByKey(ctx context.Context, key string) (*domain.Blob, error) {
+	query := `SELECT ` + blobColumns + ` FROM blobs WHERE blob_key = ?`
+
+	blob, err := scanBlob(r.db.QueryRowContext(ctx, query, key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return blob, nil
+}
+
+// Acquire inserts the blob or increments the reference count of the existing one
+func (r *blobRepo) Acquire(ctx context.Context, blob *domain.Blob) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, `UPDATE blobs SET ref_count = ref_count + 1, updated_at = ? WHERE blob_key = ?`, now, blob.Key)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	created := affected == 0
+	if created {
+		blob.RefCount = 1
+		blob.CreatedAt = now
+		blob.UpdatedAt = now
+
+		query := `INSERT INTO blobs (blob_key, sha256, size, content_type, ref_count, created_at, updated_at)
+                  VALUES (?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query,
+			blob.Key,
+			blob.SHA256,
+			blob.Size,
+			blob.ContentType,
+			blob.RefCount,
+			blob.CreatedAt,
+			blob.UpdatedAt,
+		)
+		if err != nil {
+			return false, err
+		}
+		if blob.ID, err = result.LastInsertId(); err != nil {
+			return false, err
+		}
+	} else {
+		existing, err := scanBlob(tx.QueryRowContext(ctx, `SELECT `+blobColumns+` FROM blobs WHERE blob_key = ?`, blob.Key))
+		if err != nil {
+			return false, err
+		}
+		*blob = *existing
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return created, nil
+}
+
+// Release decrements the reference count and deletes the blob when it reaches zero
+func (r *blobRepo) Release(ctx context.Context, key string) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE blobs SET ref_count = ref_count - 1, updated_at = ? WHERE blob_key = ?`, time.Now(), key)
+	if err != nil {
+		return 0, err
+	}
+
+	var remaining int
+	err = tx.QueryRowContext(ctx, `SELECT ref_count FROM blobs WHERE blob_key = ?`, key).Scan(&remaining)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if remaining <= 0 {
+		remaining = 0
+		if _, err := tx.ExecContext(ctx, `DELETE FROM blobs WHERE blob_key = ?`, key); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return remaining, nil
+}
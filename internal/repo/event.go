@@ -0,0 +1,147 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewEventOutboxRepo),
+	)
+}
+
+// EventOutboxRepoParams represents the parameters required for event outbox repository initialization
+type EventOutboxRepoParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// eventOutboxRepo implements the event outbox repository interface
+type eventOutboxRepo struct {
+	db *sql.DB
+}
+
+// NewEventOutboxRepo creates a new event outbox repository instance
+func NewEventOutboxRepo(p EventOutboxRepoParams) domain.EventOutboxRepo {
+	return &eventOutboxRepo{
+		db: p.DB,
+	}
+}
+
+const outboxEventColumns = `id, name, payload, actor_id, request_id, attempts, last_error, next_attempt_at,
+              handled_by, created_at, published_at, failed_at`
+
+// scanOutboxEvent scans an outbox event row
+func scanOutboxEvent(row rowScanner) (*domain.OutboxEvent, error) {
+	var event domain.OutboxEvent
+	var payload, handledBy string
+	err := row.Scan(
+		&event.ID,
+		&event.Name,
+		&payload,
+		&event.ActorID,
+		&event.RequestID,
+		&event.Attempts,
+		&event.LastError,
+		&event.NextAttemptAt,
+		&handledBy,
+		&event.CreatedAt,
+		&event.PublishedAt,
+		&event.FailedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Payload = []byte(payload)
+	event.HandledBy = strings.Fields(handledBy)
+	return &event, nil
+}
+
+// Create stores an event in the outbox, in the transaction of the context if there is one
+func (r *eventOutboxRepo) Create(ctx context.Context, event *domain.OutboxEvent) error {
+	query := `INSERT INTO event_outbox (name, payload, actor_id, request_id, next_attempt_at, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
+		event.Name,
+		string(event.Payload),
+		event.ActorID,
+		event.RequestID,
+		event.NextAttemptAt,
+		event.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	event.ID = id
+	return nil
+}
+
+// ListDue retrieves pending events whose next attempt is due, in the order they were stored
+func (r *eventOutboxRepo) ListDue(ctx context.Context, now time.Time, limit int) ([]*domain.OutboxEvent, error) {
+	query := `SELECT ` + outboxEventColumns + ` FROM event_outbox
+              WHERE published_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?
+              ORDER BY id LIMIT ?`
+
+	rows, err := r.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.OutboxEvent
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// UpdateDelivery stores the outcome of a delivery attempt
+func (r *eventOutboxRepo) UpdateDelivery(ctx context.Context, event *domain.OutboxEvent) error {
+	query := `UPDATE event_outbox SET attempts = ?, last_error = ?, next_attempt_at = ?, handled_by = ?, published_at = ?,
+              failed_at = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query,
+		event.Attempts,
+		event.LastError,
+		event.NextAttemptAt,
+		strings.Join(event.HandledBy, " "),
+		event.PublishedAt,
+		event.FailedAt,
+		event.ID,
+	)
+	return err
+}
+
+// DeletePublished removes events published before the given time
+func (r *eventOutboxRepo) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM event_outbox WHERE published_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,238 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewIdentityRepo),
+	)
+}
+
+// IdentityRepoParams represents the parameters required for identity repository initialization
+type IdentityRepoParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// identityRepo implements the identity repository interface
+type identityRepo struct {
+	db *sql.DB
+}
+
+// NewIdentityRepo creates a new identity repository instance
+func NewIdentityRepo(p IdentityRepoParams) domain.IdentityRepo {
+	return &identityRepo{
+		db: p.DB,
+	}
+}
+
+// scanIdentity scans a user identity row
+func scanIdentity(row rowScanner) (*domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.LastLoginAt,
+		&identity.CreatedAt,
+		&identity.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+const identityColumns = `id, user_id, provider, subject, email, last_login_at, created_at, updated_at`
+
+// Create links a new external identity to a user
+func (r *identityRepo) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	now := time.Now()
+	identity.LastLoginAt = now
+	identity.CreatedAt = now
+	identity.UpdatedAt = now
+
+	query := `INSERT INTO user_identities (user_id, provider, subject, email, last_login_at, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+		identity.LastLoginAt,
+		identity.CreatedAt,
+		identity.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	identity.ID = id
+	return nil
+}
+
+// GetByProviderSubject retrieves an identity by provider and subject
+func (r *identityRepo) GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE provider = ? AND subject = ?`
+
+	identity, err := scanIdentity(r.db.QueryRowContext(ctx, query, provider, subject))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// ListByUser retrieves all identities linked to a user
+func (r *identityRepo) ListByUser(ctx context.Context, userID int64) ([]*domain.UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = ? ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*domain.UserIdentity
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// Update updates the email and last login time of an identity
+func (r *identityRepo) Update(ctx context.Context, identity *domain.UserIdentity) error {
+	identity.UpdatedAt = time.Now()
+
+	query := `UPDATE user_identities SET email = ?, last_login_at = ?, updated_at = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query,
+		identity.Email,
+		identity.LastLoginAt,
+		identity.UpdatedAt,
+		identity.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete unlinks an identity from a user. It returns false if no identity matched.
+func (r *identityRepo) Delete(ctx context.Context, userID, id int64) (bool, error) {
+	query := `DELETE FROM user_identities WHERE id = ? AND user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// CreateState stores a pending login and prunes expired ones
+func (r *identityRepo) CreateState(ctx context.Context, state *domain.OIDCLoginState) error {
+	state.CreatedAt = time.Now()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < ?`, state.CreatedAt); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		state.StateHash,
+		state.Provider,
+		state.Nonce,
+		state.CodeVerifier,
+		state.ExpiresAt,
+		state.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	state.ID = id
+	return nil
+}
+
+// ConsumeState retrieves and deletes a pending login so it can be used only once
+func (r *identityRepo) ConsumeState(ctx context.Context, stateHash string) (*domain.OIDCLoginState, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, state_hash, provider, nonce, code_verifier, expires_at, created_at
+              FROM oidc_login_states WHERE state_hash = ?`
+
+	var state domain.OIDCLoginState
+	err = tx.QueryRowContext(ctx, query, stateHash).Scan(
+		&state.ID,
+		&state.StateHash,
+		&state.Provider,
+		&state.Nonce,
+		&state.CodeVerifier,
+		&state.ExpiresAt,
+		&state.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE id = ?`, state.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
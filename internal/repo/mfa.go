@@ -0,0 +1,248 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewMFARepo),
+	)
+}
+
+// MFARepoParams represents the parameters required for MFA repository initialization
+type MFARepoParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// mfaRepo implements the MFA repository interface
+type mfaRepo struct {
+	db *sql.DB
+}
+
+// NewMFARepo creates a new MFA repository instance
+func NewMFARepo(p MFARepoParams) domain.MFARepo {
+	return &mfaRepo{
+		db: p.DB,
+	}
+}
+
+// GetByUserID retrieves the MFA settings of a user
+func (r *mfaRepo) GetByUserID(ctx context.Context, userID int64) (*domain.UserMFA, error) {
+	query := `SELECT user_id, secret, enabled, last_used_step, confirmed_at, created_at, updated_at
+              FROM user_mfa WHERE user_id = ?`
+
+	var mfa domain.UserMFA
+	var confirmedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.Secret,
+		&mfa.Enabled,
+		&mfa.LastUsedStep,
+		&confirmedAt,
+		&mfa.CreatedAt,
+		&mfa.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if confirmedAt.Valid {
+		mfa.ConfirmedAt = &confirmedAt.Time
+	}
+	return &mfa, nil
+}
+
+// Save creates or replaces the MFA settings of a user
+func (r *mfaRepo) Save(ctx context.Context, mfa *domain.UserMFA) error {
+	now := time.Now()
+	if mfa.CreatedAt.IsZero() {
+		mfa.CreatedAt = now
+	}
+	mfa.UpdatedAt = now
+
+	query := `INSERT INTO user_mfa (user_id, secret, enabled, last_used_step, confirmed_at, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)
+              ON CONFLICT(user_id) DO UPDATE SET
+                  secret = excluded.secret,
+                  enabled = excluded.enabled,
+                  last_used_step = excluded.last_used_step,
+                  confirmed_at = excluded.confirmed_at,
+                  updated_at = excluded.updated_at`
+
+	_, err := r.db.ExecContext(ctx, query,
+		mfa.UserID,
+		mfa.Secret,
+		mfa.Enabled,
+		mfa.LastUsedStep,
+		mfa.ConfirmedAt,
+		mfa.CreatedAt,
+		mfa.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes the MFA settings and recovery codes of a user
+func (r *mfaRepo) Delete(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes invalidates all existing recovery codes and stores the new hashes
+func (r *mfaRepo) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`,
+			userID, hash, now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks a matching unused recovery code as used.
+// It returns false when no unused code matches.
+func (r *mfaRepo) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := `UPDATE mfa_recovery_codes SET used_at = ?
+              WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// CreateChallenge stores a new MFA login challenge
+func (r *mfaRepo) CreateChallenge(ctx context.Context, challenge *domain.MFAChallenge) error {
+	challenge.CreatedAt = time.Now()
+
+	query := `INSERT INTO mfa_challenges (user_id, token_hash, attempts, expires_at, created_at)
+              VALUES (?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		challenge.UserID,
+		challenge.TokenHash,
+		challenge.Attempts,
+		challenge.ExpiresAt,
+		challenge.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	challenge.ID = id
+	return nil
+}
+
+// GetChallenge retrieves an MFA challenge by its token hash
+func (r *mfaRepo) GetChallenge(ctx context.Context, tokenHash string) (*domain.MFAChallenge, error) {
+	query := `SELECT id, user_id, token_hash, attempts, expires_at, used_at, created_at
+              FROM mfa_challenges WHERE token_hash = ?`
+
+	var challenge domain.MFAChallenge
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&challenge.ID,
+		&challenge.UserID,
+		&challenge.TokenHash,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+		&usedAt,
+		&challenge.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		challenge.UsedAt = &usedAt.Time
+	}
+	return &challenge, nil
+}
+
+// IncrementChallengeAttempts records a failed verification attempt
+func (r *mfaRepo) IncrementChallengeAttempts(ctx context.Context, id int64) error {
+	query := `UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseChallenge marks a challenge as used. It returns false if it was already used.
+func (r *mfaRepo) UseChallenge(ctx context.Context, id int64) (bool, error) {
+	query := `UPDATE mfa_challenges SET used_at = ? WHERE id = ? AND used_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
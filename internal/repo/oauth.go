@@ -0,0 +1,416 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewOAuthRepo),
+	)
+}
+
+// OAuthRepoParams represents the parameters required for OAuth2 repository initialization
+type OAuthRepoParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// oauthRepo implements the OAuth2 repository interface
+type oauthRepo struct {
+	db *sql.DB
+}
+
+// NewOAuthRepo creates a new OAuth2 repository instance
+func NewOAuthRepo(p OAuthRepoParams) domain.OAuthRepo {
+	return &oauthRepo{
+		db: p.DB,
+	}
+}
+
+// scanOAuthClient scans a client row, decoding the space separated lists
+func scanOAuthClient(row rowScanner) (*domain.OAuthClient, error) {
+	var client domain.OAuthClient
+	var redirectURIs, grantTypes, scopes string
+	err := row.Scan(
+		&client.ID,
+		&client.ClientID,
+		&client.SecretHash,
+		&client.Name,
+		&redirectURIs,
+		&grantTypes,
+		&scopes,
+		&client.Confidential,
+		&client.CreatedAt,
+		&client.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	client.GrantTypes = strings.Fields(grantTypes)
+	client.Scopes = strings.Fields(scopes)
+	return &client, nil
+}
+
+const oauthClientColumns = `id, client_id, secret_hash, name, redirect_uris, grant_types, scopes, confidential,
+              created_at, updated_at`
+
+// CreateClient creates a new OAuth2 client
+func (r *oauthRepo) CreateClient(ctx context.Context, client *domain.OAuthClient) error {
+	now := time.Now()
+	client.CreatedAt = now
+	client.UpdatedAt = now
+
+	query := `INSERT INTO oauth_clients (client_id, secret_hash, name, redirect_uris, grant_types, scopes, confidential, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		client.ClientID,
+		client.SecretHash,
+		client.Name,
+		strings.Join(client.RedirectURIs, " "),
+		strings.Join(client.GrantTypes, " "),
+		strings.Join(client.Scopes, " "),
+		client.Confidential,
+		client.CreatedAt,
+		client.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	client.ID = id
+	return nil
+}
+
+// GetClient retrieves an OAuth2 client by client ID
+func (r *oauthRepo) GetClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE client_id = ?`
+
+	client, err := scanOAuthClient(r.db.QueryRowContext(ctx, query, clientID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// ListClients retrieves all OAuth2 clients
+func (r *oauthRepo) ListClients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []*domain.OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// DeleteClient deletes an OAuth2 client with its codes, refresh tokens and consents
+func (r *oauthRepo) DeleteClient(ctx context.Context, clientID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"oauth_authorization_codes", "oauth_refresh_tokens", "oauth_consents", "oauth_clients"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE client_id = ?`, clientID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CreateAuthorizationCode stores a new authorization code
+func (r *oauthRepo) CreateAuthorizationCode(ctx context.Context, code *domain.OAuthAuthorizationCode) error {
+	code.CreatedAt = time.Now()
+
+	query := `INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope,
+              code_challenge, code_challenge_method, expires_at, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		code.Scope,
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.ExpiresAt,
+		code.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	code.ID = id
+	return nil
+}
+
+// GetAuthorizationCode retrieves an authorization code by its hash
+func (r *oauthRepo) GetAuthorizationCode(ctx context.Context, codeHash string) (*domain.OAuthAuthorizationCode, error) {
+	query := `SELECT id, code_hash, client_id, user_id, redirect_uri, scope, code_challenge, code_challenge_method,
+              expires_at, used_at, created_at
+              FROM oauth_authorization_codes WHERE code_hash = ?`
+
+	var code domain.OAuthAuthorizationCode
+	err := r.db.QueryRowContext(ctx, query, codeHash).Scan(
+		&code.ID,
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.CodeChallenge,
+		&code.CodeChallengeMethod,
+		&code.ExpiresAt,
+		&code.UsedAt,
+		&code.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// UseAuthorizationCode marks a code as used. It returns false if it was already used.
+func (r *oauthRepo) UseAuthorizationCode(ctx context.Context, id int64) (bool, error) {
+	query := `UPDATE oauth_authorization_codes SET used_at = ? WHERE id = ? AND used_at IS NULL`
+
+	return r.execAffected(ctx, query, time.Now(), id)
+}
+
+// CreateRefreshToken stores a new refresh token
+func (r *oauthRepo) CreateRefreshToken(ctx context.Context, token *domain.OAuthRefreshToken) error {
+	token.CreatedAt = time.Now()
+
+	query := `INSERT INTO oauth_refresh_tokens (token_hash, client_id, user_id, scope, expires_at, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		token.TokenHash,
+		token.ClientID,
+		token.UserID,
+		token.Scope,
+		token.ExpiresAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	token.ID = id
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token by its hash
+func (r *oauthRepo) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.OAuthRefreshToken, error) {
+	query := `SELECT id, token_hash, client_id, user_id, scope, expires_at, revoked_at, created_at
+              FROM oauth_refresh_tokens WHERE token_hash = ?`
+
+	var token domain.OAuthRefreshToken
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.TokenHash,
+		&token.ClientID,
+		&token.UserID,
+		&token.Scope,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RevokeRefreshToken marks a refresh token as revoked. It returns false if it was already revoked.
+func (r *oauthRepo) RevokeRefreshToken(ctx context.Context, id int64) (bool, error) {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+
+	return r.execAffected(ctx, query, time.Now(), id)
+}
+
+// RevokeRefreshTokensByUser revokes all refresh tokens of a user
+func (r *oauthRepo) RevokeRefreshTokensByUser(ctx context.Context, userID int64) error {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokensByClientUser revokes all refresh tokens a user granted to a client
+func (r *oauthRepo) RevokeRefreshTokensByClientUser(ctx context.Context, clientID string, userID int64) error {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = ?
+              WHERE client_id = ? AND user_id = ? AND revoked_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now(), clientID, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetConsent retrieves the consent a user granted to a client
+func (r *oauthRepo) GetConsent(ctx context.Context, userID int64, clientID string) (*domain.OAuthConsent, error) {
+	query := `SELECT user_id, client_id, scope, created_at, updated_at
+              FROM oauth_consents WHERE user_id = ? AND client_id = ?`
+
+	var consent domain.OAuthConsent
+	err := r.db.QueryRowContext(ctx, query, userID, clientID).Scan(
+		&consent.UserID,
+		&consent.ClientID,
+		&consent.Scope,
+		&consent.CreatedAt,
+		&consent.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+// SaveConsent creates or replaces the consent a user granted to a client
+func (r *oauthRepo) SaveConsent(ctx context.Context, consent *domain.OAuthConsent) error {
+	now := time.Now()
+	if consent.CreatedAt.IsZero() {
+		consent.CreatedAt = now
+	}
+	consent.UpdatedAt = now
+
+	query := `INSERT INTO oauth_consents (user_id, client_id, scope, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?)
+              ON CONFLICT(user_id, client_id) DO UPDATE SET scope = excluded.scope, updated_at = excluded.updated_at`
+
+	_, err := r.db.ExecContext(ctx, query,
+		consent.UserID,
+		consent.ClientID,
+		consent.Scope,
+		consent.CreatedAt,
+		consent.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteConsent deletes the consent a user granted to a client
+func (r *oauthRepo) DeleteConsent(ctx context.Context, userID int64, clientID string) error {
+	query := `DELETE FROM oauth_consents WHERE user_id = ? AND client_id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, userID, clientID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeAccessToken adds an access token ID to the denylist and prunes expired entries
+func (r *oauthRepo) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	query := `INSERT OR IGNORE INTO oauth_revoked_tokens (jti, expires_at) VALUES (?, ?)`
+
+	if _, err := r.db.ExecContext(ctx, query, jti, expiresAt); err != nil {
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM oauth_revoked_tokens WHERE expires_at < ?`, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether an access token ID is on the denylist
+func (r *oauthRepo) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT COUNT(*) FROM oauth_revoked_tokens WHERE jti = ?`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, jti).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// execAffected executes an update and reports whether any row changed
+func (r *oauthRepo) execAffected(ctx context.Context, query string, args ...any) (bool, error) {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
@@ -3,6 +3,8 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/luxixing/fx-gin/internal/domain"
@@ -37,20 +39,24 @@ func NewProfileRepo(p ProfileRepoParams) domain.ProfileRepo {
 
 func (r *profileRepo) Create(ctx context.Context, profile *domain.Profile) error {
 	now := time.Now()
+	profile.Version = 1
 	profile.CreatedAt = now
 	profile.UpdatedAt = now
+	thumbnails := encodeThumbnails(profile.AvatarThumbnailKeys)
 
-	query := `INSERT INTO profiles (user_id, nickname, avatar, bio, phone, gender, birthday, created_at, updated_at) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO profiles (user_id, nickname, avatar, avatar_thumbnails, bio, phone, gender, birthday, locale, created_at, updated_at) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
 		profile.UserID,
 		profile.Nickname,
-		profile.Avatar,
+		profile.AvatarKey,
+		thumbnails,
 		profile.Bio,
 		profile.Phone,
 		profile.Gender,
 		profile.Birthday,
+		profile.Locale,
 		profile.CreatedAt,
 		profile.UpdatedAt,
 	)
@@ -68,19 +74,36 @@ func (r *profileRepo) Create(ctx context.Context, profile *domain.Profile) error
 }
 
 func (r *profileRepo) GetByUserID(ctx context.Context, userID int64) (*domain.Profile, error) {
-	query := `SELECT id, user_id, nickname, avatar, bio, phone, gender, birthday, created_at, updated_at 
-			  FROM profiles WHERE user_id = ?`
+	return r.getByUserID(ctx, userID, false)
+}
+
+// GetDeletedByUserID retrieves the profile of a soft deleted user
+func (r *profileRepo) GetDeletedByUserID(ctx context.Context, userID int64) (*domain.Profile, error) {
+	return r.getByUserID(ctx, userID, true)
+}
+
+func (r *profileRepo) getByUserID(ctx context.Context, userID int64, deleted bool) (*domain.Profile, error) {
+	query := `SELECT id, user_id, nickname, avatar, avatar_thumbnails, bio, phone, gender, birthday, locale, version, created_at, updated_at 
+			  FROM profiles WHERE user_id = ? AND deleted_at IS NULL`
+	if deleted {
+		query = `SELECT id, user_id, nickname, avatar, avatar_thumbnails, bio, phone, gender, birthday, locale, version, created_at, updated_at 
+			  FROM profiles WHERE user_id = ? AND deleted_at IS NOT NULL`
+	}
 
 	var profile domain.Profile
-	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+	var thumbnails string
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID).Scan(
 		&profile.ID,
 		&profile.UserID,
 		&profile.Nickname,
-		&profile.Avatar,
+		&profile.AvatarKey,
+		&thumbnails,
 		&profile.Bio,
 		&profile.Phone,
 		&profile.Gender,
 		&profile.Birthday,
+		&profile.Locale,
+		&profile.Version,
 		&profile.CreatedAt,
 		&profile.UpdatedAt,
 	)
@@ -92,41 +115,130 @@ func (r *profileRepo) GetByUserID(ctx context.Context, userID int64) (*domain.Pr
 		return nil, err
 	}
 
+	profile.AvatarThumbnailKeys = decodeThumbnails(thumbnails)
 	return &profile, nil
 }
 
+// GetByUserIDs retrieves the profiles of the given users in one query
+func (r *profileRepo) GetByUserIDs(ctx context.Context, userIDs []int64) ([]*domain.Profile, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	placeholders, args := inList(userIDs)
+	query := `SELECT id, user_id, nickname, avatar, avatar_thumbnails, bio, phone, gender, birthday, locale, version, created_at, updated_at 
+			  FROM profiles WHERE user_id IN (` + placeholders + `) AND deleted_at IS NULL`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []*domain.Profile
+	for rows.Next() {
+		profile := &domain.Profile{}
+		var thumbnails string
+		err := rows.Scan(
+			&profile.ID,
+			&profile.UserID,
+			&profile.Nickname,
+			&profile.AvatarKey,
+			&thumbnails,
+			&profile.Bio,
+			&profile.Phone,
+			&profile.Gender,
+			&profile.Birthday,
+			&profile.Locale,
+			&profile.Version,
+			&profile.CreatedAt,
+			&profile.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		profile.AvatarThumbnailKeys = decodeThumbnails(thumbnails)
+		profiles = append(profiles, profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// Update updates the profile if the stored version still matches profile.Version,
+// returning ErrPreconditionFailed when it was modified concurrently
 func (r *profileRepo) Update(ctx context.Context, profile *domain.Profile) error {
 	now := time.Now()
 	profile.UpdatedAt = now
+	thumbnails := encodeThumbnails(profile.AvatarThumbnailKeys)
 
-	query := `UPDATE profiles SET nickname = ?, avatar = ?, bio = ?, phone = ?, gender = ?, birthday = ?, updated_at = ? 
-			  WHERE id = ?`
+	query := `UPDATE profiles SET nickname = ?, avatar = ?, avatar_thumbnails = ?, bio = ?, phone = ?, gender = ?, birthday = ?, locale = ?, version = version + 1, updated_at = ? 
+			  WHERE id = ? AND version = ? AND deleted_at IS NULL`
 
-	_, err := r.db.ExecContext(ctx, query,
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
 		profile.Nickname,
-		profile.Avatar,
+		profile.AvatarKey,
+		thumbnails,
 		profile.Bio,
 		profile.Phone,
 		profile.Gender,
 		profile.Birthday,
+		profile.Locale,
 		profile.UpdatedAt,
 		profile.ID,
+		profile.Version,
 	)
+	if err != nil {
+		return err
+	}
 
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return domain.ErrPreconditionFailed
+	}
 
+	profile.Version++
 	return nil
 }
 
 func (r *profileRepo) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM profiles WHERE id = ?`
 
-	_, err := r.db.ExecContext(ctx, query, id)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// encodeThumbnails stores thumbnail keys as space separated size=key pairs
+func encodeThumbnails(keys map[string]string) string {
+	pairs := make([]string, 0, len(keys))
+	for size, key := range keys {
+		pairs = append(pairs, size+"="+key)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// decodeThumbnails parses thumbnail keys written by encodeThumbnails
+func decodeThumbnails(value string) map[string]string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	keys := make(map[string]string, len(fields))
+	for _, pair := range fields {
+		if size, key, ok := strings.Cut(pair, "="); ok {
+			keys[size] = key
+		}
+	}
+	return keys
+}
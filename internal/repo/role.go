@@ -34,12 +34,13 @@ func NewRoleRepo(p RoleRepoParams) domain.RoleRepo {
 
 func (r *roleRepo) Create(ctx context.Context, role *domain.Role) error {
 	now := time.Now()
+	role.Version = 1
 	role.CreatedAt = now
 	role.UpdatedAt = now
 
 	query := `INSERT INTO roles (name, description, created_at, updated_at) VALUES (?, ?, ?, ?)`
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
 		role.Name,
 		role.Description,
 		role.CreatedAt,
@@ -59,13 +60,14 @@ func (r *roleRepo) Create(ctx context.Context, role *domain.Role) error {
 }
 
 func (r *roleRepo) GetByID(ctx context.Context, id int64) (*domain.Role, error) {
-	query := `SELECT id, name, description, created_at, updated_at FROM roles WHERE id = ?`
+	query := `SELECT id, name, description, version, created_at, updated_at FROM roles WHERE id = ?`
 
 	var role domain.Role
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
 		&role.ID,
 		&role.Name,
 		&role.Description,
+		&role.Version,
 		&role.CreatedAt,
 		&role.UpdatedAt,
 	)
@@ -82,13 +84,14 @@ func (r *roleRepo) GetByID(ctx context.Context, id int64) (*domain.Role, error)
 
 // GetByName 根据名称获取角色
 func (r *roleRepo) GetByName(ctx context.Context, name string) (*domain.Role, error) {
-	query := `SELECT id, name, description, created_at, updated_at FROM roles WHERE name = ?`
+	query := `SELECT id, name, description, version, created_at, updated_at FROM roles WHERE name = ?`
 
 	var role domain.Role
-	err := r.db.QueryRowContext(ctx, query, name).Scan(
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, name).Scan(
 		&role.ID,
 		&role.Name,
 		&role.Description,
+		&role.Version,
 		&role.CreatedAt,
 		&role.UpdatedAt,
 	)
@@ -106,19 +109,28 @@ func (r *roleRepo) GetByName(ctx context.Context, name string) (*domain.Role, er
 func (r *roleRepo) Update(ctx context.Context, role *domain.Role) error {
 	role.UpdatedAt = time.Now()
 
-	query := `UPDATE roles SET name = ?, description = ?, updated_at = ? WHERE id = ?`
+	query := `UPDATE roles SET name = ?, description = ?, version = version + 1, updated_at = ? WHERE id = ? AND version = ?`
 
-	_, err := r.db.ExecContext(ctx, query,
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
 		role.Name,
 		role.Description,
 		role.UpdatedAt,
 		role.ID,
+		role.Version,
 	)
+	if err != nil {
+		return err
+	}
 
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return domain.ErrPreconditionFailed
+	}
 
+	role.Version++
 	return nil
 }
 
@@ -126,7 +138,7 @@ func (r *roleRepo) Update(ctx context.Context, role *domain.Role) error {
 func (r *roleRepo) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM roles WHERE id = ?`
 
-	_, err := r.db.ExecContext(ctx, query, id)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -136,9 +148,9 @@ func (r *roleRepo) Delete(ctx context.Context, id int64) error {
 
 // List retrieves all roles from the database
 func (r *roleRepo) List(ctx context.Context) ([]*domain.Role, error) {
-	query := `SELECT id, name, description, created_at, updated_at FROM roles`
+	query := `SELECT id, name, description, version, created_at, updated_at FROM roles`
 
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -151,6 +163,7 @@ func (r *roleRepo) List(ctx context.Context) ([]*domain.Role, error) {
 			&role.ID,
 			&role.Name,
 			&role.Description,
+			&role.Version,
 			&role.CreatedAt,
 			&role.UpdatedAt,
 		)
@@ -173,7 +186,7 @@ func (r *roleRepo) AddRoleToUser(ctx context.Context, userID int64, roleID int64
 
 	query := `INSERT INTO user_roles (user_id, role_id, created_at) VALUES (?, ?, ?)`
 
-	_, err := r.db.ExecContext(ctx, query, userID, roleID, now)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, roleID, now)
 	if err != nil {
 		return err
 	}
@@ -185,7 +198,7 @@ func (r *roleRepo) AddRoleToUser(ctx context.Context, userID int64, roleID int64
 func (r *roleRepo) RemoveRoleFromUser(ctx context.Context, userID int64, roleID int64) error {
 	query := `DELETE FROM user_roles WHERE user_id = ? AND role_id = ?`
 
-	_, err := r.db.ExecContext(ctx, query, userID, roleID)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, roleID)
 	if err != nil {
 		return err
 	}
@@ -196,13 +209,13 @@ func (r *roleRepo) RemoveRoleFromUser(ctx context.Context, userID int64, roleID
 // GetUserRoles retrieves all roles assigned to a user
 func (r *roleRepo) GetUserRoles(ctx context.Context, userID int64) ([]*domain.Role, error) {
 	query := `
-		SELECT r.id, r.name, r.description, r.created_at, r.updated_at 
+		SELECT r.id, r.name, r.description, r.version, r.created_at, r.updated_at 
 		FROM roles r
 		JOIN user_roles ur ON r.id = ur.role_id
 		WHERE ur.user_id = ?
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -215,6 +228,7 @@ func (r *roleRepo) GetUserRoles(ctx context.Context, userID int64) ([]*domain.Ro
 			&role.ID,
 			&role.Name,
 			&role.Description,
+			&role.Version,
 			&role.CreatedAt,
 			&role.UpdatedAt,
 		)
@@ -231,16 +245,62 @@ func (r *roleRepo) GetUserRoles(ctx context.Context, userID int64) ([]*domain.Ro
 	return roles, nil
 }
 
+// GetRolesByUserIDs retrieves the roles of the given users in one query
+func (r *roleRepo) GetRolesByUserIDs(ctx context.Context, userIDs []int64) (map[int64][]*domain.Role, error) {
+	roles := make(map[int64][]*domain.Role, len(userIDs))
+	if len(userIDs) == 0 {
+		return roles, nil
+	}
+	placeholders, args := inList(userIDs)
+	query := `
+		SELECT ur.user_id, r.id, r.name, r.description, r.version, r.created_at, r.updated_at 
+		FROM roles r
+		JOIN user_roles ur ON r.id = ur.role_id
+		WHERE ur.user_id IN (` + placeholders + `)
+		ORDER BY r.id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		role := &domain.Role{}
+		err := rows.Scan(
+			&userID,
+			&role.ID,
+			&role.Name,
+			&role.Description,
+			&role.Version,
+			&role.CreatedAt,
+			&role.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		roles[userID] = append(roles[userID], role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
 // GetUsersByRoleID retrieves all users who have a specific role
 func (r *roleRepo) GetUsersByRoleID(ctx context.Context, roleID int64) ([]*domain.User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.password, u.status, u.created_at, u.updated_at
+		SELECT u.id, u.username, u.email, u.password, u.status, u.email_verified_at, u.version, u.created_at, u.updated_at
 		FROM users u
 		JOIN user_roles ur ON u.id = ur.user_id
-		WHERE ur.role_id = ?
+		WHERE ur.role_id = ? AND u.deleted_at IS NULL
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, roleID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, roleID)
 	if err != nil {
 		return nil, err
 	}
@@ -255,6 +315,8 @@ func (r *roleRepo) GetUsersByRoleID(ctx context.Context, roleID int64) ([]*domai
 			&user.Email,
 			&user.Password,
 			&user.Status,
+			&user.EmailVerifiedAt,
+			&user.Version,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -0,0 +1,43 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/infra/db"
+)
+
+// newTestDB opens a migrated SQLite database in a temporary directory
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	database, err := sql.Open("sqlite3", db.DataSourceName(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if err := db.RunMigrations(db.MigrationConfig{DB: database}); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+	return database
+}
+
+// createTestUser stores an active user
+func createTestUser(t *testing.T, users domain.UserRepo, username string) *domain.User {
+	t.Helper()
+
+	user := &domain.User{
+		Username: username,
+		Email:    username + "@example.com",
+		Password: "hash",
+		Status:   domain.UserStatusActive,
+	}
+	if err := users.Create(context.Background(), user); err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewTransactor),
+	)
+}
+
+// txKey is the context key of the transaction started by InTx
+type txKey struct{}
+
+// txState is a transaction with the callbacks to run once it has committed
+type txState struct {
+	tx          *sql.Tx
+	afterCommit []func()
+}
+
+// querier is the part of *sql.DB and *sql.Tx used by the repositories
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// TransactorParams represents the parameters required for transactor initialization
+type TransactorParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// transactor implements the transactor interface
+type transactor struct {
+	db *sql.DB
+}
+
+// NewTransactor creates a new transactor instance
+func NewTransactor(p TransactorParams) domain.Transactor {
+	return &transactor{
+		db: p.DB,
+	}
+}
+
+// InTx runs fn in a transaction, committed when fn succeeds. Called inside a transaction,
+// fn joins it.
+func (t *transactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	state := &txState{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, callback := range state.afterCommit {
+		callback()
+	}
+	return nil
+}
+
+// AfterCommit registers fn to run once the transaction of the context has committed
+func (t *transactor) AfterCommit(ctx context.Context, fn func()) bool {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return false
+	}
+	state.afterCommit = append(state.afterCommit, fn)
+	return true
+}
+
+// conn returns the transaction of the context, or the database outside a transaction
+func conn(ctx context.Context, db *sql.DB) querier {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
+	}
+	return db
+}
+
+// withTx runs fn in the transaction of the context, or in its own transaction committed
+// when fn succeeds
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(state.tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
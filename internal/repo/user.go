@@ -3,6 +3,10 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/luxixing/fx-gin/internal/domain"
@@ -41,17 +45,19 @@ func NewUserRepo(p UserRepoParams) domain.UserRepo {
 func (r *userRepo) Create(ctx context.Context, user *domain.User) error {
 	logger.Debug(ctx, "Create", zap.Any("user", user))
 	now := time.Now()
+	user.Version = 1
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	query := `INSERT INTO users (username, email, password, status, created_at, updated_at) 
-              VALUES (?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO users (username, email, password, status, email_verified_at, created_at, updated_at) 
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
 		user.Username,
 		user.Email,
 		user.Password,
 		user.Status,
+		user.EmailVerifiedAt,
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
@@ -70,16 +76,18 @@ func (r *userRepo) Create(ctx context.Context, user *domain.User) error {
 
 // GetByID retrieves a user by ID
 func (r *userRepo) GetByID(ctx context.Context, id int64) (*domain.User, error) {
-	query := `SELECT id, username, email, password, status, created_at, updated_at 
-              FROM users WHERE id = ?`
+	query := `SELECT id, username, email, password, status, email_verified_at, version, created_at, updated_at 
+              FROM users WHERE id = ? AND deleted_at IS NULL`
 
 	var user domain.User
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.Password,
 		&user.Status,
+		&user.EmailVerifiedAt,
+		&user.Version,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -94,18 +102,62 @@ func (r *userRepo) GetByID(ctx context.Context, id int64) (*domain.User, error)
 	return &user, nil
 }
 
+// GetByIDs retrieves the users with the given IDs in one query
+func (r *userRepo) GetByIDs(ctx context.Context, ids []int64) ([]*domain.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	placeholders, args := inList(ids)
+	query := `SELECT id, username, email, password, status, email_verified_at, version, created_at, updated_at 
+              FROM users WHERE id IN (` + placeholders + `) AND deleted_at IS NULL`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user := &domain.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.Password,
+			&user.Status,
+			&user.EmailVerifiedAt,
+			&user.Version,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 // GetByUsername retrieves a user by username
 func (r *userRepo) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
-	query := `SELECT id, username, email, password, status, created_at, updated_at 
-              FROM users WHERE username = ?`
+	query := `SELECT id, username, email, password, status, email_verified_at, version, created_at, updated_at 
+              FROM users WHERE username = ? AND deleted_at IS NULL`
 
 	var user domain.User
-	err := r.db.QueryRowContext(ctx, query, username).Scan(
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, username).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.Password,
 		&user.Status,
+		&user.EmailVerifiedAt,
+		&user.Version,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -122,16 +174,18 @@ func (r *userRepo) GetByUsername(ctx context.Context, username string) (*domain.
 
 // GetByEmail retrieves a user by email
 func (r *userRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	query := `SELECT id, username, email, password, status, created_at, updated_at 
-              FROM users WHERE email = ?`
+	query := `SELECT id, username, email, password, status, email_verified_at, version, created_at, updated_at 
+              FROM users WHERE email = ? AND deleted_at IS NULL`
 
 	var user domain.User
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.Password,
 		&user.Status,
+		&user.EmailVerifiedAt,
+		&user.Version,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -146,52 +200,297 @@ func (r *userRepo) GetByEmail(ctx context.Context, email string) (*domain.User,
 	return &user, nil
 }
 
-// Update updates user information
+// Update updates user information if the stored version still matches user.Version,
+// returning ErrPreconditionFailed when the user was modified concurrently
 func (r *userRepo) Update(ctx context.Context, user *domain.User) error {
 	user.UpdatedAt = time.Now()
 
-	query := `UPDATE users SET username = ?, email = ?, password = ?, status = ?, updated_at = ? 
-              WHERE id = ?`
+	query := `UPDATE users SET username = ?, email = ?, password = ?, status = ?, email_verified_at = ?, version = version + 1, updated_at = ? 
+              WHERE id = ? AND version = ? AND deleted_at IS NULL`
 
-	_, err := r.db.ExecContext(ctx, query,
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
 		user.Username,
 		user.Email,
 		user.Password,
 		user.Status,
+		user.EmailVerifiedAt,
 		user.UpdatedAt,
 		user.ID,
+		user.Version,
 	)
+	if err != nil {
+		return err
+	}
 
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return domain.ErrPreconditionFailed
+	}
 
+	user.Version++
 	return nil
 }
 
-// Delete deletes a user
-func (r *userRepo) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM users WHERE id = ?`
+// Delete soft deletes a user and its profile. Released usernames and emails are
+// replaced by tombstones so they can be registered again while the user is kept.
+func (r *userRepo) Delete(ctx context.Context, id int64, releaseIdentifiers bool) error {
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		now := time.Now()
+		query := `UPDATE users SET deleted_at = ?, version = version + 1, updated_at = ? WHERE id = ? AND deleted_at IS NULL`
+		if releaseIdentifiers {
+			query = `UPDATE users SET deleted_at = ?, version = version + 1, updated_at = ?,
+              username = 'deleted:' || id || ':' || username, email = 'deleted:' || id || ':' || email
+              WHERE id = ? AND deleted_at IS NULL`
+		}
+		if _, err := tx.ExecContext(ctx, query, now, now, id); err != nil {
+			return err
+		}
+
+		query = `UPDATE profiles SET deleted_at = ? WHERE user_id = ? AND deleted_at IS NULL`
+		_, err := tx.ExecContext(ctx, query, now, id)
+		return err
+	})
+}
+
+// GetDeletedByID retrieves a soft deleted user with its original username and email
+func (r *userRepo) GetDeletedByID(ctx context.Context, id int64) (*domain.User, error) {
+	query := `SELECT id, username, email, password, status, email_verified_at, version, created_at, updated_at, deleted_at 
+              FROM users WHERE id = ? AND deleted_at IS NOT NULL`
+
+	var user domain.User
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password,
+		&user.Status,
+		&user.EmailVerifiedAt,
+		&user.Version,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.DeletedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	restoreIdentifiers(&user)
+	return &user, nil
+}
+
+// IsUsernameTaken reports whether a username is in use, including by deleted users
+// whose identifiers were not released
+func (r *userRepo) IsUsernameTaken(ctx context.Context, username string) (bool, error) {
+	var count int
+	err := conn(ctx, r.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE username = ?`, username).Scan(&count)
+	return count > 0, err
+}
 
-	_, err := r.db.ExecContext(ctx, query, id)
+// IsEmailTaken reports whether an email is in use, including by deleted users
+// whose identifiers were not released
+func (r *userRepo) IsEmailTaken(ctx context.Context, email string) (bool, error) {
+	var count int
+	err := conn(ctx, r.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE email = ?`, email).Scan(&count)
+	return count > 0, err
+}
+
+// Restore undeletes a user and its profile, reclaiming released identifiers. It returns
+// ErrUsernameExists or ErrEmailRegistered when they were taken in the meantime.
+func (r *userRepo) Restore(ctx context.Context, user *domain.User) error {
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var count int
+		query := `SELECT COUNT(*) FROM users WHERE username = ? AND id != ?`
+		if err := tx.QueryRowContext(ctx, query, user.Username, user.ID).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return domain.ErrUsernameExists
+		}
+		query = `SELECT COUNT(*) FROM users WHERE email = ? AND id != ?`
+		if err := tx.QueryRowContext(ctx, query, user.Email, user.ID).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return domain.ErrEmailRegistered
+		}
+
+		user.UpdatedAt = time.Now()
+		query = `UPDATE users SET username = ?, email = ?, deleted_at = NULL, version = version + 1, updated_at = ? 
+              WHERE id = ? AND deleted_at IS NOT NULL`
+		result, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.UpdatedAt, user.ID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return domain.ErrPreconditionFailed
+		}
+
+		query = `UPDATE profiles SET deleted_at = NULL WHERE user_id = ?`
+		_, err = tx.ExecContext(ctx, query, user.ID)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
+	user.Version++
+	user.DeletedAt = nil
 	return nil
 }
 
-// List retrieves a list of users
-func (r *userRepo) List(ctx context.Context, offset, limit int) ([]*domain.User, error) {
-	query := `SELECT id, username, email, password, status, created_at, updated_at 
-              FROM users ORDER BY id DESC LIMIT ?, ?`
+// ListDeletedIDs returns the IDs of users deleted before the given time, oldest first
+func (r *userRepo) ListDeletedIDs(ctx context.Context, before time.Time, limit int) ([]int64, error) {
+	query := `SELECT id FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ? ORDER BY deleted_at LIMIT ?`
 
-	rows, err := r.db.QueryContext(ctx, query, offset, limit)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, before, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// userTables are the tables holding rows that belong to a user, removed when it is purged
+var userTables = []string{
+	"profiles",
+	"user_roles",
+	"user_mfa",
+	"mfa_recovery_codes",
+	"mfa_challenges",
+	"user_tokens",
+	"user_identities",
+	"api_keys",
+	"oauth_authorization_codes",
+	"oauth_refresh_tokens",
+	"oauth_consents",
+}
+
+// Purge permanently deletes a soft deleted user and everything that belongs to it
+func (r *userRepo) Purge(ctx context.Context, id int64) error {
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ? AND deleted_at IS NOT NULL`, id)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return nil
+		}
+
+		for _, table := range userTables {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE user_id = ?", table), id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// restoreIdentifiers strips the tombstones written when identifiers were released
+func restoreIdentifiers(user *domain.User) {
+	prefix := fmt.Sprintf("deleted:%d:", user.ID)
+	user.Username = strings.TrimPrefix(user.Username, prefix)
+	user.Email = strings.TrimPrefix(user.Email, prefix)
+}
+
+// userSortColumns are the fields the user list can be sorted by
+var userSortColumns = map[string]string{
+	"id":         "u.id",
+	"username":   "u.username",
+	"email":      "u.email",
+	"created_at": "u.created_at",
+	"updated_at": "u.updated_at",
+}
+
+// userCursor is the position after the last user of a page, encoded into an opaque string
+type userCursor struct {
+	Sort  string `json:"s"`
+	ID    int64  `json:"i"`
+	Value string `json:"v,omitempty"` // Value of the sort field, times are formatted as RFC 3339
+}
+
+// List retrieves the users matching a query using keyset pagination for cursors
+// and offset pagination for pages
+func (r *userRepo) List(ctx context.Context, q *domain.UserQuery) ([]*domain.User, string, error) {
+	sort := q.Sort
+	if sort == "" {
+		sort = "-id"
+	}
+	field := strings.TrimPrefix(sort, "-")
+	column, ok := userSortColumns[field]
+	if !ok {
+		return nil, "", domain.ErrInvalidSort
+	}
+	direction, operator := "ASC", ">"
+	if strings.HasPrefix(sort, "-") {
+		direction, operator = "DESC", "<"
+	}
+
+	where, args, err := r.userFilter(ctx, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if q.Cursor != "" {
+		cursor, value, err := decodeUserCursor(q.Cursor, field)
+		if err != nil || cursor.Sort != sort {
+			return nil, "", domain.ErrInvalidCursor
+		}
+		if field == "id" {
+			where = append(where, "u.id "+operator+" ?")
+			args = append(args, cursor.ID)
+		} else {
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND u.id %[2]s ?))", column, operator))
+			args = append(args, value, value, cursor.ID)
+		}
+	}
+
+	query := `SELECT u.id, u.username, u.email, u.password, u.status, u.email_verified_at, u.version, u.created_at, u.updated_at, u.deleted_at 
+              FROM users u`
+	query += " WHERE " + strings.Join(where, " AND ")
+	if field == "id" {
+		query += " ORDER BY u.id " + direction
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, u.id %s", column, direction, direction)
+	}
+
+	// One extra row tells whether there is a following page
+	query += " LIMIT ? OFFSET ?"
+	args = append(args, q.Limit+1, 0)
+	if q.Cursor == "" && q.Page > 1 {
+		args[len(args)-1] = (q.Page - 1) * q.Limit
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
 	var users []*domain.User
 	for rows.Next() {
 		user := &domain.User{}
@@ -201,31 +500,170 @@ func (r *userRepo) List(ctx context.Context, offset, limit int) ([]*domain.User,
 			&user.Email,
 			&user.Password,
 			&user.Status,
+			&user.EmailVerifiedAt,
+			&user.Version,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&user.DeletedAt,
 		)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		users = append(users, user)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return users, nil
+	var next string
+	if len(users) > q.Limit {
+		users = users[:q.Limit]
+		if next, err = encodeUserCursor(sort, field, users[len(users)-1]); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// The cursor holds stored values, identifiers are only restored for the response
+	if q.Deleted {
+		for _, user := range users {
+			restoreIdentifiers(user)
+		}
+	}
+	return users, next, nil
 }
 
-// Count retrieves the total number of users
-func (r *userRepo) Count(ctx context.Context) (int, error) {
-	query := `SELECT COUNT(*) FROM users`
+// Count retrieves the number of users matching the filters of a query
+func (r *userRepo) Count(ctx context.Context, q *domain.UserQuery) (int, error) {
+	where, args, err := r.userFilter(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `SELECT COUNT(*) FROM users u`
+	query += " WHERE " + strings.Join(where, " AND ")
 
 	var count int
-	err := r.db.QueryRowContext(ctx, query).Scan(&count)
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 
 	return count, nil
 }
+
+// userFilter builds the WHERE conditions of a user query
+func (r *userRepo) userFilter(ctx context.Context, q *domain.UserQuery) ([]string, []any, error) {
+	where := []string{"u.deleted_at IS NULL"}
+	if q.Deleted {
+		where[0] = "u.deleted_at IS NOT NULL"
+	}
+
+	var args []any
+	if q.Status != nil {
+		where = append(where, "u.status = ?")
+		args = append(args, *q.Status)
+	}
+	if q.Role != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM user_roles ur JOIN roles r ON r.id = ur.role_id 
+              WHERE ur.user_id = u.id AND r.name = ?)`)
+		args = append(args, q.Role)
+	}
+	if q.CreatedAfter != nil {
+		where = append(where, "u.created_at >= ?")
+		args = append(args, q.CreatedAfter.In(time.Local))
+	}
+	if q.CreatedBefore != nil {
+		where = append(where, "u.created_at < ?")
+		args = append(args, q.CreatedBefore.In(time.Local))
+	}
+
+	terms := strings.Fields(q.Search)
+	if len(terms) == 0 {
+		return where, args, nil
+	}
+
+	fts, err := r.hasSearchIndex(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fts {
+		// Every term is quoted so FTS5 syntax in the input is matched literally
+		match := make([]string, len(terms))
+		for i, term := range terms {
+			match[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+		}
+		where = append(where, "u.id IN (SELECT rowid FROM users_fts WHERE users_fts MATCH ?)")
+		args = append(args, strings.Join(match, " "))
+		return where, args, nil
+	}
+
+	for _, term := range terms {
+		pattern := likeEscaper.Replace(term) + "%"
+		where = append(where, `(u.username LIKE ? ESCAPE '\' OR u.email LIKE ? ESCAPE '\' 
+              OR EXISTS (SELECT 1 FROM profiles p WHERE p.user_id = u.id AND p.nickname LIKE ? ESCAPE '\'))`)
+		args = append(args, pattern, pattern, pattern)
+	}
+	return where, args, nil
+}
+
+// inList returns the placeholders and arguments of an IN condition over IDs
+func inList(ids []int64) (string, []any) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// hasSearchIndex reports whether the users_fts full-text index was created by the migration
+func (r *userRepo) hasSearchIndex(ctx context.Context) (bool, error) {
+	var count int
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users_fts'`).Scan(&count)
+	return count > 0, err
+}
+
+// encodeUserCursor returns the cursor pointing after user
+func encodeUserCursor(sort, field string, user *domain.User) (string, error) {
+	cursor := userCursor{Sort: sort, ID: user.ID}
+	switch field {
+	case "username":
+		cursor.Value = user.Username
+	case "email":
+		cursor.Value = user.Email
+	case "created_at":
+		cursor.Value = user.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = user.UpdatedAt.Format(time.RFC3339Nano)
+	}
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeUserCursor parses a cursor and returns the sort field value to continue from
+func decodeUserCursor(s, field string) (*userCursor, any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cursor userCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, nil, err
+	}
+
+	switch field {
+	case "created_at", "updated_at":
+		value, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		return &cursor, value, err
+	default:
+		return &cursor, cursor.Value, nil
+	}
+}
@@ -0,0 +1,382 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+func TestUserUpdateRejectsStaleVersion(t *testing.T) {
+	ctx := context.Background()
+	users := NewUserRepo(UserRepoParams{DB: newTestDB(t)})
+	user := createTestUser(t, users, "alice")
+
+	// Two writers read the same version
+	first, err := users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	second := *first
+
+	first.Email = "first@example.com"
+	if err := users.Update(ctx, first); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("version after update = %d, want 2", first.Version)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		version int64
+		err     error
+	}{
+		{"stale version", second.Version, domain.ErrPreconditionFailed},
+		{"future version", first.Version + 1, domain.ErrPreconditionFailed},
+		{"current version", first.Version, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			update := second
+			update.Version = tc.version
+			update.Email = "second@example.com"
+			if err := users.Update(ctx, &update); !errors.Is(err, tc.err) {
+				t.Fatalf("update = %v, want %v", err, tc.err)
+			}
+
+			stored, err := users.GetByID(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("get user: %v", err)
+			}
+			if tc.err != nil && stored.Email != "first@example.com" {
+				t.Errorf("rejected update was stored: %+v", stored)
+			}
+			if tc.err == nil && (stored.Email != "second@example.com" || stored.Version != tc.version+1) {
+				t.Errorf("stored user = %+v", stored)
+			}
+		})
+	}
+}
+
+func TestUserListCursorWalksAllPages(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	users := NewUserRepo(UserRepoParams{DB: database})
+
+	// Names are out of ID order and several users share a creation time,
+	// so pages only line up when ties are broken by ID
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	created := map[string]time.Time{
+		"dave":  base,
+		"alice": base.Add(time.Hour),
+		"frank": base.Add(time.Hour),
+		"carol": base.Add(time.Hour),
+		"erin":  base.Add(2 * time.Hour),
+		"bob":   base,
+		"gina":  base.Add(time.Hour),
+	}
+	var all []*domain.User
+	for _, name := range []string{"dave", "alice", "frank", "carol", "erin", "bob", "gina"} {
+		user := createTestUser(t, users, name)
+		user.CreatedAt = created[name]
+		if _, err := database.Exec(`UPDATE users SET created_at = ? WHERE id = ?`, user.CreatedAt, user.ID); err != nil {
+			t.Fatalf("set created_at: %v", err)
+		}
+		all = append(all, user)
+	}
+
+	for _, tc := range []struct {
+		sort string
+		less func(a, b *domain.User) bool
+	}{
+		{"id", func(a, b *domain.User) bool { return a.ID < b.ID }},
+		{"-id", func(a, b *domain.User) bool { return a.ID > b.ID }},
+		{"username", func(a, b *domain.User) bool { return a.Username < b.Username }},
+		{"-email", func(a, b *domain.User) bool { return a.Email > b.Email }},
+		{"created_at", func(a, b *domain.User) bool {
+			return a.CreatedAt.Before(b.CreatedAt) || a.CreatedAt.Equal(b.CreatedAt) && a.ID < b.ID
+		}},
+		{"-created_at", func(a, b *domain.User) bool {
+			return a.CreatedAt.After(b.CreatedAt) || a.CreatedAt.Equal(b.CreatedAt) && a.ID > b.ID
+		}},
+	} {
+		t.Run(tc.sort, func(t *testing.T) {
+			expected := slices.Clone(all)
+			sort.SliceStable(expected, func(i, j int) bool { return tc.less(expected[i], expected[j]) })
+			var want []string
+			for _, user := range expected {
+				want = append(want, user.Username)
+			}
+
+			var got []string
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > len(all) {
+					t.Fatalf("cursor did not end after %d pages: %v", pages, got)
+				}
+				page, next, err := users.List(ctx, &domain.UserQuery{Sort: tc.sort, Limit: 2, Cursor: cursor})
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				for _, user := range page {
+					got = append(got, user.Username)
+				}
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+
+			if !slices.Equal(got, want) {
+				t.Errorf("pages = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestUserListCursorIsStableUnderDeletes(t *testing.T) {
+	ctx := context.Background()
+	users := NewUserRepo(UserRepoParams{DB: newTestDB(t)})
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		createTestUser(t, users, name)
+	}
+
+	first, next, err := users.List(ctx, &domain.UserQuery{Sort: "username", Limit: 2})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	// Removing a row of the first page shifts offsets but not the keyset
+	if err := users.Delete(ctx, first[0].ID, false); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	second, next, err := users.List(ctx, &domain.UserQuery{Sort: "username", Limit: 2, Cursor: next})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(second) != 2 || second[0].Username != "carol" || second[1].Username != "dave" || next != "" {
+		t.Errorf("second page = %v, next = %q", second, next)
+	}
+}
+
+func TestUserListRejectsInvalidCursors(t *testing.T) {
+	ctx := context.Background()
+	users := NewUserRepo(UserRepoParams{DB: newTestDB(t)})
+	for _, name := range []string{"alice", "bob", "carol"} {
+		createTestUser(t, users, name)
+	}
+	_, byUsername, err := users.List(ctx, &domain.UserQuery{Sort: "username", Limit: 1})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	_, byCreatedAt, err := users.List(ctx, &domain.UserQuery{Sort: "created_at", Limit: 1})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		sort   string
+		cursor string
+		err    error
+	}{
+		{"garbage", "username", "not a cursor", domain.ErrInvalidCursor},
+		{"cursor of another sort", "-username", byUsername, domain.ErrInvalidCursor},
+		{"cursor of another field", "created_at", byUsername, domain.ErrInvalidCursor},
+		{"matching sort", "created_at", byCreatedAt, nil},
+		{"unknown sort", "password", "", domain.ErrInvalidSort},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := users.List(ctx, &domain.UserQuery{Sort: tc.sort, Limit: 1, Cursor: tc.cursor})
+			if !errors.Is(err, tc.err) {
+				t.Errorf("list = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestUserSoftDeleteAndRestore(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		release bool
+	}{
+		{"identifiers kept", false},
+		{"identifiers released", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			database := newTestDB(t)
+			users := NewUserRepo(UserRepoParams{DB: database})
+			profiles := NewProfileRepo(ProfileRepoParams{DB: database})
+			user := createTestUser(t, users, "alice")
+			if err := profiles.Create(ctx, &domain.Profile{UserID: user.ID, Nickname: "Alice"}); err != nil {
+				t.Fatalf("create profile: %v", err)
+			}
+
+			if err := users.Delete(ctx, user.ID, tc.release); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if active, err := users.GetByID(ctx, user.ID); err != nil || active != nil {
+				t.Fatalf("deleted user is still active: %+v, %v", active, err)
+			}
+			if profile, err := profiles.GetByUserID(ctx, user.ID); err != nil || profile != nil {
+				t.Fatalf("profile of deleted user is still active: %+v, %v", profile, err)
+			}
+			deleted, err := users.GetDeletedByID(ctx, user.ID)
+			if err != nil || deleted == nil {
+				t.Fatalf("get deleted user: %+v, %v", deleted, err)
+			}
+			// Tombstones never leak, the original identifiers are reported
+			if deleted.Username != "alice" || deleted.Email != "alice@example.com" || deleted.DeletedAt == nil {
+				t.Errorf("deleted user = %+v", deleted)
+			}
+			listed, _, err := users.List(ctx, &domain.UserQuery{Deleted: true, Limit: 10})
+			if err != nil || len(listed) != 1 || listed[0].Username != "alice" {
+				t.Errorf("deleted users = %+v, %v", listed, err)
+			}
+
+			taken, err := users.IsUsernameTaken(ctx, "alice")
+			if err != nil {
+				t.Fatalf("is username taken: %v", err)
+			}
+			if taken == tc.release {
+				t.Errorf("username taken = %v with released identifiers %v", taken, tc.release)
+			}
+
+			if err := users.Restore(ctx, deleted); err != nil {
+				t.Fatalf("restore: %v", err)
+			}
+			restored, err := users.GetByID(ctx, user.ID)
+			if err != nil || restored == nil {
+				t.Fatalf("get restored user: %+v, %v", restored, err)
+			}
+			if restored.Username != "alice" || restored.Email != "alice@example.com" || restored.Version != deleted.Version {
+				t.Errorf("restored user = %+v, want version %d", restored, deleted.Version)
+			}
+			if profile, err := profiles.GetByUserID(ctx, user.ID); err != nil || profile == nil {
+				t.Errorf("profile was not restored: %v", err)
+			}
+		})
+	}
+}
+
+func TestUserRestoreRejectsReclaimedIdentifiers(t *testing.T) {
+	ctx := context.Background()
+	users := NewUserRepo(UserRepoParams{DB: newTestDB(t)})
+	user := createTestUser(t, users, "alice")
+
+	if err := users.Delete(ctx, user.ID, true); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	createTestUser(t, users, "alice")
+
+	deleted, err := users.GetDeletedByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get deleted user: %v", err)
+	}
+	if err := users.Restore(ctx, deleted); !errors.Is(err, domain.ErrUsernameExists) {
+		t.Fatalf("restore = %v, want ErrUsernameExists", err)
+	}
+	if still, err := users.GetDeletedByID(ctx, user.ID); err != nil || still == nil {
+		t.Errorf("failed restore changed the user: %+v, %v", still, err)
+	}
+}
+
+func TestUserUpdateRejectsDeletedUser(t *testing.T) {
+	ctx := context.Background()
+	users := NewUserRepo(UserRepoParams{DB: newTestDB(t)})
+	user := createTestUser(t, users, "alice")
+
+	if err := users.Delete(ctx, user.ID, false); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	deleted, err := users.GetDeletedByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get deleted user: %v", err)
+	}
+	// The version matches, only the deletion rejects the update
+	if err := users.Update(ctx, deleted); !errors.Is(err, domain.ErrPreconditionFailed) {
+		t.Errorf("update of deleted user = %v, want ErrPreconditionFailed", err)
+	}
+}
+
+func TestUserPurge(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	users := NewUserRepo(UserRepoParams{DB: database})
+	profiles := NewProfileRepo(ProfileRepoParams{DB: database})
+	roles := NewRoleRepo(RoleRepoParams{DB: database})
+
+	role := &domain.Role{Name: "tester"}
+	if err := roles.Create(ctx, role); err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	old := createTestUser(t, users, "old")
+	recent := createTestUser(t, users, "recent")
+	active := createTestUser(t, users, "active")
+	for _, user := range []*domain.User{old, recent, active} {
+		if err := profiles.Create(ctx, &domain.Profile{UserID: user.ID}); err != nil {
+			t.Fatalf("create profile: %v", err)
+		}
+		if err := roles.AddRoleToUser(ctx, user.ID, role.ID); err != nil {
+			t.Fatalf("add role: %v", err)
+		}
+	}
+	for _, user := range []*domain.User{old, recent} {
+		if err := users.Delete(ctx, user.ID, false); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	cutoff := time.Now().Add(time.Hour)
+	if _, err := database.Exec(`UPDATE users SET deleted_at = ? WHERE id = ?`, cutoff.Add(-48*time.Hour), old.ID); err != nil {
+		t.Fatalf("backdate deletion: %v", err)
+	}
+	if _, err := database.Exec(`UPDATE users SET deleted_at = ? WHERE id = ?`, cutoff.Add(time.Minute), recent.ID); err != nil {
+		t.Fatalf("postdate deletion: %v", err)
+	}
+
+	ids, err := users.ListDeletedIDs(ctx, cutoff, 10)
+	if err != nil {
+		t.Fatalf("list deleted: %v", err)
+	}
+	if !slices.Equal(ids, []int64{old.ID}) {
+		t.Fatalf("deleted before cutoff = %v, want [%d]", ids, old.ID)
+	}
+
+	// Active users are never purged
+	for _, id := range []int64{old.ID, active.ID} {
+		if err := users.Purge(ctx, id); err != nil {
+			t.Fatalf("purge %d: %v", id, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		user *domain.User
+		kept bool
+	}{
+		{old, false},
+		{recent, true},
+		{active, true},
+	} {
+		var count int
+		if err := database.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ?`, tc.user.ID).Scan(&count); err != nil {
+			t.Fatalf("count users: %v", err)
+		}
+		for _, table := range []string{"profiles", "user_roles"} {
+			var rows int
+			if err := database.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE user_id = ?`, tc.user.ID).Scan(&rows); err != nil {
+				t.Fatalf("count %s: %v", table, err)
+			}
+			count += rows
+		}
+		if kept := count == 3; kept != tc.kept {
+			t.Errorf("%s: %d of 3 rows left, want kept %v", tc.user.Username, count, tc.kept)
+		}
+		if !tc.kept && count != 0 {
+			t.Errorf("%s: %d rows left after purge", tc.user.Username, count)
+		}
+	}
+}
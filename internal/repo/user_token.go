@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewUserTokenRepo),
+	)
+}
+
+// UserTokenRepoParams represents the parameters required for user token repository initialization
+type UserTokenRepoParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// userTokenRepo implements the user token repository interface
+type userTokenRepo struct {
+	db *sql.DB
+}
+
+// NewUserTokenRepo creates a new user token repository instance
+func NewUserTokenRepo(p UserTokenRepoParams) domain.UserTokenRepo {
+	return &userTokenRepo{
+		db: p.DB,
+	}
+}
+
+// Create stores a new user token
+func (r *userTokenRepo) Create(ctx context.Context, token *domain.UserToken) error {
+	token.CreatedAt = time.Now()
+
+	query := `INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.Email,
+		token.ExpiresAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	token.ID = id
+	return nil
+}
+
+// GetByHash retrieves a token by purpose and hash
+func (r *userTokenRepo) GetByHash(ctx context.Context, purpose, tokenHash string) (*domain.UserToken, error) {
+	query := `SELECT id, user_id, purpose, token_hash, email, expires_at, used_at, created_at
+              FROM user_tokens WHERE purpose = ? AND token_hash = ?`
+
+	var token domain.UserToken
+	err := r.db.QueryRowContext(ctx, query, purpose, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.Email,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// Use marks a token as used. It returns false if the token was already used.
+func (r *userTokenRepo) Use(ctx context.Context, id int64) (bool, error) {
+	query := `UPDATE user_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// DeleteByUser removes all tokens of a user for the given purpose
+func (r *userTokenRepo) DeleteByUser(ctx context.Context, userID int64, purpose string) error {
+	query := `DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, purpose)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
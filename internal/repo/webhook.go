@@ -0,0 +1,419 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewWebhookRepo),
+	)
+}
+
+// WebhookRepoParams represents the parameters required for webhook repository initialization
+type WebhookRepoParams struct {
+	fx.In
+
+	DB *sql.DB
+}
+
+// webhookRepo implements the webhook repository interface
+type webhookRepo struct {
+	db *sql.DB
+}
+
+// NewWebhookRepo creates a new webhook repository instance
+func NewWebhookRepo(p WebhookRepoParams) domain.WebhookRepo {
+	return &webhookRepo{
+		db: p.DB,
+	}
+}
+
+const webhookColumns = `id, url, description, events, active, secret, created_at, updated_at`
+
+// scanWebhook scans a webhook row, decoding the space separated events
+func scanWebhook(row rowScanner) (*domain.Webhook, error) {
+	var webhook domain.Webhook
+	var events string
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.URL,
+		&webhook.Description,
+		&events,
+		&webhook.Active,
+		&webhook.Secret,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Events = strings.Fields(events)
+	return &webhook, nil
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event, payload, status, attempts, response_code,
+              next_attempt_at, redelivery, created_at, completed_at`
+
+// scanWebhookDelivery scans a webhook delivery row
+func scanWebhookDelivery(row rowScanner) (*domain.WebhookDelivery, error) {
+	var delivery domain.WebhookDelivery
+	var payload string
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.ResponseCode,
+		&delivery.NextAttemptAt,
+		&delivery.Redelivery,
+		&delivery.CreatedAt,
+		&delivery.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Payload = []byte(payload)
+	return &delivery, nil
+}
+
+// Create creates a new webhook
+func (r *webhookRepo) Create(ctx context.Context, webhook *domain.Webhook) error {
+	now := time.Now()
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+
+	query := `INSERT INTO webhooks (url, description, events, active, secret, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		webhook.URL,
+		webhook.Description,
+		strings.Join(webhook.Events, " "),
+		webhook.Active,
+		webhook.Secret,
+		webhook.CreatedAt,
+		webhook.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	webhook.ID = id
+	return nil
+}
+
+// GetByID retrieves a webhook by ID
+func (r *webhookRepo) GetByID(ctx context.Context, id int64) (*domain.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = ?`
+
+	webhook, err := scanWebhook(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+// Update updates the URL, description, events and state of a webhook
+func (r *webhookRepo) Update(ctx context.Context, webhook *domain.Webhook) error {
+	webhook.UpdatedAt = time.Now()
+
+	query := `UPDATE webhooks SET url = ?, description = ?, events = ?, active = ?, updated_at = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query,
+		webhook.URL,
+		webhook.Description,
+		strings.Join(webhook.Events, " "),
+		webhook.Active,
+		webhook.UpdatedAt,
+		webhook.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete deletes a webhook with its deliveries and their attempts
+func (r *webhookRepo) Delete(ctx context.Context, id int64) error {
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM webhook_attempts WHERE delivery_id IN
+              (SELECT id FROM webhook_deliveries WHERE webhook_id = ?)`, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+		return err
+	})
+}
+
+// List retrieves all webhooks
+func (r *webhookRepo) List(ctx context.Context) ([]*domain.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id DESC`
+
+	return r.list(ctx, query)
+}
+
+// ListActive retrieves the active webhooks subscribed to an event
+func (r *webhookRepo) ListActive(ctx context.Context, event string) ([]*domain.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE active = 1 ORDER BY id`
+
+	webhooks, err := r.list(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscribed []*domain.Webhook
+	for _, webhook := range webhooks {
+		if webhook.Receives(event) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+	return subscribed, nil
+}
+
+// CreateDelivery creates a new delivery, in the transaction of the context if there is one.
+// A second delivery of an event to a webhook is ignored unless it is a redelivery.
+func (r *webhookRepo) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (bool, error) {
+	query := `INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, status, next_attempt_at, redelivery, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
+		delivery.WebhookID,
+		delivery.EventID,
+		delivery.Event,
+		string(delivery.Payload),
+		delivery.Status,
+		delivery.NextAttemptAt,
+		delivery.Redelivery,
+		delivery.CreatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+
+	delivery.ID = id
+	return true, nil
+}
+
+// GetDelivery retrieves a delivery of a webhook by ID
+func (r *webhookRepo) GetDelivery(ctx context.Context, webhookID, id int64) (*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = ? AND webhook_id = ?`
+
+	delivery, err := scanWebhookDelivery(r.db.QueryRowContext(ctx, query, id, webhookID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// ListDeliveries retrieves deliveries of a webhook matching the query, newest first
+func (r *webhookRepo) ListDeliveries(ctx context.Context, webhookID int64, q *domain.WebhookDeliveryQuery, beforeID int64, limit int) ([]*domain.WebhookDelivery, error) {
+	where := []string{"webhook_id = ?"}
+	args := []any{webhookID}
+	if beforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, beforeID)
+	}
+	if q.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, q.Status)
+	}
+	if q.Event != "" {
+		where = append(where, "event = ?")
+		args = append(args, q.Event)
+	}
+
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE ` +
+		strings.Join(where, " AND ") + ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	return r.listDeliveries(ctx, query, args...)
+}
+
+// ListDue retrieves pending deliveries of active webhooks whose next attempt is due, in the
+// order they were created
+func (r *webhookRepo) ListDue(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+              WHERE status = ? AND next_attempt_at <= ?
+              AND webhook_id IN (SELECT id FROM webhooks WHERE active = 1)
+              ORDER BY id LIMIT ?`
+
+	return r.listDeliveries(ctx, query, domain.WebhookDeliveryPending, now, limit)
+}
+
+// RecordAttempt stores an attempt and the resulting state of its delivery
+func (r *webhookRepo) RecordAttempt(ctx context.Context, delivery *domain.WebhookDelivery, attempt *domain.WebhookAttempt) error {
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		query := `INSERT INTO webhook_attempts (delivery_id, response_code, response_body, error, duration_ms, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+
+		result, err := tx.ExecContext(ctx, query,
+			attempt.DeliveryID,
+			attempt.ResponseCode,
+			attempt.ResponseBody,
+			attempt.Error,
+			attempt.Duration,
+			attempt.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if attempt.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		query = `UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, next_attempt_at = ?, completed_at = ?
+              WHERE id = ?`
+
+		_, err = tx.ExecContext(ctx, query,
+			delivery.Status,
+			delivery.Attempts,
+			delivery.ResponseCode,
+			delivery.NextAttemptAt,
+			delivery.CompletedAt,
+			delivery.ID,
+		)
+		return err
+	})
+}
+
+// ListAttempts retrieves the attempts of a delivery in the order they were made
+func (r *webhookRepo) ListAttempts(ctx context.Context, deliveryID int64) ([]*domain.WebhookAttempt, error) {
+	query := `SELECT id, delivery_id, response_code, response_body, error, duration_ms, created_at
+              FROM webhook_attempts WHERE delivery_id = ? ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*domain.WebhookAttempt
+	for rows.Next() {
+		var attempt domain.WebhookAttempt
+		err := rows.Scan(
+			&attempt.ID,
+			&attempt.DeliveryID,
+			&attempt.ResponseCode,
+			&attempt.ResponseBody,
+			&attempt.Error,
+			&attempt.Duration,
+			&attempt.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &attempt)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// DeleteCompleted removes deliveries completed before the given time with their attempts
+func (r *webhookRepo) DeleteCompleted(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM webhook_attempts WHERE delivery_id IN
+              (SELECT id FROM webhook_deliveries WHERE completed_at < ?)`, before)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE completed_at < ?`, before)
+		if err != nil {
+			return err
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	return deleted, err
+}
+
+func (r *webhookRepo) list(ctx context.Context, query string, args ...any) ([]*domain.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*domain.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (r *webhookRepo) listDeliveries(ctx context.Context, query string, args ...any) ([]*domain.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*domain.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewAccountService),
+	)
+}
+
+// Mail templates use the "t" and "n" functions to look up messages in the recipient's locale
+var (
+	verificationMailTmpl = template.Must(template.New("verification").Funcs(i18n.New(i18n.DefaultLocale).FuncMap()).Parse(
+		`{{t "mail.greeting" "username" .Username}}
+
+{{t "mail.verification.body"}}
+
+{{.Link}}
+
+{{.Expiry}}
+{{t "mail.verification.ignore"}}
+`))
+
+	passwordResetMailTmpl = template.Must(template.New("password_reset").Funcs(i18n.New(i18n.DefaultLocale).FuncMap()).Parse(
+		`{{t "mail.greeting" "username" .Username}}
+
+{{t "mail.password_reset.body"}}
+
+{{.Link}}
+
+{{.Expiry}}
+{{t "mail.password_reset.ignore"}}
+`))
+)
+
+// AccountServiceParams represents the parameters required for account service initialization
+type AccountServiceParams struct {
+	fx.In
+
+	Config        *config.Config
+	UserRepo      domain.UserRepo
+	ProfileRepo   domain.ProfileRepo
+	UserTokenRepo domain.UserTokenRepo
+	OAuthRepo     domain.OAuthRepo
+	Mailer        domain.Mailer
+	Transactor    domain.Transactor
+	Auditor       domain.Auditor
+}
+
+// accountService implements the account service interface
+type accountService struct {
+	cfg           *config.Config
+	userRepo      domain.UserRepo
+	profileRepo   domain.ProfileRepo
+	userTokenRepo domain.UserTokenRepo
+	oauthRepo     domain.OAuthRepo
+	mailer        domain.Mailer
+	transactor    domain.Transactor
+	auditor       domain.Auditor
+}
+
+// NewAccountService creates a new account service instance
+func NewAccountService(p AccountServiceParams) domain.AccountService {
+	return &accountService{
+		cfg:           p.Config,
+		userRepo:      p.UserRepo,
+		profileRepo:   p.ProfileRepo,
+		userTokenRepo: p.UserTokenRepo,
+		oauthRepo:     p.OAuthRepo,
+		mailer:        p.Mailer,
+		transactor:    p.Transactor,
+		auditor:       p.Auditor,
+	}
+}
+
+// SendVerificationEmail issues a new verification token and emails it to the user
+func (s *accountService) SendVerificationEmail(ctx context.Context, user *domain.User) error {
+	ttl := s.cfg.Account.VerificationTTL
+	token, err := s.issueToken(ctx, user, domain.TokenPurposeEmailVerification, ttl)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, user, "mail.verification.subject", verificationMailTmpl, "/verify-email", token, ttl)
+}
+
+// ResendVerificationEmail sends a new verification email to an unverified address.
+// It does not reveal whether the address is registered.
+func (s *accountService) ResendVerificationEmail(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || user.EmailVerifiedAt != nil {
+		logger.Info(ctx, "Verification email not sent, address unknown or already verified")
+		return nil
+	}
+
+	return s.SendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail confirms the email address bound to the token and activates
+// accounts that were waiting for verification
+func (s *accountService) VerifyEmail(ctx context.Context, token string) error {
+	userToken, err := s.consumeToken(ctx, domain.TokenPurposeEmailVerification, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userToken.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return domain.ErrUserNotFound
+	}
+	// The token only proves ownership of the address it was sent to
+	if userToken.Email != user.Email {
+		logger.Info(ctx, "Rejected verification token for a changed email address", zap.Int64("user_id", user.ID))
+		return domain.ErrInvalidAccountToken
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if user.Status == domain.UserStatusInactive {
+		user.Status = domain.UserStatusActive
+	}
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := s.userTokenRepo.DeleteByUser(ctx, user.ID, domain.TokenPurposeEmailVerification); err != nil {
+		logger.Error(ctx, "Failed to clean up verification tokens", zap.Error(err))
+	}
+
+	logger.Info(ctx, "Email address verified", zap.Int64("user_id", user.ID))
+	return nil
+}
+
+// RequestPasswordReset emails a password reset link.
+// It does not reveal whether the address is registered.
+func (s *accountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || user.Status == domain.UserStatusLocked {
+		logger.Info(ctx, "Password reset email not sent, address unknown or account locked")
+		return nil
+	}
+
+	ttl := s.cfg.Account.PasswordResetTTL
+	token, err := s.issueToken(ctx, user, domain.TokenPurposePasswordReset, ttl)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, user, "mail.password_reset.subject", passwordResetMailTmpl, "/reset-password", token, ttl)
+}
+
+// ResetPassword sets a new password using a reset token and invalidates all other reset tokens
+func (s *accountService) ResetPassword(ctx context.Context, req *domain.ResetPasswordRequest) error {
+	userToken, err := s.consumeToken(ctx, domain.TokenPurposePasswordReset, req.Token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userToken.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return domain.ErrUserNotFound
+	}
+	// A link sent to a previous address no longer grants access to the account
+	if userToken.Email != user.Email {
+		logger.Info(ctx, "Rejected password reset token for a changed email address", zap.Int64("user_id", user.ID))
+		return domain.ErrInvalidAccountToken
+	}
+
+	// Receiving the reset email proves ownership of the address
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := s.SetPassword(ctx, user, req.Password); err != nil {
+		return err
+	}
+
+	if err := s.userTokenRepo.DeleteByUser(ctx, user.ID, domain.TokenPurposePasswordReset); err != nil {
+		logger.Error(ctx, "Failed to clean up password reset tokens", zap.Error(err))
+	}
+
+	// The request is anonymous, the owner of the reset token is the actor
+	s.auditor.Record(ctx, &domain.AuditEvent{
+		ActorID:    user.ID,
+		Action:     domain.AuditUserPasswordReset,
+		TargetType: domain.AuditTargetUser,
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+	logger.Info(ctx, "Password reset", zap.Int64("user_id", user.ID))
+	return nil
+}
+
+// SetPassword stores the user with a new password, together with any other change made to
+// it. A new password usually follows a suspected compromise, so the access tokens and OAuth
+// refresh tokens obtained with the old one are revoked in the same transaction. API keys are
+// separate credentials and stay valid.
+func (s *accountService) SetPassword(ctx context.Context, user *domain.User, password string) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.Password = hashedPassword
+
+	return s.transactor.InTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if err := s.userTokenRepo.DeleteByUser(ctx, user.ID, domain.TokenPurposeAccess); err != nil {
+			return fmt.Errorf("failed to revoke access tokens: %w", err)
+		}
+		if err := s.oauthRepo.RevokeRefreshTokensByUser(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		return nil
+	})
+}
+
+// issueToken creates a single-use token for the current email address of the user and
+// stores only its hash
+func (s *accountService) issueToken(ctx context.Context, user *domain.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	userToken := &domain.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashSecret(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.userTokenRepo.Create(ctx, userToken); err != nil {
+		return "", fmt.Errorf("failed to save token: %w", err)
+	}
+
+	return token, nil
+}
+
+// consumeToken validates a token and marks it as used
+func (s *accountService) consumeToken(ctx context.Context, purpose, token string) (*domain.UserToken, error) {
+	userToken, err := s.userTokenRepo.GetByHash(ctx, purpose, hashSecret(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+	if userToken == nil || userToken.UsedAt != nil || time.Now().After(userToken.ExpiresAt) {
+		return nil, domain.ErrInvalidAccountToken
+	}
+
+	ok, err := s.userTokenRepo.Use(ctx, userToken.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use token: %w", err)
+	}
+	if !ok {
+		return nil, domain.ErrInvalidAccountToken
+	}
+
+	return userToken, nil
+}
+
+// send renders a templated email containing a token link in the user's locale and delivers it
+func (s *accountService) send(ctx context.Context, user *domain.User, subjectKey string, tmpl *template.Template, path, token string, ttl time.Duration) error {
+	link := s.cfg.Account.BaseURL + path + "?token=" + url.QueryEscape(token)
+	l := s.localizer(ctx, user.ID)
+
+	localized, err := tmpl.Clone()
+	if err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	var body bytes.Buffer
+	err = localized.Funcs(l.FuncMap()).Execute(&body, map[string]any{
+		"Username": user.Username,
+		"Link":     link,
+		"Expiry":   expiryMessage(l, ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	subject := l.T(subjectKey)
+
+	msg := &domain.MailMessage{
+		To:      []string{user.Email},
+		Subject: subject,
+		Text:    body.String(),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	logger.Info(ctx, "Email sent", zap.Int64("user_id", user.ID), zap.String("subject", subject))
+	return nil
+}
+
+// localizer returns a localizer for the user's preferred locale, falling back to
+// the locale of the current request
+func (s *accountService) localizer(ctx context.Context, userID int64) *i18n.Localizer {
+	profile, err := s.profileRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to get user profile", zap.Error(err))
+	}
+
+	preferred := ""
+	if profile != nil {
+		preferred = profile.Locale
+	}
+	return i18n.New(i18n.Negotiate(preferred, i18n.FromContext(ctx).Locale()))
+}
+
+// Helper function: describe when a link expires
+func expiryMessage(l *i18n.Localizer, ttl time.Duration) string {
+	if ttl >= time.Hour {
+		return l.N("mail.expiry.hours", int(ttl.Hours()))
+	}
+	return l.N("mail.expiry.minutes", int(ttl.Minutes()))
+}
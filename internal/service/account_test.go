@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/repo"
+)
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	userRepo := repo.NewUserRepo(repo.UserRepoParams{DB: database})
+	userTokenRepo := repo.NewUserTokenRepo(repo.UserTokenRepoParams{DB: database})
+	oauthRepo := repo.NewOAuthRepo(repo.OAuthRepoParams{DB: database})
+	s := NewAccountService(AccountServiceParams{
+		Config:        newTestConfig(t, nil),
+		UserRepo:      userRepo,
+		ProfileRepo:   repo.NewProfileRepo(repo.ProfileRepoParams{DB: database}),
+		UserTokenRepo: userTokenRepo,
+		OAuthRepo:     oauthRepo,
+		Transactor:    repo.NewTransactor(repo.TransactorParams{DB: database}),
+		Auditor:       newTestAuditor(database),
+	}).(*accountService)
+
+	user := createTestUser(t, database, "alice")
+	other := createTestUser(t, database, "bob")
+
+	for _, u := range []*domain.User{user, other} {
+		if err := userTokenRepo.Create(ctx, &domain.UserToken{
+			UserID: u.ID, Purpose: domain.TokenPurposeAccess, TokenHash: hashSecret("access-" + u.Username), ExpiresAt: time.Now().Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("create access token: %v", err)
+		}
+		if err := oauthRepo.CreateRefreshToken(ctx, &domain.OAuthRefreshToken{
+			TokenHash: hashSecret("refresh-" + u.Username), ClientID: "client", UserID: u.ID, ExpiresAt: time.Now().Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("create refresh token: %v", err)
+		}
+	}
+
+	token, err := s.issueToken(ctx, user, domain.TokenPurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatalf("issue reset token: %v", err)
+	}
+	if err := s.ResetPassword(ctx, &domain.ResetPasswordRequest{Token: token, Password: "N3wPassword"}); err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+
+	updated, err := userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if !verifyPassword(updated.Password, "N3wPassword") {
+		t.Errorf("password was not changed")
+	}
+
+	for _, tc := range []struct {
+		user    *domain.User
+		revoked bool
+	}{
+		{user, true},
+		{other, false},
+	} {
+		access, err := userTokenRepo.GetByHash(ctx, domain.TokenPurposeAccess, hashSecret("access-"+tc.user.Username))
+		if err != nil {
+			t.Fatalf("get access token: %v", err)
+		}
+		if (access == nil) != tc.revoked {
+			t.Errorf("access token of %s: revoked = %v, want %v", tc.user.Username, access == nil, tc.revoked)
+		}
+
+		refresh, err := oauthRepo.GetRefreshToken(ctx, hashSecret("refresh-"+tc.user.Username))
+		if err != nil {
+			t.Fatalf("get refresh token: %v", err)
+		}
+		if (refresh.RevokedAt != nil) != tc.revoked {
+			t.Errorf("refresh token of %s: revoked = %v, want %v", tc.user.Username, refresh.RevokedAt != nil, tc.revoked)
+		}
+	}
+
+	if err := s.ResetPassword(ctx, &domain.ResetPasswordRequest{Token: token, Password: "An0therPassword"}); err == nil {
+		t.Errorf("reset token was accepted twice")
+	}
+}
+
+func TestAccountTokensAreBoundToTheAddress(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		send   func(u *userTest, user *domain.User) error
+		redeem func(u *userTest, token string) error
+	}{
+		{
+			name: "email verification",
+			send: func(u *userTest, user *domain.User) error {
+				return u.accounts.SendVerificationEmail(context.Background(), user)
+			},
+			redeem: func(u *userTest, token string) error {
+				return u.accounts.VerifyEmail(context.Background(), token)
+			},
+		},
+		{
+			name: "password reset",
+			send: func(u *userTest, user *domain.User) error {
+				return u.accounts.RequestPasswordReset(context.Background(), user.Email)
+			},
+			redeem: func(u *userTest, token string) error {
+				return u.accounts.ResetPassword(context.Background(), &domain.ResetPasswordRequest{Token: token, Password: "N3wPassword"})
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			u := newUserTest(t, nil)
+			user := createTestUser(t, u.db, "alice")
+			user.EmailVerifiedAt = nil
+			if err := u.userRepo.Update(ctx, user); err != nil {
+				t.Fatalf("unverify user: %v", err)
+			}
+
+			if err := tc.send(u, user); err != nil {
+				t.Fatalf("send token: %v", err)
+			}
+			token := u.mailToken(t, "alice@example.com")
+
+			user.Email = "mallory@example.com"
+			if err := u.userRepo.Update(ctx, user); err != nil {
+				t.Fatalf("change email: %v", err)
+			}
+			if err := tc.redeem(u, token); !errors.Is(err, domain.ErrInvalidAccountToken) {
+				t.Errorf("redeem after the address changed: err = %v, want %v", err, domain.ErrInvalidAccountToken)
+			}
+
+			changed, err := u.userRepo.GetByID(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("get user: %v", err)
+			}
+			if changed.EmailVerifiedAt != nil {
+				t.Errorf("new address was verified with a token sent to the old one")
+			}
+		})
+	}
+}
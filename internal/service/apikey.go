@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewAPIKeyService),
+	)
+}
+
+// apiKeyLookupSize is the number of random bytes in the visible part of a key
+const apiKeyLookupSize = 6
+
+// APIKeyServiceParams represents the parameters required for API key service initialization
+type APIKeyServiceParams struct {
+	fx.In
+
+	Config     *config.Config
+	APIKeyRepo domain.APIKeyRepo
+	UserRepo   domain.UserRepo
+	RoleRepo   domain.RoleRepo
+	Auditor    domain.Auditor
+}
+
+// apiKeyService implements the API key service interface
+type apiKeyService struct {
+	cfg        *config.Config
+	apiKeyRepo domain.APIKeyRepo
+	userRepo   domain.UserRepo
+	roleRepo   domain.RoleRepo
+	auditor    domain.Auditor
+}
+
+// NewAPIKeyService creates a new API key service instance
+func NewAPIKeyService(p APIKeyServiceParams) domain.APIKeyService {
+	return &apiKeyService{
+		cfg:        p.Config,
+		apiKeyRepo: p.APIKeyRepo,
+		userRepo:   p.UserRepo,
+		roleRepo:   p.RoleRepo,
+		auditor:    p.Auditor,
+	}
+}
+
+// Create issues a new API key. The full key is returned only once.
+func (s *apiKeyService) Create(ctx context.Context, principal *domain.Principal, req *domain.APIKeyRequest) (*domain.APIKeyResponse, error) {
+	// Keys must not be able to mint further keys unless explicitly allowed
+	if principal.Method == domain.AuthMethodAPIKey && !principal.HasPermission(domain.PermissionAPIKeysManage) {
+		return nil, domain.ErrForbidden
+	}
+
+	key := &domain.APIKey{
+		Name:      req.Name,
+		Scopes:    normalizeScopes(req.Scopes),
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	switch {
+	case req.ServiceAccount != "":
+		if !principal.HasPermission(domain.PermissionAPIKeysManage) {
+			return nil, domain.ErrForbidden
+		}
+		key.ServiceAccount = req.ServiceAccount
+	case req.UserID != nil && !principal.IsUser(*req.UserID):
+		if !principal.HasPermission(domain.PermissionAPIKeysManage) {
+			return nil, domain.ErrForbidden
+		}
+		owner, err := s.userRepo.GetByID(ctx, *req.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if owner == nil {
+			return nil, domain.ErrUserNotFound
+		}
+		key.UserID = req.UserID
+	default:
+		if principal.UserID == 0 {
+			return nil, domain.NewValidationError("user_id_required", "service account or user_id is required")
+		}
+		userID := principal.UserID
+		key.UserID = &userID
+	}
+
+	if err := s.validateScopes(principal, key.Scopes); err != nil {
+		return nil, err
+	}
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
+		return nil, domain.ErrInvalidExpiry
+	}
+
+	prefix, secret, err := s.generateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate api key: %w", err)
+	}
+	fullKey := prefix + "_" + secret
+	key.Prefix = prefix
+	key.KeyHash = hashSecret(fullKey)
+
+	if err := s.apiKeyRepo.Create(ctx, key); err != nil {
+		return nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	s.audit(ctx, domain.AuditAPIKeyCreate, key.ID, auditChanges(nil, key))
+	logger.Info(ctx, "API key created", zap.Int64("api_key_id", key.ID), zap.String("prefix", key.Prefix))
+	return &domain.APIKeyResponse{
+		APIKey: *key,
+		Key:    fullKey,
+	}, nil
+}
+
+// Get retrieves an API key visible to the principal
+func (s *apiKeyService) Get(ctx context.Context, principal *domain.Principal, id int64) (*domain.APIKey, error) {
+	key, err := s.apiKeyRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	if key == nil || !s.canManage(principal, key) {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+
+	return key, nil
+}
+
+// List retrieves the principal's own API keys, or all keys when all is set and permitted
+func (s *apiKeyService) List(ctx context.Context, principal *domain.Principal, all bool) ([]*domain.APIKey, error) {
+	if all {
+		if !principal.HasPermission(domain.PermissionAPIKeysManage) {
+			return nil, domain.ErrForbidden
+		}
+		keys, err := s.apiKeyRepo.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list api keys: %w", err)
+		}
+		return keys, nil
+	}
+
+	if principal.UserID == 0 {
+		return []*domain.APIKey{}, nil
+	}
+	keys, err := s.apiKeyRepo.ListByUser(ctx, principal.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Update changes the name, scopes and expiry of an API key
+func (s *apiKeyService) Update(ctx context.Context, principal *domain.Principal, id int64, req *domain.APIKeyUpdateRequest) (*domain.APIKey, error) {
+	key, err := s.Get(ctx, principal, id)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := normalizeScopes(req.Scopes)
+	if err := s.validateScopes(principal, scopes); err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return nil, domain.ErrInvalidExpiry
+	}
+
+	before := *key
+	key.Name = req.Name
+	key.Scopes = scopes
+	key.ExpiresAt = req.ExpiresAt
+	if err := s.apiKeyRepo.Update(ctx, key); err != nil {
+		return nil, fmt.Errorf("failed to update api key: %w", err)
+	}
+	s.audit(ctx, domain.AuditAPIKeyUpdate, key.ID, auditChanges(&before, key))
+
+	return key, nil
+}
+
+// Delete revokes an API key
+func (s *apiKeyService) Delete(ctx context.Context, principal *domain.Principal, id int64) error {
+	key, err := s.Get(ctx, principal, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.apiKeyRepo.Delete(ctx, key.ID); err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+
+	s.audit(ctx, domain.AuditAPIKeyDelete, key.ID, nil)
+	logger.Info(ctx, "API key revoked", zap.Int64("api_key_id", key.ID), zap.String("prefix", key.Prefix))
+	return nil
+}
+
+// Authenticate verifies an API key and resolves the principal it acts as.
+// User-owned keys are limited to the intersection of their scopes and the owner's permissions.
+func (s *apiKeyService) Authenticate(ctx context.Context, fullKey, clientIP string) (*domain.Principal, error) {
+	prefix, ok := s.parseKey(fullKey)
+	if !ok {
+		return nil, domain.ErrUnauthorized
+	}
+
+	key, err := s.apiKeyRepo.GetByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashSecret(fullKey))) != 1 {
+		return nil, domain.ErrUnauthorized
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, domain.ErrUnauthorized
+	}
+
+	principal := &domain.Principal{
+		ServiceAccount: key.ServiceAccount,
+		Roles:          []string{},
+		Permissions:    key.Scopes,
+		Method:         domain.AuthMethodAPIKey,
+		APIKeyID:       key.ID,
+	}
+
+	if key.UserID != nil {
+		owner, err := principalForUser(ctx, s.userRepo, s.roleRepo, *key.UserID, domain.AuthMethodAPIKey)
+		if err != nil {
+			return nil, err
+		}
+		principal.UserID = owner.UserID
+		principal.Roles = owner.Roles
+		principal.Permissions = intersectPermissions(key.Scopes, owner)
+	}
+
+	// Throttle last-used writes so busy keys do not write on every request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= s.cfg.Auth.APIKeyTouchInterval || key.LastUsedIP != clientIP {
+		if err := s.apiKeyRepo.TouchLastUsed(ctx, key.ID, now, clientIP); err != nil {
+			logger.Error(ctx, "Failed to record api key usage", zap.Error(err))
+		}
+	}
+
+	return principal, nil
+}
+
+// audit records an action on an API key in the audit log
+func (s *apiKeyService) audit(ctx context.Context, action string, keyID int64, changes json.RawMessage) {
+	s.auditor.Record(ctx, &domain.AuditEvent{
+		Action:     action,
+		TargetType: domain.AuditTargetAPIKey,
+		TargetID:   strconv.FormatInt(keyID, 10),
+		Changes:    changes,
+	})
+}
+
+// canManage reports whether the principal owns the key or may manage all keys
+func (s *apiKeyService) canManage(principal *domain.Principal, key *domain.APIKey) bool {
+	if principal.HasPermission(domain.PermissionAPIKeysManage) {
+		return true
+	}
+	return key.UserID != nil && principal.IsUser(*key.UserID)
+}
+
+// validateScopes ensures scopes are known and held by the principal creating the key
+func (s *apiKeyService) validateScopes(principal *domain.Principal, scopes []string) error {
+	for _, scope := range scopes {
+		if !isKnownPermission(scope) {
+			return domain.NewUnknownScopeError(scope)
+		}
+		if !principal.HasPermission(scope) {
+			return domain.NewScopeNotAllowedError(scope)
+		}
+	}
+	return nil
+}
+
+// generateKey creates the visible lookup prefix and the secret part of a new key
+func (s *apiKeyService) generateKey() (string, string, error) {
+	lookup := make([]byte, apiKeyLookupSize)
+	if _, err := rand.Read(lookup); err != nil {
+		return "", "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return s.cfg.Auth.APIKeyPrefix + "_" + hex.EncodeToString(lookup), secret, nil
+}
+
+// parseKey extracts the visible prefix from a full key
+func (s *apiKeyService) parseKey(fullKey string) (string, bool) {
+	prefixLen := len(s.cfg.Auth.APIKeyPrefix) + 1 + apiKeyLookupSize*2
+	if !strings.HasPrefix(fullKey, s.cfg.Auth.APIKeyPrefix+"_") || len(fullKey) <= prefixLen+1 || fullKey[prefixLen] != '_' {
+		return "", false
+	}
+	return fullKey[:prefixLen], true
+}
+
+// Helper function: Check whether a scope names a known permission
+func isKnownPermission(scope string) bool {
+	if scope == domain.PermissionAll {
+		return true
+	}
+	for _, permission := range domain.Permissions {
+		if permission == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function: Deduplicate and trim scopes
+func normalizeScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		result = append(result, scope)
+	}
+	return result
+}
+
+// Helper function: Keep only the scopes the owner still holds
+func intersectPermissions(scopes []string, owner *domain.Principal) []string {
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if owner.HasPermission(scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
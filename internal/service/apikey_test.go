@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/repo"
+)
+
+// apiKeyTest is an API key service on a test database with a user without permissions
+type apiKeyTest struct {
+	db       *sql.DB
+	keys     domain.APIKeyService
+	roleRepo domain.RoleRepo
+	admin    *domain.Principal
+	user     *domain.User
+}
+
+// newAPIKeyTest creates an API key service and the user alice
+func newAPIKeyTest(t *testing.T) *apiKeyTest {
+	t.Helper()
+
+	database := newTestDB(t)
+	k := &apiKeyTest{
+		db:       database,
+		roleRepo: repo.NewRoleRepo(repo.RoleRepoParams{DB: database}),
+		admin:    &domain.Principal{Roles: []string{"admin"}, Permissions: []string{domain.PermissionAll}, Method: domain.AuthMethodBearer},
+		user:     createTestUser(t, database, "alice"),
+	}
+	k.keys = NewAPIKeyService(APIKeyServiceParams{
+		Config:     newTestConfig(t, nil),
+		APIKeyRepo: repo.NewAPIKeyRepo(repo.APIKeyRepoParams{DB: database}),
+		UserRepo:   repo.NewUserRepo(repo.UserRepoParams{DB: database}),
+		RoleRepo:   k.roleRepo,
+		Auditor:    newTestAuditor(database),
+	})
+	return k
+}
+
+// createKey creates a key of the user with the given scopes
+func (k *apiKeyTest) createKey(t *testing.T, scopes ...string) *domain.APIKeyResponse {
+	t.Helper()
+
+	key, err := k.keys.Create(context.Background(), k.admin, &domain.APIKeyRequest{Name: "test", Scopes: scopes, UserID: &k.user.ID})
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	return key
+}
+
+// setRole adds or removes a role of the user
+func (k *apiKeyTest) setRole(t *testing.T, name string, granted bool) {
+	t.Helper()
+
+	ctx := context.Background()
+	role, err := k.roleRepo.GetByName(ctx, name)
+	if err != nil || role == nil {
+		t.Fatalf("get role %s: %v", name, err)
+	}
+	if granted {
+		err = k.roleRepo.AddRoleToUser(ctx, k.user.ID, role.ID)
+	} else {
+		err = k.roleRepo.RemoveRoleFromUser(ctx, k.user.ID, role.ID)
+	}
+	if err != nil {
+		t.Fatalf("change role %s: %v", name, err)
+	}
+}
+
+func TestAPIKeyScopesIntersectOwnerPermissions(t *testing.T) {
+	ctx := context.Background()
+	k := newAPIKeyTest(t)
+	key := k.createKey(t, domain.PermissionUsersRead, domain.PermissionRolesRead)
+
+	for _, tc := range []struct {
+		name   string
+		grant  bool // Grants the admin role before authenticating
+		revoke bool // Removes the admin role before authenticating
+		want   []string
+	}{
+		{"owner without permissions", false, false, []string{}},
+		{"owner with all permissions", true, false, []string{domain.PermissionUsersRead, domain.PermissionRolesRead}},
+		{"owner lost its role", false, true, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.grant || tc.revoke {
+				k.setRole(t, "admin", tc.grant)
+			}
+
+			principal, err := k.keys.Authenticate(ctx, key.Key, "127.0.0.1")
+			if err != nil {
+				t.Fatalf("authenticate: %v", err)
+			}
+			if principal.UserID != k.user.ID || principal.APIKeyID != key.ID {
+				t.Errorf("principal = user %d with key %d, want user %d with key %d", principal.UserID, principal.APIKeyID, k.user.ID, key.ID)
+			}
+			if !slices.Equal(principal.Permissions, tc.want) {
+				t.Errorf("permissions = %v, want %v", principal.Permissions, tc.want)
+			}
+			// The scopes limit the key even when its owner may do anything
+			if principal.HasPermission(domain.PermissionUsersDelete) {
+				t.Errorf("key acts with %s outside its scopes", domain.PermissionUsersDelete)
+			}
+		})
+	}
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	ctx := context.Background()
+	k := newAPIKeyTest(t)
+
+	past := time.Now().Add(-time.Minute)
+	if _, err := k.keys.Create(ctx, k.admin, &domain.APIKeyRequest{Name: "expired", ExpiresAt: &past, UserID: &k.user.ID}); err != domain.ErrInvalidExpiry {
+		t.Errorf("create with past expiry: err = %v, want %v", err, domain.ErrInvalidExpiry)
+	}
+
+	future := time.Now().Add(time.Hour)
+	key, err := k.keys.Create(ctx, k.admin, &domain.APIKeyRequest{Name: "expiring", ExpiresAt: &future, UserID: &k.user.ID})
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	if _, err := k.keys.Authenticate(ctx, key.Key, "127.0.0.1"); err != nil {
+		t.Fatalf("authenticate before expiry: %v", err)
+	}
+
+	if _, err := k.db.Exec(`UPDATE api_keys SET expires_at = ? WHERE id = ?`, past, key.ID); err != nil {
+		t.Fatalf("expire key: %v", err)
+	}
+	if _, err := k.keys.Authenticate(ctx, key.Key, "127.0.0.1"); err != domain.ErrUnauthorized {
+		t.Errorf("authenticate after expiry: err = %v, want %v", err, domain.ErrUnauthorized)
+	}
+}
+
+func TestAPIKeyRevocation(t *testing.T) {
+	ctx := context.Background()
+	k := newAPIKeyTest(t)
+	key := k.createKey(t)
+	other := k.createKey(t)
+
+	for _, tc := range []struct {
+		name string
+		key  string
+	}{
+		{"wrong secret", key.Key[:len(key.Key)-1] + "x"},
+		{"unknown prefix", "xx" + key.Key},
+		{"prefix only", key.Prefix},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := k.keys.Authenticate(ctx, tc.key, "127.0.0.1"); err != domain.ErrUnauthorized {
+				t.Errorf("err = %v, want %v", err, domain.ErrUnauthorized)
+			}
+		})
+	}
+
+	owner := &domain.Principal{UserID: k.user.ID, Roles: []string{"user"}, Permissions: []string{}, Method: domain.AuthMethodBearer}
+	if err := k.keys.Delete(ctx, owner, key.ID); err != nil {
+		t.Fatalf("delete api key: %v", err)
+	}
+	if _, err := k.keys.Authenticate(ctx, key.Key, "127.0.0.1"); err != domain.ErrUnauthorized {
+		t.Errorf("authenticate revoked key: err = %v, want %v", err, domain.ErrUnauthorized)
+	}
+	if _, err := k.keys.Authenticate(ctx, other.Key, "127.0.0.1"); err != nil {
+		t.Errorf("revoking one key revoked another: %v", err)
+	}
+
+	// Users can only revoke their own keys
+	stranger := &domain.Principal{UserID: k.user.ID + 1, Permissions: []string{}, Method: domain.AuthMethodBearer}
+	if err := k.keys.Delete(ctx, stranger, other.ID); err != domain.ErrAPIKeyNotFound {
+		t.Errorf("delete by another user: err = %v, want %v", err, domain.ErrAPIKeyNotFound)
+	}
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Options(
+			fx.Provide(NewAuditor),
+			fx.Invoke(StartConfigAudit),
+		),
+	)
+}
+
+// AuditorParams represents the parameters required for auditor initialization
+type AuditorParams struct {
+	fx.In
+
+	AuditRepo  domain.AuditRepo
+	Transactor domain.Transactor
+}
+
+// auditor implements the audit log service interface
+type auditor struct {
+	auditRepo  domain.AuditRepo
+	transactor domain.Transactor
+}
+
+// NewAuditor creates a new auditor instance
+func NewAuditor(p AuditorParams) domain.Auditor {
+	return &auditor{
+		auditRepo:  p.AuditRepo,
+		transactor: p.Transactor,
+	}
+}
+
+// verifyBatchSize is the number of events loaded at a time when verifying the chain
+const verifyBatchSize = 500
+
+// Record appends an event to the audit log
+func (a *auditor) Record(ctx context.Context, event *domain.AuditEvent) {
+	if trace := utils.FromContext(ctx); trace != nil {
+		if event.ActorID == 0 {
+			event.ActorID = trace.UserID
+		}
+		event.ClientIP = trace.ClientIP
+		event.RequestID = trace.RequestID
+	}
+
+	// The transaction holds the write lock from its start, so the last event cannot change
+	// before the new one is chained to it, whichever process writes the other event
+	err := a.transactor.InTx(ctx, func(ctx context.Context) error {
+		last, err := a.auditRepo.Last(ctx)
+		if err != nil {
+			return err
+		}
+		event.PrevHash = ""
+		if last != nil {
+			event.PrevHash = last.Hash
+		}
+		event.CreatedAt = time.Now()
+		event.Hash = auditHash(event)
+
+		return a.auditRepo.Create(ctx, event)
+	})
+	if err != nil {
+		logger.Error(ctx, "Failed to record audit event", zap.String("action", event.Action), zap.Error(err))
+	}
+}
+
+// List retrieves a page of audit events
+func (a *auditor) List(ctx context.Context, query *domain.AuditQuery) (*domain.AuditList, error) {
+	limit := query.Limit
+	if limit < 1 {
+		limit = domain.DefaultPageSize
+	}
+	if limit > domain.MaxPageSize {
+		limit = domain.MaxPageSize
+	}
+
+	var beforeID int64
+	if query.Cursor != "" {
+		id, err := strconv.ParseInt(query.Cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, domain.ErrInvalidCursor
+		}
+		beforeID = id
+	}
+
+	// One extra event tells whether there is a following page
+	events, err := a.auditRepo.List(ctx, query, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	list := &domain.AuditList{
+		Items:      events,
+		Pagination: domain.Pagination{Limit: limit},
+	}
+	if len(events) > limit {
+		list.Items = events[:limit]
+		list.Pagination.HasMore = true
+		list.Pagination.NextCursor = strconv.FormatInt(list.Items[limit-1].ID, 10)
+	}
+	if list.Items == nil {
+		list.Items = []*domain.AuditEvent{}
+	}
+
+	return list, nil
+}
+
+// Verify walks the audit log in insertion order and recomputes every hash
+func (a *auditor) Verify(ctx context.Context) (*domain.AuditVerification, error) {
+	result := &domain.AuditVerification{Valid: true}
+
+	var afterID int64
+	prevHash := ""
+	for {
+		events, err := a.auditRepo.ListAfter(ctx, afterID, verifyBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list audit events: %w", err)
+		}
+
+		for _, event := range events {
+			if event.PrevHash != prevHash || event.Hash != auditHash(event) {
+				logger.Error(ctx, "Audit log hash chain is broken", zap.Int64("event_id", event.ID))
+				result.Valid = false
+				result.BrokenAt = event.ID
+				return result, nil
+			}
+			result.Checked++
+			prevHash = event.Hash
+			afterID = event.ID
+		}
+
+		if len(events) < verifyBatchSize {
+			return result, nil
+		}
+	}
+}
+
+// RecordConfig records the settings that differ from those recorded before. The recorded
+// settings are replayed from the changes of all config.change events, so the audit log
+// itself keeps the history of the configuration.
+func (a *auditor) RecordConfig(ctx context.Context, settings map[string]any) error {
+	// Settings are compared as JSON, the way previous ones are read back
+	var current map[string]any
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		return fmt.Errorf("failed to decode settings: %w", err)
+	}
+
+	return a.transactor.InTx(ctx, func(ctx context.Context) error {
+		recorded, err := a.recordedConfig(ctx)
+		if err != nil {
+			return err
+		}
+		changes := auditChanges(recorded, current)
+		if changes == nil {
+			return nil
+		}
+
+		a.Record(ctx, &domain.AuditEvent{
+			Action:     domain.AuditConfigChange,
+			TargetType: domain.AuditTargetConfig,
+			Changes:    changes,
+		})
+		logger.Info(ctx, "Configuration changes recorded in the audit log")
+		return nil
+	})
+}
+
+// recordedConfig replays the changes of the config.change events in order
+func (a *auditor) recordedConfig(ctx context.Context) (map[string]any, error) {
+	var events []*domain.AuditEvent
+	var beforeID int64
+	for {
+		page, err := a.auditRepo.List(ctx, &domain.AuditQuery{Action: domain.AuditConfigChange}, beforeID, verifyBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list audit events: %w", err)
+		}
+		events = append(events, page...)
+		if len(page) < verifyBatchSize {
+			break
+		}
+		beforeID = page[len(page)-1].ID
+	}
+
+	settings := make(map[string]any)
+	for _, event := range slices.Backward(events) {
+		var changes map[string]domain.AuditChange
+		if err := json.Unmarshal(event.Changes, &changes); err != nil {
+			return nil, fmt.Errorf("failed to decode audit event %d: %w", event.ID, err)
+		}
+		for name, change := range changes {
+			if change.After == nil {
+				delete(settings, name)
+			} else {
+				settings[name] = change.After
+			}
+		}
+	}
+	return settings, nil
+}
+
+// ConfigAuditParams represents the parameters required to audit configuration changes
+type ConfigAuditParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Config    *config.Config
+	Auditor   domain.Auditor
+}
+
+// StartConfigAudit records the configuration changes since the previous start when the
+// application starts. Tools that do not start the application, like the admin CLI, may
+// run with other settings and leave the recorded configuration alone.
+func StartConfigAudit(p ConfigAuditParams) {
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if err := p.Auditor.RecordConfig(ctx, p.Config.Settings()); err != nil {
+				logger.Error(ctx, "Failed to record configuration changes", zap.Error(err))
+			}
+			return nil
+		},
+	})
+}
+
+// Helper function: Hash an audit event together with the hash of its predecessor
+func auditHash(event *domain.AuditEvent) string {
+	data, _ := json.Marshal([]any{
+		event.PrevHash,
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		string(event.Changes),
+		event.Detail,
+		event.ClientIP,
+		event.RequestID,
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditRedactedFields are recorded as changed without their values
+var auditRedactedFields = map[string]bool{
+	"password":      true,
+	"client_secret": true,
+}
+
+// auditIgnoredFields change with every update and are not recorded
+var auditIgnoredFields = map[string]bool{
+	"version":    true,
+	"updated_at": true,
+}
+
+// Helper function: Compare the JSON representations of two values and return the
+// changed top-level fields, nil if nothing changed
+func auditChanges(before, after any) json.RawMessage {
+	var b, a map[string]any
+	if data, err := json.Marshal(before); err == nil {
+		json.Unmarshal(data, &b)
+	}
+	if data, err := json.Marshal(after); err == nil {
+		json.Unmarshal(data, &a)
+	}
+
+	for field := range auditIgnoredFields {
+		delete(b, field)
+		delete(a, field)
+	}
+
+	changes := map[string]domain.AuditChange{}
+	for field, value := range a {
+		if old, ok := b[field]; ok && reflect.DeepEqual(old, value) || !ok && value == nil {
+			continue
+		}
+		changes[field] = domain.AuditChange{Before: b[field], After: value}
+	}
+	for field, old := range b {
+		if _, ok := a[field]; !ok {
+			changes[field] = domain.AuditChange{Before: old}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	for field := range changes {
+		if auditRedactedFields[field] {
+			changes[field] = domain.AuditChange{Before: "[redacted]", After: "[redacted]"}
+		}
+	}
+
+	data, _ := json.Marshal(changes)
+	return data
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/infra/db"
+	"github.com/luxixing/fx-gin/internal/repo"
+)
+
+// newTestAuditor creates an auditor on a database
+func newTestAuditor(database *sql.DB) domain.Auditor {
+	return NewAuditor(AuditorParams{
+		AuditRepo:  repo.NewAuditRepo(repo.AuditRepoParams{DB: database}),
+		Transactor: repo.NewTransactor(repo.TransactorParams{DB: database}),
+	})
+}
+
+func TestRecordFromSeveralProcessesKeepsOneChain(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.db")
+
+	// Separate connection pools stand in for the server and the admin CLI
+	var auditors []domain.Auditor
+	for range 2 {
+		database, err := sql.Open("sqlite3", db.DataSourceName(path))
+		if err != nil {
+			t.Fatalf("open database: %v", err)
+		}
+		t.Cleanup(func() { database.Close() })
+		if err := db.RunMigrations(db.MigrationConfig{DB: database}); err != nil {
+			t.Fatalf("run migrations: %v", err)
+		}
+		auditors = append(auditors, newTestAuditor(database))
+	}
+
+	const perWriter = 25
+	var wg sync.WaitGroup
+	for i, auditor := range auditors {
+		for j := range perWriter {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				auditor.Record(ctx, &domain.AuditEvent{
+					Action:     domain.AuditUserUpdate,
+					TargetType: domain.AuditTargetUser,
+					TargetID:   fmt.Sprintf("%d-%d", i, j),
+				})
+			}()
+		}
+	}
+	wg.Wait()
+
+	result, err := auditors[0].Verify(ctx)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !result.Valid || result.Checked != len(auditors)*perWriter {
+		t.Errorf("verify = %+v, want a valid chain of %d events", result, len(auditors)*perWriter)
+	}
+}
+
+func TestForkedEventIsRejected(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	auditRepo := repo.NewAuditRepo(repo.AuditRepoParams{DB: database})
+	newTestAuditor(database).Record(ctx, &domain.AuditEvent{Action: domain.AuditUserUpdate, TargetType: domain.AuditTargetUser, TargetID: "1"})
+
+	last, err := auditRepo.Last(ctx)
+	if err != nil || last == nil {
+		t.Fatalf("last event: %v", err)
+	}
+	fork := *last
+	fork.TargetID = "2"
+	if err := auditRepo.Create(ctx, &fork); err == nil {
+		t.Errorf("a second event chained to the same predecessor was stored")
+	}
+}
+
+func TestRecordConfigRecordsChangedSettings(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	auditor := newTestAuditor(database)
+
+	starts := []map[string]any{
+		{"APP_PORT": 8080, "MAIL_SMTP_HOST": "smtp.example.com"},
+		{"APP_PORT": 8080, "MAIL_SMTP_HOST": "smtp.example.com"},
+		{"APP_PORT": 9090},
+		{"APP_PORT": 9090},
+	}
+	for _, settings := range starts {
+		if err := auditor.RecordConfig(ctx, settings); err != nil {
+			t.Fatalf("record config: %v", err)
+		}
+	}
+
+	list, err := auditor.List(ctx, &domain.AuditQuery{Action: domain.AuditConfigChange})
+	if err != nil {
+		t.Fatalf("list audit events: %v", err)
+	}
+	if len(list.Items) != 2 {
+		t.Fatalf("recorded %d config changes, want 2", len(list.Items))
+	}
+
+	var changes map[string]domain.AuditChange
+	if err := json.Unmarshal(list.Items[0].Changes, &changes); err != nil {
+		t.Fatalf("decode changes: %v", err)
+	}
+	if len(changes) != 2 || changes["APP_PORT"].After != float64(9090) ||
+		changes["MAIL_SMTP_HOST"].Before != "smtp.example.com" || changes["MAIL_SMTP_HOST"].After != nil {
+		t.Errorf("changes = %+v, want APP_PORT changed and MAIL_SMTP_HOST removed", changes)
+	}
+}
+
+func TestVerifyDetectsChangedEvents(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// tamper changes the stored log and returns the index of the first event reported
+		// and the number of events checked before it, or -1 when the log is intact
+		tamper func(t *testing.T, database *sql.DB, events []*domain.AuditEvent) (int, int)
+	}{
+		{"untouched", func(t *testing.T, database *sql.DB, events []*domain.AuditEvent) (int, int) {
+			return -1, len(events)
+		}},
+		{"changed target", func(t *testing.T, database *sql.DB, events []*domain.AuditEvent) (int, int) {
+			mustExec(t, database, `UPDATE audit_events SET target_id = '99' WHERE id = ?`, events[2].ID)
+			return 2, 2
+		}},
+		{"changed actor", func(t *testing.T, database *sql.DB, events []*domain.AuditEvent) (int, int) {
+			mustExec(t, database, `UPDATE audit_events SET actor_id = 1 WHERE id = ?`, events[2].ID)
+			return 2, 2
+		}},
+		{"changed changes", func(t *testing.T, database *sql.DB, events []*domain.AuditEvent) (int, int) {
+			mustExec(t, database, `UPDATE audit_events SET changes = '{"status":{"from":1,"to":2}}' WHERE id = ?`, events[2].ID)
+			return 2, 2
+		}},
+		{"changed time", func(t *testing.T, database *sql.DB, events []*domain.AuditEvent) (int, int) {
+			mustExec(t, database, `UPDATE audit_events SET created_at = ? WHERE id = ?`, events[2].CreatedAt.Add(-time.Hour), events[2].ID)
+			return 2, 2
+		}},
+		{"deleted event", func(t *testing.T, database *sql.DB, events []*domain.AuditEvent) (int, int) {
+			mustExec(t, database, `DELETE FROM audit_events WHERE id = ?`, events[2].ID)
+			return 3, 2
+		}},
+		{"changed event with a recomputed hash", func(t *testing.T, database *sql.DB, events []*domain.AuditEvent) (int, int) {
+			forged := *events[2]
+			forged.TargetID = "99"
+			mustExec(t, database, `UPDATE audit_events SET target_id = ?, hash = ? WHERE id = ?`, forged.TargetID, auditHash(&forged), forged.ID)
+			return 3, 3
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			database := newTestDB(t)
+			auditor := newTestAuditor(database)
+			for i := range 5 {
+				auditor.Record(ctx, &domain.AuditEvent{
+					ActorID:    42,
+					Action:     domain.AuditUserUpdate,
+					TargetType: domain.AuditTargetUser,
+					TargetID:   fmt.Sprint(i),
+					Changes:    json.RawMessage(`{"status":{"from":0,"to":1}}`),
+				})
+			}
+			events, err := repo.NewAuditRepo(repo.AuditRepoParams{DB: database}).ListAfter(ctx, 0, 10)
+			if err != nil || len(events) != 5 {
+				t.Fatalf("list events: %d, %v", len(events), err)
+			}
+
+			broken, checked := tc.tamper(t, database, events)
+			result, err := auditor.Verify(ctx)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			want := &domain.AuditVerification{Valid: true, Checked: checked}
+			if broken >= 0 {
+				want = &domain.AuditVerification{Checked: checked, BrokenAt: events[broken].ID}
+			}
+			if *result != *want {
+				t.Errorf("verify = %+v, want %+v", result, want)
+			}
+		})
+	}
+}
+
+// mustExec runs a statement directly against the database
+func mustExec(t *testing.T, database *sql.DB, query string, args ...any) {
+	t.Helper()
+
+	if _, err := database.Exec(query, args...); err != nil {
+		t.Fatalf("exec %s: %v", query, err)
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewAuthService),
+	)
+}
+
+// AuthServiceParams represents the parameters required for auth service initialization
+type AuthServiceParams struct {
+	fx.In
+
+	Config        *config.Config
+	UserService   domain.UserService
+	APIKeyService domain.APIKeyService
+	OAuthService  domain.OAuthService
+	UserRepo      domain.UserRepo
+	RoleRepo      domain.RoleRepo
+	ProfileRepo   domain.ProfileRepo
+}
+
+// authService implements the auth service interface
+type authService struct {
+	cfg           *config.Config
+	userService   domain.UserService
+	apiKeyService domain.APIKeyService
+	oauthService  domain.OAuthService
+	userRepo      domain.UserRepo
+	roleRepo      domain.RoleRepo
+	profileRepo   domain.ProfileRepo
+}
+
+// NewAuthService creates a new auth service instance
+func NewAuthService(p AuthServiceParams) domain.AuthService {
+	return &authService{
+		cfg:           p.Config,
+		userService:   p.UserService,
+		apiKeyService: p.APIKeyService,
+		oauthService:  p.OAuthService,
+		userRepo:      p.UserRepo,
+		roleRepo:      p.RoleRepo,
+		profileRepo:   p.ProfileRepo,
+	}
+}
+
+// Authenticate resolves a credential into a principal. Credentials carrying the
+// API key prefix are treated as API keys, JWTs as OAuth2 access tokens and
+// everything else as a bearer access token. Principals of users carry the locale
+// preferred in their profile.
+func (s *authService) Authenticate(ctx context.Context, credential, clientIP string) (*domain.Principal, error) {
+	principal, err := s.authenticate(ctx, credential, clientIP)
+	if err != nil || principal.UserID == 0 {
+		return principal, err
+	}
+
+	profile, err := s.profileRepo.GetByUserID(ctx, principal.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+	if profile != nil {
+		principal.Locale = profile.Locale
+	}
+	return principal, nil
+}
+
+// authenticate resolves a credential into a principal by its kind
+func (s *authService) authenticate(ctx context.Context, credential, clientIP string) (*domain.Principal, error) {
+	if credential == "" {
+		return nil, domain.ErrUnauthorized
+	}
+
+	if strings.HasPrefix(credential, s.cfg.Auth.APIKeyPrefix+"_") {
+		return s.apiKeyService.Authenticate(ctx, credential, clientIP)
+	}
+
+	if strings.Count(credential, ".") == 2 {
+		return s.oauthService.ValidateAccessToken(ctx, credential)
+	}
+
+	userID, err := s.userService.ValidateToken(ctx, credential)
+	if err != nil {
+		return nil, domain.ErrUnauthorized
+	}
+
+	return s.PrincipalForUser(ctx, userID, domain.AuthMethodBearer)
+}
+
+// PrincipalForUser builds a principal with the permissions of the user's roles
+func (s *authService) PrincipalForUser(ctx context.Context, userID int64, method string) (*domain.Principal, error) {
+	return principalForUser(ctx, s.userRepo, s.roleRepo, userID, method)
+}
+
+// Helper function: Build a principal for an active user from their roles
+func principalForUser(ctx context.Context, userRepo domain.UserRepo, roleRepo domain.RoleRepo, userID int64, method string) (*domain.Principal, error) {
+	user, err := userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || user.Status != domain.UserStatusActive {
+		return nil, domain.ErrUnauthorized
+	}
+
+	roles, err := roleRepo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	principal := &domain.Principal{
+		UserID:      userID,
+		Roles:       make([]string, 0, len(roles)),
+		Permissions: []string{},
+		Method:      method,
+	}
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		principal.Roles = append(principal.Roles, role.Name)
+		for _, permission := range domain.RolePermissions[role.Name] {
+			if !seen[permission] {
+				seen[permission] = true
+				principal.Permissions = append(principal.Permissions, permission)
+			}
+		}
+	}
+
+	return principal, nil
+}
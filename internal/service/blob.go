@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewBlobService),
+	)
+}
+
+// BlobServiceParams represents the parameters required for blob service initialization
+type BlobServiceParams struct {
+	fx.In
+
+	Config    *config.Config
+	BlobRepo  domain.BlobRepo
+	BlobStore domain.BlobStore
+}
+
+// blobService implements the blob service interface
+type blobService struct {
+	cfg       *config.Config
+	blobRepo  domain.BlobRepo
+	blobStore domain.BlobStore
+}
+
+// NewBlobService creates a new blob service instance
+func NewBlobService(p BlobServiceParams) domain.BlobService {
+	return &blobService{
+		cfg:       p.Config,
+		blobRepo:  p.BlobRepo,
+		blobStore: p.BlobStore,
+	}
+}
+
+// Save hashes the content into a temporary file and uploads it unless a blob
+// with the same content already exists below prefix
+func (s *blobService) Save(ctx context.Context, prefix string, r io.Reader, contentType string) (*domain.Blob, error) {
+	tmp, err := os.CreateTemp("", "blob-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob content: %w", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	blob := &domain.Blob{
+		Key:         path.Join(prefix, sum[:2], sum),
+		SHA256:      sum,
+		Size:        size,
+		ContentType: contentType,
+	}
+
+	upload := func() error {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return s.blobStore.Put(ctx, blob.Key, tmp, size, contentType)
+	}
+
+	// Upload before recording the blob so a recorded blob always has content
+	existing, err := s.blobRepo.GetByKey(ctx, blob.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+	uploaded := existing == nil
+	if uploaded {
+		if err := upload(); err != nil {
+			return nil, fmt.Errorf("failed to store blob: %w", err)
+		}
+	}
+
+	created, err := s.blobRepo.Acquire(ctx, blob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record blob: %w", err)
+	}
+	// The existing blob was released in the meantime and its content deleted
+	if created && !uploaded {
+		if err := upload(); err != nil {
+			s.Release(ctx, blob.Key)
+			return nil, fmt.Errorf("failed to store blob: %w", err)
+		}
+	}
+
+	if !created {
+		logger.Info(ctx, "Reusing stored blob", zap.String("key", blob.Key), zap.Int("ref_count", blob.RefCount))
+	}
+	return blob, nil
+}
+
+// Open returns the content and metadata of a blob
+func (s *blobService) Open(ctx context.Context, key string) (io.ReadCloser, *domain.Blob, error) {
+	blob, err := s.blobRepo.GetByKey(ctx, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+	if blob == nil {
+		return nil, nil, domain.ErrBlobNotFound
+	}
+
+	content, err := s.blobStore.Open(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, blob, nil
+}
+
+// Release drops a reference and deletes the content when it was the last one
+func (s *blobService) Release(ctx context.Context, key string) error {
+	remaining, err := s.blobRepo.Release(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to release blob: %w", err)
+	}
+	if remaining > 0 {
+		return nil
+	}
+
+	if err := s.blobStore.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// URL returns a download URL valid for BLOB_URL_TTL
+func (s *blobService) URL(ctx context.Context, key string) (string, error) {
+	return s.blobStore.URL(ctx, key, s.cfg.Blob.URLTTL)
+}
+
+// VerifyURL checks a download URL served by the application. Stores with their own
+// download URLs do not serve blobs through the application.
+func (s *blobService) VerifyURL(key, expires, signature string) error {
+	verifier, ok := s.blobStore.(domain.BlobURLVerifier)
+	if !ok {
+		return domain.ErrInvalidBlobURL
+	}
+	return verifier.VerifyURL(key, expires, signature)
+}
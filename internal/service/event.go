@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"github.com/rs/xid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewEventBus),
+	)
+}
+
+const (
+	// relayBatchSize is the number of outbox events loaded at a time
+	relayBatchSize = 100
+	// maxRelayBackoff is the longest wait before retrying the delivery of an event
+	maxRelayBackoff = time.Hour
+)
+
+// AsEventSubscriber annotates a constructor of a domain.EventSubscriber so that its result
+// is added to the subscribers of the event bus
+func AsEventSubscriber(constructor any) any {
+	return fx.Annotate(constructor, fx.ResultTags(`group:"event_subscribers"`))
+}
+
+// EventBusParams represents the parameters required for event bus initialization
+type EventBusParams struct {
+	fx.In
+
+	Lifecycle   fx.Lifecycle
+	Config      *config.Config
+	Transactor  domain.Transactor
+	OutboxRepo  domain.EventOutboxRepo
+	Subscribers []domain.EventSubscriber `group:"event_subscribers"`
+}
+
+// eventBus implements the event bus interface. Events published in a transaction are
+// delivered by the relay, which runs from application start until it stops. Tools that
+// do not start the application leave them in the outbox for the server to deliver.
+type eventBus struct {
+	cfg         *config.EventsConfig
+	transactor  domain.Transactor
+	outboxRepo  domain.EventOutboxRepo
+	subscribers []domain.EventSubscriber
+
+	// Wakes the relay when a transaction with events has committed
+	wake chan struct{}
+	// Tracks asynchronous deliveries, waited for when the application stops
+	async sync.WaitGroup
+}
+
+// NewEventBus creates a new event bus instance and runs its relay with the application
+func NewEventBus(p EventBusParams) domain.EventBus {
+	b := &eventBus{
+		cfg:         p.Config.Events,
+		transactor:  p.Transactor,
+		outboxRepo:  p.OutboxRepo,
+		subscribers: p.Subscribers,
+		wake:        make(chan struct{}, 1),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if b.cfg.RelayInterval <= 0 {
+				logger.Info(ctx, "Delivery of events from the outbox is disabled")
+				close(done)
+				return nil
+			}
+			go func() {
+				defer close(done)
+				b.relay(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			stopped := make(chan struct{})
+			go func() {
+				<-done
+				b.async.Wait()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-stopCtx.Done():
+			}
+			return nil
+		},
+	})
+	return b
+}
+
+// Publish stores events in the outbox of the transaction of the context, or delivers them
+// right away outside a transaction
+func (b *eventBus) Publish(ctx context.Context, events ...domain.Event) error {
+	if !b.transactor.AfterCommit(ctx, b.wakeRelay) {
+		var errs []error
+		for _, event := range events {
+			occurrence := domain.EventOccurrence{ID: xid.New().String(), OccurredAt: time.Now()}
+			errs = append(errs, b.dispatch(domain.WithEventOccurrence(ctx, occurrence), event))
+		}
+		return errors.Join(errs...)
+	}
+
+	now := time.Now()
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", event.EventName(), err)
+		}
+		stored := &domain.OutboxEvent{
+			Name:          event.EventName(),
+			Payload:       payload,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+		if trace := utils.FromContext(ctx); trace != nil {
+			stored.ActorID = trace.UserID
+			stored.RequestID = trace.RequestID
+		}
+		if err := b.outboxRepo.Create(ctx, stored); err != nil {
+			return fmt.Errorf("failed to store event %s: %w", event.EventName(), err)
+		}
+	}
+	return nil
+}
+
+// dispatch delivers an event published outside a transaction to its subscribers.
+// Synchronous subscribers are called in turn and their errors returned; asynchronous ones
+// are called in the background and their errors logged, since there is no outbox entry
+// to retry them from.
+func (b *eventBus) dispatch(ctx context.Context, event domain.Event) error {
+	var errs []error
+	for _, subscriber := range b.subscribers {
+		if !subscriber.Receives(event.EventName()) {
+			continue
+		}
+		if subscriber.Async {
+			b.async.Add(1)
+			go func() {
+				defer b.async.Done()
+				if err := deliver(context.WithoutCancel(ctx), subscriber, event); err != nil {
+					logger.Error(ctx, "Event subscriber failed", zap.String("event", event.EventName()),
+						zap.String("subscriber", subscriber.Name), zap.Error(err))
+				}
+			}()
+			continue
+		}
+		if err := deliver(ctx, subscriber, event); err != nil {
+			logger.Error(ctx, "Event subscriber failed", zap.String("event", event.EventName()),
+				zap.String("subscriber", subscriber.Name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", subscriber.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// relay delivers the events of the outbox whenever a transaction with events commits,
+// and at every interval for events stored by other processes and retries
+func (b *eventBus) relay(ctx context.Context) {
+	ticker := time.NewTicker(b.cfg.RelayInterval)
+	defer ticker.Stop()
+
+	for {
+		b.relayDue(ctx)
+		select {
+		case <-ticker.C:
+			b.removePublished(ctx)
+		case <-b.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// relayDue delivers the events whose next attempt is due
+func (b *eventBus) relayDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := b.outboxRepo.ListDue(ctx, time.Now(), relayBatchSize)
+		if err != nil {
+			logger.Error(ctx, "Failed to list outbox events", zap.Error(err))
+			return
+		}
+		for _, event := range events {
+			b.relayEvent(event)
+		}
+		if len(events) < relayBatchSize {
+			return
+		}
+	}
+}
+
+// relayEvent delivers an outbox event with the trace of the request that published it,
+// and records the outcome. Failed deliveries are retried with exponential backoff until
+// the last attempt.
+func (b *eventBus) relayEvent(stored *domain.OutboxEvent) {
+	requestID := stored.RequestID
+	if requestID == "" {
+		requestID = xid.New().String()
+	}
+	ctx := context.WithValue(context.Background(), domain.TraceKey, &domain.TraceInfo{
+		RequestID: requestID,
+		StartTime: time.Now(),
+		Method:    "EVENT",
+		Path:      stored.Name,
+		UserID:    stored.ActorID,
+	})
+	ctx = domain.WithEventOccurrence(ctx, domain.EventOccurrence{
+		ID:         strconv.FormatInt(stored.ID, 10),
+		OccurredAt: stored.CreatedAt,
+	})
+
+	event, err := domain.DecodeEvent(stored.Name, stored.Payload)
+	if err == nil {
+		err = b.dispatchStored(ctx, stored, event)
+	}
+
+	now := time.Now()
+	if err == nil {
+		stored.PublishedAt = &now
+	} else {
+		stored.Attempts++
+		stored.LastError = err.Error()
+		stored.NextAttemptAt = now.Add(min(time.Second<<min(stored.Attempts, 12), maxRelayBackoff))
+		if stored.Attempts >= b.cfg.MaxAttempts {
+			stored.FailedAt = &now
+			logger.Error(ctx, "Giving up delivery of event", zap.Int64("event_id", stored.ID),
+				zap.String("event", stored.Name), zap.Int("attempts", stored.Attempts), zap.Error(err))
+		}
+	}
+	if err := b.outboxRepo.UpdateDelivery(ctx, stored); err != nil {
+		logger.Error(ctx, "Failed to update outbox event", zap.Int64("event_id", stored.ID), zap.Error(err))
+	}
+}
+
+// dispatchStored delivers an outbox event to the subscribers that have not handled it
+// yet and records those that succeed, so that a retry only calls the ones that failed.
+// The relay already runs in the background, so asynchronous subscribers are called in
+// turn as well and their errors fail the delivery like those of synchronous ones.
+func (b *eventBus) dispatchStored(ctx context.Context, stored *domain.OutboxEvent, event domain.Event) error {
+	var errs []error
+	for _, subscriber := range b.subscribers {
+		if !subscriber.Receives(stored.Name) || slices.Contains(stored.HandledBy, subscriber.Name) {
+			continue
+		}
+		if err := deliver(ctx, subscriber, event); err != nil {
+			logger.Error(ctx, "Event subscriber failed", zap.String("event", stored.Name),
+				zap.String("subscriber", subscriber.Name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", subscriber.Name, err))
+			continue
+		}
+		stored.HandledBy = append(stored.HandledBy, subscriber.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// removePublished removes delivered events once their retention period has passed
+func (b *eventBus) removePublished(ctx context.Context) {
+	if b.cfg.Retention <= 0 {
+		return
+	}
+	if _, err := b.outboxRepo.DeletePublished(ctx, time.Now().Add(-b.cfg.Retention)); err != nil {
+		logger.Error(ctx, "Failed to remove published outbox events", zap.Error(err))
+	}
+}
+
+// wakeRelay lets the relay deliver committed events without waiting for the interval
+func (b *eventBus) wakeRelay() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Helper function: Call a subscriber, reporting a panic as its error
+func deliver(ctx context.Context, subscriber domain.EventSubscriber, event domain.Event) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return subscriber.Handle(ctx, event)
+}
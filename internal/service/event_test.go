@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/repo"
+	"go.uber.org/fx/fxtest"
+)
+
+func TestRelayRetriesOnlyFailedSubscribers(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	transactor := repo.NewTransactor(repo.TransactorParams{DB: database})
+	outboxRepo := repo.NewEventOutboxRepo(repo.EventOutboxRepoParams{DB: database})
+
+	calls := map[string]int{}
+	occurrences := map[string]bool{}
+	failures := 1
+	subscribers := []domain.EventSubscriber{
+		domain.Subscribe("sync", false, func(ctx context.Context, event domain.UserDeleted) error {
+			calls["sync"]++
+			return nil
+		}),
+		domain.Subscribe("async", true, func(ctx context.Context, event domain.UserDeleted) error {
+			calls["async"]++
+			occurrence, _ := domain.EventOccurrenceFromContext(ctx)
+			occurrences[occurrence.ID] = true
+			if failures > 0 {
+				failures--
+				return errors.New("unavailable")
+			}
+			return nil
+		}),
+	}
+	b := NewEventBus(EventBusParams{
+		Lifecycle:   fxtest.NewLifecycle(t),
+		Config:      newTestConfig(t, nil),
+		Transactor:  transactor,
+		OutboxRepo:  outboxRepo,
+		Subscribers: subscribers,
+	}).(*eventBus)
+
+	err := transactor.InTx(ctx, func(ctx context.Context) error {
+		return b.Publish(ctx, domain.UserDeleted{UserID: 1})
+	})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("subscribers were called before the relay: %v", calls)
+	}
+
+	// relay lists the events that are due, including the retry scheduled after a failure
+	relay := func() *domain.OutboxEvent {
+		t.Helper()
+		events, err := outboxRepo.ListDue(ctx, time.Now().Add(time.Hour), relayBatchSize)
+		if err != nil {
+			t.Fatalf("list outbox: %v", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("got %d due events, want 1", len(events))
+		}
+		b.relayEvent(events[0])
+		return events[0]
+	}
+
+	first := relay()
+	if first.PublishedAt != nil || first.Attempts != 1 {
+		t.Errorf("after a failed subscriber: published = %v, attempts = %d", first.PublishedAt != nil, first.Attempts)
+	}
+	if !slices.Equal(first.HandledBy, []string{"sync"}) {
+		t.Errorf("handled by %v, want [sync]", first.HandledBy)
+	}
+
+	second := relay()
+	if second.PublishedAt == nil {
+		t.Errorf("event was not published once every subscriber handled it")
+	}
+	if calls["sync"] != 1 || calls["async"] != 2 {
+		t.Errorf("calls = %v, want sync called once and async retried once", calls)
+	}
+	if id := strconv.FormatInt(first.ID, 10); len(occurrences) != 1 || !occurrences[id] {
+		t.Errorf("retries were delivered with event IDs %v, want the outbox ID %s", occurrences, id)
+	}
+
+	due, err := outboxRepo.ListDue(ctx, time.Now().Add(time.Hour), relayBatchSize)
+	if err != nil {
+		t.Fatalf("list outbox: %v", err)
+	}
+	if len(due) != 0 {
+		t.Errorf("published event is still due")
+	}
+}
+
+func TestPublishOutsideTransaction(t *testing.T) {
+	database := newTestDB(t)
+	b := NewEventBus(EventBusParams{
+		Lifecycle:  fxtest.NewLifecycle(t),
+		Config:     newTestConfig(t, nil),
+		Transactor: repo.NewTransactor(repo.TransactorParams{DB: database}),
+		OutboxRepo: repo.NewEventOutboxRepo(repo.EventOutboxRepoParams{DB: database}),
+		Subscribers: []domain.EventSubscriber{
+			domain.Subscribe("failing", false, func(ctx context.Context, event domain.UserDeleted) error {
+				return errors.New("unavailable")
+			}),
+		},
+	})
+
+	if err := b.Publish(context.Background(), domain.UserDeleted{UserID: 1}); err == nil {
+		t.Errorf("error of a synchronous subscriber was not returned")
+	}
+}
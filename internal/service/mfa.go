@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/totp"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewMFAService),
+	)
+}
+
+// MFAServiceParams represents the parameters required for MFA service initialization
+type MFAServiceParams struct {
+	fx.In
+
+	Config        *config.Config
+	UserRepo      domain.UserRepo
+	MFARepo       domain.MFARepo
+	UserTokenRepo domain.UserTokenRepo
+	Auditor       domain.Auditor
+}
+
+// mfaService implements the MFA service interface
+type mfaService struct {
+	cfg           *config.Config
+	userRepo      domain.UserRepo
+	mfaRepo       domain.MFARepo
+	userTokenRepo domain.UserTokenRepo
+	auditor       domain.Auditor
+}
+
+// NewMFAService creates a new MFA service instance
+func NewMFAService(p MFAServiceParams) domain.MFAService {
+	return &mfaService{
+		cfg:           p.Config,
+		userRepo:      p.UserRepo,
+		mfaRepo:       p.MFARepo,
+		userTokenRepo: p.UserTokenRepo,
+		auditor:       p.Auditor,
+	}
+}
+
+// Enroll starts TOTP enrollment by generating a new secret.
+// The factor stays disabled until it is confirmed with a valid code.
+func (s *mfaService) Enroll(ctx context.Context, userID int64) (*domain.MFAEnrollResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+
+	existing, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa settings: %w", err)
+	}
+	if existing != nil && existing.Enabled {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	mfa := &domain.UserMFA{
+		UserID: userID,
+		Secret: secret,
+	}
+	if existing != nil {
+		mfa.CreatedAt = existing.CreatedAt
+	}
+	if err := s.mfaRepo.Save(ctx, mfa); err != nil {
+		return nil, fmt.Errorf("failed to save mfa settings: %w", err)
+	}
+
+	uri := totp.URI(s.cfg.MFA.Issuer, user.Username, secret)
+	logger.Info(ctx, "TOTP enrollment started", zap.Int64("user_id", userID))
+	return &domain.MFAEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRPayload:  uri,
+	}, nil
+}
+
+// Confirm enables TOTP after verifying the first code and issues recovery codes
+func (s *mfaService) Confirm(ctx context.Context, userID int64, code string) (*domain.MFAConfirmResponse, error) {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa settings: %w", err)
+	}
+	if mfa == nil {
+		return nil, domain.ErrMFAEnrollmentNotStarted
+	}
+	if mfa.Enabled {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	if err := s.verifyTOTP(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.ConfirmedAt = &now
+	if err := s.mfaRepo.Save(ctx, mfa); err != nil {
+		return nil, fmt.Errorf("failed to save mfa settings: %w", err)
+	}
+
+	codes, err := s.generateRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, domain.AuditUserMFAEnable, userID, 0, "")
+	logger.Info(ctx, "TOTP enrollment confirmed", zap.Int64("user_id", userID))
+	return &domain.MFAConfirmResponse{RecoveryCodes: codes}, nil
+}
+
+// Disable turns off TOTP after verifying a current code or recovery code
+func (s *mfaService) Disable(ctx context.Context, userID int64, code string) error {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get mfa settings: %w", err)
+	}
+	if mfa == nil || !mfa.Enabled {
+		return domain.ErrMFANotEnabled
+	}
+
+	if err := s.verifyCode(ctx, mfa, code); err != nil {
+		return err
+	}
+
+	if err := s.mfaRepo.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete mfa settings: %w", err)
+	}
+
+	s.audit(ctx, domain.AuditUserMFADisable, userID, 0, "")
+	logger.Info(ctx, "TOTP disabled", zap.Int64("user_id", userID))
+	return nil
+}
+
+// Reset removes the TOTP factor and recovery codes of a user, enabled or still pending,
+// without verifying a code
+func (s *mfaService) Reset(ctx context.Context, userID int64) error {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get mfa settings: %w", err)
+	}
+	if mfa == nil {
+		return domain.ErrMFANotEnabled
+	}
+
+	if err := s.mfaRepo.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete mfa settings: %w", err)
+	}
+
+	s.audit(ctx, domain.AuditUserMFADisable, userID, 0, "reset")
+	logger.Info(ctx, "TOTP reset", zap.Int64("user_id", userID))
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after verifying a current TOTP code
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) (*domain.MFAConfirmResponse, error) {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa settings: %w", err)
+	}
+	if mfa == nil || !mfa.Enabled {
+		return nil, domain.ErrMFANotEnabled
+	}
+
+	if err := s.verifyTOTP(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.generateRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, domain.AuditUserMFARecoveryCodes, userID, 0, "")
+	return &domain.MFAConfirmResponse{RecoveryCodes: codes}, nil
+}
+
+// CompleteLogin verifies the second factor for a pending challenge and issues a full token
+func (s *mfaService) CompleteLogin(ctx context.Context, req *domain.MFALoginRequest) (*domain.TokenResponse, error) {
+	challenge, err := s.mfaRepo.GetChallenge(ctx, hashSecret(req.ChallengeToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get challenge: %w", err)
+	}
+	if challenge == nil || challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) {
+		var userID int64
+		if challenge != nil {
+			userID = challenge.UserID
+		}
+		s.audit(ctx, domain.AuditUserLoginFailed, userID, 0, domain.ErrInvalidChallenge.Code)
+		return nil, domain.ErrInvalidChallenge
+	}
+	if challenge.Attempts >= s.cfg.MFA.MaxAttempts {
+		s.audit(ctx, domain.AuditUserLoginFailed, challenge.UserID, 0, domain.ErrTooManyAttempts.Code)
+		return nil, domain.ErrTooManyAttempts
+	}
+
+	mfa, err := s.mfaRepo.GetByUserID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa settings: %w", err)
+	}
+	if mfa == nil || !mfa.Enabled {
+		s.audit(ctx, domain.AuditUserLoginFailed, challenge.UserID, 0, domain.ErrInvalidChallenge.Code)
+		return nil, domain.ErrInvalidChallenge
+	}
+
+	if err := s.verifyCode(ctx, mfa, req.Code); err != nil {
+		if incErr := s.mfaRepo.IncrementChallengeAttempts(ctx, challenge.ID); incErr != nil {
+			logger.Error(ctx, "Failed to record challenge attempt", zap.Error(incErr))
+		}
+		var codeErr *domain.Error
+		if errors.As(err, &codeErr) {
+			s.audit(ctx, domain.AuditUserLoginFailed, challenge.UserID, 0, codeErr.Code)
+		}
+		return nil, err
+	}
+
+	// Consume the challenge so it cannot be completed twice
+	ok, err := s.mfaRepo.UseChallenge(ctx, challenge.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use challenge: %w", err)
+	}
+	if !ok {
+		s.audit(ctx, domain.AuditUserLoginFailed, challenge.UserID, 0, domain.ErrInvalidChallenge.Code)
+		return nil, domain.ErrInvalidChallenge
+	}
+
+	resp, err := issueAccessToken(ctx, s.userTokenRepo, challenge.UserID, s.cfg.Auth.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	// The detail tells whether a recovery code was used instead of the authenticator
+	factor := "totp"
+	if len(strings.TrimSpace(req.Code)) != totp.Digits {
+		factor = "recovery_code"
+	}
+	s.audit(ctx, domain.AuditUserLogin, challenge.UserID, challenge.UserID, factor)
+	return resp, nil
+}
+
+// verifyCode accepts either a TOTP code or an unused recovery code
+func (s *mfaService) verifyCode(ctx context.Context, mfa *domain.UserMFA, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.verifyTOTP(ctx, mfa, code)
+	}
+
+	ok, err := s.mfaRepo.UseRecoveryCode(ctx, mfa.UserID, hashSecret(normalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("failed to verify recovery code: %w", err)
+	}
+	if !ok {
+		return domain.ErrInvalidVerificationCode
+	}
+
+	logger.Warn(ctx, "Recovery code used", zap.Int64("user_id", mfa.UserID))
+	return nil
+}
+
+// verifyTOTP validates a TOTP code and rejects reuse of an already accepted step
+func (s *mfaService) verifyTOTP(ctx context.Context, mfa *domain.UserMFA, code string) error {
+	step, ok := totp.Validate(mfa.Secret, code, time.Now(), s.cfg.MFA.Skew)
+	if !ok || step <= mfa.LastUsedStep {
+		return domain.ErrInvalidVerificationCode
+	}
+
+	mfa.LastUsedStep = step
+	if err := s.mfaRepo.Save(ctx, mfa); err != nil {
+		return fmt.Errorf("failed to save mfa settings: %w", err)
+	}
+	return nil
+}
+
+// generateRecoveryCodes creates a fresh set of recovery codes and stores their hashes
+func (s *mfaService) generateRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, s.cfg.MFA.RecoveryCodeCount)
+	hashes := make([]string, len(codes))
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := hex.EncodeToString(buf)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashSecret(code)
+	}
+
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// audit records an MFA action on a user in the audit log. Logins are anonymous requests,
+// a successful one passes the user signing in as the actor.
+func (s *mfaService) audit(ctx context.Context, action string, userID, actorID int64, detail string) {
+	event := &domain.AuditEvent{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: domain.AuditTargetUser,
+		Detail:     detail,
+	}
+	if userID != 0 {
+		event.TargetID = strconv.FormatInt(userID, 10)
+	}
+	s.auditor.Record(ctx, event)
+}
+
+// Helper function: Normalize a recovery code for hashing
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", "_", "", " ", "").Replace(code)
+}
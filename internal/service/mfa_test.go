@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/repo"
+	"github.com/luxixing/fx-gin/pkg/totp"
+)
+
+func TestCompleteLoginIsAudited(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	cfg := newTestConfig(t, nil)
+	mfaRepo := repo.NewMFARepo(repo.MFARepoParams{DB: database})
+	auditor := newTestAuditor(database)
+	s := NewMFAService(MFAServiceParams{
+		Config:        cfg,
+		UserRepo:      repo.NewUserRepo(repo.UserRepoParams{DB: database}),
+		MFARepo:       mfaRepo,
+		UserTokenRepo: repo.NewUserTokenRepo(repo.UserTokenRepoParams{DB: database}),
+		Auditor:       auditor,
+	})
+
+	user := createTestUser(t, database, "alice")
+	enrollment, err := s.Enroll(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	confirmed, err := s.Confirm(ctx, user.ID, code)
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		code   string
+		action string
+		actor  int64
+		detail string
+	}{
+		{"wrong code", "zzzzz-zzzzz", domain.AuditUserLoginFailed, 0, domain.ErrInvalidVerificationCode.Code},
+		{"recovery code", confirmed.RecoveryCodes[0], domain.AuditUserLogin, user.ID, "recovery_code"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			challenge, err := createMFAChallenge(ctx, mfaRepo, user.ID, cfg.MFA.ChallengeTTL)
+			if err != nil {
+				t.Fatalf("create challenge: %v", err)
+			}
+			s.CompleteLogin(ctx, &domain.MFALoginRequest{ChallengeToken: challenge.ChallengeToken, Code: tc.code})
+
+			list, err := auditor.List(ctx, &domain.AuditQuery{TargetType: domain.AuditTargetUser, TargetID: strconv.FormatInt(user.ID, 10)})
+			if err != nil {
+				t.Fatalf("list audit events: %v", err)
+			}
+			last := list.Items[0]
+			if last.Action != tc.action || last.ActorID != tc.actor || last.Detail != tc.detail {
+				t.Errorf("last event = %s by %d (%s), want %s by %d (%s)",
+					last.Action, last.ActorID, last.Detail, tc.action, tc.actor, tc.detail)
+			}
+		})
+	}
+}
+
+func TestResetRemovesTheFactorWithoutACode(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	mfaRepo := repo.NewMFARepo(repo.MFARepoParams{DB: database})
+	auditor := newTestAuditor(database)
+	s := NewMFAService(MFAServiceParams{
+		Config:        newTestConfig(t, nil),
+		UserRepo:      repo.NewUserRepo(repo.UserRepoParams{DB: database}),
+		MFARepo:       mfaRepo,
+		UserTokenRepo: repo.NewUserTokenRepo(repo.UserTokenRepoParams{DB: database}),
+		Auditor:       auditor,
+	})
+
+	user := createTestUser(t, database, "alice")
+	if err := s.Reset(ctx, user.ID); err != domain.ErrMFANotEnabled {
+		t.Fatalf("reset without a factor: err = %v, want %v", err, domain.ErrMFANotEnabled)
+	}
+
+	enrollment, err := s.Enroll(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	if _, err := s.Confirm(ctx, user.ID, code); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+
+	if err := s.Reset(ctx, user.ID); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	mfa, err := mfaRepo.GetByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get mfa settings: %v", err)
+	}
+	if mfa != nil {
+		t.Errorf("factor was not removed")
+	}
+
+	list, err := auditor.List(ctx, &domain.AuditQuery{TargetType: domain.AuditTargetUser, TargetID: strconv.FormatInt(user.ID, 10)})
+	if err != nil {
+		t.Fatalf("list audit events: %v", err)
+	}
+	if last := list.Items[0]; last.Action != domain.AuditUserMFADisable || last.Detail != "reset" {
+		t.Errorf("last event = %s (%s), want %s (reset)", last.Action, last.Detail, domain.AuditUserMFADisable)
+	}
+}
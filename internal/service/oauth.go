@@ -0,0 +1,727 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewOAuthService),
+	)
+}
+
+// PKCE code challenge method, plain challenges are not supported
+const codeChallengeMethodS256 = "S256"
+
+// OAuthServiceParams represents the parameters required for OAuth2 service initialization
+type OAuthServiceParams struct {
+	fx.In
+
+	Config    *config.Config
+	OAuthRepo domain.OAuthRepo
+	UserRepo  domain.UserRepo
+	RoleRepo  domain.RoleRepo
+	Signer    domain.TokenSigner
+	Auditor   domain.Auditor
+}
+
+// oauthService implements the OAuth2 service interface
+type oauthService struct {
+	cfg       *config.Config
+	oauthRepo domain.OAuthRepo
+	userRepo  domain.UserRepo
+	roleRepo  domain.RoleRepo
+	signer    domain.TokenSigner
+	auditor   domain.Auditor
+}
+
+// NewOAuthService creates a new OAuth2 service instance
+func NewOAuthService(p OAuthServiceParams) domain.OAuthService {
+	return &oauthService{
+		cfg:       p.Config,
+		oauthRepo: p.OAuthRepo,
+		userRepo:  p.UserRepo,
+		roleRepo:  p.RoleRepo,
+		signer:    p.Signer,
+		auditor:   p.Auditor,
+	}
+}
+
+// RegisterClient registers a new OAuth2 client. The secret of confidential clients is returned only once.
+func (s *oauthService) RegisterClient(ctx context.Context, principal *domain.Principal, req *domain.OAuthClientRequest) (*domain.OAuthClientResponse, error) {
+	client := &domain.OAuthClient{
+		Name:         req.Name,
+		RedirectURIs: normalizeScopes(req.RedirectURIs),
+		GrantTypes:   normalizeScopes(req.GrantTypes),
+		Scopes:       normalizeScopes(req.Scopes),
+		Confidential: req.Confidential,
+	}
+
+	for _, grantType := range client.GrantTypes {
+		switch grantType {
+		case domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken:
+		case domain.GrantTypeClientCredentials:
+			if !client.Confidential {
+				return nil, domain.NewValidationError("invalid_grant_types", "client_credentials requires a confidential client")
+			}
+		default:
+			return nil, domain.NewValidationError("invalid_grant_types", "unsupported grant type: "+grantType)
+		}
+	}
+	if containsString(client.GrantTypes, domain.GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return nil, domain.NewValidationError("invalid_redirect_uri", "authorization_code requires at least one redirect URI")
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return nil, domain.NewValidationError("invalid_redirect_uri", "invalid redirect URI: "+redirectURI)
+		}
+	}
+	// Clients must not be able to obtain more than their creator holds
+	for _, scope := range client.Scopes {
+		if !isKnownPermission(scope) {
+			return nil, domain.NewUnknownScopeError(scope)
+		}
+		if !principal.HasPermission(scope) {
+			return nil, domain.NewScopeNotAllowedError(scope)
+		}
+	}
+
+	lookup := make([]byte, 12)
+	if _, err := rand.Read(lookup); err != nil {
+		return nil, fmt.Errorf("failed to generate client id: %w", err)
+	}
+	client.ClientID = hex.EncodeToString(lookup)
+
+	var secret string
+	if client.Confidential {
+		var err error
+		secret, err = randomToken(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate client secret: %w", err)
+		}
+		client.SecretHash = hashSecret(secret)
+	}
+
+	if err := s.oauthRepo.CreateClient(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to create oauth client: %w", err)
+	}
+
+	s.auditor.Record(ctx, &domain.AuditEvent{
+		Action:     domain.AuditOAuthClientRegister,
+		TargetType: domain.AuditTargetOAuthClient,
+		TargetID:   client.ClientID,
+		Changes:    auditChanges(nil, client),
+	})
+	logger.Info(ctx, "OAuth client registered", zap.String("client_id", client.ClientID))
+	return &domain.OAuthClientResponse{
+		OAuthClient:  *client,
+		ClientSecret: secret,
+	}, nil
+}
+
+// ListClients retrieves all registered OAuth2 clients
+func (s *oauthService) ListClients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	clients, err := s.oauthRepo.ListClients(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list oauth clients: %w", err)
+	}
+	if clients == nil {
+		clients = []*domain.OAuthClient{}
+	}
+	return clients, nil
+}
+
+// DeleteClient deletes an OAuth2 client. Its access tokens stop validating immediately.
+func (s *oauthService) DeleteClient(ctx context.Context, clientID string) error {
+	client, err := s.oauthRepo.GetClient(ctx, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to get oauth client: %w", err)
+	}
+	if client == nil {
+		return domain.ErrOAuthClientNotFound
+	}
+
+	if err := s.oauthRepo.DeleteClient(ctx, clientID); err != nil {
+		return fmt.Errorf("failed to delete oauth client: %w", err)
+	}
+
+	s.auditor.Record(ctx, &domain.AuditEvent{
+		Action:     domain.AuditOAuthClientDelete,
+		TargetType: domain.AuditTargetOAuthClient,
+		TargetID:   clientID,
+		Changes:    auditChanges(client, nil),
+	})
+	logger.Info(ctx, "OAuth client deleted", zap.String("client_id", clientID))
+	return nil
+}
+
+// Authorize handles an authorization request on behalf of the signed in user.
+// Errors about the client or redirect URI are returned directly, all other
+// errors are reported to the client through the redirect URI.
+func (s *oauthService) Authorize(ctx context.Context, principal *domain.Principal, req *domain.AuthorizeRequest) (*domain.AuthorizeResponse, error) {
+	// Only the user themselves may grant access, not tokens issued to other clients
+	if principal.UserID == 0 || principal.Method == domain.AuthMethodOAuth {
+		return nil, domain.ErrForbidden
+	}
+
+	client, err := s.oauthRepo.GetClient(ctx, req.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth client: %w", err)
+	}
+	if client == nil {
+		return nil, domain.NewOAuthError(http.StatusBadRequest, "invalid_request", "unknown client")
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !containsString(client.RedirectURIs, redirectURI) {
+		return nil, domain.NewOAuthError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered")
+	}
+
+	reject := func(code, description string) (*domain.AuthorizeResponse, error) {
+		return &domain.AuthorizeResponse{
+			RedirectTo: withQuery(redirectURI, url.Values{
+				"error":             {code},
+				"error_description": {description},
+				"state":             {req.State},
+			}),
+		}, nil
+	}
+
+	if req.ResponseType != "code" {
+		return reject("unsupported_response_type", "only the code response type is supported")
+	}
+	if !containsString(client.GrantTypes, domain.GrantTypeAuthorizationCode) {
+		return reject("unauthorized_client", "client may not use the authorization code grant")
+	}
+	if req.CodeChallenge != "" && req.CodeChallengeMethod != codeChallengeMethodS256 {
+		return reject("invalid_request", "code_challenge_method must be S256")
+	}
+	if req.CodeChallenge == "" && !client.Confidential {
+		return reject("invalid_request", "public clients must use PKCE")
+	}
+
+	scopes, ok := requestedScopes(req.Scope, client.Scopes)
+	if !ok {
+		return reject("invalid_scope", "requested scope is not allowed for this client")
+	}
+
+	consent, err := s.oauthRepo.GetConsent(ctx, principal.UserID, client.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consent: %w", err)
+	}
+	granted := consent != nil && isSubset(scopes, strings.Fields(consent.Scope))
+
+	if req.Approve != nil && !*req.Approve {
+		return reject("access_denied", "the user denied the request")
+	}
+	if !granted {
+		if req.Approve == nil {
+			return &domain.AuthorizeResponse{
+				ConsentRequired: true,
+				Client:          client.Name,
+				Scopes:          scopes,
+			}, nil
+		}
+
+		consentScopes := scopes
+		if consent != nil {
+			consentScopes = normalizeScopes(append(strings.Fields(consent.Scope), scopes...))
+		}
+		err := s.oauthRepo.SaveConsent(ctx, &domain.OAuthConsent{
+			UserID:   principal.UserID,
+			ClientID: client.ClientID,
+			Scope:    strings.Join(consentScopes, " "),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save consent: %w", err)
+		}
+	}
+
+	code, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate authorization code: %w", err)
+	}
+	err = s.oauthRepo.CreateAuthorizationCode(ctx, &domain.OAuthAuthorizationCode{
+		CodeHash:            hashSecret(code),
+		ClientID:            client.ClientID,
+		UserID:              principal.UserID,
+		RedirectURI:         req.RedirectURI, // Must be repeated in the token request only if it was sent here
+		Scope:               strings.Join(scopes, " "),
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().Add(s.cfg.OAuth.CodeTTL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save authorization code: %w", err)
+	}
+
+	logger.Info(ctx, "Authorization code issued", zap.String("client_id", client.ClientID), zap.Int64("user_id", principal.UserID))
+	return &domain.AuthorizeResponse{
+		RedirectTo: withQuery(redirectURI, url.Values{
+			"code":  {code},
+			"state": {req.State},
+		}),
+	}, nil
+}
+
+// Token handles a token request for the authorization code, refresh token
+// and client credentials grants
+func (s *oauthService) Token(ctx context.Context, req *domain.TokenRequest) (*domain.OAuthTokenResponse, error) {
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !containsString(client.GrantTypes, req.GrantType) {
+		switch req.GrantType {
+		case domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken, domain.GrantTypeClientCredentials:
+			return nil, domain.NewOAuthError(http.StatusBadRequest, "unauthorized_client", "client may not use this grant type")
+		default:
+			return nil, domain.NewOAuthError(http.StatusBadRequest, "unsupported_grant_type", "")
+		}
+	}
+
+	switch req.GrantType {
+	case domain.GrantTypeAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case domain.GrantTypeRefreshToken:
+		return s.refresh(ctx, client, req)
+	default:
+		scopes, ok := requestedScopes(req.Scope, client.Scopes)
+		if !ok {
+			return nil, domain.NewOAuthError(http.StatusBadRequest, "invalid_scope", "")
+		}
+		return s.issueTokens(ctx, client, 0, scopes, false)
+	}
+}
+
+// Introspect reports the state of a token to an authenticated confidential client (RFC 7662)
+func (s *oauthService) Introspect(ctx context.Context, clientID, clientSecret, token string) (*domain.IntrospectionResponse, error) {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.Confidential {
+		return nil, domain.NewOAuthError(http.StatusUnauthorized, "invalid_client", "introspection requires a confidential client")
+	}
+
+	inactive := &domain.IntrospectionResponse{Active: false}
+
+	if claims, err := s.verifyAccessToken(ctx, token); err == nil {
+		return &domain.IntrospectionResponse{
+			Active:    true,
+			Scope:     claimString(claims, "scope"),
+			ClientID:  claimString(claims, "client_id"),
+			Subject:   claimString(claims, "sub"),
+			TokenType: "Bearer",
+			ExpiresAt: claimInt(claims, "exp"),
+			IssuedAt:  claimInt(claims, "iat"),
+			Issuer:    s.cfg.OAuth.Issuer,
+		}, nil
+	}
+
+	refreshToken, err := s.oauthRepo.GetRefreshToken(ctx, hashSecret(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	// Refresh tokens are only disclosed to the client they were issued to
+	if refreshToken == nil || refreshToken.ClientID != client.ClientID ||
+		refreshToken.RevokedAt != nil || time.Now().After(refreshToken.ExpiresAt) {
+		return inactive, nil
+	}
+
+	return &domain.IntrospectionResponse{
+		Active:    true,
+		Scope:     refreshToken.Scope,
+		ClientID:  refreshToken.ClientID,
+		Subject:   strconv.FormatInt(refreshToken.UserID, 10),
+		TokenType: "refresh_token",
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+		Issuer:    s.cfg.OAuth.Issuer,
+	}, nil
+}
+
+// Revoke revokes an access or refresh token issued to the client (RFC 7009).
+// Unknown tokens are ignored.
+func (s *oauthService) Revoke(ctx context.Context, clientID, clientSecret, token string) error {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	if claims, err := s.signer.Verify(token); err == nil {
+		if claimString(claims, "client_id") != client.ClientID {
+			return nil
+		}
+		expiresAt := time.Unix(claimInt(claims, "exp"), 0)
+		if err := s.oauthRepo.RevokeAccessToken(ctx, claimString(claims, "jti"), expiresAt); err != nil {
+			return fmt.Errorf("failed to revoke access token: %w", err)
+		}
+		logger.Info(ctx, "Access token revoked", zap.String("client_id", client.ClientID))
+		return nil
+	}
+
+	refreshToken, err := s.oauthRepo.GetRefreshToken(ctx, hashSecret(token))
+	if err != nil {
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if refreshToken == nil || refreshToken.ClientID != client.ClientID {
+		return nil
+	}
+	if _, err := s.oauthRepo.RevokeRefreshToken(ctx, refreshToken.ID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	logger.Info(ctx, "Refresh token revoked", zap.String("client_id", client.ClientID))
+	return nil
+}
+
+// RevokeConsent withdraws the consent a user granted to a client and revokes its refresh tokens
+func (s *oauthService) RevokeConsent(ctx context.Context, userID int64, clientID string) error {
+	if err := s.oauthRepo.DeleteConsent(ctx, userID, clientID); err != nil {
+		return fmt.Errorf("failed to delete consent: %w", err)
+	}
+	if err := s.oauthRepo.RevokeRefreshTokensByClientUser(ctx, clientID, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	logger.Info(ctx, "OAuth consent revoked", zap.String("client_id", clientID), zap.Int64("user_id", userID))
+	return nil
+}
+
+// ValidateAccessToken verifies a signed access token and resolves its principal.
+// User tokens are limited to the intersection of their scopes and the user's permissions.
+func (s *oauthService) ValidateAccessToken(ctx context.Context, token string) (*domain.Principal, error) {
+	claims, err := s.verifyAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := claimString(claims, "client_id")
+	client, err := s.oauthRepo.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth client: %w", err)
+	}
+	if client == nil {
+		return nil, domain.ErrUnauthorized
+	}
+
+	scopes := strings.Fields(claimString(claims, "scope"))
+	subject := claimString(claims, "sub")
+
+	// Client credentials tokens have no resource owner, their subject is the client (RFC 9068)
+	if subject == clientID {
+		return &domain.Principal{
+			ServiceAccount: "client:" + clientID,
+			Roles:          []string{},
+			Permissions:    intersectPermissions(scopes, &domain.Principal{Permissions: client.Scopes}),
+			Method:         domain.AuthMethodOAuth,
+			ClientID:       clientID,
+		}, nil
+	}
+
+	userID, err := strconv.ParseInt(subject, 10, 64)
+	if err != nil {
+		return nil, domain.ErrUnauthorized
+	}
+	owner, err := principalForUser(ctx, s.userRepo, s.roleRepo, userID, domain.AuthMethodOAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	owner.Permissions = intersectPermissions(scopes, owner)
+	owner.ClientID = clientID
+	return owner, nil
+}
+
+// JWKS returns the public keys used to sign access tokens
+func (s *oauthService) JWKS() map[string]any {
+	return s.signer.JWKS()
+}
+
+// Metadata returns the authorization server metadata (RFC 8414)
+func (s *oauthService) Metadata() map[string]any {
+	issuer := strings.TrimRight(s.cfg.OAuth.Issuer, "/")
+	return map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"introspection_endpoint":                issuer + "/oauth/introspect",
+		"revocation_endpoint":                   issuer + "/oauth/revoke",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"scopes_supported":                      domain.Permissions,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeClientCredentials, domain.GrantTypeRefreshToken},
+		"code_challenge_methods_supported":      []string{codeChallengeMethodS256},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	}
+}
+
+// exchangeCode redeems an authorization code
+func (s *oauthService) exchangeCode(ctx context.Context, client *domain.OAuthClient, req *domain.TokenRequest) (*domain.OAuthTokenResponse, error) {
+	invalidGrant := domain.NewOAuthError(http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+
+	code, err := s.oauthRepo.GetAuthorizationCode(ctx, hashSecret(req.Code))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authorization code: %w", err)
+	}
+	if code == nil || code.ClientID != client.ClientID || time.Now().After(code.ExpiresAt) {
+		return nil, invalidGrant
+	}
+	if code.UsedAt != nil {
+		// A replayed code may have been stolen, revoke what was issued with it
+		if err := s.oauthRepo.RevokeRefreshTokensByClientUser(ctx, code.ClientID, code.UserID); err != nil {
+			logger.Error(ctx, "Failed to revoke refresh tokens", zap.Error(err))
+		}
+		logger.Info(ctx, "Authorization code replayed", zap.String("client_id", client.ClientID))
+		return nil, invalidGrant
+	}
+	if req.RedirectURI != code.RedirectURI {
+		return nil, domain.NewOAuthError(http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+	}
+	if code.CodeChallenge != "" {
+		sum := sha256.Sum256([]byte(req.CodeVerifier))
+		challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+		if req.CodeVerifier == "" || subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1 {
+			return nil, domain.NewOAuthError(http.StatusBadRequest, "invalid_grant", "code_verifier does not match")
+		}
+	}
+
+	used, err := s.oauthRepo.UseAuthorizationCode(ctx, code.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use authorization code: %w", err)
+	}
+	if !used {
+		return nil, invalidGrant
+	}
+
+	return s.issueTokens(ctx, client, code.UserID, strings.Fields(code.Scope), true)
+}
+
+// refresh rotates a refresh token
+func (s *oauthService) refresh(ctx context.Context, client *domain.OAuthClient, req *domain.TokenRequest) (*domain.OAuthTokenResponse, error) {
+	invalidGrant := domain.NewOAuthError(http.StatusBadRequest, "invalid_grant", "refresh token is invalid or expired")
+
+	refreshToken, err := s.oauthRepo.GetRefreshToken(ctx, hashSecret(req.RefreshToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if refreshToken == nil || refreshToken.ClientID != client.ClientID || time.Now().After(refreshToken.ExpiresAt) {
+		return nil, invalidGrant
+	}
+
+	scopes := strings.Fields(refreshToken.Scope)
+	if req.Scope != "" {
+		requested := normalizeScopes(strings.Fields(req.Scope))
+		if !isSubset(requested, scopes) {
+			return nil, domain.NewOAuthError(http.StatusBadRequest, "invalid_scope", "")
+		}
+		scopes = requested
+	}
+
+	revoked, err := s.oauthRepo.RevokeRefreshToken(ctx, refreshToken.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	if !revoked {
+		// A rotated token was presented again, revoke the whole family
+		if err := s.oauthRepo.RevokeRefreshTokensByClientUser(ctx, refreshToken.ClientID, refreshToken.UserID); err != nil {
+			logger.Error(ctx, "Failed to revoke refresh tokens", zap.Error(err))
+		}
+		logger.Info(ctx, "Refresh token reused", zap.String("client_id", client.ClientID), zap.Int64("user_id", refreshToken.UserID))
+		return nil, invalidGrant
+	}
+
+	return s.issueTokens(ctx, client, refreshToken.UserID, scopes, true)
+}
+
+// issueTokens signs an access token and, when allowed, stores a new refresh token.
+// A zero userID issues a client credentials token.
+func (s *oauthService) issueTokens(ctx context.Context, client *domain.OAuthClient, userID int64, scopes []string, withRefresh bool) (*domain.OAuthTokenResponse, error) {
+	subject := client.ClientID
+	if userID != 0 {
+		// The user must still be active when tokens are issued or refreshed
+		if _, err := principalForUser(ctx, s.userRepo, s.roleRepo, userID, domain.AuthMethodOAuth); err != nil {
+			if errors.Is(err, domain.ErrUnauthorized) {
+				return nil, domain.NewOAuthError(http.StatusBadRequest, "invalid_grant", "user is not active")
+			}
+			return nil, err
+		}
+		subject = strconv.FormatInt(userID, 10)
+	}
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token id: %w", err)
+	}
+
+	now := time.Now()
+	scope := strings.Join(scopes, " ")
+	accessToken, err := s.signer.Sign(map[string]any{
+		"sub":       subject,
+		"client_id": client.ClientID,
+		"scope":     scope,
+		"jti":       jti,
+		"iat":       now.Unix(),
+		"exp":       now.Add(s.cfg.OAuth.AccessTokenTTL).Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	resp := &domain.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.cfg.OAuth.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}
+
+	if withRefresh && userID != 0 && containsString(client.GrantTypes, domain.GrantTypeRefreshToken) {
+		refreshToken, err := randomToken(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		}
+		err = s.oauthRepo.CreateRefreshToken(ctx, &domain.OAuthRefreshToken{
+			TokenHash: hashSecret(refreshToken),
+			ClientID:  client.ClientID,
+			UserID:    userID,
+			Scope:     scope,
+			ExpiresAt: now.Add(s.cfg.OAuth.RefreshTokenTTL),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save refresh token: %w", err)
+		}
+		resp.RefreshToken = refreshToken
+	}
+
+	logger.Info(ctx, "OAuth access token issued", zap.String("client_id", client.ClientID), zap.Int64("user_id", userID))
+	return resp, nil
+}
+
+// authenticateClient verifies the client credentials. Public clients authenticate with their client ID only.
+func (s *oauthService) authenticateClient(ctx context.Context, clientID, clientSecret string) (*domain.OAuthClient, error) {
+	invalidClient := domain.NewOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	if clientID == "" {
+		return nil, invalidClient
+	}
+
+	client, err := s.oauthRepo.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth client: %w", err)
+	}
+	if client == nil {
+		return nil, invalidClient
+	}
+	if client.Confidential && subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashSecret(clientSecret))) != 1 {
+		return nil, invalidClient
+	}
+
+	return client, nil
+}
+
+// verifyAccessToken checks the signature, expiry and revocation of an access token
+func (s *oauthService) verifyAccessToken(ctx context.Context, token string) (map[string]any, error) {
+	claims, err := s.signer.Verify(token)
+	if err != nil {
+		return nil, domain.ErrUnauthorized
+	}
+
+	revoked, err := s.oauthRepo.IsAccessTokenRevoked(ctx, claimString(claims, "jti"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return nil, domain.ErrUnauthorized
+	}
+
+	return claims, nil
+}
+
+// Helper function: Resolve the requested scopes against those allowed for a client.
+// An empty request grants all allowed scopes.
+func requestedScopes(scope string, allowed []string) ([]string, bool) {
+	requested := normalizeScopes(strings.Fields(scope))
+	if len(requested) == 0 {
+		return allowed, true
+	}
+	return requested, isSubset(requested, allowed)
+}
+
+// Helper function: Check that every item of subset appears in set
+func isSubset(subset, set []string) bool {
+	for _, item := range subset {
+		if !containsString(set, item) {
+			return false
+		}
+	}
+	return true
+}
+
+// Helper function: Check whether a slice contains a string
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function: Append query parameters to a URI, skipping empty values
+func withQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Helper function: Read a string claim
+func claimString(claims map[string]any, key string) string {
+	value, _ := claims[key].(string)
+	return value
+}
+
+// Helper function: Read a numeric claim, JSON numbers decode as float64
+func claimInt(claims map[string]any, key string) int64 {
+	switch value := claims[key].(type) {
+	case float64:
+		return int64(value)
+	case int64:
+		return value
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/infra/signing"
+	"github.com/luxixing/fx-gin/internal/repo"
+)
+
+const (
+	testRedirectURI = "https://app.example.com/callback"
+	// testVerifier is the PKCE code verifier of RFC 7636 Appendix B
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// oauthTest holds an OAuth2 service with a registered public client
+type oauthTest struct {
+	service domain.OAuthService
+	client  *domain.OAuthClientResponse
+	user    *domain.User
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	t.Helper()
+
+	database := newTestDB(t)
+	cfg := newTestConfig(t, map[string]string{
+		"OAUTH_SIGNING_KEY_FILE": filepath.Join(t.TempDir(), "signing_key.pem"),
+	})
+	signer, err := signing.NewSigner(signing.SignerParams{Config: cfg})
+	if err != nil {
+		t.Fatalf("create signer: %v", err)
+	}
+	s := NewOAuthService(OAuthServiceParams{
+		Config:    cfg,
+		OAuthRepo: repo.NewOAuthRepo(repo.OAuthRepoParams{DB: database}),
+		UserRepo:  repo.NewUserRepo(repo.UserRepoParams{DB: database}),
+		RoleRepo:  repo.NewRoleRepo(repo.RoleRepoParams{DB: database}),
+		Signer:    signer,
+		Auditor:   newTestAuditor(database),
+	})
+
+	user := createTestUser(t, database, "alice")
+	client, err := s.RegisterClient(context.Background(), &domain.Principal{UserID: user.ID, Method: domain.AuthMethodBearer}, &domain.OAuthClientRequest{
+		Name:         "app",
+		RedirectURIs: []string{testRedirectURI},
+		GrantTypes:   []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken},
+	})
+	if err != nil {
+		t.Fatalf("register client: %v", err)
+	}
+	return &oauthTest{service: s, client: client, user: user}
+}
+
+// authorize runs an approved authorization request and returns the redirect parameters
+func (o *oauthTest) authorize(t *testing.T, challenge, method string) url.Values {
+	t.Helper()
+
+	approve := true
+	resp, err := o.service.Authorize(context.Background(), &domain.Principal{UserID: o.user.ID, Method: domain.AuthMethodBearer}, &domain.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            o.client.ClientID,
+		State:               "xyz",
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: method,
+		Approve:             &approve,
+	})
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	redirect, err := url.Parse(resp.RedirectTo)
+	if err != nil {
+		t.Fatalf("parse redirect %q: %v", resp.RedirectTo, err)
+	}
+	return redirect.Query()
+}
+
+// exchange redeems an authorization code
+func (o *oauthTest) exchange(code, verifier string) (*domain.OAuthTokenResponse, error) {
+	return o.service.Token(context.Background(), &domain.TokenRequest{
+		GrantType:    domain.GrantTypeAuthorizationCode,
+		Code:         code,
+		CodeVerifier: verifier,
+		ClientID:     o.client.ClientID,
+	})
+}
+
+// refresh rotates a refresh token
+func (o *oauthTest) refresh(refreshToken string) (*domain.OAuthTokenResponse, error) {
+	return o.service.Token(context.Background(), &domain.TokenRequest{
+		GrantType:    domain.GrantTypeRefreshToken,
+		RefreshToken: refreshToken,
+		ClientID:     o.client.ClientID,
+	})
+}
+
+// s256 returns the S256 code challenge of a verifier
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// assertInvalidGrant fails unless err is an invalid_grant OAuth2 error
+func assertInvalidGrant(t *testing.T, err error) {
+	t.Helper()
+
+	oauthErr, ok := domain.AsOAuthError(err)
+	if !ok || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("err = %v, want invalid_grant", err)
+	}
+}
+
+func TestOAuthAuthorizeRequiresS256ForPublicClients(t *testing.T) {
+	o := newOAuthTest(t)
+
+	for _, tc := range []struct {
+		name      string
+		challenge string
+		method    string
+	}{
+		{"without challenge", "", ""},
+		{"plain challenge", "verifier", "plain"},
+		{"challenge without method", s256("verifier"), ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			query := o.authorize(t, tc.challenge, tc.method)
+			if query.Get("error") != "invalid_request" || query.Get("code") != "" || query.Get("state") != "xyz" {
+				t.Errorf("redirect parameters = %v, want invalid_request", query)
+			}
+		})
+	}
+}
+
+func TestOAuthExchangeChecksCodeVerifier(t *testing.T) {
+	o := newOAuthTest(t)
+
+	for _, tc := range []struct {
+		name     string
+		verifier string
+		valid    bool
+	}{
+		{"missing verifier", "", false},
+		{"other verifier", "another-verifier-of-sufficient-length-0123456", false},
+		{"challenge as verifier", s256(testVerifier), false},
+		{"matching verifier", testVerifier, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code := o.authorize(t, s256(testVerifier), codeChallengeMethodS256).Get("code")
+			if code == "" {
+				t.Fatalf("no authorization code issued")
+			}
+
+			resp, err := o.exchange(code, tc.verifier)
+			if !tc.valid {
+				assertInvalidGrant(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchange: %v", err)
+			}
+			if resp.AccessToken == "" || resp.RefreshToken == "" {
+				t.Errorf("token response = %+v, want access and refresh token", resp)
+			}
+		})
+	}
+}
+
+func TestOAuthCodeReuseRevokesIssuedTokens(t *testing.T) {
+	o := newOAuthTest(t)
+	code := o.authorize(t, s256(testVerifier), codeChallengeMethodS256).Get("code")
+
+	first, err := o.exchange(code, testVerifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	_, err = o.exchange(code, testVerifier)
+	assertInvalidGrant(t, err)
+
+	// The refresh token issued with the replayed code is revoked as well
+	_, err = o.refresh(first.RefreshToken)
+	assertInvalidGrant(t, err)
+}
+
+func TestOAuthRefreshTokenReuseRevokesFamily(t *testing.T) {
+	o := newOAuthTest(t)
+	issued, err := o.exchange(o.authorize(t, s256(testVerifier), codeChallengeMethodS256).Get("code"), testVerifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	rotated, err := o.refresh(issued.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == issued.RefreshToken {
+		t.Fatalf("refresh token was not rotated")
+	}
+
+	// Presenting the rotated token again revokes the token that replaced it
+	_, err = o.refresh(issued.RefreshToken)
+	assertInvalidGrant(t, err)
+	_, err = o.refresh(rotated.RefreshToken)
+	assertInvalidGrant(t, err)
+}
@@ -0,0 +1,617 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewOIDCService),
+	)
+}
+
+// oidcHTTPTimeout bounds discovery, key and token requests to identity providers
+const oidcHTTPTimeout = 10 * time.Second
+
+// usernameInvalidChars matches characters not allowed in provisioned usernames
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// OIDCServiceParams represents the parameters required for OIDC service initialization
+type OIDCServiceParams struct {
+	fx.In
+
+	Config        *config.Config
+	IdentityRepo  domain.IdentityRepo
+	UserRepo      domain.UserRepo
+	ProfileRepo   domain.ProfileRepo
+	RoleRepo      domain.RoleRepo
+	MFARepo       domain.MFARepo
+	UserTokenRepo domain.UserTokenRepo
+	Transactor    domain.Transactor
+	EventBus      domain.EventBus
+	Auditor       domain.Auditor
+}
+
+// oidcService implements the OIDC service interface
+type oidcService struct {
+	cfg           *config.Config
+	identityRepo  domain.IdentityRepo
+	userRepo      domain.UserRepo
+	profileRepo   domain.ProfileRepo
+	roleRepo      domain.RoleRepo
+	mfaRepo       domain.MFARepo
+	userTokenRepo domain.UserTokenRepo
+	transactor    domain.Transactor
+	eventBus      domain.EventBus
+	auditor       domain.Auditor
+	httpClient    *http.Client
+
+	mu      sync.Mutex
+	clients map[string]*oidcClient
+}
+
+// oidcClient holds the discovered endpoints and keys of a provider
+type oidcClient struct {
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCService creates a new OIDC service instance
+func NewOIDCService(p OIDCServiceParams) domain.OIDCService {
+	return &oidcService{
+		cfg:           p.Config,
+		identityRepo:  p.IdentityRepo,
+		userRepo:      p.UserRepo,
+		profileRepo:   p.ProfileRepo,
+		roleRepo:      p.RoleRepo,
+		mfaRepo:       p.MFARepo,
+		userTokenRepo: p.UserTokenRepo,
+		transactor:    p.Transactor,
+		eventBus:      p.EventBus,
+		auditor:       p.Auditor,
+		httpClient:    &http.Client{Timeout: oidcHTTPTimeout},
+		clients:       make(map[string]*oidcClient),
+	}
+}
+
+// Providers lists the configured identity providers
+func (s *oidcService) Providers() []*domain.OIDCProvider {
+	providers := make([]*domain.OIDCProvider, 0, len(s.cfg.OIDC.Providers))
+	for _, p := range s.cfg.OIDC.Providers {
+		displayName := p.DisplayName
+		if displayName == "" {
+			displayName = p.Name
+		}
+		providers = append(providers, &domain.OIDCProvider{
+			Name:        p.Name,
+			DisplayName: displayName,
+			LoginURL:    strings.TrimRight(s.cfg.OIDC.BaseURL, "/") + "/api/v1/auth/oidc/" + p.Name + "/login",
+		})
+	}
+	return providers
+}
+
+// AuthorizationURL starts a login with state, nonce and PKCE and returns the provider URL
+func (s *oidcService) AuthorizationURL(ctx context.Context, provider string) (string, error) {
+	client, err := s.client(provider)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	err = s.identityRepo.CreateState(ctx, &domain.OIDCLoginState{
+		StateHash:    hashSecret(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(s.cfg.OIDC.StateTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save login state: %w", err)
+	}
+
+	return client.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Callback completes a login: it validates the state, redeems the code, verifies
+// the ID token and signs in the linked user, provisioning one when allowed
+func (s *oidcService) Callback(ctx context.Context, provider string, req *domain.OIDCCallbackRequest) (*domain.TokenResponse, error) {
+	user, resp, err := s.login(ctx, provider, req)
+	if err != nil {
+		// Failures are recorded like those of password logins, with the user if known
+		var codeErr *domain.Error
+		if errors.As(err, &codeErr) {
+			var userID int64
+			if user != nil {
+				userID = user.ID
+			}
+			s.audit(ctx, domain.AuditUserLoginFailed, userID, 0, nil, "oidc:"+provider+": "+codeErr.Code)
+		}
+		return nil, err
+	}
+
+	// The request is anonymous, the user signing in is the actor. With MFA the login is
+	// recorded once the second factor has been verified.
+	action := domain.AuditUserLogin
+	if resp.MFARequired {
+		action = domain.AuditUserLoginChallenge
+	}
+	s.audit(ctx, action, user.ID, user.ID, nil, "oidc:"+provider)
+	return resp, nil
+}
+
+// login runs the steps of Callback. It returns the user along with an error when the
+// error concerns a known user.
+func (s *oidcService) login(ctx context.Context, provider string, req *domain.OIDCCallbackRequest) (*domain.User, *domain.TokenResponse, error) {
+	if req.Error != "" {
+		if req.ErrorDescription != "" {
+			return nil, nil, domain.NewUnauthorizedError("provider_error", "identity provider returned an error: "+req.Error+": "+req.ErrorDescription)
+		}
+		return nil, nil, domain.NewUnauthorizedError("provider_error", "identity provider returned an error: "+req.Error)
+	}
+
+	client, err := s.client(provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state, err := s.identityRepo.ConsumeState(ctx, hashSecret(req.State))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get login state: %w", err)
+	}
+	if state == nil || state.Provider != provider || time.Now().After(state.ExpiresAt) {
+		return nil, nil, domain.ErrInvalidLoginState
+	}
+
+	httpCtx := oidc.ClientContext(ctx, s.httpClient)
+	token, err := client.oauth2.Exchange(httpCtx, req.Code, oauth2.VerifierOption(state.CodeVerifier))
+	if err != nil {
+		logger.Error(ctx, "Failed to redeem authorization code", zap.String("provider", provider), zap.Error(err))
+		return nil, nil, domain.ErrExternalLoginFailed
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, domain.ErrInvalidIDToken
+	}
+	idToken, err := client.verifier.Verify(httpCtx, rawIDToken)
+	if err != nil {
+		logger.Error(ctx, "Failed to verify id token", zap.String("provider", provider), zap.Error(err))
+		return nil, nil, domain.ErrInvalidIDToken
+	}
+	if idToken.Nonce != state.Nonce {
+		return nil, nil, domain.ErrInvalidIDToken
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode id token claims: %w", err)
+	}
+
+	providerCfg := s.providerConfig(provider)
+	user, err := s.resolveUser(ctx, providerCfg, idToken.Subject, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Status != domain.UserStatusActive {
+		return user, nil, domain.ErrAccountInactive
+	}
+
+	if err := s.syncRoles(ctx, providerCfg, user.ID, claims); err != nil {
+		return user, nil, err
+	}
+
+	resp, err := issueLoginToken(ctx, s.cfg, s.mfaRepo, s.userTokenRepo, user.ID)
+	if err != nil {
+		return user, nil, err
+	}
+
+	logger.Info(ctx, "OIDC login successful", zap.String("provider", provider), zap.Int64("user_id", user.ID))
+	return user, resp, nil
+}
+
+// ListIdentities retrieves the external identities linked to a user
+func (s *oidcService) ListIdentities(ctx context.Context, userID int64) ([]*domain.UserIdentity, error) {
+	identities, err := s.identityRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	if identities == nil {
+		identities = []*domain.UserIdentity{}
+	}
+	return identities, nil
+}
+
+// Unlink removes an external identity from a user
+func (s *oidcService) Unlink(ctx context.Context, userID, identityID int64) error {
+	deleted, err := s.identityRepo.Delete(ctx, userID, identityID)
+	if err != nil {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+	if !deleted {
+		return domain.ErrIdentityNotFound
+	}
+
+	s.audit(ctx, domain.AuditUserIdentityUnlink, userID, 0, nil, "identity "+strconv.FormatInt(identityID, 10))
+	logger.Info(ctx, "External identity unlinked", zap.Int64("user_id", userID), zap.Int64("identity_id", identityID))
+	return nil
+}
+
+// resolveUser finds the user linked to an external identity. Unknown identities are
+// linked by verified email or provisioned just in time when the provider allows it.
+func (s *oidcService) resolveUser(ctx context.Context, p *config.OIDCProviderConfig, subject string, claims map[string]any) (*domain.User, error) {
+	email := claimString(claims, "email")
+	emailVerified := claimBool(claims, "email_verified")
+
+	identity, err := s.identityRepo.GetByProviderSubject(ctx, p.Name, subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+	if identity != nil {
+		identity.Email = email
+		identity.LastLoginAt = time.Now()
+		if err := s.identityRepo.Update(ctx, identity); err != nil {
+			return nil, fmt.Errorf("failed to update identity: %w", err)
+		}
+
+		user, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if user == nil {
+			return nil, domain.ErrUserNotFound
+		}
+		return user, nil
+	}
+
+	var user *domain.User
+	if email != "" {
+		user, err = s.userRepo.GetByEmail(ctx, email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check email: %w", err)
+		}
+	}
+
+	detail := "oidc:" + p.Name
+	switch {
+	case user != nil:
+		// Only link by email when both the provider and this service verified the address,
+		// otherwise whoever registered the address first could take over the identity
+		if !p.LinkByEmail || !emailVerified || user.EmailVerifiedAt == nil {
+			return nil, domain.ErrEmailRegistered
+		}
+		detail += ", linked by verified email"
+	case p.AutoProvision:
+		user, err = s.provisionUser(ctx, claims, email, emailVerified)
+		if err != nil {
+			return nil, err
+		}
+		s.audit(ctx, domain.AuditUserRegister, user.ID, user.ID, nil, detail)
+	default:
+		return nil, domain.NewForbiddenError("identity_not_linked", "no account is linked to this identity")
+	}
+
+	err = s.identityRepo.Create(ctx, &domain.UserIdentity{
+		UserID:   user.ID,
+		Provider: p.Name,
+		Subject:  subject,
+		Email:    email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	s.audit(ctx, domain.AuditUserIdentityLink, user.ID, user.ID, nil, detail)
+
+	logger.Info(ctx, "External identity linked", zap.String("provider", p.Name), zap.Int64("user_id", user.ID))
+	return user, nil
+}
+
+// provisionUser creates a user for a first-time external login. The user gets an
+// unusable random password and can set one through password reset.
+func (s *oidcService) provisionUser(ctx context.Context, claims map[string]any, email string, emailVerified bool) (*domain.User, error) {
+	if email == "" {
+		return nil, domain.NewForbiddenError("email_required", "identity provider did not return an email address")
+	}
+
+	// The email may still be reserved by a deleted user
+	taken, err := s.userRepo.IsEmailTaken(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check email: %w", err)
+	}
+	if taken {
+		return nil, domain.ErrEmailRegistered
+	}
+
+	username, err := s.availableUsername(ctx, claimString(claims, "preferred_username"), email)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+	hashedPassword, err := hashPassword(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &domain.User{
+		Username: username,
+		Email:    email,
+		Password: hashedPassword,
+		Status:   domain.UserStatusActive,
+	}
+	if emailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	err = s.transactor.InTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+
+		nickname := claimString(claims, "name")
+		if nickname == "" {
+			nickname = username
+		}
+		if err := s.profileRepo.Create(ctx, &domain.Profile{UserID: user.ID, Nickname: nickname}); err != nil {
+			return fmt.Errorf("failed to create profile: %w", err)
+		}
+
+		defaultRole, err := s.roleRepo.GetByName(ctx, "user")
+		if err != nil {
+			return fmt.Errorf("failed to get default role: %w", err)
+		}
+		if defaultRole != nil {
+			if err := s.roleRepo.AddRoleToUser(ctx, user.ID, defaultRole.ID); err != nil {
+				return fmt.Errorf("failed to assign default role: %w", err)
+			}
+		}
+
+		return s.eventBus.Publish(ctx, domain.UserRegistered{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Status:   user.Status,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "User provisioned from external identity", zap.Int64("user_id", user.ID), zap.String("username", username))
+	return user, nil
+}
+
+// availableUsername derives a free username from the preferred username or the email address
+func (s *oidcService) availableUsername(ctx context.Context, preferred, email string) (string, error) {
+	base := preferred
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	base = strings.Trim(usernameInvalidChars.ReplaceAllString(base, ""), ".-")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		taken, err := s.userRepo.IsUsernameTaken(ctx, candidate)
+		if err != nil {
+			return "", fmt.Errorf("failed to check username: %w", err)
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", fmt.Errorf("failed to generate username: %w", err)
+		}
+		candidate = base + "-" + hex.EncodeToString(suffix)
+	}
+
+	return "", errors.New("failed to find an available username")
+}
+
+// syncRoles grants the roles mapped from the role claim and revokes mapped roles
+// the claim no longer carries. Roles outside the mapping are left untouched.
+func (s *oidcService) syncRoles(ctx context.Context, p *config.OIDCProviderConfig, userID int64, claims map[string]any) error {
+	if len(p.RoleMapping) == 0 {
+		return nil
+	}
+
+	desired := make(map[string]bool)
+	for _, value := range claimStrings(claims, p.RoleClaim) {
+		if role, ok := p.RoleMapping[value]; ok {
+			desired[role] = true
+		}
+	}
+
+	current, err := s.roleRepo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user roles: %w", err)
+	}
+	assigned := make(map[string]bool, len(current))
+	before := make([]string, 0, len(current))
+	for _, role := range current {
+		assigned[role.Name] = true
+		before = append(before, role.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range p.RoleMapping {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if desired[name] == assigned[name] {
+			continue
+		}
+
+		role, err := s.roleRepo.GetByName(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to get role: %w", err)
+		}
+		if role == nil {
+			logger.Warn(ctx, "Mapped role does not exist", zap.String("role", name))
+			continue
+		}
+
+		if desired[name] {
+			err = s.roleRepo.AddRoleToUser(ctx, userID, role.ID)
+		} else {
+			err = s.roleRepo.RemoveRoleFromUser(ctx, userID, role.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update user roles: %w", err)
+		}
+		if desired[name] {
+			assigned[name] = true
+		} else {
+			delete(assigned, name)
+		}
+		logger.Info(ctx, "User role synced from identity provider",
+			zap.Int64("user_id", userID), zap.String("role", name), zap.Bool("granted", desired[name]))
+	}
+
+	slices.Sort(before)
+	after := slices.Sorted(maps.Keys(assigned))
+	if !slices.Equal(before, after) {
+		s.audit(ctx, domain.AuditUserRoles, userID, 0, auditChanges(
+			map[string][]string{"roles": before},
+			map[string][]string{"roles": after},
+		), "oidc:"+p.Name)
+	}
+	return nil
+}
+
+// audit records an action on a user in the audit log. Callbacks are anonymous requests,
+// the user signing in is passed as the actor where the action is theirs.
+func (s *oidcService) audit(ctx context.Context, action string, userID, actorID int64, changes json.RawMessage, detail string) {
+	event := &domain.AuditEvent{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: domain.AuditTargetUser,
+		Changes:    changes,
+		Detail:     detail,
+	}
+	if userID != 0 {
+		event.TargetID = strconv.FormatInt(userID, 10)
+	}
+	s.auditor.Record(ctx, event)
+}
+
+// client returns the client for a provider, running discovery on first use
+func (s *oidcService) client(provider string) (*oidcClient, error) {
+	p := s.providerConfig(provider)
+	if p == nil {
+		return nil, domain.ErrUnknownProvider
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if client, ok := s.clients[provider]; ok {
+		return client, nil
+	}
+
+	// Discovery and key fetching outlive the request, so they use a background context
+	oidcProvider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), s.httpClient), p.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover identity provider: %w", err)
+	}
+
+	redirectURL := p.RedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimRight(s.cfg.OIDC.BaseURL, "/") + "/api/v1/auth/oidc/" + p.Name + "/callback"
+	}
+
+	client := &oidcClient{
+		oauth2: &oauth2.Config{
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			Endpoint:     oidcProvider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       p.Scopes,
+		},
+		verifier: oidcProvider.Verifier(&oidc.Config{ClientID: p.ClientID}),
+	}
+	s.clients[provider] = client
+	return client, nil
+}
+
+// providerConfig returns the configuration of a provider, or nil if it is not configured
+func (s *oidcService) providerConfig(provider string) *config.OIDCProviderConfig {
+	for i := range s.cfg.OIDC.Providers {
+		if s.cfg.OIDC.Providers[i].Name == provider {
+			return &s.cfg.OIDC.Providers[i]
+		}
+	}
+	return nil
+}
+
+// Helper function: Read a boolean claim, some providers send "true" as a string
+func claimBool(claims map[string]any, key string) bool {
+	switch value := claims[key].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	default:
+		return false
+	}
+}
+
+// Helper function: Read a claim that may be a single string or a list of strings
+func claimStrings(claims map[string]any, key string) []string {
+	switch value := claims[key].(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		result := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,466 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/repo"
+	"go.uber.org/fx/fxtest"
+)
+
+// fakeIdP is an OpenID provider serving discovery, keys and tokens. Codes are issued by
+// the test for the authorization request it would have answered.
+type fakeIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+// fakeGrant is what an authorization code redeems to
+type fakeGrant struct {
+	challenge string
+	claims    map[string]any
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	idp := &fakeIdP{key: key, codes: make(map[string]fakeGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		grant, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idp.sign(t, grant.claims),
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// authorize answers an authorization URL with a code for an ID token with the claims.
+// The nonce of the request is used unless the claims carry one.
+func (idp *fakeIdP) authorize(t *testing.T, authURL string, claims map[string]any) *domain.OIDCCallbackRequest {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization URL without S256 challenge: %s", authURL)
+	}
+
+	all := map[string]any{
+		"iss":   idp.URL,
+		"aud":   q.Get("client_id"),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+
+	idp.mu.Lock()
+	code := strconv.Itoa(len(idp.codes)) + "-" + q.Get("state")[:8]
+	idp.codes[code] = fakeGrant{challenge: q.Get("code_challenge"), claims: all}
+	idp.mu.Unlock()
+	return &domain.OIDCCallbackRequest{Code: code, State: q.Get("state")}
+}
+
+// sign creates an RS256 JWT
+func (idp *fakeIdP) sign(t *testing.T, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Errorf("encode claims: %v", err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Errorf("sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// oidcTest is an OIDC service for the provider "corp" served by a fake IdP
+type oidcTest struct {
+	*oidcService
+	db           *sql.DB
+	idp          *fakeIdP
+	identityRepo domain.IdentityRepo
+	roleRepo     domain.RoleRepo
+	auditor      domain.Auditor
+}
+
+func newOIDCTest(t *testing.T, vars map[string]string) *oidcTest {
+	t.Helper()
+
+	idp := newFakeIdP(t)
+	env := map[string]string{
+		"OIDC_PROVIDERS_0_NAME":      "corp",
+		"OIDC_PROVIDERS_0_ISSUER":    idp.URL,
+		"OIDC_PROVIDERS_0_CLIENT_ID": "fx-gin",
+	}
+	for k, v := range vars {
+		env[k] = v
+	}
+
+	database := newTestDB(t)
+	cfg := newTestConfig(t, env)
+	transactor := repo.NewTransactor(repo.TransactorParams{DB: database})
+	identityRepo := repo.NewIdentityRepo(repo.IdentityRepoParams{DB: database})
+	roleRepo := repo.NewRoleRepo(repo.RoleRepoParams{DB: database})
+	auditor := newTestAuditor(database)
+	s := NewOIDCService(OIDCServiceParams{
+		Config:        cfg,
+		IdentityRepo:  identityRepo,
+		UserRepo:      repo.NewUserRepo(repo.UserRepoParams{DB: database}),
+		ProfileRepo:   repo.NewProfileRepo(repo.ProfileRepoParams{DB: database}),
+		RoleRepo:      roleRepo,
+		MFARepo:       repo.NewMFARepo(repo.MFARepoParams{DB: database}),
+		UserTokenRepo: repo.NewUserTokenRepo(repo.UserTokenRepoParams{DB: database}),
+		Transactor:    transactor,
+		EventBus: NewEventBus(EventBusParams{
+			Lifecycle:  fxtest.NewLifecycle(t),
+			Config:     cfg,
+			Transactor: transactor,
+			OutboxRepo: repo.NewEventOutboxRepo(repo.EventOutboxRepoParams{DB: database}),
+		}),
+		Auditor: auditor,
+	}).(*oidcService)
+
+	return &oidcTest{oidcService: s, db: database, idp: idp, identityRepo: identityRepo, roleRepo: roleRepo, auditor: auditor}
+}
+
+// login runs a login through the fake IdP with the claims of the ID token
+func (o *oidcTest) login(t *testing.T, claims map[string]any) (*domain.TokenResponse, error) {
+	t.Helper()
+
+	authURL, err := o.AuthorizationURL(context.Background(), "corp")
+	if err != nil {
+		t.Fatalf("authorization URL: %v", err)
+	}
+	return o.Callback(context.Background(), "corp", o.idp.authorize(t, authURL, claims))
+}
+
+// linkedUser returns the ID of the user linked to a subject of the provider
+func (o *oidcTest) linkedUser(t *testing.T, subject string) int64 {
+	t.Helper()
+
+	identity, err := o.identityRepo.GetByProviderSubject(context.Background(), "corp", subject)
+	if err != nil {
+		t.Fatalf("get identity: %v", err)
+	}
+	if identity == nil {
+		return 0
+	}
+	return identity.UserID
+}
+
+// lastAuditAction returns the action of the latest audit event
+func (o *oidcTest) lastAuditAction(t *testing.T) string {
+	t.Helper()
+
+	list, err := o.auditor.List(context.Background(), &domain.AuditQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("list audit events: %v", err)
+	}
+	if len(list.Items) == 0 {
+		return ""
+	}
+	return list.Items[0].Action
+}
+
+func TestOIDCCallbackRejectsReusedState(t *testing.T) {
+	o := newOIDCTest(t, nil)
+	ctx := context.Background()
+
+	authURL, err := o.AuthorizationURL(ctx, "corp")
+	if err != nil {
+		t.Fatalf("authorization URL: %v", err)
+	}
+	req := o.idp.authorize(t, authURL, map[string]any{"sub": "s-1", "email": "new@example.com", "email_verified": true})
+	if _, err := o.Callback(ctx, "corp", req); err != nil {
+		t.Fatalf("first callback: %v", err)
+	}
+
+	// The state is consumed, even though the IdP would accept another code
+	replay := o.idp.authorize(t, authURL, map[string]any{"sub": "s-1", "email": "new@example.com", "email_verified": true})
+	if _, err := o.Callback(ctx, "corp", replay); !errors.Is(err, domain.ErrInvalidLoginState) {
+		t.Errorf("reused state: err = %v, want %v", err, domain.ErrInvalidLoginState)
+	}
+}
+
+func TestOIDCCallbackRejectsExpiredState(t *testing.T) {
+	o := newOIDCTest(t, nil)
+	o.cfg.OIDC.StateTTL = -time.Second
+
+	_, err := o.login(t, map[string]any{"sub": "s-1", "email": "new@example.com"})
+	if !errors.Is(err, domain.ErrInvalidLoginState) {
+		t.Errorf("expired state: err = %v, want %v", err, domain.ErrInvalidLoginState)
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	o := newOIDCTest(t, nil)
+
+	_, err := o.login(t, map[string]any{"sub": "s-1", "email": "new@example.com", "nonce": "other"})
+	if !errors.Is(err, domain.ErrInvalidIDToken) {
+		t.Errorf("nonce mismatch: err = %v, want %v", err, domain.ErrInvalidIDToken)
+	}
+	if o.linkedUser(t, "s-1") != 0 {
+		t.Errorf("identity was linked despite the nonce mismatch")
+	}
+	if action := o.lastAuditAction(t); action != domain.AuditUserLoginFailed {
+		t.Errorf("last audit action = %s, want %s", action, domain.AuditUserLoginFailed)
+	}
+}
+
+func TestOIDCCallbackLinksUsers(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		vars          map[string]string
+		existing      bool
+		unverified    bool // The existing user has not verified its email address
+		emailVerified bool
+		wantErr       error
+		wantExisting  bool
+		wantAction    string
+	}{
+		{
+			name:          "provisions new users",
+			emailVerified: true,
+			wantAction:    domain.AuditUserLogin,
+		},
+		{
+			name:    "refuses provisioning when disabled",
+			vars:    map[string]string{"OIDC_PROVIDERS_0_AUTO_PROVISION": "false"},
+			wantErr: &domain.Error{Code: "identity_not_linked"},
+		},
+		{
+			name:          "links existing users by verified email",
+			vars:          map[string]string{"OIDC_PROVIDERS_0_LINK_BY_EMAIL": "true"},
+			existing:      true,
+			emailVerified: true,
+			wantExisting:  true,
+			wantAction:    domain.AuditUserLogin,
+		},
+		{
+			name:          "refuses to link by unverified email",
+			vars:          map[string]string{"OIDC_PROVIDERS_0_LINK_BY_EMAIL": "true"},
+			existing:      true,
+			emailVerified: false,
+			wantErr:       domain.ErrEmailRegistered,
+		},
+		{
+			name:          "refuses to link to an unverified account",
+			vars:          map[string]string{"OIDC_PROVIDERS_0_LINK_BY_EMAIL": "true"},
+			existing:      true,
+			unverified:    true,
+			emailVerified: true,
+			wantErr:       domain.ErrEmailRegistered,
+		},
+		{
+			name:          "refuses to link by email when disabled",
+			existing:      true,
+			emailVerified: true,
+			wantErr:       domain.ErrEmailRegistered,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newOIDCTest(t, tc.vars)
+			var existing *domain.User
+			if tc.existing {
+				existing = createTestUser(t, o.db, "alice")
+			}
+			if tc.unverified {
+				if _, err := o.db.Exec(`UPDATE users SET email_verified_at = NULL WHERE id = ?`, existing.ID); err != nil {
+					t.Fatalf("unverify email: %v", err)
+				}
+			}
+
+			resp, err := o.login(t, map[string]any{
+				"sub":                "s-1",
+				"email":              "alice@example.com",
+				"email_verified":     tc.emailVerified,
+				"preferred_username": "alice.corp",
+			})
+			if tc.wantErr != nil {
+				var want, got *domain.Error
+				if !errors.As(tc.wantErr, &want) || !errors.As(err, &got) || got.Code != want.Code {
+					t.Fatalf("err = %v, want %v", err, tc.wantErr)
+				}
+				if o.linkedUser(t, "s-1") != 0 {
+					t.Errorf("identity was linked")
+				}
+				return
+			}
+			if err != nil || resp.Token == "" {
+				t.Fatalf("login = %+v, %v, want a token", resp, err)
+			}
+
+			userID := o.linkedUser(t, "s-1")
+			if userID == 0 {
+				t.Fatalf("identity was not linked")
+			}
+			if tc.wantExisting && userID != existing.ID {
+				t.Errorf("identity linked to user %d, want %d", userID, existing.ID)
+			}
+			if !tc.wantExisting {
+				user, err := o.userRepo.GetByID(context.Background(), userID)
+				if err != nil || user.Username != "alice.corp" || user.EmailVerifiedAt == nil {
+					t.Errorf("provisioned user = %+v, %v", user, err)
+				}
+			}
+			if action := o.lastAuditAction(t); action != tc.wantAction {
+				t.Errorf("last audit action = %s, want %s", action, tc.wantAction)
+			}
+
+			// The next login finds the linked identity
+			if _, err := o.login(t, map[string]any{"sub": "s-1", "email": "alice@example.com"}); err != nil {
+				t.Errorf("second login: %v", err)
+			}
+			if o.linkedUser(t, "s-1") != userID {
+				t.Errorf("second login linked another user")
+			}
+		})
+	}
+}
+
+func TestOIDCSyncRoles(t *testing.T) {
+	o := newOIDCTest(t, map[string]string{
+		"OIDC_PROVIDERS_0_ROLE_MAPPING": "engineering:admin,staff:user",
+	})
+	ctx := context.Background()
+
+	roles := func() []string {
+		t.Helper()
+		userRoles, err := o.roleRepo.GetUserRoles(ctx, o.linkedUser(t, "s-1"))
+		if err != nil {
+			t.Fatalf("get user roles: %v", err)
+		}
+		var names []string
+		for _, role := range userRoles {
+			names = append(names, role.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	for _, tc := range []struct {
+		name   string
+		groups any
+		want   []string
+	}{
+		{"grants mapped roles", []string{"engineering", "staff", "sales"}, []string{"admin", "user"}},
+		{"revokes roles missing from the claim", []string{"staff"}, []string{"user"}},
+		{"accepts a single value", "engineering", []string{"admin"}},
+		{"revokes all mapped roles", []string{}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := o.login(t, map[string]any{
+				"sub":            "s-1",
+				"email":          "alice@example.com",
+				"email_verified": true,
+				"groups":         tc.groups,
+			})
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+			if got := roles(); !slices.Equal(got, tc.want) {
+				t.Errorf("roles = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	list, err := o.auditor.List(ctx, &domain.AuditQuery{Action: domain.AuditUserRoles})
+	if err != nil {
+		t.Fatalf("list audit events: %v", err)
+	}
+	if len(list.Items) != 4 {
+		t.Errorf("recorded %d role changes, want one per login", len(list.Items))
+	}
+}
+
+func TestOIDCSyncRolesKeepsUnmappedRoles(t *testing.T) {
+	o := newOIDCTest(t, map[string]string{
+		"OIDC_PROVIDERS_0_ROLE_MAPPING": "engineering:admin",
+	})
+	ctx := context.Background()
+
+	if _, err := o.login(t, map[string]any{"sub": "s-1", "email": "alice@example.com", "groups": []string{}}); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	userRoles, err := o.roleRepo.GetUserRoles(ctx, o.linkedUser(t, "s-1"))
+	if err != nil {
+		t.Fatalf("get user roles: %v", err)
+	}
+	if len(userRoles) != 1 || userRoles[0].Name != "user" {
+		t.Errorf("roles = %+v, want the default role outside the mapping", userRoles)
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/jsonpatch"
+	"github.com/luxixing/fx-gin/pkg/validation"
+)
+
+// Helper function: Apply a patch to the JSON representation of doc, a pointer to a
+// struct with binding rules, and validate the result. It returns the JSON names of
+// the top level fields that changed.
+func applyPatch(doc any, patch *domain.Patch) ([]string, error) {
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+	switch patch.ContentType {
+	case jsonpatch.MergePatchContentType, "application/json":
+		patched, err = jsonpatch.MergePatch(original, patch.Body)
+	case jsonpatch.JSONPatchContentType:
+		patched, err = jsonpatch.Apply(original, patch.Body)
+	default:
+		return nil, domain.ErrUnsupportedPatch
+	}
+	switch {
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		return nil, domain.ErrPatchTestFailed.Wrap(err)
+	case err != nil:
+		return nil, domain.ErrInvalidPatch.Wrap(err)
+	}
+
+	// Decode into a new value so removed members are reset to their zero value
+	target := reflect.New(reflect.TypeOf(doc).Elem())
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target.Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, domain.ErrInvalidRequest.Wrap(err)
+		}
+		return nil, domain.ErrInvalidPatch.Wrap(err)
+	}
+	if err := validation.Struct(target.Interface()); err != nil {
+		return nil, domain.ErrInvalidRequest.Wrap(err)
+	}
+
+	result, err := json.Marshal(target.Interface())
+	if err != nil {
+		return nil, err
+	}
+	changed, err := changedFields(original, result)
+	if err != nil {
+		return nil, err
+	}
+
+	reflect.ValueOf(doc).Elem().Set(target.Elem())
+	return changed, nil
+}
+
+// Helper function: Compare the top level members of two JSON objects
+func changedFields(before, after []byte) ([]string, error) {
+	var old, updated map[string]any
+	if err := json.Unmarshal(before, &old); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &updated); err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for name, value := range updated {
+		if !reflect.DeepEqual(old[name], value) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := updated[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	return changed, nil
+}
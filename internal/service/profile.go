@@ -0,0 +1,362 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/imaging"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewProfileService),
+	)
+}
+
+// ProfileServiceParams represents the parameters required for profile service initialization
+type ProfileServiceParams struct {
+	fx.In
+
+	Config      *config.Config
+	UserRepo    domain.UserRepo
+	ProfileRepo domain.ProfileRepo
+	BlobService domain.BlobService
+}
+
+// profileService implements the profile service interface
+type profileService struct {
+	cfg         *config.Config
+	userRepo    domain.UserRepo
+	profileRepo domain.ProfileRepo
+	blobService domain.BlobService
+}
+
+// NewProfileService creates a new profile service instance
+func NewProfileService(p ProfileServiceParams) domain.ProfileService {
+	return &profileService{
+		cfg:         p.Config,
+		userRepo:    p.UserRepo,
+		profileRepo: p.ProfileRepo,
+		blobService: p.BlobService,
+	}
+}
+
+// GetProfile returns the profile of a user, creating an empty one if missing
+func (s *profileService) GetProfile(ctx context.Context, userID int64) (*domain.Profile, error) {
+	profile, err := s.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.withAvatarURLs(ctx, profile), nil
+}
+
+// GetProfiles returns the profiles of existing users by user ID, creating missing ones
+func (s *profileService) GetProfiles(ctx context.Context, userIDs []int64) (map[int64]*domain.Profile, error) {
+	users, err := s.userRepo.GetByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	stored, err := s.profileRepo.GetByUserIDs(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user profiles: %w", err)
+	}
+	byUser := make(map[int64]*domain.Profile, len(stored))
+	for _, profile := range stored {
+		byUser[profile.UserID] = profile
+	}
+
+	profiles := make(map[int64]*domain.Profile, len(users))
+	for _, user := range users {
+		profile, ok := byUser[user.ID]
+		if !ok {
+			profile = &domain.Profile{
+				UserID:   user.ID,
+				Nickname: user.Username,
+			}
+			if err := s.profileRepo.Create(ctx, profile); err != nil {
+				return nil, fmt.Errorf("failed to create user profile: %w", err)
+			}
+		}
+		profiles[user.ID] = s.withAvatarURLs(ctx, profile)
+	}
+	return profiles, nil
+}
+
+// UpdateProfile replaces the editable fields of a profile
+func (s *profileService) UpdateProfile(ctx context.Context, userID, version int64, req *domain.ProfileRequest) (*domain.Profile, error) {
+	if err := validateBirthday(req.Birthday); err != nil {
+		return nil, err
+	}
+
+	profile, err := s.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(profile.Version, version); err != nil {
+		return nil, err
+	}
+
+	profile.Nickname = req.Nickname
+	profile.Bio = req.Bio
+	profile.Phone = req.Phone
+	profile.Gender = req.Gender
+	profile.Birthday = req.Birthday
+	profile.Locale = req.Locale
+
+	return s.save(ctx, profile)
+}
+
+// PatchProfile applies a patch to the editable fields of a profile
+func (s *profileService) PatchProfile(ctx context.Context, userID, version int64, patch *domain.Patch) (*domain.Profile, error) {
+	profile, err := s.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(profile.Version, version); err != nil {
+		return nil, err
+	}
+
+	doc := &domain.ProfileRequest{
+		Nickname: profile.Nickname,
+		Bio:      profile.Bio,
+		Phone:    profile.Phone,
+		Gender:   profile.Gender,
+		Birthday: profile.Birthday,
+		Locale:   profile.Locale,
+	}
+	if _, err := applyPatch(doc, patch); err != nil {
+		return nil, err
+	}
+	if err := validateBirthday(doc.Birthday); err != nil {
+		return nil, err
+	}
+
+	profile.Nickname = doc.Nickname
+	profile.Bio = doc.Bio
+	profile.Phone = doc.Phone
+	profile.Gender = doc.Gender
+	profile.Birthday = doc.Birthday
+	profile.Locale = doc.Locale
+
+	return s.save(ctx, profile)
+}
+
+// UploadAvatar decodes the image, scales it down to the configured maximum dimension,
+// generates square thumbnails and replaces the previous avatar
+func (s *profileService) UploadAvatar(ctx context.Context, userID int64, data []byte) (*domain.Profile, error) {
+	if int64(len(data)) > s.cfg.Profile.AvatarMaxSize {
+		return nil, domain.ErrAvatarTooLarge
+	}
+
+	img, contentType, err := imaging.Decode(data)
+	switch {
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		logger.Info(ctx, "Rejected avatar upload", zap.String("content_type", contentType))
+		return nil, domain.ErrUnsupportedAvatar
+	case errors.Is(err, imaging.ErrTooManyPixels):
+		return nil, domain.ErrAvatarTooLarge
+	case err != nil:
+		return nil, domain.ErrInvalidAvatar.Wrap(err)
+	}
+
+	profile, err := s.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store the scaled avatar and its thumbnails, releasing what was stored on failure
+	blobType, _ := imaging.OutputFormat(contentType)
+	var stored []string
+	store := func(img image.Image) (string, error) {
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, img, contentType); err != nil {
+			return "", fmt.Errorf("failed to encode avatar: %w", err)
+		}
+		blob, err := s.blobService.Save(ctx, "avatars", &buf, blobType)
+		if err != nil {
+			return "", fmt.Errorf("failed to store avatar: %w", err)
+		}
+		stored = append(stored, blob.Key)
+		return blob.Key, nil
+	}
+
+	avatarKey, err := store(imaging.Fit(img, s.cfg.Profile.AvatarMaxDimension))
+	thumbnailKeys := make(map[string]string, len(s.cfg.Profile.AvatarThumbnailSizes))
+	for _, size := range s.cfg.Profile.AvatarThumbnailSizes {
+		if err != nil {
+			break
+		}
+		var key string
+		key, err = store(imaging.Thumbnail(img, size))
+		thumbnailKeys[strconv.Itoa(size)] = key
+	}
+	if err != nil {
+		s.releaseBlobs(ctx, stored)
+		return nil, err
+	}
+
+	previous := avatarKeys(profile)
+	profile.AvatarKey = avatarKey
+	profile.AvatarThumbnailKeys = thumbnailKeys
+	saved, err := s.save(ctx, profile)
+	if err != nil {
+		s.releaseBlobs(ctx, stored)
+		return nil, err
+	}
+
+	s.releaseBlobs(ctx, previous)
+
+	logger.Info(ctx, "Avatar uploaded", zap.Int64("user_id", userID), zap.String("key", profile.AvatarKey))
+	return saved, nil
+}
+
+// DeleteAvatar removes the avatar and its thumbnails
+func (s *profileService) DeleteAvatar(ctx context.Context, userID int64) (*domain.Profile, error) {
+	profile, err := s.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if profile.AvatarKey == "" {
+		return s.withAvatarURLs(ctx, profile), nil
+	}
+
+	previous := avatarKeys(profile)
+	profile.AvatarKey = ""
+	profile.AvatarThumbnailKeys = nil
+	saved, err := s.save(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	s.releaseBlobs(ctx, previous)
+	return saved, nil
+}
+
+// PurgeProfile permanently deletes the profile of a deleted user and releases its avatar
+func (s *profileService) PurgeProfile(ctx context.Context, userID int64) error {
+	profile, err := s.profileRepo.GetDeletedByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user profile: %w", err)
+	}
+	if profile == nil {
+		return nil
+	}
+
+	if err := s.profileRepo.Delete(ctx, profile.ID); err != nil {
+		return fmt.Errorf("failed to delete user profile: %w", err)
+	}
+
+	s.releaseBlobs(ctx, avatarKeys(profile))
+	return nil
+}
+
+// load retrieves the profile of an existing user, creating a default one if missing
+func (s *profileService) load(ctx context.Context, userID int64) (*domain.Profile, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+
+	profile, err := s.profileRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+	if profile == nil {
+		profile = &domain.Profile{
+			UserID:   user.ID,
+			Nickname: user.Username,
+		}
+		if err := s.profileRepo.Create(ctx, profile); err != nil {
+			return nil, fmt.Errorf("failed to create user profile: %w", err)
+		}
+	}
+
+	return profile, nil
+}
+
+// save persists the profile and returns it with avatar URLs
+func (s *profileService) save(ctx context.Context, profile *domain.Profile) (*domain.Profile, error) {
+	if err := s.profileRepo.Update(ctx, profile); err != nil {
+		return nil, fmt.Errorf("failed to update user profile: %w", err)
+	}
+
+	logger.Info(ctx, "Profile updated", zap.Int64("user_id", profile.UserID))
+	return s.withAvatarURLs(ctx, profile), nil
+}
+
+// withAvatarURLs fills in the download URLs of the avatar and its thumbnails
+func (s *profileService) withAvatarURLs(ctx context.Context, profile *domain.Profile) *domain.Profile {
+	profile.Avatar = ""
+	profile.AvatarThumbnails = nil
+	if profile.AvatarKey == "" {
+		return profile
+	}
+
+	url, err := s.blobService.URL(ctx, profile.AvatarKey)
+	if err != nil {
+		logger.Error(ctx, "Failed to get avatar URL", zap.Error(err))
+		return profile
+	}
+	profile.Avatar = url
+
+	profile.AvatarThumbnails = make(map[string]string, len(profile.AvatarThumbnailKeys))
+	for size, key := range profile.AvatarThumbnailKeys {
+		url, err := s.blobService.URL(ctx, key)
+		if err != nil {
+			logger.Error(ctx, "Failed to get avatar thumbnail URL", zap.Error(err))
+			continue
+		}
+		profile.AvatarThumbnails[size] = url
+	}
+	return profile
+}
+
+// releaseBlobs releases stored blobs, failures are only logged
+func (s *profileService) releaseBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.blobService.Release(ctx, key); err != nil {
+			logger.Error(ctx, "Failed to release blob", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// Helper function: Reject birthdays in the future, the format is checked by request binding
+func validateBirthday(birthday string) error {
+	if birthday == "" {
+		return nil
+	}
+
+	date, err := time.Parse(time.DateOnly, birthday)
+	if err != nil || date.After(time.Now()) {
+		return domain.ErrInvalidBirthday
+	}
+	return nil
+}
+
+// Helper function: Collect the blob keys of an avatar and its thumbnails
+func avatarKeys(profile *domain.Profile) []string {
+	if profile.AvatarKey == "" {
+		return nil
+	}
+
+	keys := []string{profile.AvatarKey}
+	for _, key := range profile.AvatarThumbnailKeys {
+		keys = append(keys, key)
+	}
+	return keys
+}
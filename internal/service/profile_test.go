@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"testing"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/infra/blob"
+	"github.com/luxixing/fx-gin/internal/repo"
+)
+
+// newAvatarTest creates a profile service storing avatars in a temporary directory
+func newAvatarTest(t *testing.T, vars map[string]string) (domain.ProfileService, domain.BlobService, *domain.User) {
+	t.Helper()
+
+	database := newTestDB(t)
+	cfg := newTestConfig(t, vars)
+	store, err := blob.NewLocalStore(t.TempDir(), "http://localhost:38080", []byte("url-secret"))
+	if err != nil {
+		t.Fatalf("create local store: %v", err)
+	}
+	blobService := NewBlobService(BlobServiceParams{
+		Config:    cfg,
+		BlobRepo:  repo.NewBlobRepo(repo.BlobRepoParams{DB: database}),
+		BlobStore: store,
+	})
+	profiles := NewProfileService(ProfileServiceParams{
+		Config:      cfg,
+		UserRepo:    repo.NewUserRepo(repo.UserRepoParams{DB: database}),
+		ProfileRepo: repo.NewProfileRepo(repo.ProfileRepoParams{DB: database}),
+		BlobService: blobService,
+	})
+	return profiles, blobService, createTestUser(t, database, "alice")
+}
+
+// testImage encodes a w x h image as PNG or JPEG
+func testImage(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := range w {
+		for y := range h {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatalf("encode image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// blobImage decodes a stored blob and returns its content type and dimensions
+func blobImage(t *testing.T, blobs domain.BlobService, key string) (string, image.Point) {
+	t.Helper()
+
+	rc, b, err := blobs.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("open blob %s: %v", key, err)
+	}
+	defer rc.Close()
+	img, _, err := image.Decode(rc)
+	if err != nil {
+		t.Fatalf("decode blob %s: %v", key, err)
+	}
+	return b.ContentType, img.Bounds().Size()
+}
+
+func TestUploadAvatarScalesAndThumbnails(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		format      string
+		contentType string
+	}{
+		{"png", "png", "image/png"},
+		{"jpeg", "jpeg", "image/jpeg"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			profiles, blobs, user := newAvatarTest(t, map[string]string{
+				"PROFILE_AVATAR_MAX_DIMENSION":   "100",
+				"PROFILE_AVATAR_THUMBNAIL_SIZES": "48,16",
+			})
+
+			profile, err := profiles.UploadAvatar(ctx, user.ID, testImage(t, tc.format, 300, 150))
+			if err != nil {
+				t.Fatalf("upload avatar: %v", err)
+			}
+			if profile.Avatar == "" || len(profile.AvatarThumbnails) != 2 {
+				t.Errorf("avatar = %q, thumbnails = %v, want URLs of the avatar and 2 thumbnails", profile.Avatar, profile.AvatarThumbnails)
+			}
+
+			contentType, size := blobImage(t, blobs, profile.AvatarKey)
+			if contentType != tc.contentType || size != image.Pt(100, 50) {
+				t.Errorf("avatar = %s %v, want %s scaled to 100x50", contentType, size, tc.contentType)
+			}
+			for _, side := range []string{"48", "16"} {
+				contentType, size := blobImage(t, blobs, profile.AvatarThumbnailKeys[side])
+				if contentType != tc.contentType || size.X != size.Y || strconv.Itoa(size.X) != side {
+					t.Errorf("thumbnail %s = %s %v, want %s square", side, contentType, size, tc.contentType)
+				}
+			}
+
+			// A new avatar releases the previous one and its thumbnails
+			previous := profile.AvatarKey
+			if _, err := profiles.UploadAvatar(ctx, user.ID, testImage(t, tc.format, 80, 80)); err != nil {
+				t.Fatalf("replace avatar: %v", err)
+			}
+			if _, _, err := blobs.Open(ctx, previous); !errors.Is(err, domain.ErrBlobNotFound) {
+				t.Errorf("open previous avatar: err = %v, want %v", err, domain.ErrBlobNotFound)
+			}
+		})
+	}
+}
+
+func TestUploadAvatarRejectsInvalidContent(t *testing.T) {
+	valid := testImage(t, "png", 40, 40)
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"over the size limit", append(valid, make([]byte, 4096)...), domain.ErrAvatarTooLarge},
+		{"gif header only", []byte("GIF89a\x01\x00\x01\x00"), domain.ErrInvalidAvatar},
+		{"html", []byte("<html><script>alert(1)</script></html>"), domain.ErrUnsupportedAvatar},
+		{"truncated image", valid[:len(valid)/2], domain.ErrInvalidAvatar},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			profiles, _, user := newAvatarTest(t, map[string]string{"PROFILE_AVATAR_MAX_SIZE": "4096"})
+
+			_, err := profiles.UploadAvatar(context.Background(), user.ID, tc.data)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Invoke(StartUserPurger),
+	)
+}
+
+// UserPurgerParams represents the parameters required to run the purge job
+type UserPurgerParams struct {
+	fx.In
+
+	Lifecycle   fx.Lifecycle
+	Config      *config.Config
+	UserService domain.UserService
+}
+
+// StartUserPurger periodically purges users whose retention period has passed,
+// running from application start until it stops
+func StartUserPurger(p UserPurgerParams) {
+	interval := p.Config.User.PurgeInterval
+	if interval <= 0 {
+		logger.Info(context.Background(), "Purging of deleted users is disabled")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	purge := func() {
+		before := time.Now().Add(-p.Config.User.DeletedRetention)
+		purged, err := p.UserService.PurgeDeletedUsers(ctx, before)
+		if err != nil {
+			logger.Error(ctx, "Failed to purge deleted users", zap.Error(err))
+		}
+		if purged > 0 {
+			logger.Info(ctx, "Purged deleted users", zap.Int("count", purged))
+		}
+	}
+
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+
+				purge()
+				for {
+					select {
+					case <-ticker.C:
+						purge()
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+			case <-stopCtx.Done():
+			}
+			return nil
+		},
+	})
+}
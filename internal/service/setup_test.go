@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/infra/db"
+	"github.com/luxixing/fx-gin/internal/repo"
+	"github.com/luxixing/fx-gin/pkg/validation"
+)
+
+// newTestDB opens a migrated SQLite database in a temporary directory
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	database, err := sql.Open("sqlite3", db.DataSourceName(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if err := db.RunMigrations(db.MigrationConfig{DB: database}); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+	return database
+}
+
+// newTestConfig returns the default configuration with the given variables applied,
+// ignoring the environment of the process
+func newTestConfig(t *testing.T, vars map[string]string) *config.Config {
+	t.Helper()
+
+	var cfg config.Config
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: vars}); err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	return &cfg
+}
+
+// createTestUser stores an active user with a verified email address
+func createTestUser(t *testing.T, database *sql.DB, username string) *domain.User {
+	t.Helper()
+
+	password, err := hashPassword("Passw0rd1")
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	verifiedAt := time.Now()
+	user := &domain.User{
+		Username:        username,
+		Email:           username + "@example.com",
+		Password:        password,
+		Status:          domain.UserStatusActive,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	if err := repo.NewUserRepo(repo.UserRepoParams{DB: database}).Create(context.Background(), user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+var validationOnce sync.Once
+
+// setupValidation registers the custom rules on the validator of request binding like the
+// router does, so patched documents are validated as in requests
+func setupValidation(t *testing.T) {
+	t.Helper()
+
+	var err error
+	validationOnce.Do(func() {
+		if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+			err = validation.Setup(v)
+		}
+	})
+	if err != nil {
+		t.Fatalf("set up validation: %v", err)
+	}
+}
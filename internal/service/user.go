@@ -6,10 +6,14 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
-	"errors"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/luxixing/fx-gin/internal/config"
 	"github.com/luxixing/fx-gin/internal/domain"
 	"github.com/luxixing/fx-gin/pkg/logger"
 	"github.com/luxixing/fx-gin/pkg/registry"
@@ -27,82 +31,130 @@ func init() {
 type UserServiceParams struct {
 	fx.In
 
-	UserRepo    domain.UserRepo
-	ProfileRepo domain.ProfileRepo
-	RoleRepo    domain.RoleRepo
+	Config         *config.Config
+	UserRepo       domain.UserRepo
+	ProfileRepo    domain.ProfileRepo
+	RoleRepo       domain.RoleRepo
+	MFARepo        domain.MFARepo
+	UserTokenRepo  domain.UserTokenRepo
+	AccountService domain.AccountService
+	ProfileService domain.ProfileService
+	Auditor        domain.Auditor
+	Transactor     domain.Transactor
+	EventBus       domain.EventBus
 }
 
 // userService implements the user service interface
 type userService struct {
-	userRepo    domain.UserRepo
-	profileRepo domain.ProfileRepo
-	roleRepo    domain.RoleRepo
+	cfg            *config.Config
+	userRepo       domain.UserRepo
+	profileRepo    domain.ProfileRepo
+	roleRepo       domain.RoleRepo
+	mfaRepo        domain.MFARepo
+	userTokenRepo  domain.UserTokenRepo
+	accountService domain.AccountService
+	profileService domain.ProfileService
+	auditor        domain.Auditor
+	transactor     domain.Transactor
+	eventBus       domain.EventBus
 }
 
 // NewUserService creates a new user service instance
 func NewUserService(p UserServiceParams) domain.UserService {
 	return &userService{
-		userRepo:    p.UserRepo,
-		profileRepo: p.ProfileRepo,
-		roleRepo:    p.RoleRepo,
+		cfg:            p.Config,
+		userRepo:       p.UserRepo,
+		profileRepo:    p.ProfileRepo,
+		roleRepo:       p.RoleRepo,
+		mfaRepo:        p.MFARepo,
+		userTokenRepo:  p.UserTokenRepo,
+		accountService: p.AccountService,
+		profileService: p.ProfileService,
+		auditor:        p.Auditor,
+		transactor:     p.Transactor,
+		eventBus:       p.EventBus,
 	}
 }
 
 // Register registers a new user
 func (s *userService) Register(ctx context.Context, req *domain.UserRequest) (*domain.User, error) {
-	logger.Debug(ctx, "register", zap.Any("req", req))
 	// Check if username already exists
-	existingUser, err := s.userRepo.GetByUsername(ctx, req.Username)
+	taken, err := s.userRepo.IsUsernameTaken(ctx, req.Username)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check username: %w", err)
 	}
-	if existingUser != nil {
-		return nil, errors.New("username already exists")
+	if taken {
+		return nil, domain.ErrUsernameExists
 	}
 
 	// Check if email already exists
-	existingUser, err = s.userRepo.GetByEmail(ctx, req.Email)
+	taken, err = s.userRepo.IsEmailTaken(ctx, req.Email)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check email: %w", err)
 	}
-	if existingUser != nil {
-		return nil, errors.New("email already registered")
+	if taken {
+		return nil, domain.ErrEmailRegistered
 	}
 
 	// Hash password
-	hashedPassword, err := s.hashPassword(req.Password)
+	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Create user
+	// Create user, inactive until the email is verified when verification is required
+	status := domain.UserStatusActive
+	if s.cfg.Account.RequireEmailVerification {
+		status = domain.UserStatusInactive
+	}
 	user := &domain.User{
 		Username: req.Username,
 		Email:    req.Email,
 		Password: hashedPassword,
-		Status:   domain.UserStatusActive, // Default to active
+		Status:   status,
 	}
 
-	if err := s.userRepo.Create(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
-	}
+	// The user, its profile and role and the registration event are stored together
+	err = s.transactor.InTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
 
-	// Create default profile
-	profile := &domain.Profile{
-		UserID:   user.ID,
-		Nickname: user.Username,
-	}
-	if err := s.profileRepo.Create(ctx, profile); err != nil {
-		// Don't return error, user can still continue
-	}
+		// Create default profile
+		profile := &domain.Profile{
+			UserID:   user.ID,
+			Nickname: user.Username,
+		}
+		if err := s.profileRepo.Create(ctx, profile); err != nil {
+			return fmt.Errorf("failed to create profile: %w", err)
+		}
 
-	// Assign default role (if exists)
-	defaultRole, _ := s.roleRepo.GetByName(ctx, "user")
-	if defaultRole != nil {
-		if err := s.roleRepo.AddRoleToUser(ctx, user.ID, defaultRole.ID); err != nil {
+		// Assign default role (if exists)
+		defaultRole, err := s.roleRepo.GetByName(ctx, "user")
+		if err != nil {
+			return fmt.Errorf("failed to get default role: %w", err)
+		}
+		if defaultRole != nil {
+			if err := s.roleRepo.AddRoleToUser(ctx, user.ID, defaultRole.ID); err != nil {
+				return fmt.Errorf("failed to assign default role: %w", err)
+			}
 		}
+
+		return s.eventBus.Publish(ctx, domain.UserRegistered{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Status:   user.Status,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	s.audit(ctx, domain.AuditUserRegister, user.ID, nil, "")
+
+	s.sendVerificationEmail(ctx, user)
+
 	// Don't return password
 	user.Password = ""
 	return user, nil
@@ -115,7 +167,7 @@ func (s *userService) GetUserByID(ctx context.Context, id int64) (*domain.User,
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, domain.ErrUserNotFound
 	}
 
 	// Don't return password
@@ -124,93 +176,247 @@ func (s *userService) GetUserByID(ctx context.Context, id int64) (*domain.User,
 }
 
 // UpdateUser updates user information
-func (s *userService) UpdateUser(ctx context.Context, id int64, req *domain.UserRequest) error {
+func (s *userService) UpdateUser(ctx context.Context, id, version int64, req *domain.UserRequest) (*domain.User, error) {
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return errors.New("user not found")
+		return nil, domain.ErrUserNotFound
 	}
+	if err := checkVersion(user.Version, version); err != nil {
+		return nil, err
+	}
+	before := *user
 
-	// Check if username is already used by another user
-	if req.Username != user.Username {
-		existingUser, err := s.userRepo.GetByUsername(ctx, req.Username)
-		if err != nil {
-			return fmt.Errorf("failed to check username: %w", err)
+	if err := s.setIdentity(ctx, user, req.Username, req.Email); err != nil {
+		return nil, err
+	}
+
+	// Update user, a new password also ends the sessions of the user
+	err = s.transactor.InTx(ctx, func(ctx context.Context) error {
+		if err := s.saveUser(ctx, user, req.Password); err != nil {
+			return err
 		}
-		if existingUser != nil && existingUser.ID != id {
-			return errors.New("username already exists")
+		return s.eventBus.Publish(ctx, userUpdated(user))
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit(ctx, domain.AuditUserUpdate, id, userChanges(&before, user), "")
+	if user.Email != before.Email {
+		s.sendVerificationEmail(ctx, user)
+	}
+
+	// Don't return password
+	user.Password = ""
+	return user, nil
+}
+
+// PatchUser applies a patch to the user document. Fields listed in userFieldPermissions
+// can only be changed by principals holding the corresponding permission.
+func (s *userService) PatchUser(ctx context.Context, principal *domain.Principal, id, version int64, patch *domain.Patch) (*domain.UserWithRoles, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if err := checkVersion(user.Version, version); err != nil {
+		return nil, err
+	}
+
+	roles, err := s.roleRepo.GetUserRoles(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	doc := &domain.UserDocument{
+		Username: user.Username,
+		Email:    user.Email,
+		Status:   user.Status,
+		Roles:    make([]string, 0, len(roles)),
+	}
+	for _, role := range roles {
+		doc.Roles = append(doc.Roles, role.Name)
+	}
+	before := *doc
+
+	changed, err := applyPatch(doc, patch)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range changed {
+		if permission, ok := userFieldPermissions[field]; ok && !principal.HasPermission(permission) {
+			logger.Info(ctx, "Rejected patch of protected field", zap.Int64("user_id", id), zap.String("field", field))
+			return nil, domain.NewFieldNotAllowedError(field)
 		}
-		user.Username = req.Username
 	}
 
-	// Check if email is already used by another user
-	if req.Email != user.Email {
-		existingUser, err := s.userRepo.GetByEmail(ctx, req.Email)
-		if err != nil {
-			return fmt.Errorf("failed to check email: %w", err)
+	if err := s.setIdentity(ctx, user, doc.Username, doc.Email); err != nil {
+		return nil, err
+	}
+	user.Status = doc.Status
+
+	// The roles and user are changed together, and only published when something changed
+	err = s.transactor.InTx(ctx, func(ctx context.Context) error {
+		if err := s.setRoles(ctx, id, roles, doc.Roles); err != nil {
+			return err
 		}
-		if existingUser != nil && existingUser.ID != id {
-			return errors.New("email already registered")
+		if err := s.saveUser(ctx, user, doc.Password); err != nil {
+			return err
 		}
-		user.Email = req.Email
+		if len(changed) == 0 {
+			return nil
+		}
+		return s.eventBus.Publish(ctx, userUpdated(user))
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Update password if provided
-	if req.Password != "" {
-		hashedPassword, err := s.hashPassword(req.Password)
-		if err != nil {
-			return fmt.Errorf("failed to hash password: %w", err)
-		}
-		user.Password = hashedPassword
+	// Role changes are recorded separately so they can be queried on their own
+	after := *doc
+	if slices.Contains(changed, "roles") {
+		s.audit(ctx, domain.AuditUserRoles, id, auditChanges(
+			map[string][]string{"roles": before.Roles},
+			map[string][]string{"roles": after.Roles},
+		), "")
+	}
+	before.Roles, after.Roles = nil, nil
+	if changes := auditChanges(&before, &after); changes != nil {
+		s.audit(ctx, domain.AuditUserUpdate, id, changes, "")
 	}
 
-	// Update user
-	if err := s.userRepo.Update(ctx, user); err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+	if slices.Contains(changed, "email") {
+		s.sendVerificationEmail(ctx, user)
 	}
 
-	return nil
+	logger.Info(ctx, "User patched", zap.Int64("user_id", id), zap.Strings("fields", changed))
+	return s.GetUserWithRoles(ctx, id)
 }
 
 // DeleteUser deletes a user
-func (s *userService) DeleteUser(ctx context.Context, id int64) error {
+func (s *userService) DeleteUser(ctx context.Context, id, version int64) error {
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return errors.New("user not found")
+		return domain.ErrUserNotFound
+	}
+	if err := checkVersion(user.Version, version); err != nil {
+		return err
 	}
 
-	// Delete user
-	if err := s.userRepo.Delete(ctx, id); err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+	// Soft delete, the user is purged after the retention period
+	err = s.transactor.InTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Delete(ctx, id, s.cfg.User.ReleaseIdentifiers); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return s.eventBus.Publish(ctx, domain.UserDeleted{UserID: id})
+	})
+	if err != nil {
+		return err
 	}
 
+	s.audit(ctx, domain.AuditUserDelete, id, nil, "")
+	logger.Info(ctx, "User deleted", zap.Int64("user_id", id))
 	return nil
 }
 
-// ListUsers retrieves a list of users
-func (s *userService) ListUsers(ctx context.Context, page, pageSize int) ([]*domain.User, int, error) {
-	if page < 1 {
-		page = 1
+// RestoreUser undeletes a user that has not been purged yet
+func (s *userService) RestoreUser(ctx context.Context, id int64) (*domain.User, error) {
+	user, err := s.userRepo.GetDeletedByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted user: %w", err)
 	}
-	if pageSize < 1 {
-		pageSize = 10
+	if user == nil {
+		return nil, domain.ErrUserNotFound
 	}
 
-	offset := (page - 1) * pageSize
-	users, err := s.userRepo.List(ctx, offset, pageSize)
+	err = s.transactor.InTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Restore(ctx, user); err != nil {
+			return fmt.Errorf("failed to restore user: %w", err)
+		}
+		return s.eventBus.Publish(ctx, domain.UserRestored{UserID: id})
+	})
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get user list: %w", err)
+		return nil, err
+	}
+
+	s.audit(ctx, domain.AuditUserRestore, id, nil, "")
+	logger.Info(ctx, "User restored", zap.Int64("user_id", id))
+	user.Password = ""
+	return user, nil
+}
+
+// purgeBatchSize is the number of users purged per query
+const purgeBatchSize = 100
+
+// PurgeDeletedUsers permanently deletes users deleted before the given time
+func (s *userService) PurgeDeletedUsers(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	for {
+		ids, err := s.userRepo.ListDeletedIDs(ctx, before, purgeBatchSize)
+		if err != nil {
+			return purged, fmt.Errorf("failed to list deleted users: %w", err)
+		}
+
+		for _, id := range ids {
+			if err := s.profileService.PurgeProfile(ctx, id); err != nil {
+				return purged, err
+			}
+			if err := s.userRepo.Purge(ctx, id); err != nil {
+				return purged, fmt.Errorf("failed to purge user: %w", err)
+			}
+			s.audit(ctx, domain.AuditUserPurge, id, nil, "")
+			purged++
+		}
+
+		if len(ids) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// ListUsers retrieves a page of users matching the query
+func (s *userService) ListUsers(ctx context.Context, query *domain.UserQuery) (*domain.UserList, error) {
+	q := *query
+	if q.Limit < 1 {
+		q.Limit = domain.DefaultPageSize
+	}
+	if q.Limit > domain.MaxPageSize {
+		q.Limit = domain.MaxPageSize
 	}
 
-	// Get total count
-	total, err := s.userRepo.Count(ctx)
+	users, next, err := s.userRepo.List(ctx, &q)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get user count: %w", err)
+		return nil, fmt.Errorf("failed to get user list: %w", err)
+	}
+
+	if users == nil {
+		users = []*domain.User{}
+	}
+	list := &domain.UserList{
+		Items: users,
+		Pagination: domain.Pagination{
+			Limit:      q.Limit,
+			NextCursor: next,
+			HasMore:    next != "",
+		},
+	}
+	if q.Cursor == "" {
+		list.Pagination.Page = max(q.Page, 1)
+	}
+
+	// Counting is skipped unless asked for, it scans every matching row
+	if q.WithTotal {
+		total, err := s.userRepo.Count(ctx, &q)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user count: %w", err)
+		}
+		list.Pagination.Total = &total
 	}
 
 	// Remove passwords
@@ -218,7 +424,7 @@ func (s *userService) ListUsers(ctx context.Context, page, pageSize int) ([]*dom
 		user.Password = ""
 	}
 
-	return users, total, nil
+	return list, nil
 }
 
 // Login user login
@@ -229,41 +435,93 @@ func (s *userService) Login(ctx context.Context, req *domain.LoginRequest) (*dom
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return nil, errors.New("invalid username or password")
+		// Only the code is recorded, a mistyped name is often someone's password
+		s.audit(ctx, domain.AuditUserLoginFailed, 0, nil, domain.ErrInvalidCredentials.Code)
+		return nil, domain.ErrInvalidCredentials
 	}
 
 	// Check user status
-	if user.Status != domain.UserStatusActive {
-		return nil, errors.New("account is not active or has been locked")
+	var loginErr *domain.Error
+	switch {
+	case user.Status == domain.UserStatusInactive && user.EmailVerifiedAt == nil:
+		loginErr = domain.ErrEmailNotVerified
+	case user.Status != domain.UserStatusActive:
+		loginErr = domain.ErrAccountInactive
+	case !verifyPassword(user.Password, req.Password):
+		loginErr = domain.ErrInvalidCredentials
+	}
+	if loginErr != nil {
+		s.audit(ctx, domain.AuditUserLoginFailed, user.ID, nil, loginErr.Code)
+		return nil, loginErr
 	}
 
-	// Verify password
-	if !s.verifyPassword(user.Password, req.Password) {
-		return nil, errors.New("invalid username or password")
+	resp, err := issueLoginToken(ctx, s.cfg, s.mfaRepo, s.userTokenRepo, user.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Generate token (simple implementation, should use JWT or other standard methods in production)
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+	// The request is anonymous, the user signing in is the actor. With MFA the login is
+	// recorded once the second factor has been verified.
+	event := &domain.AuditEvent{
+		ActorID:    user.ID,
+		Action:     domain.AuditUserLogin,
+		TargetType: domain.AuditTargetUser,
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	}
+	if resp.MFARequired {
+		event.Action = domain.AuditUserLoginChallenge
+	}
+	s.auditor.Record(ctx, event)
+	return resp, nil
+}
+
+// Helper function: Issue an access token, or an MFA challenge when the user has TOTP enabled
+func issueLoginToken(ctx context.Context, cfg *config.Config, mfaRepo domain.MFARepo, tokenRepo domain.UserTokenRepo, userID int64) (*domain.TokenResponse, error) {
+	mfa, err := mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa settings: %w", err)
+	}
+	if mfa != nil && mfa.Enabled {
+		return createMFAChallenge(ctx, mfaRepo, userID, cfg.MFA.ChallengeTTL)
+	}
+
+	return issueAccessToken(ctx, tokenRepo, userID, cfg.Auth.TokenTTL)
+}
+
+// Helper function: Create a short-lived challenge that must be completed with a TOTP or recovery code
+func createMFAChallenge(ctx context.Context, mfaRepo domain.MFARepo, userID int64, ttl time.Duration) (*domain.TokenResponse, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
 	}
-	token := base64.StdEncoding.EncodeToString(tokenBytes)
-	expiresAt := time.Now().Add(24 * time.Hour).Unix()
 
-	// In production, token should be saved to database or cache
-	// ...
+	challenge := &domain.MFAChallenge{
+		UserID:    userID,
+		TokenHash: hashSecret(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := mfaRepo.CreateChallenge(ctx, challenge); err != nil {
+		return nil, fmt.Errorf("failed to create challenge: %w", err)
+	}
 
 	return &domain.TokenResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
+		ExpiresAt:      challenge.ExpiresAt.Unix(),
+		MFARequired:    true,
+		ChallengeToken: token,
 	}, nil
 }
 
-// ValidateToken validates a token
+// ValidateToken validates an access token and returns the user ID it was issued to
 func (s *userService) ValidateToken(ctx context.Context, token string) (int64, error) {
-	// In production, token should be validated against database or cache
-	// For demo purposes, return a fixed user ID
-	return 1, nil
+	accessToken, err := s.userTokenRepo.GetByHash(ctx, domain.TokenPurposeAccess, hashSecret(token))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token: %w", err)
+	}
+	if accessToken == nil || accessToken.UsedAt != nil || time.Now().After(accessToken.ExpiresAt) {
+		return 0, domain.ErrInvalidToken
+	}
+
+	return accessToken.UserID, nil
 }
 
 // GetUserWithProfile retrieves a user and their profile
@@ -274,23 +532,13 @@ func (s *userService) GetUserWithProfile(ctx context.Context, id int64) (*domain
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, domain.ErrUserNotFound
 	}
 
-	// Get profile
-	profile, err := s.profileRepo.GetByUserID(ctx, id)
+	// Get profile, a default one is created if not exists
+	profile, err := s.profileService.GetProfile(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user profile: %w", err)
-	}
-	if profile == nil {
-		// Create default profile if not exists
-		profile = &domain.Profile{
-			UserID:   user.ID,
-			Nickname: user.Username,
-		}
-		if err := s.profileRepo.Create(ctx, profile); err != nil {
-			return nil, fmt.Errorf("failed to create user profile: %w", err)
-		}
+		return nil, err
 	}
 
 	// Don't return password
@@ -301,6 +549,29 @@ func (s *userService) GetUserWithProfile(ctx context.Context, id int64) (*domain
 	}, nil
 }
 
+// GetUsersByIDs retrieves the users with the given IDs
+func (s *userService) GetUsersByIDs(ctx context.Context, ids []int64) ([]*domain.User, error) {
+	users, err := s.userRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	// Don't return passwords
+	for _, user := range users {
+		user.Password = ""
+	}
+	return users, nil
+}
+
+// GetRolesByUserIDs retrieves the roles of the given users
+func (s *userService) GetRolesByUserIDs(ctx context.Context, ids []int64) (map[int64][]*domain.Role, error) {
+	roles, err := s.roleRepo.GetRolesByUserIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	return roles, nil
+}
+
 // GetUserWithRoles retrieves a user and their roles
 func (s *userService) GetUserWithRoles(ctx context.Context, id int64) (*domain.UserWithRoles, error) {
 	// Get user
@@ -309,7 +580,7 @@ func (s *userService) GetUserWithRoles(ctx context.Context, id int64) (*domain.U
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, domain.ErrUserNotFound
 	}
 
 	// Get roles
@@ -334,17 +605,192 @@ func (s *userService) GetUserWithRoles(ctx context.Context, id int64) (*domain.U
 	}, nil
 }
 
+// setIdentity changes the username and email of a user, rejecting values used by another user.
+// A changed email address is unverified until the user confirms it.
+func (s *userService) setIdentity(ctx context.Context, user *domain.User, username, email string) error {
+	if username != user.Username {
+		taken, err := s.userRepo.IsUsernameTaken(ctx, username)
+		if err != nil {
+			return fmt.Errorf("failed to check username: %w", err)
+		}
+		if taken {
+			return domain.ErrUsernameExists
+		}
+		user.Username = username
+	}
+
+	if email != user.Email {
+		taken, err := s.userRepo.IsEmailTaken(ctx, email)
+		if err != nil {
+			return fmt.Errorf("failed to check email: %w", err)
+		}
+		if taken {
+			return domain.ErrEmailRegistered
+		}
+		// Nobody has confirmed the new address yet
+		user.Email = email
+		user.EmailVerifiedAt = nil
+	}
+
+	return nil
+}
+
+// saveUser stores the changes to a user. A new password is set by the account service,
+// which also revokes the tokens issued with the old one.
+func (s *userService) saveUser(ctx context.Context, user *domain.User, password string) error {
+	if password != "" {
+		return s.accountService.SetPassword(ctx, user, password)
+	}
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	return nil
+}
+
+// sendVerificationEmail asks the user to confirm its email address. Failures are only
+// logged, the user can request a new verification email.
+func (s *userService) sendVerificationEmail(ctx context.Context, user *domain.User) {
+	if err := s.accountService.SendVerificationEmail(ctx, user); err != nil {
+		logger.Error(ctx, "Failed to send verification email", zap.Error(err))
+	}
+}
+
+// setRoles grants and revokes roles so the user has exactly the named roles
+func (s *userService) setRoles(ctx context.Context, userID int64, current []*domain.Role, names []string) error {
+	wanted := make(map[string]*domain.Role, len(names))
+	for _, name := range names {
+		if _, ok := wanted[name]; ok {
+			continue
+		}
+		role, err := s.roleRepo.GetByName(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to get role: %w", err)
+		}
+		if role == nil {
+			return domain.NewUnknownRoleError(name)
+		}
+		wanted[name] = role
+	}
+
+	for _, role := range current {
+		if _, ok := wanted[role.Name]; ok {
+			delete(wanted, role.Name)
+			continue
+		}
+		if err := s.roleRepo.RemoveRoleFromUser(ctx, userID, role.ID); err != nil {
+			return fmt.Errorf("failed to revoke role: %w", err)
+		}
+	}
+	for _, role := range wanted {
+		if err := s.roleRepo.AddRoleToUser(ctx, userID, role.ID); err != nil {
+			return fmt.Errorf("failed to grant role: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// userFieldPermissions lists the user document fields that need a permission to change,
+// so users cannot change their own status or roles
+var userFieldPermissions = map[string]string{
+	"status": domain.PermissionUsersWrite,
+	"roles":  domain.PermissionRolesWrite,
+}
+
+// Helper function: Reject changes based on a stale version, zero accepts any version
+func checkVersion(current, expected int64) error {
+	if expected != 0 && expected != current {
+		return domain.ErrPreconditionFailed
+	}
+	return nil
+}
+
 // Helper function: Hash password
-func (s *userService) hashPassword(password string) (string, error) {
+func hashPassword(password string) (string, error) {
 	// Simple implementation, in production use bcrypt or argon2
 	hash := sha256.Sum256([]byte(password))
 	return base64.StdEncoding.EncodeToString(hash[:]), nil
 }
 
 // Helper function: Verify password
-func (s *userService) verifyPassword(hashedPassword, password string) bool {
+func verifyPassword(hashedPassword, password string) bool {
 	// Simple implementation, in production use bcrypt or argon2
 	hash := sha256.Sum256([]byte(password))
 	inputHash := base64.StdEncoding.EncodeToString(hash[:])
 	return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(inputHash)) == 1
 }
+
+// Helper function: Issue an opaque access token, only its hash is stored
+func issueAccessToken(ctx context.Context, tokenRepo domain.UserTokenRepo, userID int64, ttl time.Duration) (*domain.TokenResponse, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	accessToken := &domain.UserToken{
+		UserID:    userID,
+		Purpose:   domain.TokenPurposeAccess,
+		TokenHash: hashSecret(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := tokenRepo.Create(ctx, accessToken); err != nil {
+		return nil, fmt.Errorf("failed to save token: %w", err)
+	}
+
+	return &domain.TokenResponse{
+		Token:     token,
+		ExpiresAt: accessToken.ExpiresAt.Unix(),
+	}, nil
+}
+
+// Helper function: Generate a random URL-safe token of n bytes
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Helper function: Hash a high-entropy secret (tokens, recovery codes) for storage
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// audit records an action on a user in the audit log
+func (s *userService) audit(ctx context.Context, action string, userID int64, changes json.RawMessage, detail string) {
+	event := &domain.AuditEvent{
+		Action:     action,
+		TargetType: domain.AuditTargetUser,
+		Changes:    changes,
+		Detail:     detail,
+	}
+	if userID != 0 {
+		event.TargetID = strconv.FormatInt(userID, 10)
+	}
+	s.auditor.Record(ctx, event)
+}
+
+// Helper function: Build the event published when a user has changed
+func userUpdated(user *domain.User) domain.UserUpdated {
+	return domain.UserUpdated{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Status:   user.Status,
+	}
+}
+
+// Helper function: Diff the audited fields of a user, a changed password hash is
+// recorded without its value
+func userChanges(before, after *domain.User) json.RawMessage {
+	type auditedUser struct {
+		*domain.User
+		Password bool `json:"password,omitempty"`
+	}
+	return auditChanges(
+		auditedUser{User: before},
+		auditedUser{User: after, Password: after.Password != before.Password},
+	)
+}
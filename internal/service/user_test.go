@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/infra/mail"
+	"github.com/luxixing/fx-gin/internal/repo"
+	"go.uber.org/fx/fxtest"
+)
+
+// userTest is a user service on a test database, sending emails to an outbox
+type userTest struct {
+	db            *sql.DB
+	users         *userService
+	accounts      domain.AccountService
+	userRepo      domain.UserRepo
+	roleRepo      domain.RoleRepo
+	userTokenRepo domain.UserTokenRepo
+	oauthRepo     domain.OAuthRepo
+	auditor       domain.Auditor
+	outbox        *mail.MemoryOutbox
+}
+
+// newUserTest creates a user service with the given configuration variables
+func newUserTest(t *testing.T, vars map[string]string) *userTest {
+	t.Helper()
+	setupValidation(t)
+
+	database := newTestDB(t)
+	cfg := newTestConfig(t, vars)
+	u := &userTest{
+		db:            database,
+		userRepo:      repo.NewUserRepo(repo.UserRepoParams{DB: database}),
+		roleRepo:      repo.NewRoleRepo(repo.RoleRepoParams{DB: database}),
+		userTokenRepo: repo.NewUserTokenRepo(repo.UserTokenRepoParams{DB: database}),
+		oauthRepo:     repo.NewOAuthRepo(repo.OAuthRepoParams{DB: database}),
+		auditor:       newTestAuditor(database),
+		outbox:        mail.NewMemoryOutbox(),
+	}
+	profileRepo := repo.NewProfileRepo(repo.ProfileRepoParams{DB: database})
+	transactor := repo.NewTransactor(repo.TransactorParams{DB: database})
+
+	u.accounts = NewAccountService(AccountServiceParams{
+		Config:        cfg,
+		UserRepo:      u.userRepo,
+		ProfileRepo:   profileRepo,
+		UserTokenRepo: u.userTokenRepo,
+		OAuthRepo:     u.oauthRepo,
+		Mailer:        u.outbox,
+		Transactor:    transactor,
+		Auditor:       u.auditor,
+	})
+	u.users = NewUserService(UserServiceParams{
+		Config:         cfg,
+		UserRepo:       u.userRepo,
+		ProfileRepo:    profileRepo,
+		RoleRepo:       u.roleRepo,
+		MFARepo:        repo.NewMFARepo(repo.MFARepoParams{DB: database}),
+		UserTokenRepo:  u.userTokenRepo,
+		AccountService: u.accounts,
+		ProfileService: NewProfileService(ProfileServiceParams{Config: cfg, UserRepo: u.userRepo, ProfileRepo: profileRepo}),
+		Auditor:        u.auditor,
+		Transactor:     transactor,
+		EventBus: NewEventBus(EventBusParams{
+			Lifecycle:  fxtest.NewLifecycle(t),
+			Config:     cfg,
+			Transactor: transactor,
+			OutboxRepo: repo.NewEventOutboxRepo(repo.EventOutboxRepoParams{DB: database}),
+		}),
+	}).(*userService)
+	return u
+}
+
+// mailToken extracts the token of the link in the last email sent to an address
+func (u *userTest) mailToken(t *testing.T, to string) string {
+	t.Helper()
+
+	msg := u.outbox.Last()
+	if msg == nil || len(msg.To) != 1 || msg.To[0] != to {
+		t.Fatalf("last email = %+v, want one to %s", msg, to)
+	}
+	match := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(msg.Text)
+	if match == nil {
+		t.Fatalf("email has no token link: %s", msg.Text)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatalf("unescape token: %v", err)
+	}
+	return token
+}
+
+func TestChangedEmailRequiresVerification(t *testing.T) {
+	admin := &domain.Principal{UserID: 1, Permissions: []string{domain.PermissionAll}}
+
+	for _, tc := range []struct {
+		name   string
+		update func(u *userTest, user *domain.User) error
+	}{
+		{
+			name: "update",
+			update: func(u *userTest, user *domain.User) error {
+				_, err := u.users.UpdateUser(context.Background(), user.ID, 0, &domain.UserRequest{
+					Username: user.Username,
+					Email:    "new@example.com",
+				})
+				return err
+			},
+		},
+		{
+			name: "patch",
+			update: func(u *userTest, user *domain.User) error {
+				_, err := u.users.PatchUser(context.Background(), admin, user.ID, 0, &domain.Patch{
+					ContentType: "application/merge-patch+json",
+					Body:        []byte(`{"email": "new@example.com"}`),
+				})
+				return err
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			u := newUserTest(t, nil)
+			user := createTestUser(t, u.db, "alice")
+
+			if err := tc.update(u, user); err != nil {
+				t.Fatalf("change email: %v", err)
+			}
+			changed, err := u.userRepo.GetByID(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("get user: %v", err)
+			}
+			if changed.Email != "new@example.com" || changed.EmailVerifiedAt != nil {
+				t.Fatalf("user = %s verified at %v, want the new address unverified", changed.Email, changed.EmailVerifiedAt)
+			}
+
+			token := u.mailToken(t, "new@example.com")
+			if err := u.accounts.VerifyEmail(ctx, token); err != nil {
+				t.Fatalf("verify email: %v", err)
+			}
+			verified, err := u.userRepo.GetByID(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("get user: %v", err)
+			}
+			if verified.EmailVerifiedAt == nil {
+				t.Errorf("new address was not verified")
+			}
+		})
+	}
+}
+
+func TestUnchangedEmailStaysVerified(t *testing.T) {
+	ctx := context.Background()
+	u := newUserTest(t, nil)
+	user := createTestUser(t, u.db, "alice")
+
+	_, err := u.users.UpdateUser(ctx, user.ID, 0, &domain.UserRequest{Username: "alice2", Email: user.Email})
+	if err != nil {
+		t.Fatalf("update user: %v", err)
+	}
+	updated, err := u.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if updated.EmailVerifiedAt == nil {
+		t.Errorf("verification was cleared although the email did not change")
+	}
+	if msg := u.outbox.Last(); msg != nil {
+		t.Errorf("sent %q although the email did not change", msg.Subject)
+	}
+}
+
+func TestChangedPasswordRevokesSessions(t *testing.T) {
+	admin := &domain.Principal{UserID: 1, Permissions: []string{domain.PermissionAll}}
+
+	for _, tc := range []struct {
+		name   string
+		update func(u *userTest, user *domain.User) error
+	}{
+		{
+			name: "update",
+			update: func(u *userTest, user *domain.User) error {
+				_, err := u.users.UpdateUser(context.Background(), user.ID, 0, &domain.UserRequest{
+					Username: user.Username,
+					Email:    user.Email,
+					Password: "N3wPassword",
+				})
+				return err
+			},
+		},
+		{
+			name: "patch",
+			update: func(u *userTest, user *domain.User) error {
+				_, err := u.users.PatchUser(context.Background(), admin, user.ID, 0, &domain.Patch{
+					ContentType: "application/merge-patch+json",
+					Body:        []byte(`{"password": "N3wPassword"}`),
+				})
+				return err
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			u := newUserTest(t, nil)
+			user := createTestUser(t, u.db, "alice")
+
+			if err := u.userTokenRepo.Create(ctx, &domain.UserToken{
+				UserID: user.ID, Purpose: domain.TokenPurposeAccess, TokenHash: hashSecret("access"), ExpiresAt: time.Now().Add(time.Hour),
+			}); err != nil {
+				t.Fatalf("create access token: %v", err)
+			}
+			if err := u.oauthRepo.CreateRefreshToken(ctx, &domain.OAuthRefreshToken{
+				TokenHash: hashSecret("refresh"), ClientID: "client", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour),
+			}); err != nil {
+				t.Fatalf("create refresh token: %v", err)
+			}
+
+			if err := tc.update(u, user); err != nil {
+				t.Fatalf("change password: %v", err)
+			}
+			updated, err := u.userRepo.GetByID(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("get user: %v", err)
+			}
+			if !verifyPassword(updated.Password, "N3wPassword") {
+				t.Errorf("password was not changed")
+			}
+
+			access, err := u.userTokenRepo.GetByHash(ctx, domain.TokenPurposeAccess, hashSecret("access"))
+			if err != nil {
+				t.Fatalf("get access token: %v", err)
+			}
+			if access != nil {
+				t.Errorf("access token was not revoked")
+			}
+			refresh, err := u.oauthRepo.GetRefreshToken(ctx, hashSecret("refresh"))
+			if err != nil {
+				t.Fatalf("get refresh token: %v", err)
+			}
+			if refresh.RevokedAt == nil {
+				t.Errorf("refresh token was not revoked")
+			}
+		})
+	}
+}
+
+func TestRegisterRollsBackOnFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		table string
+	}{
+		{"profile", "profiles"},
+		{"default role", "user_roles"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			u := newUserTest(t, nil)
+			if _, err := u.db.Exec("DROP TABLE " + tc.table); err != nil {
+				t.Fatalf("drop %s: %v", tc.table, err)
+			}
+
+			_, err := u.users.Register(ctx, &domain.UserRequest{Username: "alice", Email: "alice@example.com", Password: "Passw0rd"})
+			if err == nil {
+				t.Fatalf("registered without a %s", tc.name)
+			}
+			user, err := u.userRepo.GetByUsername(ctx, "alice")
+			if err != nil {
+				t.Fatalf("get user: %v", err)
+			}
+			if user != nil {
+				t.Errorf("user was stored although registration failed")
+			}
+		})
+	}
+}
+
+func TestFailedLoginAuditsOnlyTheCode(t *testing.T) {
+	ctx := context.Background()
+	u := newUserTest(t, nil)
+	user := createTestUser(t, u.db, "alice")
+
+	for _, tc := range []struct {
+		name     string
+		username string
+		target   string
+	}{
+		{"unknown username", "Passw0rd!", ""},
+		{"wrong password", user.Username, strconv.FormatInt(user.ID, 10)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := u.users.Login(ctx, &domain.LoginRequest{Username: tc.username, Password: "wrong"}); err != domain.ErrInvalidCredentials {
+				t.Fatalf("login: err = %v, want %v", err, domain.ErrInvalidCredentials)
+			}
+
+			list, err := u.auditor.List(ctx, &domain.AuditQuery{Action: domain.AuditUserLoginFailed})
+			if err != nil {
+				t.Fatalf("list audit events: %v", err)
+			}
+			last := list.Items[0]
+			if last.Detail != domain.ErrInvalidCredentials.Code || last.TargetID != tc.target {
+				t.Errorf("last event = %q on %q, want %q on %q", last.Detail, last.TargetID, domain.ErrInvalidCredentials.Code, tc.target)
+			}
+		})
+	}
+}
@@ -0,0 +1,620 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/rs/xid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewWebhookService, AsEventSubscriber(NewWebhookSubscriber)),
+	)
+}
+
+const (
+	// webhookSecretPrefix marks webhook signing secrets
+	webhookSecretPrefix = "whsec_"
+	// webhookBatchSize is the number of pending deliveries loaded at a time
+	webhookBatchSize = 100
+	// maxWebhookBackoff is the longest wait before retrying a delivery
+	maxWebhookBackoff = 6 * time.Hour
+	// webhookResponseLimit is the number of bytes of a response body kept in the delivery log
+	webhookResponseLimit = 1024
+)
+
+// errPrivateAddress is returned when a webhook URL resolves to an address that is not public
+var errPrivateAddress = errors.New("webhook address is not public")
+
+// WebhookServiceParams represents the parameters required for webhook service initialization
+type WebhookServiceParams struct {
+	fx.In
+
+	Lifecycle   fx.Lifecycle
+	Config      *config.Config
+	WebhookRepo domain.WebhookRepo
+	Transactor  domain.Transactor
+	Auditor     domain.Auditor
+}
+
+// webhookService implements the webhook service interface. Deliveries are created when
+// events are published and sent by the dispatcher, which runs from application start
+// until it stops.
+type webhookService struct {
+	cfg         *config.Config
+	webhookRepo domain.WebhookRepo
+	transactor  domain.Transactor
+	auditor     domain.Auditor
+	httpClient  *http.Client
+
+	// Wakes the dispatcher when deliveries have been created
+	wake chan struct{}
+}
+
+// NewWebhookService creates a new webhook service instance and runs its dispatcher with
+// the application
+func NewWebhookService(p WebhookServiceParams) domain.WebhookService {
+	cfg := p.Config.Webhooks
+	s := &webhookService{
+		cfg:         p.Config,
+		webhookRepo: p.WebhookRepo,
+		transactor:  p.Transactor,
+		auditor:     p.Auditor,
+		httpClient:  newWebhookClient(cfg),
+		wake:        make(chan struct{}, 1),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if cfg.PollInterval <= 0 {
+				logger.Info(ctx, "Delivery of webhooks is disabled")
+				close(done)
+				return nil
+			}
+			go func() {
+				defer close(done)
+				s.dispatch(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+			case <-stopCtx.Done():
+			}
+			return nil
+		},
+	})
+	return s
+}
+
+// WebhookSubscriberParams represents the parameters required for webhook subscriber initialization
+type WebhookSubscriberParams struct {
+	fx.In
+
+	WebhookService domain.WebhookService
+}
+
+// NewWebhookSubscriber creates the subscriber that turns every event into deliveries to the
+// webhooks subscribed to it. It is synchronous, so events are retried by the event bus until
+// their deliveries are stored.
+func NewWebhookSubscriber(p WebhookSubscriberParams) domain.EventSubscriber {
+	return domain.EventSubscriber{
+		Name:   "webhooks",
+		Handle: p.WebhookService.Enqueue,
+	}
+}
+
+// Create registers a webhook with a new signing secret. The secret is returned only once.
+func (s *webhookService) Create(ctx context.Context, req *domain.WebhookRequest) (*domain.WebhookResponse, error) {
+	events, err := s.validate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	webhook := &domain.Webhook{
+		URL:         req.URL,
+		Description: req.Description,
+		Events:      events,
+		Active:      true,
+		Secret:      webhookSecretPrefix + secret,
+	}
+	if err := s.webhookRepo.Create(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	s.audit(ctx, domain.AuditWebhookCreate, webhook.ID, auditChanges(nil, webhook), "")
+	logger.Info(ctx, "Webhook created", zap.Int64("webhook_id", webhook.ID), zap.Strings("events", webhook.Events))
+	return &domain.WebhookResponse{
+		Webhook: *webhook,
+		Secret:  webhook.Secret,
+	}, nil
+}
+
+// Get retrieves a webhook
+func (s *webhookService) Get(ctx context.Context, id int64) (*domain.Webhook, error) {
+	webhook, err := s.webhookRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if webhook == nil {
+		return nil, domain.ErrWebhookNotFound
+	}
+
+	return webhook, nil
+}
+
+// List retrieves all webhooks
+func (s *webhookService) List(ctx context.Context) ([]*domain.Webhook, error) {
+	webhooks, err := s.webhookRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	if webhooks == nil {
+		webhooks = []*domain.Webhook{}
+	}
+
+	return webhooks, nil
+}
+
+// Update changes the URL, description, events and state of a webhook. Pending deliveries
+// are sent to the new URL.
+func (s *webhookService) Update(ctx context.Context, id int64, req *domain.WebhookUpdateRequest) (*domain.Webhook, error) {
+	webhook, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.validate(&req.WebhookRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *webhook
+	webhook.URL = req.URL
+	webhook.Description = req.Description
+	webhook.Events = events
+	webhook.Active = req.Active
+	if err := s.webhookRepo.Update(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+	s.audit(ctx, domain.AuditWebhookUpdate, webhook.ID, auditChanges(&before, webhook), "")
+
+	// Deliveries waiting for the webhook to be reactivated are due
+	if webhook.Active && !before.Active {
+		s.wakeDispatcher()
+	}
+	return webhook, nil
+}
+
+// Delete removes a webhook with its deliveries
+func (s *webhookService) Delete(ctx context.Context, id int64) error {
+	webhook, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.webhookRepo.Delete(ctx, webhook.ID); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	s.audit(ctx, domain.AuditWebhookDelete, webhook.ID, nil, "")
+	logger.Info(ctx, "Webhook deleted", zap.Int64("webhook_id", webhook.ID))
+	return nil
+}
+
+// ListDeliveries retrieves a page of the deliveries of a webhook, newest first
+func (s *webhookService) ListDeliveries(ctx context.Context, webhookID int64, query *domain.WebhookDeliveryQuery) (*domain.WebhookDeliveryList, error) {
+	if _, err := s.Get(ctx, webhookID); err != nil {
+		return nil, err
+	}
+
+	limit := query.Limit
+	if limit < 1 {
+		limit = domain.DefaultPageSize
+	}
+	if limit > domain.MaxPageSize {
+		limit = domain.MaxPageSize
+	}
+
+	var beforeID int64
+	if query.Cursor != "" {
+		id, err := strconv.ParseInt(query.Cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, domain.ErrInvalidCursor
+		}
+		beforeID = id
+	}
+
+	// One extra delivery tells whether there is a following page
+	deliveries, err := s.webhookRepo.ListDeliveries(ctx, webhookID, query, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	list := &domain.WebhookDeliveryList{
+		Items:      deliveries,
+		Pagination: domain.Pagination{Limit: limit},
+	}
+	if len(deliveries) > limit {
+		list.Items = deliveries[:limit]
+		list.Pagination.HasMore = true
+		list.Pagination.NextCursor = strconv.FormatInt(list.Items[limit-1].ID, 10)
+	}
+	if list.Items == nil {
+		list.Items = []*domain.WebhookDelivery{}
+	}
+
+	return list, nil
+}
+
+// GetDelivery retrieves a delivery of a webhook with the log of its attempts
+func (s *webhookService) GetDelivery(ctx context.Context, webhookID, id int64) (*domain.WebhookDelivery, error) {
+	delivery, err := s.webhookRepo.GetDelivery(ctx, webhookID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	if delivery == nil {
+		return nil, domain.ErrWebhookDeliveryNotFound
+	}
+
+	delivery.AttemptLog, err = s.webhookRepo.ListAttempts(ctx, delivery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook attempts: %w", err)
+	}
+	return delivery, nil
+}
+
+// Redeliver sends the event of a delivery again as a new delivery with the same event ID,
+// whatever the state of the original
+func (s *webhookService) Redeliver(ctx context.Context, webhookID, id int64) (*domain.WebhookDelivery, error) {
+	original, err := s.webhookRepo.GetDelivery(ctx, webhookID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	if original == nil {
+		return nil, domain.ErrWebhookDeliveryNotFound
+	}
+
+	now := time.Now()
+	delivery := &domain.WebhookDelivery{
+		WebhookID:     original.WebhookID,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        domain.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		Redelivery:    true,
+		CreatedAt:     now,
+	}
+	if _, err := s.webhookRepo.CreateDelivery(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+
+	s.audit(ctx, domain.AuditWebhookRedeliver, webhookID, nil, "delivery "+strconv.FormatInt(original.ID, 10))
+	logger.Info(ctx, "Webhook delivery scheduled again", zap.Int64("webhook_id", webhookID),
+		zap.Int64("delivery_id", original.ID), zap.Int64("redelivery_id", delivery.ID))
+	s.wakeDispatcher()
+	return delivery, nil
+}
+
+// Enqueue creates a delivery of an event for each active webhook subscribed to it. The
+// deliveries share the ID of the event occurrence, which the relay derives from the
+// outbox entry, so a retried event creates no second delivery and receivers can
+// recognize repeated requests.
+func (s *webhookService) Enqueue(ctx context.Context, event domain.Event) error {
+	webhooks, err := s.webhookRepo.ListActive(ctx, event.EventName())
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.EventName(), err)
+	}
+	occurrence, ok := domain.EventOccurrenceFromContext(ctx)
+	if !ok {
+		occurrence = domain.EventOccurrence{ID: xid.New().String(), OccurredAt: time.Now()}
+	}
+	payload, err := json.Marshal(domain.WebhookPayload{
+		ID:        occurrence.ID,
+		Event:     event.EventName(),
+		CreatedAt: occurrence.OccurredAt,
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	now := time.Now()
+	return s.transactor.InTx(ctx, func(ctx context.Context) error {
+		for _, webhook := range webhooks {
+			delivery := &domain.WebhookDelivery{
+				WebhookID:     webhook.ID,
+				EventID:       occurrence.ID,
+				Event:         event.EventName(),
+				Payload:       payload,
+				Status:        domain.WebhookDeliveryPending,
+				NextAttemptAt: &now,
+				CreatedAt:     now,
+			}
+			created, err := s.webhookRepo.CreateDelivery(ctx, delivery)
+			if err != nil {
+				return fmt.Errorf("failed to create webhook delivery: %w", err)
+			}
+			if !created {
+				logger.Info(ctx, "Webhook already has a delivery of the event", zap.Int64("webhook_id", webhook.ID),
+					zap.String("event_id", occurrence.ID))
+			}
+		}
+		s.transactor.AfterCommit(ctx, s.wakeDispatcher)
+		return nil
+	})
+}
+
+// dispatch sends pending deliveries whenever deliveries are created, and at every interval
+// for retries and deliveries created by other processes
+func (s *webhookService) dispatch(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Webhooks.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sendDue(ctx)
+		select {
+		case <-ticker.C:
+			s.removeCompleted(ctx)
+		case <-s.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendDue sends the deliveries whose next attempt is due, several at a time
+func (s *webhookService) sendDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := s.webhookRepo.ListDue(ctx, time.Now(), webhookBatchSize)
+		if err != nil {
+			logger.Error(ctx, "Failed to list webhook deliveries", zap.Error(err))
+			return
+		}
+
+		webhooks := make(map[int64]*domain.Webhook)
+		slots := make(chan struct{}, max(s.cfg.Webhooks.Concurrency, 1))
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			webhook, ok := webhooks[delivery.WebhookID]
+			if !ok {
+				if webhook, err = s.webhookRepo.GetByID(ctx, delivery.WebhookID); err != nil {
+					logger.Error(ctx, "Failed to get webhook", zap.Int64("webhook_id", delivery.WebhookID), zap.Error(err))
+					continue
+				}
+				webhooks[delivery.WebhookID] = webhook
+			}
+			if webhook == nil {
+				continue
+			}
+
+			slots <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				s.send(webhook, delivery)
+			}()
+		}
+		wg.Wait()
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// send makes an attempt of a delivery and records its outcome. Failed deliveries are retried
+// with exponential backoff and marked dead after the last attempt.
+func (s *webhookService) send(webhook *domain.Webhook, delivery *domain.WebhookDelivery) {
+	cfg := s.cfg.Webhooks
+	ctx := context.WithValue(context.Background(), domain.TraceKey, &domain.TraceInfo{
+		RequestID: xid.New().String(),
+		StartTime: time.Now(),
+		Method:    "WEBHOOK",
+		Path:      delivery.Event,
+	})
+
+	attempt := &domain.WebhookAttempt{
+		DeliveryID: delivery.ID,
+		CreatedAt:  time.Now(),
+	}
+	status, body, err := s.post(ctx, webhook, delivery)
+	attempt.Duration = time.Since(attempt.CreatedAt).Milliseconds()
+	attempt.ResponseCode = status
+	attempt.ResponseBody = body
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseCode = status
+	switch {
+	case err == nil:
+		delivery.Status = domain.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+		delivery.CompletedAt = &now
+	case delivery.Attempts >= cfg.MaxAttempts:
+		delivery.Status = domain.WebhookDeliveryDead
+		delivery.NextAttemptAt = nil
+		delivery.CompletedAt = &now
+		logger.Error(ctx, "Giving up webhook delivery", zap.Int64("webhook_id", webhook.ID),
+			zap.Int64("delivery_id", delivery.ID), zap.Int("attempts", delivery.Attempts), zap.Error(err))
+	default:
+		next := now.Add(min(cfg.RetryDelay<<min(delivery.Attempts-1, 16), maxWebhookBackoff))
+		delivery.NextAttemptAt = &next
+		logger.Info(ctx, "Webhook delivery failed, retrying", zap.Int64("webhook_id", webhook.ID),
+			zap.Int64("delivery_id", delivery.ID), zap.Time("next_attempt_at", next), zap.Error(err))
+	}
+
+	if err := s.webhookRepo.RecordAttempt(ctx, delivery, attempt); err != nil {
+		logger.Error(ctx, "Failed to record webhook attempt", zap.Int64("delivery_id", delivery.ID), zap.Error(err))
+	}
+}
+
+// post sends the payload of a delivery signed with the secret of the webhook, and returns
+// the status and beginning of the response. Any status other than 2xx is an error.
+func (s *webhookService) post(ctx context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery) (int, string, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", s.cfg.App.Name+"-webhooks/"+s.cfg.App.Version)
+	req.Header.Set(domain.WebhookHeaderID, delivery.EventID)
+	req.Header.Set(domain.WebhookHeaderEvent, delivery.Event)
+	req.Header.Set(domain.WebhookHeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(domain.WebhookHeaderTimestamp, timestamp)
+	req.Header.Set(domain.WebhookHeaderSignature, signWebhook(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(body), fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// removeCompleted removes completed deliveries once their retention period has passed
+func (s *webhookService) removeCompleted(ctx context.Context) {
+	if s.cfg.Webhooks.Retention <= 0 {
+		return
+	}
+	if _, err := s.webhookRepo.DeleteCompleted(ctx, time.Now().Add(-s.cfg.Webhooks.Retention)); err != nil {
+		logger.Error(ctx, "Failed to remove completed webhook deliveries", zap.Error(err))
+	}
+}
+
+// wakeDispatcher lets the dispatcher send new deliveries without waiting for the interval
+func (s *webhookService) wakeDispatcher() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// validate checks the URL of a webhook request and returns its deduplicated events
+func (s *webhookService) validate(req *domain.WebhookRequest) ([]string, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return nil, domain.ErrInvalidWebhookURL
+	}
+	if !s.cfg.Webhooks.AllowPrivateNetworks {
+		if ip := net.ParseIP(u.Hostname()); u.Hostname() == "localhost" || ip != nil && !isPublicIP(ip) {
+			return nil, domain.ErrInvalidWebhookURL
+		}
+	}
+
+	events := normalizeScopes(req.Events)
+	for _, event := range events {
+		if !slices.Contains(domain.EventNames, event) {
+			return nil, domain.NewUnknownEventError(event)
+		}
+	}
+	return events, nil
+}
+
+// audit records an action on a webhook in the audit log
+func (s *webhookService) audit(ctx context.Context, action string, webhookID int64, changes json.RawMessage, detail string) {
+	s.auditor.Record(ctx, &domain.AuditEvent{
+		Action:     action,
+		TargetType: domain.AuditTargetWebhook,
+		TargetID:   strconv.FormatInt(webhookID, 10),
+		Changes:    changes,
+		Detail:     detail,
+	})
+}
+
+// Helper function: Create the HTTP client of webhook deliveries. Redirects are not followed,
+// and unless allowed, connections to addresses that are not public are refused after the
+// host name is resolved.
+func newWebhookClient(cfg *config.WebhooksConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Helper function: Sign a webhook payload, the signature covers the timestamp so a captured
+// request cannot be replayed later
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Helper function: Check whether an IP address is routable on the internet
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
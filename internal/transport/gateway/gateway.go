@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	userv1 "github.com/luxixing/fx-gin/api/user/v1"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/transport/http/middleware"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Prefix is the path under which the gateway is mounted on the router
+const Prefix = "/gateway"
+
+func init() {
+	registry.Register(
+		fx.Provide(NewGateway),
+	)
+}
+
+// forwardedHeaders are passed on to the gRPC server as metadata, authorization is always
+// forwarded by the gateway
+var forwardedHeaders = []string{
+	middleware.RequestIdHeader,
+	middleware.RealIPHeader,
+	middleware.AcceptLanguageHeader,
+	"X-API-Key",
+}
+
+// codeStatus maps gRPC status codes to the HTTP status codes of the error kinds they stand for
+var codeStatus = map[codes.Code]int{
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusRequestEntityTooLarge,
+	codes.Aborted:            http.StatusPreconditionFailed,
+	codes.FailedPrecondition: http.StatusPreconditionRequired,
+	codes.Internal:           http.StatusInternalServerError,
+}
+
+// GatewayParams represents the parameters required for gateway initialization
+type GatewayParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Config    *config.Config
+}
+
+// Gateway exposes the gRPC services as JSON REST endpoints following the HTTP bindings of
+// their proto definitions. Requests are sent to the gRPC server as calls, so they are
+// authenticated, checked and logged by its interceptors like any other call.
+type Gateway struct {
+	handler http.Handler
+}
+
+// NewGateway creates the gateway with a client of the gRPC server. The client connects on
+// the first request and is closed when the application stops.
+func NewGateway(p GatewayParams) (*Gateway, error) {
+	conn, err := grpc.NewClient(dialAddr(p.Config), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeader),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeader),
+		// Field names and zero values like the HTTP API
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+		runtime.WithErrorHandler(handleError),
+	)
+	if err := userv1.RegisterUserServiceHandlerClient(context.Background(), mux, userv1.NewUserServiceClient(conn)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to register user service gateway: %w", err)
+	}
+
+	p.Lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return conn.Close()
+		},
+	})
+	return &Gateway{handler: http.StripPrefix(Prefix, mux)}, nil
+}
+
+// Handle serves a gateway request. The call continues the trace of the request, with its
+// request ID and client IP.
+func (g *Gateway) Handle(c *gin.Context) {
+	if trace := utils.FromContext(c); trace != nil {
+		c.Request.Header.Set(middleware.RequestIdHeader, trace.RequestID)
+		c.Request.Header.Set(middleware.RealIPHeader, trace.ClientIP)
+	}
+	g.handler.ServeHTTP(c.Writer, c.Request)
+}
+
+// handleError writes a problem response for a failed call, from the code, message and
+// details of its status
+func handleError(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	httpStatus, ok := codeStatus[st.Code()]
+	if !ok {
+		httpStatus = runtime.HTTPStatusFromCode(st.Code())
+	}
+
+	problem := &domain.Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(httpStatus),
+		Status:    httpStatus,
+		Detail:    st.Message(),
+		Instance:  Prefix + r.URL.Path,
+		RequestID: w.Header().Get(middleware.RequestIdHeader),
+	}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			problem.Code = detail.GetReason()
+		case *errdetails.BadRequest:
+			for _, violation := range detail.GetFieldViolations() {
+				problem.Errors = append(problem.Errors, domain.FieldError{
+					Field:   violation.GetField(),
+					Rule:    violation.GetReason(),
+					Message: violation.GetDescription(),
+				})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", domain.ProblemContentType)
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// Helper function: Map request headers to the metadata read by the gRPC interceptors
+func incomingHeader(key string) (string, bool) {
+	for _, header := range forwardedHeaders {
+		if strings.EqualFold(key, header) {
+			return strings.ToLower(header), true
+		}
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// Helper function: Drop the response metadata already set as headers by the router or
+// the gateway
+func outgoingHeader(key string) (string, bool) {
+	switch key {
+	case "content-type", "x-request-id", "content-language":
+		return "", false
+	default:
+		return runtime.MetadataHeaderPrefix + key, true
+	}
+}
+
+// Helper function: Address of the gRPC server as reached from this process
+func dialAddr(cfg *config.Config) string {
+	host, port := cfg.App.Host, cfg.GRPC.Port
+	if cfg.GRPC.SharedPort {
+		port = cfg.App.Port
+	}
+	switch host {
+	case "", "0.0.0.0", "::":
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	userv1 "github.com/luxixing/fx-gin/api/user/v1"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/transport/http/middleware"
+	"go.uber.org/fx/fxtest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// recordingUserServer answers GetUser with the requested ID and keeps the metadata of the call.
+// User 0 is not found, with the status the error interceptor writes.
+type recordingUserServer struct {
+	userv1.UnimplementedUserServiceServer
+	md metadata.MD
+}
+
+func (s *recordingUserServer) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.User, error) {
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	if req.GetId() == 0 {
+		st, _ := status.New(codes.NotFound, domain.ErrUserNotFound.Message).WithDetails(&errdetails.ErrorInfo{Reason: domain.ErrUserNotFound.Code})
+		return nil, st.Err()
+	}
+	return &userv1.User{Id: req.GetId(), Username: "alice"}, nil
+}
+
+// newTestGateway routes the gateway like the router does, in front of a gRPC server
+// on a local port
+func newTestGateway(t *testing.T) (*gin.Engine, *recordingUserServer) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &recordingUserServer{}
+	srv := grpc.NewServer()
+	userv1.RegisterUserServiceServer(srv, server)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	lc := fxtest.NewLifecycle(t)
+	g, err := NewGateway(GatewayParams{
+		Lifecycle: lc,
+		Config: &config.Config{
+			App:  &config.AppConfig{Host: "127.0.0.1"},
+			GRPC: &config.GRPCConfig{Enabled: true, Port: lis.Addr().(*net.TCPAddr).Port, Gateway: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	lc.RequireStart()
+	t.Cleanup(lc.RequireStop)
+
+	r := gin.New()
+	r.SetTrustedProxies(nil)
+	r.Use(middleware.RequestContext())
+	r.Any(Prefix+"/*path", g.Handle)
+	return r, server
+}
+
+func TestGatewayForwardsHeaders(t *testing.T) {
+	r, server := newTestGateway(t)
+
+	req := httptest.NewRequest(http.MethodGet, Prefix+"/v1/users/7", nil)
+	req.Header.Set(middleware.AuthorizationHeader, "Bearer token")
+	req.Header.Set(middleware.APIKeyHeader, "fxg_key")
+	req.Header.Set(middleware.RequestIdHeader, "request-42")
+	req.Header.Set(middleware.AcceptLanguageHeader, "zh-CN")
+	// Set by the gateway from the trace, a client cannot choose its IP
+	req.Header.Set(middleware.RealIPHeader, "10.0.0.1")
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var user struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil || user.ID != "7" || user.Username != "alice" {
+		t.Errorf("body = %s, want user 7", w.Body.String())
+	}
+
+	for key, want := range map[string]string{
+		"authorization":   "Bearer token",
+		"x-api-key":       "fxg_key",
+		"x-request-id":    "request-42",
+		"accept-language": "zh-CN",
+		"x-real-ip":       "192.0.2.1",
+	} {
+		if got := server.md.Get(key); len(got) != 1 || got[0] != want {
+			t.Errorf("metadata %s = %v, want [%s]", key, got, want)
+		}
+	}
+	if got := w.Header().Values(middleware.RequestIdHeader); len(got) != 1 || got[0] != "request-42" {
+		t.Errorf("%s = %v, want only the ID of the request", middleware.RequestIdHeader, got)
+	}
+}
+
+func TestGatewayWritesProblems(t *testing.T) {
+	r, _ := newTestGateway(t)
+
+	req := httptest.NewRequest(http.MethodGet, Prefix+"/v1/users/0", nil)
+	req.Header.Set(middleware.RequestIdHeader, "request-42")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNotFound, w.Body.String())
+	}
+	var problem domain.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode problem %s: %v", w.Body.String(), err)
+	}
+	if problem.Status != http.StatusNotFound || problem.Code != domain.ErrUserNotFound.Code || problem.Instance != Prefix+"/v1/users/0" || problem.RequestID != "request-42" {
+		t.Errorf("problem = %+v", problem)
+	}
+}
@@ -0,0 +1,70 @@
+package graphql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// errDepthLimitExceeded is the error code of queries nested deeper than allowed, in the
+// style of the complexity limit of gqlgen
+const errDepthLimitExceeded = "DEPTH_LIMIT_EXCEEDED"
+
+// depthLimit rejects operations whose selections are nested deeper than the limit, before
+// they are executed. Introspection fields are not counted, so clients can always read the
+// schema.
+type depthLimit struct {
+	limit int
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = depthLimit{}
+
+// ExtensionName returns the name of the extension
+func (d depthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+// Validate accepts every schema
+func (d depthLimit) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationContext checks the depth of the operation
+func (d depthLimit) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	if depth := selectionDepth(opCtx.Operation.SelectionSet); depth > d.limit {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, d.limit)
+		err.Extensions = map[string]any{"code": errDepthLimitExceeded}
+		return err
+	}
+	return nil
+}
+
+// Helper function: Depth of the deepest field of a selection set, fragments count as their
+// fields
+func selectionDepth(set ast.SelectionSet) int {
+	depth := 0
+	for _, selection := range set {
+		var d int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name, "__") {
+				continue
+			}
+			d = 1 + selectionDepth(selection.SelectionSet)
+		case *ast.InlineFragment:
+			d = selectionDepth(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			if selection.Definition != nil {
+				d = selectionDepth(selection.Definition.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+	}
+	return depth
+}
@@ -0,0 +1,170 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/transport/graphql/generated"
+	"github.com/luxixing/fx-gin/internal/transport/graphql/model"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"github.com/luxixing/fx-gin/pkg/validation"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Path is the route of the GraphQL endpoint
+const Path = "/graphql"
+
+func init() {
+	registry.Register(
+		fx.Provide(NewHandler),
+	)
+}
+
+// HandlerParams represents the parameters required for GraphQL handler initialization
+type HandlerParams struct {
+	fx.In
+
+	Config         *config.Config
+	UserService    domain.UserService
+	ProfileService domain.ProfileService
+}
+
+// Handler serves GraphQL queries over users, profiles and roles
+type Handler struct {
+	server         *handler.Server
+	playground     http.Handler
+	userService    domain.UserService
+	profileService domain.ProfileService
+}
+
+// NewHandler creates the GraphQL handler. Queries are limited in depth and complexity; a
+// list of users costs its page size times the cost of its selection.
+func NewHandler(p HandlerParams) *Handler {
+	cfg := p.Config.GraphQL
+
+	schemaConfig := generated.Config{Resolvers: &Resolver{userService: p.UserService}}
+	schemaConfig.Complexity.Query.Users = func(childComplexity int, filter *model.UserFilter, sort *string, first *int, after *string, page *int, withTotal *bool) int {
+		limit := deref(first)
+		if limit <= 0 {
+			limit = domain.DefaultPageSize
+		}
+		return 1 + min(limit, domain.MaxPageSize)*childComplexity
+	}
+
+	server := handler.New(generated.NewExecutableSchema(schemaConfig))
+	server.AddTransport(transport.POST{})
+	if cfg.Introspection {
+		server.Use(extension.Introspection{})
+	}
+	server.Use(depthLimit{limit: cfg.MaxDepth})
+	server.Use(extension.FixedComplexityLimit(cfg.MaxComplexity))
+	server.SetErrorPresenter(presentError)
+	server.SetRecoverFunc(recoverError)
+
+	return &Handler{
+		server:         server,
+		playground:     playground.Handler("GraphQL", Path),
+		userService:    p.UserService,
+		profileService: p.ProfileService,
+	}
+}
+
+// Query handles GraphQL queries. Each request gets its own loaders, so batches and cached
+// values are never shared between principals.
+func (h *Handler) Query(c *gin.Context) {
+	ctx := WithLoaders(utils.WithContext(c), NewLoaders(h.userService, h.profileService))
+	h.server.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+}
+
+// Playground serves the GraphiQL playground
+func (h *Handler) Playground(c *gin.Context) {
+	h.playground.ServeHTTP(c.Writer, c.Request)
+}
+
+// presentError reports an error of a field. Errors of the query itself pass through; domain
+// errors get their localized message with the error code, request ID and invalid fields as
+// extensions, any other error is logged and reported as an internal error without details.
+func presentError(ctx context.Context, err error) *gqlerror.Error {
+	// Resolver errors arrive wrapped with the path of their field
+	var gqlErr *gqlerror.Error
+	if !errors.As(err, &gqlErr) {
+		gqlErr = gqlerror.WrapPath(graphql.GetPath(ctx), err)
+	}
+	if gqlErr.Err == nil {
+		return gqlErr
+	}
+
+	appErr := domain.AsError(gqlErr.Err)
+	if appErr.Kind == domain.KindInternal {
+		logger.Error(ctx, "Internal server error", zap.Error(gqlErr.Err))
+	}
+	presented := newError(ctx, appErr)
+	presented.Path = gqlErr.Path
+	return presented
+}
+
+// recoverError logs a recovered panic and returns the internal error reported for it
+func recoverError(ctx context.Context, recovered any) error {
+	err := fmt.Errorf("panic: %v", recovered)
+	logger.Error(ctx, "Recovered from panic", zap.Error(err), zap.Stack("stack"))
+	return newError(ctx, domain.NewInternalError(err))
+}
+
+// newError builds the GraphQL error of a domain error at the current field. It has no cause,
+// so it is not presented again.
+func newError(ctx context.Context, appErr *domain.Error) *gqlerror.Error {
+	localizer := i18n.FromContext(ctx)
+	message := appErr.Message
+	if detail, ok := localizer.Lookup("error." + appErr.Code); ok {
+		message = detail
+	}
+
+	extensions := map[string]any{"code": appErr.Code}
+	if trace := utils.FromContext(ctx); trace != nil {
+		extensions["request_id"] = trace.RequestID
+	}
+	if fields := fieldErrors(ctx, appErr.Err); len(fields) > 0 {
+		extensions["errors"] = fields
+	}
+	return &gqlerror.Error{
+		Message:    message,
+		Path:       graphql.GetPath(ctx),
+		Extensions: extensions,
+	}
+}
+
+// fieldErrors extracts field-level details from validation errors, with messages in the
+// locale of the request
+func fieldErrors(ctx context.Context, err error) []domain.FieldError {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil
+	}
+
+	trans := validation.Translator(i18n.FromContext(ctx).Locale())
+	fields := make([]domain.FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		fields = append(fields, domain.FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fe.Translate(trans),
+		})
+	}
+	return fields
+}
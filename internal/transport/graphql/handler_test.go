@@ -0,0 +1,243 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/transport/http/middleware"
+	"github.com/luxixing/fx-gin/pkg/validation"
+)
+
+var setupValidation sync.Once
+
+// batchCalls records the IDs each batch lookup was called with
+type batchCalls struct {
+	mu    sync.Mutex
+	calls map[string][][]int64
+}
+
+func (b *batchCalls) record(name string, ids []int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.calls == nil {
+		b.calls = map[string][][]int64{}
+	}
+	b.calls[name] = append(b.calls[name], slices.Sorted(slices.Values(ids)))
+}
+
+func (b *batchCalls) get(name string) [][]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls[name]
+}
+
+// stubUserService lists the users 1 to 5, each with the role user
+type stubUserService struct {
+	domain.UserService
+	calls *batchCalls
+}
+
+func (s stubUserService) ListUsers(ctx context.Context, query *domain.UserQuery) (*domain.UserList, error) {
+	s.calls.record("ListUsers", nil)
+	list := &domain.UserList{}
+	for id := range int64(5) {
+		list.Items = append(list.Items, &domain.User{ID: id + 1, Username: "user"})
+	}
+	return list, nil
+}
+
+func (s stubUserService) GetUsersByIDs(ctx context.Context, ids []int64) ([]*domain.User, error) {
+	s.calls.record("GetUsersByIDs", ids)
+	users := make([]*domain.User, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, &domain.User{ID: id, Username: "user"})
+	}
+	return users, nil
+}
+
+func (s stubUserService) GetRolesByUserIDs(ctx context.Context, ids []int64) (map[int64][]*domain.Role, error) {
+	s.calls.record("GetRolesByUserIDs", ids)
+	roles := make(map[int64][]*domain.Role, len(ids))
+	for _, id := range ids {
+		roles[id] = []*domain.Role{{ID: 2, Name: "user"}}
+	}
+	return roles, nil
+}
+
+// stubProfileService returns an empty profile of every user
+type stubProfileService struct {
+	domain.ProfileService
+	calls *batchCalls
+}
+
+func (s stubProfileService) GetProfiles(ctx context.Context, ids []int64) (map[int64]*domain.Profile, error) {
+	s.calls.record("GetProfiles", ids)
+	profiles := make(map[int64]*domain.Profile, len(ids))
+	for _, id := range ids {
+		profiles[id] = &domain.Profile{UserID: id}
+	}
+	return profiles, nil
+}
+
+// graphqlResponse is the body of a GraphQL response
+type graphqlResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// newTestRouter serves the GraphQL endpoint to an admin with the given limits
+func newTestRouter(t *testing.T, maxDepth, maxComplexity int) (*gin.Engine, *batchCalls) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	setupValidation.Do(func() {
+		if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+			if err := validation.Setup(v); err != nil {
+				t.Fatalf("set up validation: %v", err)
+			}
+		}
+	})
+
+	calls := &batchCalls{}
+	h := NewHandler(HandlerParams{
+		Config:         &config.Config{GraphQL: &config.GraphQLConfig{MaxDepth: maxDepth, MaxComplexity: maxComplexity, Introspection: true}},
+		UserService:    stubUserService{calls: calls},
+		ProfileService: stubProfileService{calls: calls},
+	})
+
+	r := gin.New()
+	r.Use(middleware.RequestContext(), func(c *gin.Context) {
+		c.Set(domain.PrincipalKey, &domain.Principal{UserID: 1, Roles: []string{"admin"}, Permissions: []string{domain.PermissionAll}, Method: domain.AuthMethodBearer})
+	})
+	r.POST(Path, h.Query)
+	return r, calls
+}
+
+// query posts a query and decodes the response
+func query(t *testing.T, r *gin.Engine, q string) *graphqlResponse {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"query": q})
+	req := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp graphqlResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %s: %v", w.Body.String(), err)
+	}
+	return &resp
+}
+
+// errorCode returns the code of the first error, empty without errors
+func (r *graphqlResponse) errorCode() string {
+	if len(r.Errors) == 0 {
+		return ""
+	}
+	code, _ := r.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+func TestDepthLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		query string
+		code  string
+	}{
+		{"at the limit", `{ users { items { profile { nickname } } } }`, ""},
+		{"too deep", `{ users { items { profile { avatarThumbnails { size } } } } }`, errDepthLimitExceeded},
+		{"fragment counts as its fields", `{ users { items { ...deep } } } fragment deep on User { profile { avatarThumbnails { size } } }`, errDepthLimitExceeded},
+		{"inline fragment counts as its fields", `{ users { items { ... on User { profile { avatarThumbnails { size } } } } } }`, errDepthLimitExceeded},
+		{"introspection is not counted", `{ __schema { types { fields { type { ofType { name } } } } } }`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, calls := newTestRouter(t, 4, 10000)
+
+			resp := query(t, r, tc.query)
+			if code := resp.errorCode(); code != tc.code {
+				t.Fatalf("error code = %q, want %q: %+v", code, tc.code, resp.Errors)
+			}
+			// Rejected operations are not executed
+			if listed := len(calls.get("ListUsers")) > 0; tc.code != "" && listed {
+				t.Errorf("users were listed for a rejected operation")
+			}
+		})
+	}
+}
+
+func TestUsersComplexity(t *testing.T) {
+	// The selection { items { id username } } costs 3 per user
+	for _, tc := range []struct {
+		name  string
+		first string
+		code  string
+	}{
+		{"default page size", "", ""},                                   // 1 + 10 * 3
+		{"within the limit", "(first: 50)", ""},                         // 1 + 50 * 3
+		{"over the limit", "(first: 100)", "COMPLEXITY_LIMIT_EXCEEDED"}, // 1 + 100 * 3
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := newTestRouter(t, 10, 200)
+
+			resp := query(t, r, `{ users`+tc.first+` { items { id username } } }`)
+			if code := resp.errorCode(); code != tc.code {
+				t.Errorf("error code = %q, want %q: %+v", code, tc.code, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestLoadersBatchLookups(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		query string
+		want  map[string][][]int64
+	}{
+		{
+			name:  "nested fields of a list",
+			query: `{ users { items { id profile { nickname } roles { name } } } }`,
+			want: map[string][][]int64{
+				"GetProfiles":       {{1, 2, 3, 4, 5}},
+				"GetRolesByUserIDs": {{1, 2, 3, 4, 5}},
+			},
+		},
+		{
+			name:  "aliased users",
+			query: `{ a: user(id: 1) { id } b: user(id: 2) { id } c: user(id: 3) { id } again: user(id: 1) { roles { name } } }`,
+			want: map[string][][]int64{
+				"GetUsersByIDs":     {{1, 2, 3}},
+				"GetRolesByUserIDs": {{1}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, calls := newTestRouter(t, 10, 10000)
+
+			resp := query(t, r, tc.query)
+			if len(resp.Errors) > 0 {
+				t.Fatalf("errors = %+v", resp.Errors)
+			}
+			for name, want := range tc.want {
+				got := calls.get(name)
+				if !slices.EqualFunc(got, want, slices.Equal[[]int64]) {
+					t.Errorf("%s called with %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
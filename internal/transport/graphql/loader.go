@@ -0,0 +1,74 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/vikstrous/dataloadgen"
+)
+
+// loaderWait is how long loaders collect keys before fetching them in one batch
+const loaderWait = time.Millisecond
+
+// loadersKey is the context key of the loaders of a request
+type loadersKey struct{}
+
+// Loaders batch the lookups of one request: the users, profiles and roles asked for by its
+// fields are fetched with one query each instead of one per user. Loaded values are cached
+// for the rest of the request.
+type Loaders struct {
+	users    *dataloadgen.Loader[int64, *domain.User]
+	profiles *dataloadgen.Loader[int64, *domain.Profile]
+	roles    *dataloadgen.Loader[int64, []*domain.Role]
+}
+
+// NewLoaders creates the loaders of a request
+func NewLoaders(userService domain.UserService, profileService domain.ProfileService) *Loaders {
+	return &Loaders{
+		users: dataloadgen.NewMappedLoader(func(ctx context.Context, ids []int64) (map[int64]*domain.User, error) {
+			users, err := userService.GetUsersByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int64]*domain.User, len(users))
+			for _, user := range users {
+				byID[user.ID] = user
+			}
+			return byID, nil
+		}, dataloadgen.WithWait(loaderWait)),
+		profiles: dataloadgen.NewMappedLoader(profileService.GetProfiles, dataloadgen.WithWait(loaderWait)),
+		roles: dataloadgen.NewMappedLoader(func(ctx context.Context, userIDs []int64) (map[int64][]*domain.Role, error) {
+			roles, err := userService.GetRolesByUserIDs(ctx, userIDs)
+			if err != nil {
+				return nil, err
+			}
+			// Users without roles are found too
+			for _, userID := range userIDs {
+				if _, ok := roles[userID]; !ok {
+					roles[userID] = []*domain.Role{}
+				}
+			}
+			return roles, nil
+		}, dataloadgen.WithWait(loaderWait)),
+	}
+}
+
+// WithLoaders returns a context carrying the loaders
+func WithLoaders(ctx context.Context, loaders *Loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, loaders)
+}
+
+// loadersFrom returns the loaders of the request
+func loadersFrom(ctx context.Context) *Loaders {
+	return ctx.Value(loadersKey{}).(*Loaders)
+}
+
+// Helper function: Turn the not found error of a loader into a nil value
+func found[T any](value *T, err error) (*T, error) {
+	if errors.Is(err, dataloadgen.ErrNotFound) {
+		return nil, nil
+	}
+	return value, err
+}
@@ -0,0 +1,29 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package model
+
+import (
+	"time"
+)
+
+type Query struct {
+}
+
+type Thumbnail struct {
+	// Size in pixels
+	Size int    `json:"size"`
+	URL  string `json:"url"`
+}
+
+type UserFilter struct {
+	// 0 inactive, 1 active, 2 locked
+	Status *int `json:"status,omitempty"`
+	// Role name
+	Role          *string    `json:"role,omitempty"`
+	CreatedAfter  *time.Time `json:"createdAfter,omitempty"`
+	CreatedBefore *time.Time `json:"createdBefore,omitempty"`
+	// Prefix search on username, email and nickname
+	Query *string `json:"query,omitempty"`
+	// List soft deleted users instead
+	Deleted *bool `json:"deleted,omitempty"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+// MarshalID writes an int64 ID as a string, like the ID scalar is serialized
+func MarshalID(id int64) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		io.WriteString(w, strconv.Quote(strconv.FormatInt(id, 10)))
+	})
+}
+
+// UnmarshalID reads an int64 ID given as a string or a number, other values are invalid
+// requests
+func UnmarshalID(v any) (int64, error) {
+	var (
+		id  int64
+		err error
+	)
+	switch v := v.(type) {
+	case string:
+		id, err = strconv.ParseInt(v, 10, 64)
+	case json.Number:
+		id, err = v.Int64()
+	case int:
+		id = int64(v)
+	case int64:
+		id = v
+	default:
+		err = fmt.Errorf("%T is not an ID", v)
+	}
+	if err != nil {
+		return 0, domain.ErrInvalidRequest.Wrap(err)
+	}
+	return id, nil
+}
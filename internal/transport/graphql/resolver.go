@@ -0,0 +1,42 @@
+package graphql
+
+import (
+	"context"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/utils"
+)
+
+// Resolver resolves the schema with the domain services. Users, profiles and roles asked
+// for by nested fields are loaded in batches by the loaders of the request. Permissions are
+// checked like on the corresponding HTTP routes.
+type Resolver struct {
+	userService domain.UserService
+}
+
+// Helper function: Reject principals without the permission
+func requirePermission(ctx context.Context, permission string) error {
+	principal := utils.PrincipalFromContext(ctx)
+	if principal == nil || !principal.HasPermission(permission) {
+		return domain.ErrForbidden
+	}
+	return nil
+}
+
+// Helper function: Allow principals acting on their own user or holding the permission
+func requireSelfOrPermission(ctx context.Context, userID int64, permission string) error {
+	principal := utils.PrincipalFromContext(ctx)
+	if principal == nil || !(principal.IsUser(userID) || principal.HasPermission(permission)) {
+		return domain.ErrForbidden
+	}
+	return nil
+}
+
+// Helper function: Value of an optional argument, the zero value when it is not given
+func deref[T any](value *T) T {
+	var zero T
+	if value == nil {
+		return zero
+	}
+	return *value
+}
@@ -0,0 +1,123 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.78
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/transport/graphql/generated"
+	"github.com/luxixing/fx-gin/internal/transport/graphql/model"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"github.com/luxixing/fx-gin/pkg/validation"
+	"go.uber.org/zap"
+)
+
+// AvatarThumbnails is the resolver for the avatarThumbnails field.
+func (r *profileResolver) AvatarThumbnails(ctx context.Context, obj *domain.Profile) ([]*model.Thumbnail, error) {
+	thumbnails := make([]*model.Thumbnail, 0, len(obj.AvatarThumbnails))
+	for size, url := range obj.AvatarThumbnails {
+		pixels, err := strconv.Atoi(size)
+		if err != nil {
+			continue
+		}
+		thumbnails = append(thumbnails, &model.Thumbnail{Size: pixels, URL: url})
+	}
+	sort.Slice(thumbnails, func(i, j int) bool { return thumbnails[i].Size < thumbnails[j].Size })
+	return thumbnails, nil
+}
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*domain.User, error) {
+	principal := utils.PrincipalFromContext(ctx)
+	if principal == nil || principal.UserID == 0 {
+		return nil, nil
+	}
+	return found(loadersFrom(ctx).users.Load(ctx, principal.UserID))
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id int64) (*domain.User, error) {
+	if err := requireSelfOrPermission(ctx, id, domain.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+	return found(loadersFrom(ctx).users.Load(ctx, id))
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, filter *model.UserFilter, sort *string, first *int, after *string, page *int, withTotal *bool) (*domain.UserList, error) {
+	if err := requirePermission(ctx, domain.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+
+	query := &domain.UserQuery{
+		Sort:      deref(sort),
+		Limit:     deref(first),
+		Page:      deref(page),
+		Cursor:    deref(after),
+		WithTotal: deref(withTotal),
+	}
+	if filter != nil {
+		query.Status = filter.Status
+		query.Role = deref(filter.Role)
+		query.CreatedAfter = filter.CreatedAfter
+		query.CreatedBefore = filter.CreatedBefore
+		query.Search = deref(filter.Query)
+		query.Deleted = deref(filter.Deleted)
+	}
+	// Deleted users are only visible to those who can delete and restore them
+	if query.Deleted {
+		if err := requirePermission(ctx, domain.PermissionUsersDelete); err != nil {
+			return nil, err
+		}
+	}
+	if err := validation.Struct(query); err != nil {
+		return nil, domain.ErrInvalidRequest.Wrap(err)
+	}
+
+	list, err := r.userService.ListUsers(ctx, query)
+	if err != nil {
+		logger.Error(ctx, "Failed to get user list", zap.Error(err))
+		return nil, err
+	}
+
+	// Later lookups of the listed users in the same request need no query
+	if !query.Deleted {
+		users := loadersFrom(ctx).users
+		for _, user := range list.Items {
+			users.Prime(user.ID, user)
+		}
+	}
+	return list, nil
+}
+
+// Profile is the resolver for the profile field.
+func (r *userResolver) Profile(ctx context.Context, obj *domain.User) (*domain.Profile, error) {
+	if obj.DeletedAt != nil {
+		return nil, nil
+	}
+	return found(loadersFrom(ctx).profiles.Load(ctx, obj.ID))
+}
+
+// Roles is the resolver for the roles field.
+func (r *userResolver) Roles(ctx context.Context, obj *domain.User) ([]*domain.Role, error) {
+	return loadersFrom(ctx).roles.Load(ctx, obj.ID)
+}
+
+// Profile returns generated.ProfileResolver implementation.
+func (r *Resolver) Profile() generated.ProfileResolver { return &profileResolver{r} }
+
+// Query returns generated.QueryResolver implementation.
+func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
+
+// User returns generated.UserResolver implementation.
+func (r *Resolver) User() generated.UserResolver { return &userResolver{r} }
+
+type profileResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -0,0 +1,76 @@
+package grpc
+
+import (
+	"time"
+
+	userv1 "github.com/luxixing/fx-gin/api/user/v1"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// toUser converts a domain user to its message, the password hash is never included
+func toUser(user *domain.User) *userv1.User {
+	return &userv1.User{
+		Id:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		Status:          int32(user.Status),
+		EmailVerifiedAt: toTimestamp(user.EmailVerifiedAt),
+		Version:         user.Version,
+		CreatedAt:       timestamppb.New(user.CreatedAt),
+		UpdatedAt:       timestamppb.New(user.UpdatedAt),
+		DeletedAt:       toTimestamp(user.DeletedAt),
+	}
+}
+
+// toProfile converts a domain profile to its message
+func toProfile(profile *domain.Profile) *userv1.Profile {
+	return &userv1.Profile{
+		Id:               profile.ID,
+		UserId:           profile.UserID,
+		Nickname:         profile.Nickname,
+		Avatar:           profile.Avatar,
+		AvatarThumbnails: profile.AvatarThumbnails,
+		Bio:              profile.Bio,
+		Phone:            profile.Phone,
+		Gender:           int32(profile.Gender),
+		Birthday:         profile.Birthday,
+		Locale:           profile.Locale,
+		Version:          profile.Version,
+		CreatedAt:        timestamppb.New(profile.CreatedAt),
+		UpdatedAt:        timestamppb.New(profile.UpdatedAt),
+	}
+}
+
+// toUserWithRoles converts a domain user and its roles to their message
+func toUserWithRoles(userWithRoles *domain.UserWithRoles) *userv1.UserWithRoles {
+	roles := make([]*userv1.Role, 0, len(userWithRoles.Roles))
+	for _, role := range userWithRoles.Roles {
+		roles = append(roles, &userv1.Role{
+			Id:          role.ID,
+			Name:        role.Name,
+			Description: role.Description,
+			Version:     role.Version,
+			CreatedAt:   timestamppb.New(role.CreatedAt),
+			UpdatedAt:   timestamppb.New(role.UpdatedAt),
+		})
+	}
+	return &userv1.UserWithRoles{User: toUser(&userWithRoles.User), Roles: roles}
+}
+
+// Helper function: Convert an optional time, nil stays unset
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// Helper function: Convert an optional timestamp, unset becomes nil
+func fromTimestamp(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
@@ -0,0 +1,104 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"github.com/luxixing/fx-gin/pkg/validation"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain identifies the service in error details
+const errorDomain = "fx-gin"
+
+// kindCode maps error kinds to gRPC status codes
+var kindCode = map[domain.ErrorKind]codes.Code{
+	domain.KindNotFound:             codes.NotFound,
+	domain.KindConflict:             codes.AlreadyExists,
+	domain.KindValidation:           codes.InvalidArgument,
+	domain.KindUnauthorized:         codes.Unauthenticated,
+	domain.KindForbidden:            codes.PermissionDenied,
+	domain.KindTooLarge:             codes.ResourceExhausted,
+	domain.KindUnsupported:          codes.InvalidArgument,
+	domain.KindPrecondition:         codes.Aborted,
+	domain.KindPreconditionRequired: codes.FailedPrecondition,
+	domain.KindInternal:             codes.Internal,
+}
+
+// toStatus converts an error to a status with the details of a problem response
+func toStatus(ctx context.Context, err error) error {
+	// Errors that already are a status, e.g. from recovery or the gRPC runtime, pass through
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	appErr := domain.AsError(err)
+	code, ok := kindCode[appErr.Kind]
+	if !ok {
+		code = codes.Internal
+	}
+	if code == codes.Internal {
+		logger.Error(ctx, "Internal server error", zap.Error(err))
+	}
+	return newStatus(ctx, code, appErr).Err()
+}
+
+// newStatus builds the status of an error. The message is localized like the detail of a
+// problem; the error code and request ID are attached as ErrorInfo and invalid fields as
+// BadRequest.
+func newStatus(ctx context.Context, code codes.Code, appErr *domain.Error) *status.Status {
+	// Authentication may have switched the call to the locale preferred by the user
+	if trace := utils.FromContext(ctx); trace != nil {
+		ctx = i18n.WithLocale(ctx, trace.Locale)
+	}
+	localizer := i18n.FromContext(ctx)
+	message := appErr.Message
+	if detail, ok := localizer.Lookup("error." + appErr.Code); ok {
+		message = detail
+	}
+	st := status.New(code, message)
+
+	info := &errdetails.ErrorInfo{Reason: appErr.Code, Domain: errorDomain}
+	if trace := utils.FromContext(ctx); trace != nil {
+		info.Metadata = map[string]string{"request_id": trace.RequestID}
+	}
+	details := []protoadapt.MessageV1{info, &errdetails.LocalizedMessage{Locale: localizer.Locale(), Message: message}}
+	if violations := fieldViolations(ctx, appErr.Err); len(violations) > 0 {
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// fieldViolations extracts field-level details from validation errors, with messages in
+// the locale of the call
+func fieldViolations(ctx context.Context, err error) []*errdetails.BadRequest_FieldViolation {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil
+	}
+
+	trans := validation.Translator(i18n.FromContext(ctx).Locale())
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field(),
+			Description: fe.Translate(trans),
+			Reason:      fe.Tag(),
+		})
+	}
+	return violations
+}
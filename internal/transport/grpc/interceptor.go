@@ -0,0 +1,334 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys, the lower case forms of the HTTP headers
+const (
+	RequestIDKey      = "x-request-id"
+	RealIPKey         = "x-real-ip"
+	AcceptLanguageKey = "accept-language"
+	AuthorizationKey  = "authorization"
+	APIKeyKey         = "x-api-key"
+)
+
+// publicMethods can be called without credentials
+var publicMethods = map[string]bool{
+	"/fxgin.user.v1.UserService/Register":      true,
+	"/fxgin.user.v1.UserService/Login":         true,
+	"/fxgin.user.v1.UserService/CompleteLogin": true,
+}
+
+// publicServices can be called without credentials
+var publicServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+// UnaryRequestContext interceptor adds the trace information and locale of the call to its
+// context. The x-real-ip metadata is only read from calls of trusted proxies.
+func UnaryRequestContext(trustedProxies []netip.Prefix) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(requestContext(ctx, info.FullMethod, trustedProxies), req)
+	}
+}
+
+// StreamRequestContext interceptor adds the trace information and locale of the call to its
+// context. The x-real-ip metadata is only read from calls of trusted proxies.
+func StreamRequestContext(trustedProxies []netip.Prefix) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: requestContext(ss.Context(), info.FullMethod, trustedProxies)})
+	}
+}
+
+// UnaryLogger interceptor logs every call with its status code and latency
+func UnaryLogger() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		logCall(ctx, err)
+		return resp, err
+	}
+}
+
+// StreamLogger interceptor logs every stream with its status code and duration
+func StreamLogger() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		logCall(ss.Context(), err)
+		return err
+	}
+}
+
+// UnaryErrorHandler interceptor converts errors returned by handlers to a status. Typed domain
+// errors map to their code and message; any other error is logged and reported as an
+// internal error without details.
+func UnaryErrorHandler() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, toStatus(ctx, err)
+		}
+		return resp, nil
+	}
+}
+
+// StreamErrorHandler interceptor converts errors returned by stream handlers to a status
+func StreamErrorHandler() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := handler(srv, ss); err != nil {
+			return toStatus(ss.Context(), err)
+		}
+		return nil
+	}
+}
+
+// UnaryRecovery interceptor recovers from panics and reports them as internal errors
+func UnaryRecovery() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = recoverError(ctx, recovered)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecovery interceptor recovers from panics and reports them as internal errors
+func StreamRecovery() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = recoverError(ss.Context(), recovered)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// UnaryAuth interceptor authenticates calls with a bearer token or an API key, except for
+// public methods. Accepted metadata are "authorization: Bearer <token>",
+// "authorization: ApiKey <key>" and "x-api-key: <key>".
+func UnaryAuth(authService domain.AuthService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, authService, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuth interceptor authenticates streams like UnaryAuth
+func StreamAuth(authService domain.AuthService) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), authService, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// requestContext builds the trace information of a call from its metadata
+func requestContext(ctx context.Context, method string, trustedProxies []netip.Prefix) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	// Get request ID from metadata, if not exist, generate a new one
+	requestID := firstValue(md, RequestIDKey)
+	if requestID == "" || requestID == "undefined" {
+		requestID = xid.New().String()
+	}
+
+	// Get the client IP from the peer, or from metadata when the peer is a trusted proxy
+	var realIP string
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			realIP = host
+		}
+	}
+	if forwarded := firstValue(md, RealIPKey); forwarded != "" && isTrustedProxy(realIP, trustedProxies) {
+		realIP = forwarded
+	}
+
+	trace := &domain.TraceInfo{
+		RequestID: requestID,
+		ClientIP:  realIP,
+		StartTime: time.Now(),
+		Method:    "GRPC",
+		Path:      method,
+		Locale:    i18n.Negotiate(firstValue(md, AcceptLanguageKey)),
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, requestID))
+
+	ctx = context.WithValue(ctx, domain.TraceKey, trace)
+	return i18n.WithLocale(ctx, trace.Locale)
+}
+
+// authenticate adds the principal of the call credentials to the context. The locale
+// preferred by the user wins over the one of the call, so the content-language header
+// is sent once it is known.
+func authenticate(ctx context.Context, authService domain.AuthService, method string) (context.Context, error) {
+	trace := utils.FromContext(ctx)
+	if trace != nil {
+		defer func() {
+			grpc.SetHeader(ctx, metadata.Pairs("content-language", trace.Locale))
+		}()
+	}
+	if isPublic(method) {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	clientIP := ""
+	if trace != nil {
+		clientIP = trace.ClientIP
+	}
+
+	principal, err := authService.Authenticate(ctx, extractCredential(md), clientIP)
+	if err != nil {
+		if !errors.Is(err, domain.ErrUnauthorized) {
+			logger.Error(ctx, "Failed to authenticate call", zap.Error(err))
+		}
+		return nil, domain.ErrUnauthorized
+	}
+
+	ctx = context.WithValue(ctx, domain.PrincipalKey, principal)
+	if trace != nil {
+		trace.UserID = principal.UserID
+		if principal.Locale != "" {
+			trace.Locale = i18n.Negotiate(principal.Locale, trace.Locale)
+			ctx = i18n.WithLocale(ctx, trace.Locale)
+		}
+	}
+	return ctx, nil
+}
+
+// extractCredential reads the bearer token or API key from the call metadata
+func extractCredential(md metadata.MD) string {
+	if key := firstValue(md, APIKeyKey); key != "" {
+		return strings.TrimSpace(key)
+	}
+
+	scheme, credential, found := strings.Cut(firstValue(md, AuthorizationKey), " ")
+	if !found {
+		return ""
+	}
+	switch strings.ToLower(scheme) {
+	case "bearer", "apikey":
+		return strings.TrimSpace(credential)
+	default:
+		return ""
+	}
+}
+
+// logCall logs a finished call like the HTTP request log
+func logCall(ctx context.Context, err error) {
+	trace := utils.FromContext(ctx)
+	if trace == nil {
+		zap.S().Error("trace info not found in context")
+		return
+	}
+
+	zap.S().Infow("request info",
+		"request_id", trace.RequestID,
+		"code", status.Code(err).String(),
+		"latency_ms", time.Since(trace.StartTime).Milliseconds(),
+		domain.TraceKey, trace,
+	)
+}
+
+// recoverError logs a recovered panic and returns the internal error reported for it
+func recoverError(ctx context.Context, recovered any) error {
+	err := fmt.Errorf("panic: %v", recovered)
+	logger.Error(ctx, "Recovered from panic", zap.Error(err), zap.Stack("stack"))
+	return newStatus(ctx, codes.Internal, domain.NewInternalError(err)).Err()
+}
+
+// Helper function: Check whether a method can be called without credentials
+func isPublic(method string) bool {
+	if publicMethods[method] {
+		return true
+	}
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function: Parse trusted proxies given as IPs or CIDRs
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Helper function: Check whether a peer address belongs to a trusted proxy
+func isTrustedProxy(host string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function: Get the first value of a metadata key
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// contextStream replaces the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,44 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestRequestContextTrustsRealIPOnlyFromProxies(t *testing.T) {
+	trustedProxies, err := parseTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("parse trusted proxies: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		peer string
+		want string
+	}{
+		{"trusted proxy", "127.0.0.1", "203.0.113.7"},
+		{"trusted network", "10.1.2.3", "203.0.113.7"},
+		{"client", "198.51.100.1", "198.51.100.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(tc.peer), Port: 50000}})
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(RealIPKey, "203.0.113.7"))
+
+			trace := utils.FromContext(requestContext(ctx, "/test", trustedProxies))
+			if trace.ClientIP != tc.want {
+				t.Errorf("client IP = %s, want %s", trace.ClientIP, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+	if _, err := parseTrustedProxies([]string{"proxy.example.com"}); err == nil {
+		t.Errorf("a host name was accepted as a trusted proxy")
+	}
+}
@@ -1,3 +1,144 @@
 package grpc
 
-//implement grpc server by yourself
\ No newline at end of file
+import (
+	"context"
+	"net/netip"
+	"slices"
+
+	userv1 "github.com/luxixing/fx-gin/api/user/v1"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/transport/listener"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+func init() {
+	registry.Register(
+		fx.Module("grpc",
+			fx.Provide(NewServer, NewUserServer),
+			fx.Invoke(StartServer),
+		),
+	)
+}
+
+// ServerParams represents the parameters required for gRPC server initialization
+type ServerParams struct {
+	fx.In
+
+	Config      *config.Config
+	AuthService domain.AuthService
+	UserServer  *UserServer
+}
+
+// Server is the gRPC server with its health service
+type Server struct {
+	*grpc.Server
+	health *health.Server
+}
+
+// NewServer creates the gRPC server. Its interceptors mirror the HTTP middleware: request
+// context, logging, error mapping, panic recovery and authentication, in that order.
+func NewServer(p ServerParams) *Server {
+	trustedProxies, err := parseTrustedProxies(serverTrustedProxies(p.Config))
+	if err != nil {
+		zap.S().Errorw("Failed to parse trusted proxies, x-real-ip metadata is ignored", "error", err)
+		trustedProxies = nil
+	}
+
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			UnaryRequestContext(trustedProxies),
+			UnaryLogger(),
+			UnaryErrorHandler(),
+			UnaryRecovery(),
+			UnaryAuth(p.AuthService),
+		),
+		grpc.ChainStreamInterceptor(
+			StreamRequestContext(trustedProxies),
+			StreamLogger(),
+			StreamErrorHandler(),
+			StreamRecovery(),
+			StreamAuth(p.AuthService),
+		),
+	)
+
+	userv1.RegisterUserServiceServer(srv, p.UserServer)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthServer)
+	healthServer.SetServingStatus(userv1.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	if p.Config.GRPC.Reflection {
+		reflection.Register(srv)
+	}
+
+	return &Server{Server: srv, health: healthServer}
+}
+
+// Helper function: Get the proxies trusted to tell the client IP. These are the trusted
+// proxies of HTTP and, with the gateway, the address the gateway calls from.
+func serverTrustedProxies(cfg *config.Config) []string {
+	proxies := cfg.HTTP.TrustedProxies
+	if !cfg.GRPC.Gateway {
+		return proxies
+	}
+	// The gateway dials the application host, or localhost when it listens on all addresses
+	if _, err := netip.ParseAddr(cfg.App.Host); err == nil && cfg.App.Host != "0.0.0.0" && cfg.App.Host != "::" {
+		return append(slices.Clone(proxies), cfg.App.Host)
+	}
+	return append(slices.Clone(proxies), "127.0.0.1", "::1")
+}
+
+// StartServerParams represents the parameters required to run the gRPC server
+type StartServerParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Config    *config.Config
+	Listeners *listener.Listeners
+	Server    *Server
+}
+
+// StartServer serves gRPC from application start until it stops, on its own port or on the
+// port shared with HTTP
+func StartServer(p StartServerParams) {
+	if !p.Config.GRPC.Enabled {
+		zap.S().Info("gRPC server is disabled")
+		return
+	}
+
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			lis := p.Listeners.GRPC()
+			zap.S().Infow("Starting gRPC server", "addr", lis.Addr().String())
+			go func() {
+				if err := p.Server.Serve(lis); err != nil && !listener.IsClosed(err) {
+					zap.S().Errorw("gRPC server failed", "error", err)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			zap.S().Info("Stopping gRPC server...")
+			// Report not serving so load balancers stop sending calls, then drain them
+			p.Server.health.Shutdown()
+			stopped := make(chan struct{})
+			go func() {
+				p.Server.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				p.Server.Stop()
+			}
+			return nil
+		},
+	})
+}
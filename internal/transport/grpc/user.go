@@ -0,0 +1,317 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	userv1 "github.com/luxixing/fx-gin/api/user/v1"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/jsonpatch"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"github.com/luxixing/fx-gin/pkg/validation"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// UserServerParams embed fx.In for dependency injection
+type UserServerParams struct {
+	fx.In
+
+	Config      *config.Config
+	UserService domain.UserService
+	MFAService  domain.MFAService
+}
+
+// UserServer implements the gRPC UserService on top of domain.UserService. Permissions are
+// checked like on the corresponding HTTP routes.
+type UserServer struct {
+	userv1.UnimplementedUserServiceServer
+
+	cfg         *config.Config
+	userService domain.UserService
+	mfaService  domain.MFAService
+}
+
+// NewUserServer creates a new UserServer
+func NewUserServer(p UserServerParams) *UserServer {
+	return &UserServer{
+		cfg:         p.Config,
+		userService: p.UserService,
+		mfaService:  p.MFAService,
+	}
+}
+
+// Register creates a user
+func (s *UserServer) Register(ctx context.Context, in *userv1.RegisterRequest) (*userv1.User, error) {
+	req := &domain.UserRequest{Username: in.GetUsername(), Email: in.GetEmail(), Password: in.GetPassword()}
+	if err := validation.Struct(req); err != nil {
+		return nil, domain.ErrInvalidRequest.Wrap(err)
+	}
+
+	user, err := s.userService.Register(ctx, req)
+	if err != nil {
+		logger.Error(ctx, "Failed to register user", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "User registered successfully", zap.Int64("user_id", user.ID))
+	return toUser(user), nil
+}
+
+// Login exchanges a username and password for an access token
+func (s *UserServer) Login(ctx context.Context, in *userv1.LoginRequest) (*userv1.LoginResponse, error) {
+	req := &domain.LoginRequest{Username: in.GetUsername(), Password: in.GetPassword()}
+	if err := validation.Struct(req); err != nil {
+		return nil, domain.ErrInvalidRequest.Wrap(err)
+	}
+
+	token, err := s.userService.Login(ctx, req)
+	if err != nil {
+		logger.Error(ctx, "User login failed", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "User login successful", zap.String("username", req.Username))
+	return &userv1.LoginResponse{
+		Token:          token.Token,
+		ExpiresAt:      token.ExpiresAt,
+		MfaRequired:    token.MFARequired,
+		ChallengeToken: token.ChallengeToken,
+	}, nil
+}
+
+// CompleteLogin exchanges a login challenge and a second factor for an access token
+func (s *UserServer) CompleteLogin(ctx context.Context, in *userv1.CompleteLoginRequest) (*userv1.LoginResponse, error) {
+	req := &domain.MFALoginRequest{ChallengeToken: in.GetChallengeToken(), Code: in.GetCode()}
+	if err := validation.Struct(req); err != nil {
+		return nil, domain.ErrInvalidRequest.Wrap(err)
+	}
+
+	token, err := s.mfaService.CompleteLogin(ctx, req)
+	if err != nil {
+		logger.Error(ctx, "MFA login failed", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "MFA login successful")
+	return &userv1.LoginResponse{Token: token.Token, ExpiresAt: token.ExpiresAt}, nil
+}
+
+// GetUser returns a user
+func (s *UserServer) GetUser(ctx context.Context, in *userv1.GetUserRequest) (*userv1.User, error) {
+	if err := requireSelfOrPermission(ctx, in.GetId(), domain.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userService.GetUserByID(ctx, in.GetId())
+	if err != nil {
+		logger.Error(ctx, "Failed to get user information", zap.Error(err))
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+// ListUsers returns a filtered and sorted page of users
+func (s *UserServer) ListUsers(ctx context.Context, in *userv1.ListUsersRequest) (*userv1.ListUsersResponse, error) {
+	if err := requirePermission(ctx, domain.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+	// Deleted users are only visible to those who can delete and restore them
+	if in.GetDeleted() {
+		if err := requirePermission(ctx, domain.PermissionUsersDelete); err != nil {
+			return nil, err
+		}
+	}
+
+	query := &domain.UserQuery{
+		Role:          in.GetRole(),
+		CreatedAfter:  fromTimestamp(in.GetCreatedAfter()),
+		CreatedBefore: fromTimestamp(in.GetCreatedBefore()),
+		Search:        in.GetQuery(),
+		Sort:          in.GetSort(),
+		Limit:         int(in.GetLimit()),
+		Page:          int(in.GetPage()),
+		Cursor:        in.GetCursor(),
+		WithTotal:     in.GetWithTotal(),
+		Deleted:       in.GetDeleted(),
+	}
+	if in.Status != nil {
+		status := int(in.GetStatus())
+		query.Status = &status
+	}
+	if err := validation.Struct(query); err != nil {
+		return nil, domain.ErrInvalidRequest.Wrap(err)
+	}
+
+	list, err := s.userService.ListUsers(ctx, query)
+	if err != nil {
+		logger.Error(ctx, "Failed to get user list", zap.Error(err))
+		return nil, err
+	}
+
+	resp := &userv1.ListUsersResponse{
+		Items: make([]*userv1.User, 0, len(list.Items)),
+		Pagination: &userv1.Pagination{
+			Limit:      int32(list.Pagination.Limit),
+			Page:       int32(list.Pagination.Page),
+			NextCursor: list.Pagination.NextCursor,
+			HasMore:    list.Pagination.HasMore,
+		},
+	}
+	for _, user := range list.Items {
+		resp.Items = append(resp.Items, toUser(user))
+	}
+	if list.Pagination.Total != nil {
+		total := int32(*list.Pagination.Total)
+		resp.Pagination.Total = &total
+	}
+	return resp, nil
+}
+
+// UpdateUser applies the fields named by the update mask as a merge patch of the user document
+func (s *UserServer) UpdateUser(ctx context.Context, in *userv1.UpdateUserRequest) (*userv1.UserWithRoles, error) {
+	if err := requireSelfOrPermission(ctx, in.GetId(), domain.PermissionUsersWrite); err != nil {
+		return nil, err
+	}
+	if err := s.checkVersion(in.GetVersion()); err != nil {
+		return nil, err
+	}
+
+	patch, err := updatePatch(in.GetUser(), in.GetUpdateMask().GetPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userService.PatchUser(ctx, utils.PrincipalFromContext(ctx), in.GetId(), in.GetVersion(), patch)
+	if err != nil {
+		logger.Error(ctx, "Failed to update user", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "User updated successfully", zap.Int64("user_id", in.GetId()))
+	return toUserWithRoles(user), nil
+}
+
+// DeleteUser soft deletes a user
+func (s *UserServer) DeleteUser(ctx context.Context, in *userv1.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := requirePermission(ctx, domain.PermissionUsersDelete); err != nil {
+		return nil, err
+	}
+	if err := s.checkVersion(in.GetVersion()); err != nil {
+		return nil, err
+	}
+
+	if err := s.userService.DeleteUser(ctx, in.GetId(), in.GetVersion()); err != nil {
+		logger.Error(ctx, "Failed to delete user", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "User deleted successfully", zap.Int64("user_id", in.GetId()))
+	return &emptypb.Empty{}, nil
+}
+
+// RestoreUser restores a deleted user that has not been purged yet
+func (s *UserServer) RestoreUser(ctx context.Context, in *userv1.RestoreUserRequest) (*userv1.User, error) {
+	if err := requirePermission(ctx, domain.PermissionUsersDelete); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userService.RestoreUser(ctx, in.GetId())
+	if err != nil {
+		logger.Error(ctx, "Failed to restore user", zap.Error(err))
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+// GetUserProfile returns a user with its profile
+func (s *UserServer) GetUserProfile(ctx context.Context, in *userv1.GetUserProfileRequest) (*userv1.UserWithProfile, error) {
+	if err := requireSelfOrPermission(ctx, in.GetId(), domain.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+
+	userWithProfile, err := s.userService.GetUserWithProfile(ctx, in.GetId())
+	if err != nil {
+		logger.Error(ctx, "Failed to get user profile", zap.Error(err))
+		return nil, err
+	}
+	return &userv1.UserWithProfile{
+		User:    toUser(&userWithProfile.User),
+		Profile: toProfile(&userWithProfile.Profile),
+	}, nil
+}
+
+// GetUserRoles returns a user with its roles
+func (s *UserServer) GetUserRoles(ctx context.Context, in *userv1.GetUserRolesRequest) (*userv1.UserWithRoles, error) {
+	if err := requireSelfOrPermission(ctx, in.GetId(), domain.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+
+	userWithRoles, err := s.userService.GetUserWithRoles(ctx, in.GetId())
+	if err != nil {
+		logger.Error(ctx, "Failed to get user roles", zap.Error(err))
+		return nil, err
+	}
+	return toUserWithRoles(userWithRoles), nil
+}
+
+// checkVersion requires a version for writes when configured, like If-Match over HTTP
+func (s *UserServer) checkVersion(version int64) error {
+	if version == 0 && s.cfg.HTTP.RequireIfMatch {
+		return domain.ErrPreconditionRequired
+	}
+	return nil
+}
+
+// Helper function: Build the merge patch setting the fields of the update mask
+func updatePatch(doc *userv1.UserDocument, paths []string) (*domain.Patch, error) {
+	if len(paths) == 0 {
+		return nil, domain.ErrInvalidRequest.Wrap(fmt.Errorf("update_mask is required"))
+	}
+
+	fields := make(map[string]any, len(paths))
+	for _, path := range paths {
+		switch path {
+		case "username":
+			fields[path] = doc.GetUsername()
+		case "email":
+			fields[path] = doc.GetEmail()
+		case "password":
+			fields[path] = doc.GetPassword()
+		case "status":
+			fields[path] = doc.GetStatus()
+		case "roles":
+			fields[path] = append([]string{}, doc.GetRoles()...)
+		default:
+			return nil, domain.ErrInvalidRequest.Wrap(fmt.Errorf("unknown update_mask path %q", path))
+		}
+	}
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Patch{ContentType: jsonpatch.MergePatchContentType, Body: body}, nil
+}
+
+// Helper function: Reject principals without the permission
+func requirePermission(ctx context.Context, permission string) error {
+	principal := utils.PrincipalFromContext(ctx)
+	if principal == nil || !principal.HasPermission(permission) {
+		return domain.ErrForbidden
+	}
+	return nil
+}
+
+// Helper function: Allow principals acting on their own user or holding the permission
+func requireSelfOrPermission(ctx context.Context, userID int64, permission string) error {
+	principal := utils.PrincipalFromContext(ctx)
+	if principal == nil || !(principal.IsUser(userID) || principal.HasPermission(permission)) {
+		return domain.ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	userv1 "github.com/luxixing/fx-gin/api/user/v1"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// rejectingAuthService authenticates no credential
+type rejectingAuthService struct{}
+
+func (rejectingAuthService) Authenticate(ctx context.Context, credential, clientIP string) (*domain.Principal, error) {
+	return nil, domain.ErrUnauthorized
+}
+
+func (rejectingAuthService) PrincipalForUser(ctx context.Context, userID int64, method string) (*domain.Principal, error) {
+	return nil, domain.ErrUnauthorized
+}
+
+// stubMFAService completes the challenge "challenge" with the code "123456"
+type stubMFAService struct {
+	domain.MFAService
+}
+
+func (stubMFAService) CompleteLogin(ctx context.Context, req *domain.MFALoginRequest) (*domain.TokenResponse, error) {
+	if req.ChallengeToken != "challenge" || req.Code != "123456" {
+		return nil, domain.ErrInvalidVerificationCode
+	}
+	return &domain.TokenResponse{Token: "token", ExpiresAt: 1700000000}, nil
+}
+
+// newTestClient serves the user service without valid credentials on an in-memory listener
+func newTestClient(t *testing.T) userv1.UserServiceClient {
+	t.Helper()
+
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := validation.Setup(v); err != nil {
+			t.Fatalf("set up validation: %v", err)
+		}
+	}
+
+	cfg := &config.Config{App: &config.AppConfig{}, HTTP: &config.HTTPConfig{}, GRPC: &config.GRPCConfig{}}
+	srv := NewServer(ServerParams{
+		Config:      cfg,
+		AuthService: rejectingAuthService{},
+		UserServer:  NewUserServer(UserServerParams{Config: cfg, MFAService: stubMFAService{}}),
+	})
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return userv1.NewUserServiceClient(conn)
+}
+
+func TestCompleteLoginIsPublic(t *testing.T) {
+	client := newTestClient(t)
+
+	for _, tc := range []struct {
+		name string
+		req  *userv1.CompleteLoginRequest
+		want codes.Code
+	}{
+		{"valid code", &userv1.CompleteLoginRequest{ChallengeToken: "challenge", Code: "123456"}, codes.OK},
+		{"wrong code", &userv1.CompleteLoginRequest{ChallengeToken: "challenge", Code: "654321"}, codes.InvalidArgument},
+		{"missing code", &userv1.CompleteLoginRequest{ChallengeToken: "challenge"}, codes.InvalidArgument},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := client.CompleteLogin(context.Background(), tc.req)
+			if got := status.Code(err); got != tc.want {
+				t.Fatalf("code = %s, want %s (%v)", got, tc.want, err)
+			}
+			if err == nil && resp.GetToken() != "token" {
+				t.Errorf("token = %q, want the token of the service", resp.GetToken())
+			}
+		})
+	}
+
+	if _, err := client.GetUser(context.Background(), &userv1.GetUserRequest{Id: 1}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("GetUser without credentials: code = %s, want %s", status.Code(err), codes.Unauthenticated)
+	}
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewAccountHandler),
+	)
+}
+
+// AccountHandlerParams embed fx.In for dependency injection
+type AccountHandlerParams struct {
+	fx.In
+
+	AccountService domain.AccountService
+}
+
+// AccountHandler for handling email verification and password recovery requests
+type AccountHandler struct {
+	accountService domain.AccountService
+}
+
+// NewAccountHandler creates a new AccountHandler
+func NewAccountHandler(p AccountHandlerParams) *AccountHandler {
+	return &AccountHandler{
+		accountService: p.AccountService,
+	}
+}
+
+// RequestVerification resends the verification email
+// @Summary Request email verification
+// @Description Send a new verification email. The response does not reveal whether the address is registered.
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param email body domain.EmailRequest true "Email address"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/users/verify-email/request [post]
+func (h *AccountHandler) RequestVerification(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Processing verification email request")
+
+	var req domain.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	if err := h.accountService.ResendVerificationEmail(ctx, req.Email); err != nil {
+		logger.Error(ctx, "Failed to send verification email", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": i18n.FromContext(ctx).T("account.verification_sent")})
+}
+
+// ConfirmVerification confirms an email address
+// @Summary Confirm email verification
+// @Description Verify the email address with the token from the verification email
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param token body domain.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Router /api/v1/users/verify-email/confirm [post]
+func (h *AccountHandler) ConfirmVerification(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Confirming email address")
+
+	var req domain.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	if err := h.accountService.VerifyEmail(ctx, req.Token); err != nil {
+		logger.Error(ctx, "Failed to verify email address", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("account.email_verified")})
+}
+
+// RequestPasswordReset sends a password reset email
+// @Summary Request password reset
+// @Description Send a password reset email. The response does not reveal whether the address is registered.
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param email body domain.EmailRequest true "Email address"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/users/password-reset/request [post]
+func (h *AccountHandler) RequestPasswordReset(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Processing password reset request")
+
+	var req domain.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	if err := h.accountService.RequestPasswordReset(ctx, req.Email); err != nil {
+		logger.Error(ctx, "Failed to send password reset email", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": i18n.FromContext(ctx).T("account.password_reset_sent")})
+}
+
+// ConfirmPasswordReset sets a new password
+// @Summary Confirm password reset
+// @Description Set a new password with the token from the password reset email
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param reset body domain.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Router /api/v1/users/password-reset/confirm [post]
+func (h *AccountHandler) ConfirmPasswordReset(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Confirming password reset")
+
+	var req domain.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	if err := h.accountService.ResetPassword(ctx, &req); err != nil {
+		logger.Error(ctx, "Failed to reset password", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("account.password_reset")})
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewAPIKeyHandler),
+	)
+}
+
+// APIKeyHandlerParams embed fx.In for dependency injection
+type APIKeyHandlerParams struct {
+	fx.In
+
+	APIKeyService domain.APIKeyService
+}
+
+// APIKeyHandler for handling API key requests
+type APIKeyHandler struct {
+	apiKeyService domain.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler
+func NewAPIKeyHandler(p APIKeyHandlerParams) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: p.APIKeyService,
+	}
+}
+
+// Create creates an API key
+// @Summary Create API key
+// @Description Create an API key for the current user, another user or a service account. The key is returned only once.
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param key body domain.APIKeyRequest true "API key information"
+// @Success 201 {object} domain.APIKeyResponse
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/api-keys [post]
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Creating API key")
+
+	var req domain.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	key, err := h.apiKeyService.Create(ctx, utils.PrincipalFromContext(ctx), &req)
+	if err != nil {
+		logger.Error(ctx, "Failed to create API key", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	logger.Info(ctx, "API key created successfully", zap.Int64("api_key_id", key.ID))
+	c.JSON(http.StatusCreated, key)
+}
+
+// List lists API keys
+// @Summary List API keys
+// @Description List API keys owned by the current user, or all keys with api_keys:manage
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param all query bool false "List keys of all owners"
+// @Success 200 {array} domain.APIKey
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/api-keys [get]
+func (h *APIKeyHandler) List(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Listing API keys")
+
+	all, _ := strconv.ParseBool(c.DefaultQuery("all", "false"))
+	keys, err := h.apiKeyService.List(ctx, utils.PrincipalFromContext(ctx), all)
+	if err != nil {
+		logger.Error(ctx, "Failed to list API keys", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// Get retrieves an API key
+// @Summary Get API key
+// @Description Get API key metadata
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} domain.APIKey
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/api-keys/{id} [get]
+func (h *APIKeyHandler) Get(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Getting API key")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid API key ID", zap.Error(err))
+		c.Error(domain.NewValidationError("invalid_api_key_id", "Invalid API key ID"))
+		return
+	}
+
+	key, err := h.apiKeyService.Get(ctx, utils.PrincipalFromContext(ctx), id)
+	if err != nil {
+		logger.Error(ctx, "Failed to get API key", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// Update updates an API key
+// @Summary Update API key
+// @Description Update the name, scopes and expiry of an API key
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "API key ID"
+// @Param key body domain.APIKeyUpdateRequest true "API key information"
+// @Success 200 {object} domain.APIKey
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/api-keys/{id} [put]
+func (h *APIKeyHandler) Update(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Updating API key")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid API key ID", zap.Error(err))
+		c.Error(domain.NewValidationError("invalid_api_key_id", "Invalid API key ID"))
+		return
+	}
+
+	var req domain.APIKeyUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	key, err := h.apiKeyService.Update(ctx, utils.PrincipalFromContext(ctx), id, &req)
+	if err != nil {
+		logger.Error(ctx, "Failed to update API key", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// Delete revokes an API key
+// @Summary Delete API key
+// @Description Revoke an API key
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/api-keys/{id} [delete]
+func (h *APIKeyHandler) Delete(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Deleting API key")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid API key ID", zap.Error(err))
+		c.Error(domain.NewValidationError("invalid_api_key_id", "Invalid API key ID"))
+		return
+	}
+
+	if err := h.apiKeyService.Delete(ctx, utils.PrincipalFromContext(ctx), id); err != nil {
+		logger.Error(ctx, "Failed to delete API key", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	logger.Info(ctx, "API key deleted successfully", zap.Int64("api_key_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("apikey.deleted")})
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewAuditHandler),
+	)
+}
+
+// AuditHandlerParams embed fx.In for dependency injection
+type AuditHandlerParams struct {
+	fx.In
+
+	Auditor domain.Auditor
+}
+
+// AuditHandler for handling audit log requests
+type AuditHandler struct {
+	auditor domain.Auditor
+}
+
+// NewAuditHandler creates a new AuditHandler
+func NewAuditHandler(p AuditHandlerParams) *AuditHandler {
+	return &AuditHandler{
+		auditor: p.Auditor,
+	}
+}
+
+// List retrieves audit events
+// @Summary List audit events
+// @Description Get a page of audit events, newest first. Pages are addressed with the next_cursor of the previous page.
+// @Tags Audit
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param actor_id query int false "Filter by the user who performed the action"
+// @Param action query string false "Filter by action, e.g. user.login_failed"
+// @Param target_type query string false "Filter by target type" Enums(user, api_key, oauth_client, webhook, config)
+// @Param target_id query string false "Filter by target ID"
+// @Param since query string false "Only events at or after this time (RFC 3339)"
+// @Param until query string false "Only events before this time (RFC 3339)"
+// @Param limit query int false "Items per page, at most 100" default(10)
+// @Param cursor query string false "Cursor of the page to fetch"
+// @Success 200 {object} domain.AuditList
+// @Header 200 {string} Link "Links to the first and next pages"
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/audit-events [get]
+func (h *AuditHandler) List(c *gin.Context) {
+	ctx := utils.WithContext(c)
+
+	var query domain.AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Error(ctx, "Invalid query parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	list, err := h.auditor.List(ctx, &query)
+	if err != nil {
+		logger.Error(ctx, "Failed to list audit events", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	setLinkHeader(c, &list.Pagination)
+	c.JSON(http.StatusOK, list)
+}
+
+// Verify checks the integrity of the audit log
+// @Summary Verify audit log
+// @Description Recompute the hash chain of the audit log. An event that was modified, or follows a removed event, is reported as broken_at.
+// @Tags Audit
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} domain.AuditVerification
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/audit-events/verify [get]
+func (h *AuditHandler) Verify(c *gin.Context) {
+	ctx := utils.WithContext(c)
+
+	result, err := h.auditor.Verify(ctx)
+	if err != nil {
+		logger.Error(ctx, "Failed to verify audit log", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	logger.Info(ctx, "Verified audit log", zap.Bool("valid", result.Valid), zap.Int("checked", result.Checked))
+	c.JSON(http.StatusOK, result)
+}
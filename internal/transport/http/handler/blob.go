@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewBlobHandler),
+	)
+}
+
+// BlobHandlerParams embed fx.In for dependency injection
+type BlobHandlerParams struct {
+	fx.In
+
+	BlobService domain.BlobService
+}
+
+// BlobHandler serves files stored in the local blob store
+type BlobHandler struct {
+	blobService domain.BlobService
+}
+
+// NewBlobHandler creates a new BlobHandler
+func NewBlobHandler(p BlobHandlerParams) *BlobHandler {
+	return &BlobHandler{
+		blobService: p.BlobService,
+	}
+}
+
+// Download serves a stored file
+// @Summary Download file
+// @Description Download a file such as an avatar from the local blob store. Download URLs are signed and expire after BLOB_URL_TTL.
+// @Tags Blob
+// @Produce octet-stream
+// @Param key path string true "Blob key"
+// @Param expires query int true "Expiry as a Unix timestamp"
+// @Param signature query string true "URL signature"
+// @Success 200 {file} file
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /blobs/{key} [get]
+func (h *BlobHandler) Download(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	expires := c.Query("expires")
+
+	if err := h.blobService.VerifyURL(key, expires, c.Query("signature")); err != nil {
+		c.Error(err)
+		return
+	}
+
+	content, blob, err := h.blobService.Open(ctx, key)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer content.Close()
+
+	// Content never changes for a key, so it can be cached for as long as the URL is valid
+	maxAge := int64(0)
+	if unix, err := strconv.ParseInt(expires, 10, 64); err == nil {
+		maxAge = max(unix-time.Now().Unix(), 0)
+	}
+
+	c.DataFromReader(http.StatusOK, blob.Size, blob.ContentType, content, map[string]string{
+		"Cache-Control":          fmt.Sprintf("private, max-age=%d", maxAge),
+		"ETag":                   `"` + blob.SHA256 + `"`,
+		"X-Content-Type-Options": "nosniff",
+	})
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/infra/blob"
+	"github.com/luxixing/fx-gin/internal/infra/db"
+	"github.com/luxixing/fx-gin/internal/repo"
+	"github.com/luxixing/fx-gin/internal/service"
+	"github.com/luxixing/fx-gin/internal/transport/http/middleware"
+)
+
+func TestBlobDownloadChecksSignedURLs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	database, err := sql.Open("sqlite3", db.DataSourceName(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.RunMigrations(db.MigrationConfig{DB: database}); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+	store, err := blob.NewLocalStore(t.TempDir(), "http://localhost:38080", []byte("url-secret"))
+	if err != nil {
+		t.Fatalf("create local store: %v", err)
+	}
+	blobService := service.NewBlobService(service.BlobServiceParams{
+		Config:    &config.Config{Blob: &config.BlobConfig{URLTTL: time.Hour}},
+		BlobRepo:  repo.NewBlobRepo(repo.BlobRepoParams{DB: database}),
+		BlobStore: store,
+	})
+
+	saved, err := blobService.Save(ctx, "avatars", strings.NewReader("avatar"), "image/png")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	other, err := blobService.Save(ctx, "avatars", strings.NewReader("other"), "image/png")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	signed, err := blobService.URL(ctx, saved.Key)
+	if err != nil {
+		t.Fatalf("url: %v", err)
+	}
+	valid, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse url: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(middleware.RequestContext(), middleware.ErrorHandler())
+	r.GET("/blobs/*key", NewBlobHandler(BlobHandlerParams{BlobService: blobService}).Download)
+
+	// with returns the valid URL with a query parameter replaced
+	with := func(name, value string) string {
+		query := valid.Query()
+		query.Set(name, value)
+		return valid.Path + "?" + query.Encode()
+	}
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	// A signature for another key does not open this one
+	otherURL, err := blobService.URL(ctx, other.Key)
+	if err != nil {
+		t.Fatalf("url: %v", err)
+	}
+	otherSigned, _ := url.Parse(otherURL)
+
+	for _, tc := range []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"valid", valid.RequestURI(), http.StatusOK},
+		{"expired", with("expires", expired), http.StatusForbidden},
+		{"extended expiry", with("expires", strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)), http.StatusForbidden},
+		{"tampered signature", with("signature", strings.Repeat("A", 43)), http.StatusForbidden},
+		{"missing signature", valid.Path + "?expires=" + valid.Query().Get("expires"), http.StatusForbidden},
+		{"signature of another key", with("signature", otherSigned.Query().Get("signature")), http.StatusForbidden},
+		{"other key", "/blobs/" + other.Key + "?" + valid.RawQuery, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.status, w.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				if !strings.Contains(w.Body.String(), domain.ErrInvalidBlobURL.Code) {
+					t.Errorf("body = %s, want %s", w.Body.String(), domain.ErrInvalidBlobURL.Code)
+				}
+				return
+			}
+			if w.Body.String() != "avatar" || w.Header().Get("ETag") != `"`+saved.SHA256+`"` || w.Header().Get("Content-Type") != "image/png" {
+				t.Errorf("response = %q with headers %v", w.Body.String(), w.Header())
+			}
+		})
+	}
+}
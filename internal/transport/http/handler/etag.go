@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+// versionTag formats a resource version as a strong entity tag
+func versionTag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// compositeTag derives an opaque entity tag from the versions of several resources.
+// It can be used with If-None-Match but not as an If-Match precondition.
+func compositeTag(versions ...int64) string {
+	hash := sha256.New()
+	for _, version := range versions {
+		binary.Write(hash, binary.BigEndian, version)
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:12]) + `"`
+}
+
+// ifMatchVersion returns the version a change is conditional on, taken from the
+// If-Match header. Zero means the change is unconditional, which is only allowed
+// when the header is not required.
+func ifMatchVersion(c *gin.Context, required bool) (int64, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	switch header {
+	case "":
+		if required {
+			return 0, domain.ErrPreconditionRequired
+		}
+		return 0, nil
+	case "*":
+		return 0, nil
+	}
+
+	// Strong comparison is required, weak tags and tags of other representations never match
+	if len(header) > 2 && header[0] == '"' && header[len(header)-1] == '"' {
+		if version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64); err == nil && version > 0 {
+			return version, nil
+		}
+	}
+	return 0, domain.ErrPreconditionFailed
+}
+
+// notModified sets the ETag header of a response and reports whether it matches
+// If-None-Match, in which case 304 Not Modified has been written
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
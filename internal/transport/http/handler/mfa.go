@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewMFAHandler),
+	)
+}
+
+// MFAHandlerParams embed fx.In for dependency injection
+type MFAHandlerParams struct {
+	fx.In
+
+	MFAService domain.MFAService
+}
+
+// MFAHandler for handling two-factor authentication requests
+type MFAHandler struct {
+	mfaService domain.MFAService
+}
+
+// NewMFAHandler creates a new MFAHandler
+func NewMFAHandler(p MFAHandlerParams) *MFAHandler {
+	return &MFAHandler{
+		mfaService: p.MFAService,
+	}
+}
+
+// Enroll starts TOTP enrollment
+// @Summary Start TOTP enrollment
+// @Description Generate a new TOTP secret and otpauth URI. The factor is enabled only after confirmation.
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} domain.MFAEnrollResponse
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/users/{id}/mfa/totp [post]
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Starting TOTP enrollment")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	resp, err := h.mfaService.Enroll(ctx, id)
+	if err != nil {
+		logger.Error(ctx, "Failed to start TOTP enrollment", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Confirm confirms TOTP enrollment
+// @Summary Confirm TOTP enrollment
+// @Description Verify the first TOTP code, enable two-factor authentication and return recovery codes
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param code body domain.MFACodeRequest true "TOTP code"
+// @Success 200 {object} domain.MFAConfirmResponse
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/users/{id}/mfa/totp/confirm [post]
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Confirming TOTP enrollment")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	var req domain.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	resp, err := h.mfaService.Confirm(ctx, id, req.Code)
+	if err != nil {
+		logger.Error(ctx, "Failed to confirm TOTP enrollment", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	logger.Info(ctx, "TOTP enrollment confirmed", zap.Int64("user_id", id))
+	c.JSON(http.StatusOK, resp)
+}
+
+// Disable disables TOTP
+// @Summary Disable TOTP
+// @Description Disable two-factor authentication using a current TOTP code or a recovery code
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param code body domain.MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/users/{id}/mfa/totp [delete]
+func (h *MFAHandler) Disable(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Disabling TOTP")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	var req domain.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	if err := h.mfaService.Disable(ctx, id, req.Code); err != nil {
+		logger.Error(ctx, "Failed to disable TOTP", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("mfa.disabled")})
+}
+
+// Reset removes the second factor of a user
+// @Summary Reset MFA
+// @Description Remove the TOTP factor and recovery codes of a user without a code, e.g. after the user lost the authenticator. Requires users:write.
+// @Tags MFA
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/users/{id}/mfa [delete]
+func (h *MFAHandler) Reset(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Resetting MFA")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	if err := h.mfaService.Reset(ctx, id); err != nil {
+		logger.Error(ctx, "Failed to reset MFA", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("mfa.disabled")})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes
+// @Summary Regenerate recovery codes
+// @Description Invalidate all existing recovery codes and return a new set
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param code body domain.MFACodeRequest true "TOTP code"
+// @Success 200 {object} domain.MFAConfirmResponse
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/users/{id}/mfa/recovery-codes [post]
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Regenerating recovery codes")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	var req domain.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	resp, err := h.mfaService.RegenerateRecoveryCodes(ctx, id, req.Code)
+	if err != nil {
+		logger.Error(ctx, "Failed to regenerate recovery codes", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CompleteLogin completes a login that requires a second factor
+// @Summary Complete MFA login
+// @Description Exchange an MFA challenge token and a TOTP or recovery code for an access token
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param login body domain.MFALoginRequest true "Challenge and code"
+// @Success 200 {object} domain.TokenResponse
+// @Failure 400 {object} domain.Problem
+// @Router /api/v1/users/login/mfa [post]
+func (h *MFAHandler) CompleteLogin(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Processing MFA login request")
+
+	var req domain.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	token, err := h.mfaService.CompleteLogin(ctx, &req)
+	if err != nil {
+		logger.Error(ctx, "MFA login failed", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	logger.Info(ctx, "MFA login successful")
+	c.JSON(http.StatusOK, token)
+}
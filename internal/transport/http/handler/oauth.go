@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewOAuthHandler),
+	)
+}
+
+// OAuthHandlerParams embed fx.In for dependency injection
+type OAuthHandlerParams struct {
+	fx.In
+
+	OAuthService domain.OAuthService
+}
+
+// OAuthHandler for handling OAuth2 authorization server requests
+type OAuthHandler struct {
+	oauthService domain.OAuthService
+}
+
+// NewOAuthHandler creates a new OAuthHandler
+func NewOAuthHandler(p OAuthHandlerParams) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService: p.OAuthService,
+	}
+}
+
+// Authorize starts an authorization request
+// @Summary OAuth2 authorization request
+// @Description Validate an authorization code request for the signed in user. Returns the consent to show, or the redirect URI carrying the code once consent exists.
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string false "Registered redirect URI"
+// @Param scope query string false "Space separated scopes"
+// @Param state query string false "Opaque client state"
+// @Param code_challenge query string false "PKCE code challenge, required for public clients"
+// @Param code_challenge_method query string false "Must be S256"
+// @Success 200 {object} domain.AuthorizeResponse
+// @Failure 400 {object} domain.OAuthError
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /oauth/authorize [get]
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Processing authorization request")
+
+	var req domain.AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.JSON(http.StatusBadRequest, domain.NewOAuthError(http.StatusBadRequest, "invalid_request", "response_type and client_id are required"))
+		return
+	}
+
+	h.authorize(c, &req)
+}
+
+// Consent records the consent decision for an authorization request
+// @Summary OAuth2 consent decision
+// @Description Approve or deny an authorization request. Returns the redirect URI carrying the code or the error.
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body domain.AuthorizeRequest true "Authorization request with approve set"
+// @Success 200 {object} domain.AuthorizeResponse
+// @Failure 400 {object} domain.OAuthError
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /oauth/authorize [post]
+func (h *OAuthHandler) Consent(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Processing consent decision")
+
+	var req domain.AuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Approve == nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.JSON(http.StatusBadRequest, domain.NewOAuthError(http.StatusBadRequest, "invalid_request", "response_type, client_id and approve are required"))
+		return
+	}
+
+	h.authorize(c, &req)
+}
+
+// Token issues tokens
+// @Summary OAuth2 token endpoint
+// @Description Exchange an authorization code, a refresh token or client credentials for an access token. Clients authenticate with HTTP Basic or client_id/client_secret form fields.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token or client_credentials"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI used in the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Space separated scopes"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Success 200 {object} domain.OAuthTokenResponse
+// @Failure 400 {object} domain.OAuthError
+// @Failure 401 {object} domain.OAuthError
+// @Router /oauth/token [post]
+func (h *OAuthHandler) Token(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Processing token request")
+
+	var req domain.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.JSON(http.StatusBadRequest, domain.NewOAuthError(http.StatusBadRequest, "invalid_request", "grant_type is required"))
+		return
+	}
+	req.ClientID, req.ClientSecret = clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	token, err := h.oauthService.Token(ctx, &req)
+	if err != nil {
+		logger.Error(ctx, "Token request failed", zap.Error(err))
+		h.error(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, token)
+}
+
+// Introspect reports the state of a token
+// @Summary OAuth2 token introspection
+// @Description Report whether an access or refresh token is active (RFC 7662). Requires a confidential client.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to introspect"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Success 200 {object} domain.IntrospectionResponse
+// @Failure 400 {object} domain.OAuthError
+// @Failure 401 {object} domain.OAuthError
+// @Router /oauth/introspect [post]
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Processing introspection request")
+
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, domain.NewOAuthError(http.StatusBadRequest, "invalid_request", "token is required"))
+		return
+	}
+	clientID, clientSecret := clientCredentials(c, c.PostForm("client_id"), c.PostForm("client_secret"))
+
+	resp, err := h.oauthService.Introspect(ctx, clientID, clientSecret, token)
+	if err != nil {
+		logger.Error(ctx, "Introspection request failed", zap.Error(err))
+		h.error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke revokes a token
+// @Summary OAuth2 token revocation
+// @Description Revoke an access or refresh token issued to the client (RFC 7009). Unknown tokens are ignored.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to revoke"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} domain.OAuthError
+// @Failure 401 {object} domain.OAuthError
+// @Router /oauth/revoke [post]
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Processing revocation request")
+
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, domain.NewOAuthError(http.StatusBadRequest, "invalid_request", "token is required"))
+		return
+	}
+	clientID, clientSecret := clientCredentials(c, c.PostForm("client_id"), c.PostForm("client_secret"))
+
+	if err := h.oauthService.Revoke(ctx, clientID, clientSecret, token); err != nil {
+		logger.Error(ctx, "Revocation request failed", zap.Error(err))
+		h.error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// JWKS returns the token signing keys
+// @Summary JSON Web Key Set
+// @Description Public keys used to verify access tokens
+// @Tags OAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/jwks.json [get]
+func (h *OAuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, h.oauthService.JWKS())
+}
+
+// Metadata returns the authorization server metadata
+// @Summary Authorization server metadata
+// @Description OAuth2 authorization server metadata (RFC 8414)
+// @Tags OAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/oauth-authorization-server [get]
+func (h *OAuthHandler) Metadata(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oauthService.Metadata())
+}
+
+// RegisterClient registers an OAuth2 client
+// @Summary Register OAuth client
+// @Description Register an OAuth2 client. The secret of confidential clients is returned only once.
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param client body domain.OAuthClientRequest true "Client information"
+// @Success 201 {object} domain.OAuthClientResponse
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/oauth/clients [post]
+func (h *OAuthHandler) RegisterClient(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Registering OAuth client")
+
+	var req domain.OAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	client, err := h.oauthService.RegisterClient(ctx, utils.PrincipalFromContext(ctx), &req)
+	if err != nil {
+		logger.Error(ctx, "Failed to register OAuth client", zap.Error(err))
+		h.error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, client)
+}
+
+// ListClients lists OAuth2 clients
+// @Summary List OAuth clients
+// @Description List all registered OAuth2 clients
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} domain.OAuthClient
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/oauth/clients [get]
+func (h *OAuthHandler) ListClients(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Listing OAuth clients")
+
+	clients, err := h.oauthService.ListClients(ctx)
+	if err != nil {
+		logger.Error(ctx, "Failed to list OAuth clients", zap.Error(err))
+		h.error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, clients)
+}
+
+// DeleteClient deletes an OAuth2 client
+// @Summary Delete OAuth client
+// @Description Delete an OAuth2 client together with its codes, refresh tokens and consents
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/oauth/clients/{client_id} [delete]
+func (h *OAuthHandler) DeleteClient(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Deleting OAuth client")
+
+	clientID := c.Param("client_id")
+	if err := h.oauthService.DeleteClient(ctx, clientID); err != nil {
+		logger.Error(ctx, "Failed to delete OAuth client", zap.Error(err))
+		h.error(c, err)
+		return
+	}
+
+	logger.Info(ctx, "OAuth client deleted successfully", zap.String("client_id", clientID))
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("oauth.client_deleted")})
+}
+
+// RevokeConsent withdraws a user's consent for a client
+// @Summary Revoke OAuth consent
+// @Description Withdraw the consent a user granted to a client and revoke its refresh tokens
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/users/{id}/oauth/consents/{client_id} [delete]
+func (h *OAuthHandler) RevokeConsent(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Revoking OAuth consent")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	if err := h.oauthService.RevokeConsent(ctx, id, c.Param("client_id")); err != nil {
+		logger.Error(ctx, "Failed to revoke OAuth consent", zap.Error(err))
+		h.error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("oauth.consent_revoked")})
+}
+
+// authorize runs an authorization request and writes the response
+func (h *OAuthHandler) authorize(c *gin.Context, req *domain.AuthorizeRequest) {
+	ctx := utils.WithContext(c)
+
+	resp, err := h.oauthService.Authorize(ctx, utils.PrincipalFromContext(ctx), req)
+	if err != nil {
+		logger.Error(ctx, "Authorization request failed", zap.Error(err))
+		h.error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// error writes the response for a service error. OAuth2 errors use the RFC 6749 format,
+// other errors are reported as problem details.
+func (h *OAuthHandler) error(c *gin.Context, err error) {
+	if oauthErr, ok := domain.AsOAuthError(err); ok {
+		if oauthErr.Status == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		c.JSON(oauthErr.Status, oauthErr)
+		return
+	}
+
+	c.Error(err)
+}
+
+// clientCredentials prefers HTTP Basic client authentication over form fields
+func clientCredentials(c *gin.Context, clientID, clientSecret string) (string, string) {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return clientID, clientSecret
+	}
+
+	// Basic credentials are form-urlencoded (RFC 6749 section 2.3.1)
+	if id, err := url.QueryUnescape(username); err == nil {
+		username = id
+	}
+	if secret, err := url.QueryUnescape(password); err == nil {
+		password = secret
+	}
+	return username, password
+}
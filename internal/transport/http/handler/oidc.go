@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewOIDCHandler),
+	)
+}
+
+// OIDCHandlerParams embed fx.In for dependency injection
+type OIDCHandlerParams struct {
+	fx.In
+
+	OIDCService domain.OIDCService
+}
+
+// OIDCHandler for handling login with external identity providers
+type OIDCHandler struct {
+	oidcService domain.OIDCService
+}
+
+// NewOIDCHandler creates a new OIDCHandler
+func NewOIDCHandler(p OIDCHandlerParams) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: p.OIDCService,
+	}
+}
+
+// Providers lists the configured identity providers
+// @Summary List identity providers
+// @Description List the external OpenID Connect providers users can sign in with
+// @Tags OIDC
+// @Accept json
+// @Produce json
+// @Success 200 {array} domain.OIDCProvider
+// @Router /api/v1/auth/oidc/providers [get]
+func (h *OIDCHandler) Providers(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oidcService.Providers())
+}
+
+// Login redirects to the identity provider
+// @Summary Start external login
+// @Description Redirect the browser to the identity provider's authorization endpoint
+// @Tags OIDC
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 400 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/auth/oidc/{provider}/login [get]
+func (h *OIDCHandler) Login(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	provider := c.Param("provider")
+	logger.Info(ctx, "Starting external login", zap.String("provider", provider))
+
+	authURL, err := h.oidcService.AuthorizationURL(ctx, provider)
+	if err != nil {
+		logger.Error(ctx, "Failed to start external login", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the login
+// @Summary Complete external login
+// @Description Handle the identity provider's redirect and sign in the linked user, provisioning one on first login when enabled
+// @Tags OIDC
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string true "Login state"
+// @Success 200 {object} domain.TokenResponse
+// @Failure 400 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/auth/oidc/{provider}/callback [get]
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	provider := c.Param("provider")
+	logger.Info(ctx, "Processing external login callback", zap.String("provider", provider))
+
+	var req domain.OIDCCallbackRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	token, err := h.oidcService.Callback(ctx, provider, &req)
+	if err != nil {
+		logger.Error(ctx, "External login failed", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	logger.Info(ctx, "External login successful", zap.String("provider", provider))
+	c.JSON(http.StatusOK, token)
+}
+
+// ListIdentities lists the external identities of a user
+// @Summary List linked identities
+// @Description List the external identities linked to a user
+// @Tags OIDC
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {array} domain.UserIdentity
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/users/{id}/identities [get]
+func (h *OIDCHandler) ListIdentities(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Listing linked identities")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	identities, err := h.oidcService.ListIdentities(ctx, id)
+	if err != nil {
+		logger.Error(ctx, "Failed to list linked identities", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// Unlink removes an external identity from a user
+// @Summary Unlink identity
+// @Description Remove an external identity from a user
+// @Tags OIDC
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param identity_id path int true "Identity ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/users/{id}/identities/{identity_id} [delete]
+func (h *OIDCHandler) Unlink(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Unlinking identity")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+	identityID, err := strconv.ParseInt(c.Param("identity_id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid identity ID", zap.Error(err))
+		c.Error(domain.NewValidationError("invalid_identity_id", "Invalid identity ID"))
+		return
+	}
+
+	if err := h.oidcService.Unlink(ctx, id, identityID); err != nil {
+		logger.Error(ctx, "Failed to unlink identity", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("oidc.identity_unlinked")})
+}
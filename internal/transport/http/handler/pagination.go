@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+// setLinkHeader adds RFC 8288 links to the first, previous and next pages of a list.
+// The links keep the filters of the request and follow its pagination mode.
+func setLinkHeader(c *gin.Context, p *domain.Pagination) {
+	var links []string
+	link := func(rel, param, value string) {
+		u := *c.Request.URL
+		query := u.Query()
+		query.Del("cursor")
+		query.Del("page")
+		if param != "" {
+			query.Set(param, value)
+		}
+		u.RawQuery = query.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel))
+	}
+
+	link("first", "", "")
+	if p.Page > 1 {
+		link("prev", "page", strconv.Itoa(p.Page-1))
+	}
+	if p.HasMore {
+		if p.Page > 0 {
+			link("next", "page", strconv.Itoa(p.Page+1))
+		} else {
+			link("next", "cursor", p.NextCursor)
+		}
+	}
+	c.Header("Link", strings.Join(links, ", "))
+}
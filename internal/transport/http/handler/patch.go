@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+// readPatch reads a PATCH request body. The content type selects JSON Merge Patch
+// (application/merge-patch+json or application/json) or JSON Patch (application/json-patch+json).
+func readPatch(c *gin.Context) (*domain.Patch, error) {
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, domain.ErrInvalidRequest.Wrap(err)
+	}
+
+	return &domain.Patch{
+		ContentType: c.ContentType(),
+		Body:        body,
+	}, nil
+}
@@ -0,0 +1,268 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewProfileHandler),
+	)
+}
+
+// multipartOverhead is the room left for multipart headers when limiting avatar uploads
+const multipartOverhead = 64 << 10
+
+// ProfileHandlerParams embed fx.In for dependency injection
+type ProfileHandlerParams struct {
+	fx.In
+
+	Config         *config.Config
+	ProfileService domain.ProfileService
+}
+
+// ProfileHandler for handling user profile requests
+type ProfileHandler struct {
+	cfg            *config.Config
+	profileService domain.ProfileService
+}
+
+// NewProfileHandler creates a new ProfileHandler
+func NewProfileHandler(p ProfileHandlerParams) *ProfileHandler {
+	return &ProfileHandler{
+		cfg:            p.Config,
+		profileService: p.ProfileService,
+	}
+}
+
+// UpdateProfile replaces a user profile
+// @Summary Update user profile
+// @Description Replace the profile of a user. Gender is 0 (unknown), 1 (male) or 2 (female) and birthday is formatted as YYYY-MM-DD.
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param profile body domain.ProfileRequest true "Profile information"
+// @Param If-Match header string false "ETag of the version being modified"
+// @Success 200 {object} domain.Profile
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 412 {object} domain.Problem
+// @Failure 428 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/users/{id}/profile [put]
+func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Updating user profile")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	var req domain.ProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	version, err := ifMatchVersion(c, h.cfg.HTTP.RequireIfMatch)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	profile, err := h.profileService.UpdateProfile(ctx, id, version, &req)
+	if err != nil {
+		logger.Error(ctx, "Failed to update user profile", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", versionTag(profile.Version))
+	c.JSON(http.StatusOK, profile)
+}
+
+// PatchProfile partially updates a user profile
+// @Summary Partially update user profile
+// @Description Update the profile with a JSON Merge Patch (RFC 7396) of the profile fields, or a list of JSON Patch (RFC 6902) operations with the application/json-patch+json content type. Members set to null are cleared.
+// @Tags Profile
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param profile body domain.ProfileRequest true "Profile fields to update"
+// @Param If-Match header string false "ETag of the version being modified"
+// @Success 200 {object} domain.Profile
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 412 {object} domain.Problem
+// @Failure 428 {object} domain.Problem
+// @Failure 415 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/users/{id}/profile [patch]
+func (h *ProfileHandler) PatchProfile(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Patching user profile")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	patch, err := readPatch(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	version, err := ifMatchVersion(c, h.cfg.HTTP.RequireIfMatch)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	profile, err := h.profileService.PatchProfile(ctx, id, version, patch)
+	if err != nil {
+		logger.Error(ctx, "Failed to patch user profile", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", versionTag(profile.Version))
+	c.JSON(http.StatusOK, profile)
+}
+
+// UploadAvatar uploads a new avatar
+// @Summary Upload avatar
+// @Description Upload a JPEG, PNG, GIF or WebP image as the user's avatar. The format is detected from the content; the image is scaled down and square thumbnails are generated.
+// @Tags Profile
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} domain.Profile
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 415 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/users/{id}/avatar [post]
+func (h *ProfileHandler) UploadAvatar(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Uploading avatar")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	maxSize := h.cfg.Profile.AvatarMaxSize
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		logger.Error(ctx, "Invalid avatar upload", zap.Error(err))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.Error(domain.ErrAvatarTooLarge)
+			return
+		}
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+	if fileHeader.Size > maxSize {
+		c.Error(domain.ErrAvatarTooLarge)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	profile, err := h.profileService.UploadAvatar(ctx, id, data)
+	if err != nil {
+		logger.Error(ctx, "Failed to upload avatar", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", versionTag(profile.Version))
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteAvatar removes the avatar
+// @Summary Delete avatar
+// @Description Remove the user's avatar and its thumbnails
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} domain.Profile
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/users/{id}/avatar [delete]
+func (h *ProfileHandler) DeleteAvatar(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Deleting avatar")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	profile, err := h.profileService.DeleteAvatar(ctx, id)
+	if err != nil {
+		logger.Error(ctx, "Failed to delete avatar", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", versionTag(profile.Version))
+	c.JSON(http.StatusOK, profile)
+}
@@ -5,7 +5,9 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/config"
 	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
 	"github.com/luxixing/fx-gin/pkg/logger"
 	"github.com/luxixing/fx-gin/pkg/registry"
 	"github.com/luxixing/fx-gin/pkg/utils"
@@ -23,17 +25,20 @@ func init() {
 type UserHandlerParams struct {
 	fx.In
 
+	Config      *config.Config
 	UserService domain.UserService
 }
 
 // UserHandler for handling user requests
 type UserHandler struct {
+	cfg         *config.Config
 	userService domain.UserService
 }
 
 // NewUserHandler creates a new UserHandler
 func NewUserHandler(p UserHandlerParams) *UserHandler {
 	return &UserHandler{
+		cfg:         p.Config,
 		userService: p.UserService,
 	}
 }
@@ -46,8 +51,9 @@ func NewUserHandler(p UserHandlerParams) *UserHandler {
 // @Produce json
 // @Param user body domain.UserRequest true "User registration information"
 // @Success 200 {object} domain.User
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
 // @Router /api/v1/users/register [post]
 func (h *UserHandler) Register(c *gin.Context) {
 	var req domain.UserRequest
@@ -55,7 +61,7 @@ func (h *UserHandler) Register(c *gin.Context) {
 	ctx := utils.WithContext(c)
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
 		return
 	}
 
@@ -63,7 +69,7 @@ func (h *UserHandler) Register(c *gin.Context) {
 	user, err := h.userService.Register(ctx, &req)
 	if err != nil {
 		logger.Error(ctx, "Failed to register user", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
+		c.Error(err)
 		return
 	}
 
@@ -79,8 +85,10 @@ func (h *UserHandler) Register(c *gin.Context) {
 // @Produce json
 // @Param login body domain.LoginRequest true "Login information"
 // @Success 200 {object} domain.TokenResponse
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
 // @Router /api/v1/users/login [post]
 func (h *UserHandler) Login(c *gin.Context) {
 	ctx := utils.WithContext(c)
@@ -89,14 +97,14 @@ func (h *UserHandler) Login(c *gin.Context) {
 	var req domain.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
 		return
 	}
 
 	token, err := h.userService.Login(ctx, &req)
 	if err != nil {
 		logger.Error(ctx, "User login failed", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -110,11 +118,16 @@ func (h *UserHandler) Login(c *gin.Context) {
 // @Tags User
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
+// @Param If-None-Match header string false "ETag of a cached representation"
 // @Success 200 {object} domain.UserWithProfile
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 304 "Not Modified"
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
 // @Router /api/v1/users/{id}/profile [get]
 func (h *UserHandler) GetProfile(c *gin.Context) {
 	ctx := utils.WithContext(c)
@@ -124,14 +137,19 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		logger.Error(ctx, "Invalid user ID", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(domain.ErrInvalidUserID)
 		return
 	}
 
 	userWithProfile, err := h.userService.GetUserWithProfile(ctx, id)
 	if err != nil {
 		logger.Error(ctx, "Failed to get user profile", zap.Error(err))
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+
+	// The response changes with the user as well as with the profile
+	if notModified(c, compositeTag(userWithProfile.User.Version, userWithProfile.Profile.Version)) {
 		return
 	}
 
@@ -145,11 +163,16 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 // @Tags User
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
+// @Param If-None-Match header string false "ETag of a cached representation"
 // @Success 200 {object} domain.UserWithRoles
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 304 "Not Modified"
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
 // @Router /api/v1/users/{id}/roles [get]
 func (h *UserHandler) GetRoles(c *gin.Context) {
 	ctx := utils.WithContext(c)
@@ -159,14 +182,22 @@ func (h *UserHandler) GetRoles(c *gin.Context) {
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		logger.Error(ctx, "Invalid user ID", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(domain.ErrInvalidUserID)
 		return
 	}
 
 	userWithRoles, err := h.userService.GetUserWithRoles(ctx, id)
 	if err != nil {
 		logger.Error(ctx, "Failed to get user roles", zap.Error(err))
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+
+	versions := []int64{userWithRoles.User.Version}
+	for _, role := range userWithRoles.Roles {
+		versions = append(versions, role.ID, role.Version)
+	}
+	if notModified(c, compositeTag(versions...)) {
 		return
 	}
 
@@ -180,11 +211,16 @@ func (h *UserHandler) GetRoles(c *gin.Context) {
 // @Tags User
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
+// @Param If-None-Match header string false "ETag of a cached representation"
 // @Success 200 {object} domain.User
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 304 "Not Modified"
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
 // @Router /api/v1/users/{id} [get]
 func (h *UserHandler) GetUser(c *gin.Context) {
 	ctx := utils.WithContext(c)
@@ -194,14 +230,18 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		logger.Error(ctx, "Invalid user ID", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(domain.ErrInvalidUserID)
 		return
 	}
 
 	user, err := h.userService.GetUserByID(ctx, id)
 	if err != nil {
 		logger.Error(ctx, "Failed to get user information", zap.Error(err))
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+
+	if notModified(c, versionTag(user.Version)) {
 		return
 	}
 
@@ -215,12 +255,19 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 // @Tags User
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
 // @Param user body domain.UserRequest true "User information"
+// @Param If-Match header string false "ETag of the version being modified"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 412 {object} domain.Problem
+// @Failure 428 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
 // @Router /api/v1/users/{id} [put]
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	ctx := utils.WithContext(c)
@@ -230,38 +277,110 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		logger.Error(ctx, "Invalid user ID", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(domain.ErrInvalidUserID)
 		return
 	}
 
 	var req domain.UserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	version, err := ifMatchVersion(c, h.cfg.HTTP.RequireIfMatch)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	if err := h.userService.UpdateUser(ctx, id, &req); err != nil {
+	user, err := h.userService.UpdateUser(ctx, id, version, &req)
+	if err != nil {
 		logger.Error(ctx, "Failed to update user information", zap.Error(err))
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	c.Header("ETag", versionTag(user.Version))
+
 	logger.Info(ctx, "User information updated successfully", zap.Int64("user_id", id))
-	c.JSON(http.StatusOK, gin.H{"message": "User information updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("user.updated")})
+}
+
+// PatchUser partially updates a user
+// @Summary Partially update user
+// @Description Update the user with a JSON Merge Patch (RFC 7396) of the user document, or a list of JSON Patch (RFC 6902) operations with the application/json-patch+json content type. Changing status requires users:write and changing roles requires roles:write.
+// @Tags User
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param user body domain.UserDocument true "User fields to update"
+// @Param If-Match header string false "ETag of the version being modified"
+// @Success 200 {object} domain.UserWithRoles
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 412 {object} domain.Problem
+// @Failure 428 {object} domain.Problem
+// @Failure 415 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/users/{id} [patch]
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Patching user")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	version, err := ifMatchVersion(c, h.cfg.HTTP.RequireIfMatch)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	patch, err := readPatch(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := h.userService.PatchUser(ctx, utils.PrincipalFromContext(ctx), id, version, patch)
+	if err != nil {
+		logger.Error(ctx, "Failed to patch user", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", versionTag(user.User.Version))
+	c.JSON(http.StatusOK, user)
 }
 
 // DeleteUser deletes a user
 // @Summary Delete user
-// @Description Delete the specified user
+// @Description Delete the specified user. The user is kept for the retention period and can be restored until it is purged.
 // @Tags User
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
+// @Param If-Match header string false "ETag of the version being modified"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 412 {object} domain.Problem
+// @Failure 428 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
 // @Router /api/v1/users/{id} [delete]
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	ctx := utils.WithContext(c)
@@ -271,62 +390,117 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		logger.Error(ctx, "Invalid user ID", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	version, err := ifMatchVersion(c, h.cfg.HTTP.RequireIfMatch)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	if err := h.userService.DeleteUser(ctx, id); err != nil {
+	if err := h.userService.DeleteUser(ctx, id, version); err != nil {
 		logger.Error(ctx, "Failed to delete user", zap.Error(err))
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	logger.Info(ctx, "User deleted successfully", zap.Int64("user_id", id))
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("user.deleted")})
+}
+
+// RestoreUser restores a deleted user
+// @Summary Restore user
+// @Description Restore a deleted user that has not been purged yet, together with its profile
+// @Tags User
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} domain.User
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Router /api/v1/users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Restoring user")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(ctx, "Invalid user ID", zap.Error(err))
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	user, err := h.userService.RestoreUser(ctx, id)
+	if err != nil {
+		logger.Error(ctx, "Failed to restore user", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", versionTag(user.Version))
+	c.JSON(http.StatusOK, user)
 }
 
 // ListUsers retrieves a list of users
 // @Summary List users
-// @Description Get paginated list of users
+// @Description Get a filtered and sorted page of users. Pages are addressed with the next_cursor of the previous page, or with page numbers; the Link header points to the first, previous and next pages.
 // @Tags User
 // @Accept json
 // @Produce json
-// @Param page query int false "Page number" default(1)
-// @Param size query int false "Items per page" default(10)
-// @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]string
+// @Security ApiKeyAuth
+// @Param status query int false "Filter by status" Enums(0, 1, 2)
+// @Param role query string false "Filter by role name"
+// @Param created_after query string false "Only users created at or after this time (RFC 3339)"
+// @Param created_before query string false "Only users created before this time (RFC 3339)"
+// @Param q query string false "Prefix search on username, email and nickname"
+// @Param sort query string false "Sort field, prefixed with - for descending order" Enums(id, -id, username, -username, email, -email, created_at, -created_at, updated_at, -updated_at) default(-id)
+// @Param limit query int false "Items per page, at most 100" default(10)
+// @Param cursor query string false "Cursor of the page to fetch"
+// @Param page query int false "Page number, ignored when cursor is set" default(1)
+// @Param total query bool false "Include the total number of matching users"
+// @Param deleted query bool false "List soft deleted users instead, requires users:delete"
+// @Success 200 {object} domain.UserList
+// @Header 200 {string} Link "Links to the first, previous and next pages"
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
 // @Router /api/v1/users [get]
 func (h *UserHandler) ListUsers(c *gin.Context) {
 	ctx := utils.WithContext(c)
 	logger.Info(ctx, "Getting user list")
 
-	pageStr := c.DefaultQuery("page", "1")
-	sizeStr := c.DefaultQuery("size", "10")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil {
-		page = 1
+	var query domain.UserQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Error(ctx, "Invalid query parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
 	}
 
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		size = 10
+	// Deleted users are only visible to those who can delete and restore them
+	if query.Deleted && !utils.PrincipalFromContext(ctx).HasPermission(domain.PermissionUsersDelete) {
+		c.Error(domain.ErrForbidden)
+		return
 	}
 
-	users, total, err := h.userService.ListUsers(ctx, page, size)
+	list, err := h.userService.ListUsers(ctx, &query)
 	if err != nil {
 		logger.Error(ctx, "Failed to get user list", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	logger.Info(ctx, "Successfully retrieved user list",
-		zap.Int("page", page),
-		zap.Int("size", size),
-		zap.Int("total", total),
+		zap.Int("count", len(list.Items)),
+		zap.Bool("has_more", list.Pagination.HasMore),
 	)
-	c.JSON(http.StatusOK, gin.H{
-		"total": total,
-		"items": users,
-	})
+	setLinkHeader(c, &list.Pagination)
+	c.JSON(http.StatusOK, list)
 }
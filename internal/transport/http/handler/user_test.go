@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/transport/http/middleware"
+)
+
+// stubUserService returns a fixed user with profile
+type stubUserService struct {
+	domain.UserService
+	userWithProfile *domain.UserWithProfile
+}
+
+func (s *stubUserService) GetUserWithProfile(ctx context.Context, id int64) (*domain.UserWithProfile, error) {
+	return s.userWithProfile, nil
+}
+
+func TestGetProfileTagFollowsUserAndProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	users := &stubUserService{userWithProfile: &domain.UserWithProfile{
+		User:    domain.User{ID: 1, Version: 1},
+		Profile: domain.Profile{UserID: 1, Version: 1},
+	}}
+	r := gin.New()
+	r.Use(middleware.RequestContext(), middleware.ErrorHandler())
+	r.GET("/users/:id/profile", NewUserHandler(UserHandlerParams{UserService: users}).GetProfile)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users/1/profile", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("")
+	tag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || tag == "" {
+		t.Fatalf("status = %d, ETag = %q, want 200 with an ETag", first.Code, tag)
+	}
+	if w := get(tag); w.Code != http.StatusNotModified {
+		t.Errorf("unchanged: status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		change func(u *domain.UserWithProfile)
+	}{
+		{"user changed", func(u *domain.UserWithProfile) { u.User.Version++ }},
+		{"profile changed", func(u *domain.UserWithProfile) { u.Profile.Version++ }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.change(users.userWithProfile)
+			w := get(tag)
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if w.Header().Get("ETag") == tag {
+				t.Errorf("ETag %s did not change", tag)
+			}
+			tag = w.Header().Get("ETag")
+		})
+	}
+}
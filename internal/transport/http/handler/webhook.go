@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewWebhookHandler),
+	)
+}
+
+// WebhookHandlerParams embed fx.In for dependency injection
+type WebhookHandlerParams struct {
+	fx.In
+
+	WebhookService domain.WebhookService
+}
+
+// WebhookHandler for handling webhook requests
+type WebhookHandler struct {
+	webhookService domain.WebhookService
+}
+
+// NewWebhookHandler creates a new WebhookHandler
+func NewWebhookHandler(p WebhookHandlerParams) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: p.WebhookService,
+	}
+}
+
+// Create creates a webhook
+// @Summary Create webhook
+// @Description Subscribe a URL to events. Deliveries are signed with the secret, which is returned only once.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param webhook body domain.WebhookRequest true "Webhook information"
+// @Success 201 {object} domain.WebhookResponse
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/webhooks [post]
+func (h *WebhookHandler) Create(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Creating webhook")
+
+	var req domain.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	webhook, err := h.webhookService.Create(ctx, &req)
+	if err != nil {
+		logger.Error(ctx, "Failed to create webhook", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	logger.Info(ctx, "Webhook created successfully", zap.Int64("webhook_id", webhook.ID))
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// List lists webhooks
+// @Summary List webhooks
+// @Description List all webhooks
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} domain.Webhook
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Router /api/v1/webhooks [get]
+func (h *WebhookHandler) List(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Listing webhooks")
+
+	webhooks, err := h.webhookService.List(ctx)
+	if err != nil {
+		logger.Error(ctx, "Failed to list webhooks", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// Get retrieves a webhook
+// @Summary Get webhook
+// @Description Get a webhook
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} domain.Webhook
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/webhooks/{id} [get]
+func (h *WebhookHandler) Get(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Getting webhook")
+
+	id, ok := h.webhookID(c)
+	if !ok {
+		return
+	}
+
+	webhook, err := h.webhookService.Get(ctx, id)
+	if err != nil {
+		logger.Error(ctx, "Failed to get webhook", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// Update updates a webhook
+// @Summary Update webhook
+// @Description Update the URL, description, events and state of a webhook. Pending deliveries of inactive webhooks wait until they are activated again.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Param webhook body domain.WebhookUpdateRequest true "Webhook information"
+// @Success 200 {object} domain.Webhook
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/webhooks/{id} [put]
+func (h *WebhookHandler) Update(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Updating webhook")
+
+	id, ok := h.webhookID(c)
+	if !ok {
+		return
+	}
+
+	var req domain.WebhookUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	webhook, err := h.webhookService.Update(ctx, id, &req)
+	if err != nil {
+		logger.Error(ctx, "Failed to update webhook", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// Delete deletes a webhook
+// @Summary Delete webhook
+// @Description Delete a webhook together with its deliveries
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/webhooks/{id} [delete]
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Deleting webhook")
+
+	id, ok := h.webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.Delete(ctx, id); err != nil {
+		logger.Error(ctx, "Failed to delete webhook", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	logger.Info(ctx, "Webhook deleted successfully", zap.Int64("webhook_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": i18n.FromContext(ctx).T("webhook.deleted")})
+}
+
+// ListDeliveries retrieves the delivery log of a webhook
+// @Summary List webhook deliveries
+// @Description Get a page of the deliveries of a webhook, newest first, with the response code of their last attempt. Pages are addressed with the next_cursor of the previous page.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Param status query string false "Filter by status" Enums(pending, succeeded, dead)
+// @Param event query string false "Filter by event, e.g. user.registered"
+// @Param limit query int false "Items per page, at most 100" default(10)
+// @Param cursor query string false "Cursor of the page to fetch"
+// @Success 200 {object} domain.WebhookDeliveryList
+// @Header 200 {string} Link "Links to the first and next pages"
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	ctx := utils.WithContext(c)
+
+	id, ok := h.webhookID(c)
+	if !ok {
+		return
+	}
+
+	var query domain.WebhookDeliveryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Error(ctx, "Invalid query parameters", zap.Error(err))
+		c.Error(domain.ErrInvalidRequest.Wrap(err))
+		return
+	}
+
+	list, err := h.webhookService.ListDeliveries(ctx, id, &query)
+	if err != nil {
+		logger.Error(ctx, "Failed to list webhook deliveries", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	setLinkHeader(c, &list.Pagination)
+	c.JSON(http.StatusOK, list)
+}
+
+// GetDelivery retrieves a webhook delivery
+// @Summary Get webhook delivery
+// @Description Get a delivery of a webhook with its payload and the log of its attempts
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Param delivery_id path int true "Delivery ID"
+// @Success 200 {object} domain.WebhookDelivery
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/webhooks/{id}/deliveries/{delivery_id} [get]
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	ctx := utils.WithContext(c)
+
+	id, deliveryID, ok := h.deliveryID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.GetDelivery(ctx, id, deliveryID)
+	if err != nil {
+		logger.Error(ctx, "Failed to get webhook delivery", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// Redeliver sends a webhook delivery again
+// @Summary Redeliver webhook delivery
+// @Description Send the event of a delivery again, whatever its status. The new delivery has the same event ID, so receivers can recognize it.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Param delivery_id path int true "Delivery ID"
+// @Success 202 {object} domain.WebhookDelivery
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Router /api/v1/webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	ctx := utils.WithContext(c)
+	logger.Info(ctx, "Redelivering webhook delivery")
+
+	id, deliveryID, ok := h.deliveryID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(ctx, id, deliveryID)
+	if err != nil {
+		logger.Error(ctx, "Failed to redeliver webhook delivery", zap.Error(err))
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// webhookID parses the webhook ID of the path, reporting an invalid one
+func (h *WebhookHandler) webhookID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error(utils.WithContext(c), "Invalid webhook ID", zap.Error(err))
+		c.Error(domain.NewValidationError("invalid_webhook_id", "Invalid webhook ID"))
+		return 0, false
+	}
+	return id, true
+}
+
+// deliveryID parses the webhook and delivery IDs of the path, reporting invalid ones
+func (h *WebhookHandler) deliveryID(c *gin.Context) (int64, int64, bool) {
+	id, ok := h.webhookID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		logger.Error(utils.WithContext(c), "Invalid delivery ID", zap.Error(err))
+		c.Error(domain.NewValidationError("invalid_delivery_id", "Invalid delivery ID"))
+		return 0, 0, false
+	}
+	return id, deliveryID, true
+}
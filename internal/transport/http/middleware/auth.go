@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// AuthorizationHeader is the header key for bearer tokens and API keys
+	AuthorizationHeader = "Authorization"
+	// APIKeyHeader is the alternative header key for API keys
+	APIKeyHeader = "X-API-Key"
+)
+
+// Auth middleware authenticates the request with a bearer token or an API key.
+// Accepted forms are "Authorization: Bearer <token>", "Authorization: ApiKey <key>"
+// and "X-API-Key: <key>".
+func Auth(authService domain.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := utils.WithContext(c)
+
+		credential := extractCredential(c)
+		principal, err := authService.Authenticate(ctx, credential, c.ClientIP())
+		if err != nil {
+			if !errors.Is(err, domain.ErrUnauthorized) {
+				logger.Error(ctx, "Failed to authenticate request", zap.Error(err))
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			c.Error(domain.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+
+		c.Set(domain.PrincipalKey, principal)
+		if trace, exists := c.Get(domain.TraceKey); exists {
+			traceInfo := trace.(*domain.TraceInfo)
+			traceInfo.UserID = principal.UserID
+			// The locale preferred by the user wins over the one of the request
+			if principal.Locale != "" {
+				traceInfo.Locale = i18n.Negotiate(principal.Locale, traceInfo.Locale)
+				c.Header("Content-Language", traceInfo.Locale)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission middleware rejects principals without the permission
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := principalFrom(c)
+		if principal == nil || !principal.HasPermission(permission) {
+			c.Error(domain.ErrForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSelf middleware allows only principals acting on their own user, identified by
+// the given path parameter, whatever their permissions
+func RequireSelf(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := principalFrom(c)
+		id, err := strconv.ParseInt(c.Param(param), 10, 64)
+		if principal == nil || err != nil || !principal.IsUser(id) {
+			c.Error(domain.ErrForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSelfOrPermission middleware allows principals acting on their own user,
+// identified by the given path parameter, or holding the permission
+func RequireSelfOrPermission(param, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := principalFrom(c)
+		if principal == nil {
+			c.Error(domain.ErrForbidden)
+			c.Abort()
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Param(param), 10, 64)
+		if (err == nil && principal.IsUser(id)) || principal.HasPermission(permission) {
+			c.Next()
+			return
+		}
+
+		c.Error(domain.ErrForbidden)
+		c.Abort()
+	}
+}
+
+// extractCredential reads the bearer token or API key from the request headers
+func extractCredential(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return strings.TrimSpace(key)
+	}
+
+	scheme, credential, found := strings.Cut(c.GetHeader(AuthorizationHeader), " ")
+	if !found {
+		return ""
+	}
+	switch strings.ToLower(scheme) {
+	case "bearer", "apikey":
+		return strings.TrimSpace(credential)
+	default:
+		return ""
+	}
+}
+
+// principalFrom retrieves the authenticated principal from gin context
+func principalFrom(c *gin.Context) *domain.Principal {
+	principal, exists := c.Get(domain.PrincipalKey)
+	if !exists {
+		return nil
+	}
+	return principal.(*domain.Principal)
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+// stubAuthService authenticates every credential as the same principal
+type stubAuthService struct {
+	principal *domain.Principal
+}
+
+func (s *stubAuthService) Authenticate(ctx context.Context, credential, clientIP string) (*domain.Principal, error) {
+	return s.principal, nil
+}
+
+func (s *stubAuthService) PrincipalForUser(ctx context.Context, userID int64, method string) (*domain.Principal, error) {
+	return s.principal, nil
+}
+
+func TestAuthPrefersProfileLocale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range []struct {
+		name           string
+		profileLocale  string
+		acceptLanguage string
+		want           string
+		detail         string
+	}{
+		{"profile locale", "zh", "en", "zh", "没有操作权限"},
+		{"no profile locale", "", "zh-CN", "zh", "没有操作权限"},
+		{"accept language only", "", "en", "en", "permission denied"},
+		{"unsupported profile locale", "fr", "zh-CN,en;q=0.5", "zh", "没有操作权限"},
+		{"no preference", "", "", "en", "permission denied"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(RequestContext(), ErrorHandler())
+			r.GET("/test", Auth(&stubAuthService{principal: &domain.Principal{UserID: 1, Locale: tc.profileLocale}}), func(c *gin.Context) {
+				c.Error(domain.ErrForbidden)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set(AuthorizationHeader, "Bearer token")
+			req.Header.Set(AcceptLanguageHeader, tc.acceptLanguage)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Content-Language"); got != tc.want {
+				t.Errorf("Content-Language = %q, want %q", got, tc.want)
+			}
+			if !strings.Contains(w.Body.String(), tc.detail) {
+				t.Errorf("body = %s, want detail %q", w.Body.String(), tc.detail)
+			}
+		})
+	}
+}
+
+func TestRequireSelf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range []struct {
+		name      string
+		principal *domain.Principal
+		path      string
+		want      int
+	}{
+		{"owner", &domain.Principal{UserID: 1}, "/users/1", http.StatusOK},
+		{"other user", &domain.Principal{UserID: 2}, "/users/1", http.StatusForbidden},
+		{"admin", &domain.Principal{UserID: 2, Permissions: []string{domain.PermissionAll}}, "/users/1", http.StatusForbidden},
+		{"service client", &domain.Principal{Permissions: []string{domain.PermissionAll}}, "/users/0", http.StatusForbidden},
+		{"invalid id", &domain.Principal{UserID: 1}, "/users/me", http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(RequestContext(), ErrorHandler())
+			r.GET("/users/:id", Auth(&stubAuthService{principal: tc.principal}), RequireSelf("id"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set(AuthorizationHeader, "Bearer token")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.want {
+				t.Errorf("status = %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
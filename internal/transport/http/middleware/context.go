@@ -6,14 +6,17 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
 	"github.com/rs/xid"
 )
 
 const (
 	// RequestIdHeader is the header key for request ID
 	RequestIdHeader = "X-Request-ID"
-	// RealIPHeader is the header key for real IP address
+	// RealIPHeader is the header key for the client IP address told by a trusted proxy
 	RealIPHeader = "X-Real-IP"
+	// AcceptLanguageHeader is the header key for the locales preferred by the client
+	AcceptLanguageHeader = "Accept-Language"
 )
 
 // RequestContext middleware adds request context information
@@ -25,11 +28,9 @@ func RequestContext() gin.HandlerFunc {
 			requestID = xid.New().String()
 		}
 
-		// Get real IP from header, if not exist, get from client IP
-		realIP := c.GetHeader(RealIPHeader)
-		if realIP == "" {
-			realIP = c.ClientIP()
-		}
+		// The client IP is taken from the X-Forwarded-For or X-Real-IP headers only when
+		// the request comes from a trusted proxy
+		realIP := c.ClientIP()
 
 		// Get content length from header, if not exist, get from request body size
 		bodySize := c.Request.ContentLength
@@ -43,7 +44,9 @@ func RequestContext() gin.HandlerFunc {
 			StartTime:     time.Now(),
 			Method:        c.Request.Method,
 			Path:          c.Request.URL.Path,
+			Locale:        i18n.Negotiate(c.GetHeader(AcceptLanguageHeader)),
 		}
+		c.Header("Content-Language", trace.Locale)
 
 		// Set trace info to context
 		c.Set(domain.TraceKey, trace)
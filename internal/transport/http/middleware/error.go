@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"github.com/luxixing/fx-gin/pkg/validation"
+	"go.uber.org/zap"
+)
+
+// kindStatus maps error kinds to HTTP status codes
+var kindStatus = map[domain.ErrorKind]int{
+	domain.KindNotFound:             http.StatusNotFound,
+	domain.KindConflict:             http.StatusConflict,
+	domain.KindValidation:           http.StatusBadRequest,
+	domain.KindUnauthorized:         http.StatusUnauthorized,
+	domain.KindForbidden:            http.StatusForbidden,
+	domain.KindTooLarge:             http.StatusRequestEntityTooLarge,
+	domain.KindUnsupported:          http.StatusUnsupportedMediaType,
+	domain.KindPrecondition:         http.StatusPreconditionFailed,
+	domain.KindPreconditionRequired: http.StatusPreconditionRequired,
+	domain.KindInternal:             http.StatusInternalServerError,
+}
+
+// ErrorHandler middleware writes an RFC 7807 problem response for errors added
+// with c.Error. Typed domain errors map to their status and message; any other
+// error is logged and reported as an internal server error without details.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		appErr := domain.AsError(err)
+		status, ok := kindStatus[appErr.Kind]
+		if !ok {
+			status = http.StatusInternalServerError
+		}
+		if status == http.StatusInternalServerError {
+			logger.Error(utils.WithContext(c), "Internal server error", zap.Error(err))
+		}
+
+		problem := newProblem(c, status, appErr)
+		problem.Errors = fieldErrors(c, appErr.Err)
+		writeProblem(c, problem)
+	}
+}
+
+// Recovery middleware recovers from panics and responds with an internal server error problem
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		err := fmt.Errorf("panic: %v", recovered)
+		logger.Error(utils.WithContext(c), "Recovered from panic", zap.Error(err), zap.Stack("stack"))
+		writeProblem(c, newProblem(c, http.StatusInternalServerError, domain.NewInternalError(err)))
+	})
+}
+
+// NotFound handler reports unknown routes as a problem
+func NotFound() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Error(domain.NewNotFoundError("route_not_found", "route not found"))
+	}
+}
+
+// newProblem builds the problem details for an error
+func newProblem(c *gin.Context, status int, appErr *domain.Error) *domain.Problem {
+	problem := &domain.Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   appErr.Message,
+		Instance: c.Request.URL.Path,
+		Code:     appErr.Code,
+	}
+	if detail, ok := localizer(c).Lookup("error." + appErr.Code); ok {
+		problem.Detail = detail
+	}
+	if trace := utils.FromContext(c); trace != nil {
+		problem.RequestID = trace.RequestID
+	}
+	return problem
+}
+
+// writeProblem aborts the request with the problem as the response body
+func writeProblem(c *gin.Context, problem *domain.Problem) {
+	c.Header("Content-Type", domain.ProblemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// localizer returns the localizer for the locale negotiated for the request
+func localizer(c *gin.Context) *i18n.Localizer {
+	return i18n.FromContext(utils.WithContext(c))
+}
+
+// fieldErrors extracts field-level details from request binding errors, with
+// messages in the locale requested by the client
+func fieldErrors(c *gin.Context, err error) []domain.FieldError {
+	trans := validation.Translator(localizer(c).Locale())
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]domain.FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, domain.FieldError{
+				Field:   fe.Field(),
+				Rule:    fe.Tag(),
+				Message: fe.Translate(trans),
+			})
+		}
+		return fields
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []domain.FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: validation.TypeMessage(trans, typeErr.Field, typeErr.Type.String()),
+		}}
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+func TestErrorHandlerMapsKindsToStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"not found", domain.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+		{"conflict", domain.ErrUsernameExists, http.StatusConflict, "username_exists"},
+		{"validation", domain.ErrInvalidRequest, http.StatusBadRequest, "invalid_request"},
+		{"unauthorized", domain.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+		{"forbidden", domain.ErrEmailNotVerified, http.StatusForbidden, "email_not_verified"},
+		{"too large", domain.ErrAvatarTooLarge, http.StatusRequestEntityTooLarge, "avatar_too_large"},
+		{"unsupported", domain.ErrUnsupportedPatch, http.StatusUnsupportedMediaType, "unsupported_patch_type"},
+		{"precondition failed", domain.ErrPreconditionFailed, http.StatusPreconditionFailed, "precondition_failed"},
+		{"precondition required", domain.ErrPreconditionRequired, http.StatusPreconditionRequired, "precondition_required"},
+		{"wrapped typed error", fmt.Errorf("update user: %w", domain.ErrUserNotFound.Wrap(errors.New("no rows"))), http.StatusNotFound, "user_not_found"},
+		{"untyped error", errors.New("connection refused"), http.StatusInternalServerError, "internal_error"},
+		{"unknown kind", &domain.Error{Kind: "teapot", Code: "teapot", Message: "short and stout"}, http.StatusInternalServerError, "teapot"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(RequestContext(), ErrorHandler())
+			r.GET("/test", func(c *gin.Context) {
+				c.Error(tc.err)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d", w.Code, tc.status)
+			}
+			if got := w.Header().Get("Content-Type"); got != domain.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, domain.ProblemContentType)
+			}
+			var problem domain.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode problem %s: %v", w.Body.String(), err)
+			}
+			if problem.Status != tc.status || problem.Code != tc.code || problem.Title != http.StatusText(tc.status) || problem.Instance != "/test" {
+				t.Errorf("problem = %+v", problem)
+			}
+			// Causes are logged, never returned to the client
+			if strings.Contains(w.Body.String(), "no rows") || strings.Contains(w.Body.String(), "connection refused") {
+				t.Errorf("body leaks the cause: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestErrorHandlerReportsFieldErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestContext(), ErrorHandler())
+	r.POST("/test", func(c *gin.Context) {
+		var req struct {
+			Email string `json:"email" binding:"required,email"`
+			Age   int    `json:"age"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(domain.ErrInvalidRequest.Wrap(err))
+		}
+	})
+
+	for _, tc := range []struct {
+		name  string
+		body  string
+		field string
+		rule  string
+	}{
+		{"failed rule", `{"email":"not-an-email"}`, "Email", "email"},
+		{"wrong type", `{"email":"a@example.com","age":"old"}`, "age", "type"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(tc.body)))
+
+			var problem domain.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode problem %s: %v", w.Body.String(), err)
+			}
+			if w.Code != http.StatusBadRequest || len(problem.Errors) != 1 {
+				t.Fatalf("status = %d, problem = %s", w.Code, w.Body.String())
+			}
+			if fe := problem.Errors[0]; fe.Field != tc.field || fe.Rule != tc.rule || fe.Message == "" {
+				t.Errorf("field error = %+v, want %s failing %s", fe, tc.field, tc.rule)
+			}
+		})
+	}
+}
+
+func TestProblemShape(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestContext(), ErrorHandler(), Recovery())
+	r.NoRoute(NotFound())
+	r.GET("/typed", func(c *gin.Context) {
+		c.Error(domain.ErrUserNotFound)
+	})
+	r.GET("/fields", func(c *gin.Context) {
+		var req struct {
+			Email string `form:"email" binding:"required"`
+		}
+		c.Error(domain.ErrInvalidRequest.Wrap(c.ShouldBindQuery(&req)))
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	base := []string{"type", "title", "status", "detail", "instance", "code", "request_id"}
+	for _, tc := range []struct {
+		name   string
+		path   string
+		status int
+		code   string
+		keys   []string
+	}{
+		{"typed error", "/typed", http.StatusNotFound, "user_not_found", base},
+		{"field errors", "/fields", http.StatusBadRequest, "invalid_request", append(base, "errors")},
+		{"unknown route", "/missing", http.StatusNotFound, "route_not_found", base},
+		{"panic", "/panic", http.StatusInternalServerError, "internal_error", base},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set(RequestIdHeader, "request-42")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d", w.Code, tc.status)
+			}
+			if got := w.Header().Get("Content-Type"); got != domain.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, domain.ProblemContentType)
+			}
+
+			var members map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &members); err != nil {
+				t.Fatalf("decode problem %s: %v", w.Body.String(), err)
+			}
+			for _, key := range tc.keys {
+				if _, ok := members[key]; !ok {
+					t.Errorf("problem %s has no %q", w.Body.String(), key)
+				}
+			}
+			if len(members) != len(tc.keys) {
+				t.Errorf("problem %s has %d members, want %v", w.Body.String(), len(members), tc.keys)
+			}
+
+			var problem domain.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if problem.Type != "about:blank" || problem.Status != tc.status || problem.Code != tc.code || problem.Instance != tc.path {
+				t.Errorf("problem = %+v", problem)
+			}
+			// The request ID links the problem to the logs of the request
+			if problem.RequestID != "request-42" || w.Header().Get(RequestIdHeader) != "request-42" {
+				t.Errorf("request_id = %q, header = %q, want request-42", problem.RequestID, w.Header().Get(RequestIdHeader))
+			}
+			for _, fe := range problem.Errors {
+				if fe.Field == "" || fe.Rule == "" || fe.Message == "" {
+					t.Errorf("incomplete field error %+v", fe)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/logger"
+	"github.com/luxixing/fx-gin/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// Validation modes of the OpenAPI validator
+const (
+	ValidationOff     = "off"
+	ValidationWarn    = "warn"    // Log mismatches
+	ValidationEnforce = "enforce" // Report mismatches as problem responses
+)
+
+// entityHeaders describe a response body and are dropped when the body is replaced
+var entityHeaders = []string{"Content-Type", "Content-Length", "Content-Disposition", "Content-Encoding", "ETag", "Last-Modified", "Location"}
+
+// undocumentedRoutes are the route prefixes outside of the spec: the documentation UI is not
+// part of the API, the gRPC gateway follows the proto definitions and GraphQL its schema
+var undocumentedRoutes = []string{"/swagger/", "/gateway/", "/graphql"}
+
+// openAPIValidator checks requests and responses against the operations of the spec
+type openAPIValidator struct {
+	spec      *openapi3.T
+	basePath  string
+	requests  string
+	responses string
+}
+
+// OpenAPIValidator middleware validates requests, and the responses written for them, against
+// the Swagger 2.0 document of the API. Depending on the mode, mismatches are only logged, or
+// requests are rejected with a problem and responses are replaced by an internal server error
+// problem. Responses are buffered until they have been validated, so response validation is
+// meant for development and tests. Routes missing from the document are logged.
+func OpenAPIValidator(doc string, requests, responses string) (gin.HandlerFunc, error) {
+	for _, mode := range []string{requests, responses} {
+		if mode != ValidationOff && mode != ValidationWarn && mode != ValidationEnforce {
+			return nil, fmt.Errorf("unknown validation mode %q", mode)
+		}
+	}
+
+	var swagger openapi2.T
+	if err := json.Unmarshal([]byte(doc), &swagger); err != nil {
+		return nil, fmt.Errorf("failed to parse swagger document: %w", err)
+	}
+	spec, err := openapi2conv.ToV3(&swagger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert swagger document: %w", err)
+	}
+	if err := spec.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid swagger document: %w", err)
+	}
+
+	v := &openAPIValidator{
+		spec:      spec,
+		basePath:  strings.TrimSuffix(swagger.BasePath, "/"),
+		requests:  requests,
+		responses: responses,
+	}
+	return v.handle, nil
+}
+
+func (v *openAPIValidator) handle(c *gin.Context) {
+	ctx := utils.WithContext(c)
+
+	// Unknown routes are reported by the router
+	if c.FullPath() == "" || undocumented(c.FullPath()) {
+		c.Next()
+		return
+	}
+	route := v.route(c)
+	if route == nil {
+		logger.Warn(ctx, "Route is not documented in the API specification",
+			zap.String("method", c.Request.Method), zap.String("route", c.FullPath()))
+		c.Next()
+		return
+	}
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    c.Request,
+		PathParams: pathParams(c),
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError:          true,
+			SkipSettingDefaults: true,
+			// Patches are partial, the documented body is the resource they apply to
+			ExcludeRequestBody: c.Request.Method == http.MethodPatch,
+			// Credentials are checked by the auth middleware
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+	if v.requests != ValidationOff {
+		if err := openapi3filter.ValidateRequest(ctx, input); err != nil {
+			fields := contractErrors(err, "")
+			logger.Warn(ctx, "Request does not match the API specification",
+				zap.String("route", route.Method+" "+route.Path), zap.Any("errors", fields))
+			if v.requests == ValidationEnforce {
+				problem := newProblem(c, http.StatusBadRequest, domain.ErrRequestContract.Wrap(err))
+				problem.Errors = fields
+				writeProblem(c, problem)
+				return
+			}
+		}
+	}
+
+	if v.responses == ValidationOff {
+		c.Next()
+		return
+	}
+
+	writer := &contractWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+	c.Writer = writer
+	// A panic is answered by the recovery middleware on the original writer
+	defer func() { c.Writer = writer.ResponseWriter }()
+	c.Next()
+
+	header := writer.Header().Clone()
+	// Problems are documented as the JSON responses of the operation
+	if header.Get("Content-Type") == domain.ProblemContentType {
+		header.Set("Content-Type", "application/json")
+	}
+	err := openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 writer.status,
+		Header:                 header,
+		Body:                   io.NopCloser(bytes.NewReader(writer.body.Bytes())),
+		Options:                &openapi3filter.Options{MultiError: true, IncludeResponseStatus: true},
+	})
+	if err == nil {
+		writer.flush()
+		return
+	}
+
+	fields := contractErrors(err, "")
+	logger.Warn(ctx, "Response does not match the API specification",
+		zap.String("route", route.Method+" "+route.Path), zap.Int("status", writer.status), zap.Any("errors", fields))
+	if v.responses != ValidationEnforce {
+		writer.flush()
+		return
+	}
+	for _, name := range entityHeaders {
+		writer.Header().Del(name)
+	}
+	c.Writer = writer.ResponseWriter
+	problem := newProblem(c, http.StatusInternalServerError, domain.ErrResponseContract.Wrap(err))
+	problem.Errors = fields
+	writeProblem(c, problem)
+}
+
+// route finds the documented operation of the matched route. Paths are documented relative
+// to the base path, except for the routes outside of it.
+func (v *openAPIValidator) route(c *gin.Context) *routers.Route {
+	path := c.FullPath()
+	candidates := []string{path}
+	if v.basePath != "" && strings.HasPrefix(path, v.basePath+"/") {
+		candidates = []string{strings.TrimPrefix(path, v.basePath), path}
+	}
+
+	for _, candidate := range candidates {
+		// Convert gin parameters, :id and *key, to templates
+		segments := strings.Split(candidate, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+				segments[i] = "{" + segment[1:] + "}"
+			}
+		}
+		candidate = strings.Join(segments, "/")
+
+		item := v.spec.Paths.Value(candidate)
+		if item == nil {
+			continue
+		}
+		if op := item.GetOperation(c.Request.Method); op != nil {
+			return &routers.Route{
+				Spec:      v.spec,
+				Path:      candidate,
+				PathItem:  item,
+				Method:    c.Request.Method,
+				Operation: op,
+			}
+		}
+	}
+	return nil
+}
+
+// Helper function: Check whether a route is outside of the spec
+func undocumented(route string) bool {
+	for _, prefix := range undocumentedRoutes {
+		if strings.HasPrefix(route, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function: Get the path parameters of the matched route
+func pathParams(c *gin.Context) map[string]string {
+	params := make(map[string]string, len(c.Params))
+	for _, param := range c.Params {
+		// Catch-all parameters include the leading slash
+		params[param.Key] = strings.TrimPrefix(param.Value, "/")
+	}
+	return params
+}
+
+// Helper function: Flatten validation errors into field errors
+func contractErrors(err error, field string) []domain.FieldError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var fields []domain.FieldError
+		for _, err := range e {
+			fields = append(fields, contractErrors(err, field)...)
+		}
+		return fields
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			field = e.Parameter.Name
+		}
+		if e.Err != nil {
+			return contractErrors(e.Err, field)
+		}
+		return []domain.FieldError{{Field: field, Rule: "openapi", Message: e.Reason}}
+	case *openapi3filter.ResponseError:
+		if e.Err != nil {
+			return contractErrors(e.Err, field)
+		}
+		return []domain.FieldError{{Field: field, Rule: "openapi", Message: e.Reason}}
+	case *openapi3.SchemaError:
+		path := make([]string, 0, len(e.JSONPointer())+1)
+		if field != "" {
+			path = append(path, field)
+		}
+		path = append(path, e.JSONPointer()...)
+		return []domain.FieldError{{Field: strings.Join(path, "."), Rule: e.SchemaField, Message: e.Reason}}
+	}
+	return []domain.FieldError{{Field: field, Rule: "openapi", Message: err.Error()}}
+}
+
+// contractWriter holds back the response until it has been validated
+type contractWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *contractWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *contractWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *contractWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *contractWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *contractWriter) Status() int {
+	return w.status
+}
+
+func (w *contractWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *contractWriter) Written() bool {
+	return w.written
+}
+
+// Flush is a no-op, the response is written after validation
+func (w *contractWriter) Flush() {}
+
+// flush writes the held back response
+func (w *contractWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.written {
+		w.ResponseWriter.WriteHeaderNow()
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
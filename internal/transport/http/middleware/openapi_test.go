@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luxixing/fx-gin/internal/domain"
+)
+
+// contractDoc documents creating and getting widgets
+const contractDoc = `{
+	"swagger": "2.0",
+	"info": {"title": "test", "version": "1.0"},
+	"basePath": "/api/v1",
+	"paths": {
+		"/widgets": {
+			"post": {
+				"consumes": ["application/json"],
+				"produces": ["application/json"],
+				"parameters": [{
+					"in": "body",
+					"name": "request",
+					"required": true,
+					"schema": {
+						"type": "object",
+						"required": ["name"],
+						"properties": {
+							"name": {"type": "string", "minLength": 3},
+							"size": {"type": "integer"}
+						}
+					}
+				}],
+				"responses": {"201": {"description": "created", "schema": {"$ref": "#/definitions/Widget"}}}
+			}
+		},
+		"/widgets/{id}": {
+			"get": {
+				"produces": ["application/json"],
+				"parameters": [
+					{"in": "path", "name": "id", "required": true, "type": "integer"},
+					{"in": "query", "name": "fields", "type": "string", "enum": ["name", "size"]}
+				],
+				"responses": {"200": {"description": "found", "schema": {"$ref": "#/definitions/Widget"}}}
+			}
+		}
+	},
+	"definitions": {
+		"Widget": {
+			"type": "object",
+			"required": ["id", "name"],
+			"properties": {"id": {"type": "integer"}, "name": {"type": "string"}}
+		}
+	}
+}`
+
+// newContractRouter routes the documented operations and one undocumented route
+// behind the validator. GET /widgets/2 answers with a widget without a name.
+func newContractRouter(t *testing.T, requests, responses string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	validator, err := OpenAPIValidator(contractDoc, requests, responses)
+	if err != nil {
+		t.Fatalf("create validator: %v", err)
+	}
+	r := gin.New()
+	r.Use(RequestContext(), ErrorHandler(), validator)
+	r.POST("/api/v1/widgets", func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"id": 1, "name": "gear"})
+	})
+	r.GET("/api/v1/widgets/:id", func(c *gin.Context) {
+		if c.Param("id") == "2" {
+			c.JSON(http.StatusOK, gin.H{"id": 2})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": 1, "name": "gear"})
+	})
+	r.GET("/api/v1/gadgets", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"anything": true})
+	})
+	return r
+}
+
+func TestOpenAPIValidatorRejectsRequests(t *testing.T) {
+	r := newContractRouter(t, ValidationEnforce, ValidationOff)
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		field  string // A field reported by the problem
+	}{
+		{"valid body", http.MethodPost, "/api/v1/widgets", `{"name": "gear", "size": 3}`, http.StatusCreated, ""},
+		{"missing property", http.MethodPost, "/api/v1/widgets", `{"size": 3}`, http.StatusBadRequest, "name"},
+		{"short property", http.MethodPost, "/api/v1/widgets", `{"name": "x"}`, http.StatusBadRequest, "name"},
+		{"wrong property type", http.MethodPost, "/api/v1/widgets", `{"name": "gear", "size": "big"}`, http.StatusBadRequest, "size"},
+		{"valid parameters", http.MethodGet, "/api/v1/widgets/1?fields=name", "", http.StatusOK, ""},
+		{"wrong path parameter type", http.MethodGet, "/api/v1/widgets/abc", "", http.StatusBadRequest, "id"},
+		{"query parameter outside enum", http.MethodGet, "/api/v1/widgets/1?fields=color", "", http.StatusBadRequest, "fields"},
+		{"undocumented route", http.MethodGet, "/api/v1/gadgets?anything=1", "", http.StatusOK, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.status, w.Body.String())
+			}
+			if tc.field == "" {
+				return
+			}
+			var problem domain.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode problem %s: %v", w.Body.String(), err)
+			}
+			if problem.Code != domain.ErrRequestContract.Code {
+				t.Errorf("code = %q, want %q", problem.Code, domain.ErrRequestContract.Code)
+			}
+			found := false
+			for _, fe := range problem.Errors {
+				found = found || strings.HasSuffix(fe.Field, tc.field)
+			}
+			if !found {
+				t.Errorf("errors = %+v, want one for %s", problem.Errors, tc.field)
+			}
+		})
+	}
+}
+
+func TestOpenAPIValidatorModes(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		requests  string
+		responses string
+		target    string
+		status    int
+		code      string
+	}{
+		{"requests only logged", ValidationWarn, ValidationOff, "/api/v1/widgets/abc", http.StatusOK, ""},
+		{"requests not validated", ValidationOff, ValidationOff, "/api/v1/widgets/abc", http.StatusOK, ""},
+		{"valid response", ValidationOff, ValidationEnforce, "/api/v1/widgets/1", http.StatusOK, ""},
+		{"invalid response replaced", ValidationOff, ValidationEnforce, "/api/v1/widgets/2", http.StatusInternalServerError, domain.ErrResponseContract.Code},
+		{"invalid response only logged", ValidationOff, ValidationWarn, "/api/v1/widgets/2", http.StatusOK, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newContractRouter(t, tc.requests, tc.responses)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.status, w.Body.String())
+			}
+			if tc.code == "" {
+				return
+			}
+			var problem domain.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode problem %s: %v", w.Body.String(), err)
+			}
+			if problem.Code != tc.code {
+				t.Errorf("code = %q, want %q", problem.Code, tc.code)
+			}
+		})
+	}
+
+	if _, err := OpenAPIValidator(contractDoc, "strict", ValidationOff); err == nil {
+		t.Errorf("unknown mode: want an error")
+	}
+}
@@ -5,13 +5,21 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	_ "github.com/luxixing/fx-gin/docs/swagger"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/luxixing/fx-gin/docs/swagger"
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/internal/transport/gateway"
+	"github.com/luxixing/fx-gin/internal/transport/graphql"
 	"github.com/luxixing/fx-gin/internal/transport/http/handler"
 	"github.com/luxixing/fx-gin/internal/transport/http/middleware"
 	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/luxixing/fx-gin/pkg/validation"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 )
 
 func init() {
@@ -24,20 +32,42 @@ func init() {
 type RouterParams struct {
 	fx.In
 
-	TestHandler *handler.TestHandler
-	UserHandler *handler.UserHandler
+	TestHandler    *handler.TestHandler
+	UserHandler    *handler.UserHandler
+	MFAHandler     *handler.MFAHandler
+	AccountHandler *handler.AccountHandler
+	APIKeyHandler  *handler.APIKeyHandler
+	OAuthHandler   *handler.OAuthHandler
+	OIDCHandler    *handler.OIDCHandler
+	ProfileHandler *handler.ProfileHandler
+	BlobHandler    *handler.BlobHandler
+	AuditHandler   *handler.AuditHandler
+	WebhookHandler *handler.WebhookHandler
+	AuthService    domain.AuthService
+	Gateway        *gateway.Gateway
+	GraphQLHandler *graphql.Handler
+	Config         *config.Config
+
+	// scaffold:handlers
 }
 
 // NewRouter creates and configures the Gin router
 func NewRouter(p RouterParams) *gin.Engine {
 	r := gin.New()
 
+	// Client IPs are written to the audit log, so only proxies may tell them with headers.
+	// Without valid proxies no headers are trusted, rather than those of anyone.
+	if err := r.SetTrustedProxies(p.Config.HTTP.TrustedProxies); err != nil {
+		zap.S().Errorw("Failed to set trusted proxies, client IP headers are ignored", "error", err)
+		_ = r.SetTrustedProxies(nil)
+	}
+
 	// Add third-party CORS middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Requested-With", "If-Match", "If-None-Match"},
+		ExposeHeaders:    []string{"Content-Length", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -46,26 +76,174 @@ func NewRouter(p RouterParams) *gin.Engine {
 	r.Use(middleware.RequestContext())
 	// Replace default gin.Logger with zap logger middleware
 	r.Use(middleware.Logger())
-	r.Use(gin.Recovery())
+	r.Use(middleware.Recovery())
+	// Check requests and responses against the API documentation
+	if validator := openAPIValidator(p.Config); validator != nil {
+		r.Use(validator)
+	}
+	// Map errors reported by handlers to problem details responses
+	r.Use(middleware.ErrorHandler())
+	r.NoRoute(middleware.NotFound())
+
+	// Register custom validation rules and localized messages
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := validation.Setup(v); err != nil {
+			zap.S().Errorw("Failed to set up validation", "error", err)
+		}
+	}
 
 	// Swagger documentation
 	// Create swagger documentation routes
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	auth := middleware.Auth(p.AuthService)
+
+	// OAuth2 authorization server
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", auth, p.OAuthHandler.Authorize)
+		oauth.POST("/authorize", auth, p.OAuthHandler.Consent)
+		oauth.POST("/token", p.OAuthHandler.Token)
+		oauth.POST("/introspect", p.OAuthHandler.Introspect)
+		oauth.POST("/revoke", p.OAuthHandler.Revoke)
+	}
+	r.GET("/.well-known/jwks.json", p.OAuthHandler.JWKS)
+	r.GET("/.well-known/oauth-authorization-server", p.OAuthHandler.Metadata)
+
+	// Files from the local blob store
+	r.GET("/blobs/*key", p.BlobHandler.Download)
+
+	// JSON gateway of the gRPC services, authenticated by the gRPC server
+	if p.Config.GRPC.Enabled && p.Config.GRPC.Gateway {
+		r.Any(gateway.Prefix+"/*path", p.Gateway.Handle)
+	}
+
+	// GraphQL queries, permissions are checked by the resolvers
+	if p.Config.GraphQL.Enabled {
+		r.POST(graphql.Path, auth, p.GraphQLHandler.Query)
+		if p.Config.GraphQL.Playground {
+			r.GET(graphql.Path, p.GraphQLHandler.Playground)
+		}
+	}
+
 	v1 := r.Group("/api/v1")
 	{
 		v1.GET("/test", p.TestHandler.Test)
+		// Login with external OpenID Connect providers
+		oidc := v1.Group("/auth/oidc")
+		{
+			oidc.GET("/providers", p.OIDCHandler.Providers)
+			oidc.GET("/:provider/login", p.OIDCHandler.Login)
+			oidc.GET("/:provider/callback", p.OIDCHandler.Callback)
+		}
+
 		// Add user-related routes
 		users := v1.Group("/users")
 		{
+			// Public endpoints
 			users.POST("/register", p.UserHandler.Register)
 			users.POST("/login", p.UserHandler.Login)
-			users.GET("/:id", p.UserHandler.GetUser)
-			users.PUT("/:id", p.UserHandler.UpdateUser)
-			users.DELETE("/:id", p.UserHandler.DeleteUser)
-			users.GET("", p.UserHandler.ListUsers)
-			users.GET("/:id/profile", p.UserHandler.GetProfile)
-			users.GET("/:id/roles", p.UserHandler.GetRoles)
+			users.POST("/login/mfa", p.MFAHandler.CompleteLogin)
+
+			// Email verification and password recovery
+			users.POST("/verify-email/request", p.AccountHandler.RequestVerification)
+			users.POST("/verify-email/confirm", p.AccountHandler.ConfirmVerification)
+			users.POST("/password-reset/request", p.AccountHandler.RequestPasswordReset)
+			users.POST("/password-reset/confirm", p.AccountHandler.ConfirmPasswordReset)
+
+			// Authenticated endpoints, users can always access their own account
+			authed := users.Group("", auth)
+			authed.GET("", middleware.RequirePermission(domain.PermissionUsersRead), p.UserHandler.ListUsers)
+			authed.GET("/:id", middleware.RequireSelfOrPermission("id", domain.PermissionUsersRead), p.UserHandler.GetUser)
+			authed.PUT("/:id", middleware.RequireSelfOrPermission("id", domain.PermissionUsersWrite), p.UserHandler.UpdateUser)
+			authed.PATCH("/:id", middleware.RequireSelfOrPermission("id", domain.PermissionUsersWrite), p.UserHandler.PatchUser)
+			authed.DELETE("/:id", middleware.RequirePermission(domain.PermissionUsersDelete), p.UserHandler.DeleteUser)
+			authed.POST("/:id/restore", middleware.RequirePermission(domain.PermissionUsersDelete), p.UserHandler.RestoreUser)
+			authed.GET("/:id/profile", middleware.RequireSelfOrPermission("id", domain.PermissionUsersRead), p.UserHandler.GetProfile)
+			authed.GET("/:id/roles", middleware.RequireSelfOrPermission("id", domain.PermissionUsersRead), p.UserHandler.GetRoles)
+
+			// Profile and avatar
+			authed.PUT("/:id/profile", middleware.RequireSelfOrPermission("id", domain.PermissionUsersWrite), p.ProfileHandler.UpdateProfile)
+			authed.PATCH("/:id/profile", middleware.RequireSelfOrPermission("id", domain.PermissionUsersWrite), p.ProfileHandler.PatchProfile)
+			authed.POST("/:id/avatar", middleware.RequireSelfOrPermission("id", domain.PermissionUsersWrite), p.ProfileHandler.UploadAvatar)
+			authed.DELETE("/:id/avatar", middleware.RequireSelfOrPermission("id", domain.PermissionUsersWrite), p.ProfileHandler.DeleteAvatar)
+
+			// Two-factor authentication
+			// Only the owner manages its second factor, admins can only reset it
+			authed.DELETE("/:id/mfa", middleware.RequirePermission(domain.PermissionUsersWrite), p.MFAHandler.Reset)
+			mfa := authed.Group("/:id/mfa", middleware.RequireSelf("id"))
+			mfa.POST("/totp", p.MFAHandler.Enroll)
+			mfa.POST("/totp/confirm", p.MFAHandler.Confirm)
+			mfa.DELETE("/totp", p.MFAHandler.Disable)
+			mfa.POST("/recovery-codes", p.MFAHandler.RegenerateRecoveryCodes)
+
+			// External identities
+			authed.GET("/:id/identities", middleware.RequireSelfOrPermission("id", domain.PermissionUsersRead), p.OIDCHandler.ListIdentities)
+			authed.DELETE("/:id/identities/:identity_id", middleware.RequireSelfOrPermission("id", domain.PermissionUsersWrite), p.OIDCHandler.Unlink)
+
+			// OAuth2 consents granted to clients
+			authed.DELETE("/:id/oauth/consents/:client_id", middleware.RequireSelfOrPermission("id", domain.PermissionUsersWrite), p.OAuthHandler.RevokeConsent)
+		}
+
+		// API keys for service-to-service clients
+		apiKeys := v1.Group("/api-keys", auth)
+		{
+			apiKeys.POST("", p.APIKeyHandler.Create)
+			apiKeys.GET("", p.APIKeyHandler.List)
+			apiKeys.GET("/:id", p.APIKeyHandler.Get)
+			apiKeys.PUT("/:id", p.APIKeyHandler.Update)
+			apiKeys.DELETE("/:id", p.APIKeyHandler.Delete)
+		}
+
+		// OAuth2 client registration
+		oauthClients := v1.Group("/oauth/clients", auth, middleware.RequirePermission(domain.PermissionOAuthClientsManage))
+		{
+			oauthClients.POST("", p.OAuthHandler.RegisterClient)
+			oauthClients.GET("", p.OAuthHandler.ListClients)
+			oauthClients.DELETE("/:client_id", p.OAuthHandler.DeleteClient)
+		}
+
+		// Audit log
+		audit := v1.Group("/audit-events", auth, middleware.RequirePermission(domain.PermissionAuditRead))
+		{
+			audit.GET("", p.AuditHandler.List)
+			audit.GET("/verify", p.AuditHandler.Verify)
+		}
+
+		// Webhook subscriptions and their delivery log
+		webhooks := v1.Group("/webhooks", auth, middleware.RequirePermission(domain.PermissionWebhooksManage))
+		{
+			webhooks.POST("", p.WebhookHandler.Create)
+			webhooks.GET("", p.WebhookHandler.List)
+			webhooks.GET("/:id", p.WebhookHandler.Get)
+			webhooks.PUT("/:id", p.WebhookHandler.Update)
+			webhooks.DELETE("/:id", p.WebhookHandler.Delete)
+			webhooks.GET("/:id/deliveries", p.WebhookHandler.ListDeliveries)
+			webhooks.GET("/:id/deliveries/:delivery_id", p.WebhookHandler.GetDelivery)
+			webhooks.POST("/:id/deliveries/:delivery_id/redeliver", p.WebhookHandler.Redeliver)
 		}
+
+		// scaffold:routes
 	}
 	return r
 }
+
+// openAPIValidator creates the OpenAPI validation middleware if it is enabled. Responses are
+// only validated in development and test environments.
+func openAPIValidator(cfg *config.Config) gin.HandlerFunc {
+	responses := cfg.HTTP.ValidateResponses
+	switch cfg.App.Env {
+	case "dev", "development", "test":
+	default:
+		responses = middleware.ValidationOff
+	}
+	if cfg.HTTP.ValidateRequests == middleware.ValidationOff && responses == middleware.ValidationOff {
+		return nil
+	}
+
+	validator, err := middleware.OpenAPIValidator(swagger.SwaggerInfo.ReadDoc(), cfg.HTTP.ValidateRequests, responses)
+	if err != nil {
+		zap.S().Errorw("Failed to set up OpenAPI validation", "error", err)
+		return nil
+	}
+	return validator
+}
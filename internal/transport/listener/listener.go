@@ -0,0 +1,107 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/luxixing/fx-gin/internal/config"
+	"github.com/luxixing/fx-gin/pkg/registry"
+	"github.com/soheilhy/cmux"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registry.Register(
+		fx.Provide(NewListeners),
+	)
+}
+
+// ListenersParams represents the parameters required for listener initialization
+type ListenersParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Config    *config.Config
+}
+
+// Listeners holds the sockets of the HTTP and gRPC servers. They are opened on application
+// start, so servers take them in their own start hooks.
+//
+// With a shared port both servers are reached on the application port: connections are
+// split by cmux, HTTP/1.1 goes to the HTTP server and HTTP/2 without TLS (h2c) to the gRPC
+// server. Matching on the first request would make the port answer HTTP/2 settings before
+// either server does, which gRPC clients wait for and other HTTP/2 clients reject.
+type Listeners struct {
+	mux  cmux.CMux
+	http net.Listener
+	grpc net.Listener
+}
+
+// NewListeners creates the listeners and opens them when the application starts
+func NewListeners(p ListenersParams) *Listeners {
+	l := &Listeners{}
+	cfg := p.Config
+
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			// Listen before returning so a port conflict fails the start
+			httpAddr := fmt.Sprintf("%s:%d", cfg.App.Host, cfg.App.Port)
+			root, err := net.Listen("tcp", httpAddr)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", httpAddr, err)
+			}
+
+			switch {
+			case !cfg.GRPC.Enabled:
+				l.http = root
+			case cfg.GRPC.SharedPort:
+				l.mux = cmux.New(root)
+				l.http = l.mux.Match(cmux.HTTP1())
+				l.grpc = l.mux.Match(cmux.Any())
+				zap.S().Infow("Sharing port between HTTP and gRPC", "addr", httpAddr)
+				go func() {
+					if err := l.mux.Serve(); err != nil && !IsClosed(err) {
+						zap.S().Errorw("Connection multiplexer failed", "error", err)
+					}
+				}()
+			default:
+				grpcAddr := fmt.Sprintf("%s:%d", cfg.App.Host, cfg.GRPC.Port)
+				grpcListener, err := net.Listen("tcp", grpcAddr)
+				if err != nil {
+					root.Close()
+					return fmt.Errorf("failed to listen on %s: %w", grpcAddr, err)
+				}
+				l.http = root
+				l.grpc = grpcListener
+			}
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			// Servers close their own listeners when they stop, the multiplexer owns the socket
+			if l.mux != nil {
+				l.mux.Close()
+			}
+			return nil
+		},
+	})
+	return l
+}
+
+// HTTP returns the listener of the HTTP server
+func (l *Listeners) HTTP() net.Listener {
+	return l.http
+}
+
+// GRPC returns the listener of the gRPC server, nil when gRPC is disabled
+func (l *Listeners) GRPC() net.Listener {
+	return l.grpc
+}
+
+// IsClosed reports whether a server stopped serving because its listener was closed. The
+// listeners of a shared port close together, so either server stopping ends both.
+func IsClosed(err error) bool {
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, cmux.ErrServerClosed) || errors.Is(err, cmux.ErrListenerClosed)
+}
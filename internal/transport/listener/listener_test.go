@@ -0,0 +1,112 @@
+package listener
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	userv1 "github.com/luxixing/fx-gin/api/user/v1"
+	"github.com/luxixing/fx-gin/internal/config"
+	"go.uber.org/fx/fxtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// serve starts an HTTP server answering "http" and a gRPC server without implementations
+// on the listeners
+func serve(t *testing.T, l *Listeners) {
+	t.Helper()
+
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "http")
+	})}
+	go httpServer.Serve(l.HTTP())
+	t.Cleanup(func() { httpServer.Close() })
+
+	if l.GRPC() == nil {
+		return
+	}
+	grpcServer := grpc.NewServer()
+	userv1.RegisterUserServiceServer(grpcServer, userv1.UnimplementedUserServiceServer{})
+	go grpcServer.Serve(l.GRPC())
+	t.Cleanup(grpcServer.Stop)
+}
+
+// getHTTP sends an HTTP/1.1 request to addr and returns the body
+func getHTTP(t *testing.T, addr string) string {
+	t.Helper()
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("http request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read http response: %v", err)
+	}
+	return string(body)
+}
+
+// callGRPC calls the user service at addr and returns the status code of the answer
+func callGRPC(t *testing.T, addr string) codes.Code {
+	t.Helper()
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_, err = userv1.NewUserServiceClient(conn).GetUser(context.Background(), &userv1.GetUserRequest{Id: 1})
+	return status.Code(err)
+}
+
+func TestListeners(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		grpc   config.GRPCConfig
+		shared bool // gRPC is reached on the HTTP port
+	}{
+		{"grpc disabled", config.GRPCConfig{Enabled: false}, false},
+		{"separate ports", config.GRPCConfig{Enabled: true, Port: 0}, false},
+		{"shared port", config.GRPCConfig{Enabled: true, SharedPort: true}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lc := fxtest.NewLifecycle(t)
+			l := NewListeners(ListenersParams{
+				Lifecycle: lc,
+				Config:    &config.Config{App: &config.AppConfig{Host: "127.0.0.1"}, GRPC: &tc.grpc},
+			})
+			lc.RequireStart()
+			serve(t, l)
+			t.Cleanup(lc.RequireStop)
+
+			httpAddr := l.HTTP().Addr().String()
+			if body := getHTTP(t, httpAddr); body != "http" {
+				t.Errorf("http response = %q, want %q", body, "http")
+			}
+
+			if !tc.grpc.Enabled {
+				if l.GRPC() != nil {
+					t.Errorf("gRPC listener opened while gRPC is disabled")
+				}
+				return
+			}
+			grpcAddr := l.GRPC().Addr().String()
+			if shared := grpcAddr == httpAddr; shared != tc.shared {
+				t.Errorf("gRPC listens on %s and HTTP on %s, want shared = %v", grpcAddr, httpAddr, tc.shared)
+			}
+			// The unimplemented method is answered by the gRPC server, not the HTTP server
+			if code := callGRPC(t, grpcAddr); code != codes.Unimplemented {
+				t.Errorf("gRPC status = %v, want %v", code, codes.Unimplemented)
+			}
+			// HTTP keeps working next to a gRPC connection
+			if body := getHTTP(t, httpAddr); body != "http" {
+				t.Errorf("http response after gRPC call = %q, want %q", body, "http")
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is used when no supported locale is requested
+const DefaultLocale = "en"
+
+type contextKey struct{}
+
+//go:embed locales/*.json
+var catalogFiles embed.FS
+
+// message is a catalog entry, either a plain text or one text per plural category
+type message struct {
+	text   string
+	plural map[string]string
+}
+
+// UnmarshalJSON accepts a string or an object keyed by plural category ("one", "other", ...)
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &m.plural)
+}
+
+var (
+	// supported lists the locales with a catalog, the default first
+	supported = []language.Tag{language.English, language.Chinese}
+	matcher   = language.NewMatcher(supported)
+
+	// pluralRules provides the CLDR plural rules of each locale
+	pluralRules = map[string]locales.Translator{
+		"en": en.New(),
+		"zh": zh.New(),
+	}
+
+	catalogs = loadCatalogs()
+)
+
+// loadCatalogs reads the embedded message catalogs, one JSON file per locale
+func loadCatalogs() map[string]map[string]message {
+	files, err := catalogFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	result := make(map[string]map[string]message, len(files))
+	for _, file := range files {
+		data, err := catalogFiles.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		var catalog map[string]message
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("invalid message catalog %s: %v", file.Name(), err))
+		}
+		result[strings.TrimSuffix(file.Name(), ".json")] = catalog
+	}
+	return result
+}
+
+// Negotiate returns the first supported locale among the candidates, each either a
+// locale such as "zh-CN" or an Accept-Language header. Empty candidates are skipped.
+func Negotiate(candidates ...string) string {
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		tags, _, err := language.ParseAcceptLanguage(candidate)
+		if err != nil || len(tags) == 0 {
+			continue
+		}
+		_, index, confidence := matcher.Match(tags...)
+		if confidence == language.No {
+			continue
+		}
+		base, _ := supported[index].Base()
+		return base.String()
+	}
+	return DefaultLocale
+}
+
+// Localizer looks up messages in the catalog of one locale
+type Localizer struct {
+	locale string
+}
+
+// New creates a localizer for a supported locale, falling back to the default locale
+func New(locale string) *Localizer {
+	if _, ok := catalogs[locale]; !ok {
+		locale = DefaultLocale
+	}
+	return &Localizer{locale: locale}
+}
+
+// WithLocale returns a context carrying the locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns a localizer for the locale carried by the context
+func FromContext(ctx context.Context) *Localizer {
+	locale, _ := ctx.Value(contextKey{}).(string)
+	return New(locale)
+}
+
+// Locale returns the locale of the localizer
+func (l *Localizer) Locale() string {
+	return l.locale
+}
+
+// T returns the message for key with "{name}" placeholders replaced by args, given as
+// alternating names and values. Missing messages fall back to the default locale and
+// then to the key itself.
+func (l *Localizer) T(key string, args ...any) string {
+	text, ok := l.lookup(key, nil)
+	if !ok {
+		return key
+	}
+	return format(text, args)
+}
+
+// N returns the plural form of the message for count, which is available as "{count}"
+func (l *Localizer) N(key string, count int, args ...any) string {
+	text, ok := l.lookup(key, &count)
+	if !ok {
+		return key
+	}
+	return format(text, append([]any{"count", count}, args...))
+}
+
+// Lookup is like T but reports whether the message exists
+func (l *Localizer) Lookup(key string, args ...any) (string, bool) {
+	text, ok := l.lookup(key, nil)
+	if !ok {
+		return "", false
+	}
+	return format(text, args), true
+}
+
+// FuncMap exposes T as "t" and N as "n" to templates
+func (l *Localizer) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"t": l.T,
+		"n": l.N,
+	}
+}
+
+// lookup finds the text of a message, selecting the plural category when count is set
+func (l *Localizer) lookup(key string, count *int) (string, bool) {
+	for _, locale := range []string{l.locale, DefaultLocale} {
+		msg, ok := catalogs[locale][key]
+		if !ok {
+			continue
+		}
+		if msg.plural == nil {
+			return msg.text, true
+		}
+
+		category := "other"
+		if count != nil {
+			category = strings.ToLower(pluralRules[locale].CardinalPluralRule(float64(*count), 0).String())
+		}
+		if text, ok := msg.plural[category]; ok {
+			return text, true
+		}
+		if text, ok := msg.plural["other"]; ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// format replaces "{name}" placeholders with the values of alternating name/value args
+func format(text string, args []any) string {
+	if len(args) == 0 {
+		return text
+	}
+
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
@@ -0,0 +1,30 @@
+package i18n
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"no candidates", nil, "en"},
+		{"locale", []string{"zh"}, "zh"},
+		{"region", []string{"zh-CN"}, "zh"},
+		{"header order", []string{"zh-CN,zh;q=0.9,en;q=0.8"}, "zh"},
+		{"quality values", []string{"en;q=0.5, zh;q=0.9"}, "zh"},
+		{"unsupported locale", []string{"fr"}, "en"},
+		{"unsupported first in header", []string{"fr-FR, zh;q=0.8"}, "zh"},
+		{"invalid header", []string{"not a header;q=x"}, "en"},
+		// The profile locale comes first, the header decides when it is unset or unsupported
+		{"profile wins", []string{"zh", "en"}, "zh"},
+		{"empty profile", []string{"", "zh-CN"}, "zh"},
+		{"unsupported profile", []string{"fr", "zh"}, "zh"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Negotiate(tc.candidates...); got != tc.want {
+				t.Errorf("Negotiate(%q) = %q, want %q", tc.candidates, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// MaxPixels bounds the decoded size of an image to protect against decompression bombs
+const MaxPixels = 40_000_000
+
+// Formats by sniffed content type
+var decoders = map[string]func(io.Reader) (image.Image, error){
+	"image/jpeg": jpeg.Decode,
+	"image/png":  png.Decode,
+	"image/gif":  gif.Decode,
+	"image/webp": webp.Decode,
+}
+
+var configDecoders = map[string]func(io.Reader) (image.Config, error){
+	"image/jpeg": jpeg.DecodeConfig,
+	"image/png":  png.DecodeConfig,
+	"image/gif":  gif.DecodeConfig,
+	"image/webp": webp.DecodeConfig,
+}
+
+// ErrUnsupportedFormat is returned for content that is not a supported image format
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// ErrTooManyPixels is returned for images larger than MaxPixels
+var ErrTooManyPixels = errors.New("image dimensions too large")
+
+// Decode decodes a JPEG, PNG, GIF or WebP image, detecting the format from its
+// content rather than a client supplied type. It returns the image and its content type.
+func Decode(data []byte) (image.Image, string, error) {
+	contentType := http.DetectContentType(data)
+	decode, ok := decoders[contentType]
+	if !ok {
+		return nil, contentType, ErrUnsupportedFormat
+	}
+
+	// Check the dimensions before decoding the pixels
+	cfg, err := configDecoders[contentType](bytes.NewReader(data))
+	if err != nil {
+		return nil, contentType, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, contentType, ErrTooManyPixels
+	}
+
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, contentType, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, contentType, nil
+}
+
+// Fit scales img down to fit within limit x limit pixels, keeping its aspect ratio.
+// Smaller images are returned unchanged.
+func Fit(img image.Image, limit int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= limit && h <= limit {
+		return img
+	}
+
+	if w >= h {
+		h = h * limit / w
+		w = limit
+	} else {
+		w = w * limit / h
+		h = limit
+	}
+	return scale(img, b, atLeastOne(w), atLeastOne(h))
+}
+
+// Thumbnail crops the center square of img and scales it to size x size pixels
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	return scale(img, image.Rect(x, y, x+side, y+side), size, size)
+}
+
+// OutputFormat returns the content type and file extension Encode uses for images
+// of the source type. Images that may contain transparency are written as PNG.
+func OutputFormat(sourceType string) (string, string) {
+	if sourceType == "image/jpeg" {
+		return "image/jpeg", ".jpg"
+	}
+	return "image/png", ".png"
+}
+
+// Encode writes img in the output format for the source type
+func Encode(w io.Writer, img image.Image, sourceType string) error {
+	if contentType, _ := OutputFormat(sourceType); contentType == "image/jpeg" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+	return png.Encode(w, img)
+}
+
+// scale resamples the src rectangle of img to a new w x h image
+func scale(img image.Image, src image.Rectangle, w, h int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Over, nil)
+	return dst
+}
+
+// atLeastOne ensures a dimension is at least one pixel
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,132 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// encoded returns a w x h image in the given format
+func encoded(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := range w {
+		for y := range h {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader returns a PNG that declares the dimensions but has no pixel data
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8], ihdr[9] = 8, 2 // 8 bit RGB
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestDecodeSniffsTheContent(t *testing.T) {
+	pngData := encoded(t, "png", 4, 4)
+
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		contentType string
+		err         error
+	}{
+		{"png", pngData, "image/png", nil},
+		{"jpeg", encoded(t, "jpeg", 4, 4), "image/jpeg", nil},
+		{"gif", encoded(t, "gif", 4, 4), "image/gif", nil},
+		{"text", []byte("definitely not an image"), "text/plain; charset=utf-8", ErrUnsupportedFormat},
+		{"svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), "text/xml; charset=utf-8", ErrUnsupportedFormat},
+		{"html", []byte("<html><body>hi</body></html>"), "text/html; charset=utf-8", ErrUnsupportedFormat},
+		{"too many pixels", pngHeader(10000, 10000), "image/png", ErrTooManyPixels},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			img, contentType, err := Decode(tc.data)
+			if contentType != tc.contentType {
+				t.Errorf("content type = %q, want %q", contentType, tc.contentType)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if err == nil && img.Bounds().Dx() != 4 {
+				t.Errorf("decoded width = %d, want 4", img.Bounds().Dx())
+			}
+		})
+	}
+
+	// Broken images of a supported format are neither decoded nor reported as unsupported
+	_, _, err := Decode(pngData[:len(pngData)/2])
+	if err == nil || errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("truncated png: err = %v, want a decoding error", err)
+	}
+}
+
+func TestFitAndThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 100))
+
+	for _, tc := range []struct {
+		name  string
+		img   image.Image
+		wantW int
+		wantH int
+	}{
+		{"fit wide", Fit(img, 200), 200, 50},
+		{"fit tall", Fit(image.NewRGBA(image.Rect(0, 0, 100, 400)), 200), 50, 200},
+		{"fit small", Fit(img, 1000), 400, 100},
+		{"fit thin", Fit(image.NewRGBA(image.Rect(0, 0, 1000, 1)), 100), 100, 1},
+		{"thumbnail", Thumbnail(img, 64), 64, 64},
+		{"thumbnail upscale", Thumbnail(image.NewRGBA(image.Rect(0, 0, 10, 20)), 32), 32, 32},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if b := tc.img.Bounds(); b.Dx() != tc.wantW || b.Dy() != tc.wantH {
+				t.Errorf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tc.wantW, tc.wantH)
+			}
+		})
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	for source, want := range map[string]string{
+		"image/jpeg": "image/jpeg",
+		"image/png":  "image/png",
+		"image/gif":  "image/png",
+		"image/webp": "image/png",
+	} {
+		if got, _ := OutputFormat(source); got != want {
+			t.Errorf("OutputFormat(%s) = %s, want %s", source, got, want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902) documents
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Content types of patch documents
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalidPatch is returned for malformed patch documents or operations that cannot be applied
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrTestFailed is returned when a JSON Patch "test" operation does not match
+	ErrTestFailed = errors.New("patch test operation failed")
+)
+
+// Operation is a JSON Patch operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MergePatch applies an RFC 7396 merge patch to doc. Members set to null are removed,
+// objects are merged recursively and all other values replace the target.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	if err := decode(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := decode(patch, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+// Apply applies an RFC 6902 JSON Patch to doc. Operations are applied in order and
+// the document is left unchanged if any of them fails.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target any
+	if err := decode(doc, &target); err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	for i, op := range ops {
+		var err error
+		if target, err = applyOperation(target, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+// mergeValue implements the MergePatch algorithm of RFC 7396 section 2
+func mergeValue(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergeValue(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// applyOperation applies a single JSON Patch operation and returns the new document
+func applyOperation(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+		var value any
+		if err := decode(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if doc, _, err = remove(doc, path); err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if len(path) > len(from) && isPrefix(from, path) {
+				return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidPatch)
+			}
+			if doc, _, err = remove(doc, from); err != nil {
+				return nil, err
+			}
+		} else if value, err = deepCopy(value); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// get returns the value at path
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: path not found", ErrInvalidPatch)
+			}
+			doc = value
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("%w: path not found", ErrInvalidPatch)
+		}
+	}
+	return doc, nil
+}
+
+// add inserts value at path, replacing object members and shifting array elements
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		container[token] = value
+		return doc, nil
+	case []any:
+		index := len(container)
+		if token != "-" {
+			if index, err = arrayIndex(token, len(container)); err != nil {
+				return nil, err
+			}
+		}
+		container = append(container, nil)
+		copy(container[index+1:], container[index:])
+		container[index] = value
+		return replaceParent(doc, path[:len(path)-1], container)
+	default:
+		return nil, fmt.Errorf("%w: path not found", ErrInvalidPatch)
+	}
+}
+
+// remove deletes the value at path and returns the new document and the removed value
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		value, ok := container[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: path not found", ErrInvalidPatch)
+		}
+		delete(container, token)
+		return doc, value, nil
+	case []any:
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := container[index]
+		container = append(container[:index:index], container[index+1:]...)
+		doc, err = replaceParent(doc, path[:len(path)-1], container)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("%w: path not found", ErrInvalidPatch)
+	}
+}
+
+// replaceParent stores a resized array back into its parent, arrays are values in Go
+func replaceParent(doc any, path []string, array []any) (any, error) {
+	if len(path) == 0 {
+		return array, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		container[token] = array
+	case []any:
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = array
+	}
+	return doc, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid path %q", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token, accepting values up to maxIndex
+func arrayIndex(token string, maxIndex int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > maxIndex || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	return index, nil
+}
+
+// isPrefix reports whether prefix is a leading part of path
+func isPrefix(prefix, path []string) bool {
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// deepCopy copies a decoded JSON value so copies do not share containers
+func deepCopy(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var copied any
+	err = decode(data, &copied)
+	return copied, err
+}
+
+// decode unmarshals JSON keeping numbers exact
+func decode(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
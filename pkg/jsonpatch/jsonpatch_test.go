@@ -0,0 +1,187 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestMergePatchRFC7396 runs the examples of RFC 7396 Appendix A
+func TestMergePatchRFC7396(t *testing.T) {
+	for _, tc := range []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		got, err := MergePatch([]byte(tc.doc), []byte(tc.patch))
+		if err != nil {
+			t.Errorf("merge %s into %s: %v", tc.patch, tc.doc, err)
+			continue
+		}
+		assertJSON(t, tc.doc+" + "+tc.patch, got, tc.want)
+	}
+}
+
+func TestMergePatchRejectsInvalidJSON(t *testing.T) {
+	if _, err := MergePatch([]byte(`{}`), []byte(`{"a":`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("err = %v, want ErrInvalidPatch", err)
+	}
+}
+
+// TestApplyRFC6902 runs the examples of RFC 6902 Appendix A. A.13 is left out as
+// encoding/json keeps the last of duplicate members instead of rejecting them.
+func TestApplyRFC6902(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		doc, patch string
+		want       string
+		err        error
+	}{
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo":["all","grass","cows","eat"]}`,
+			patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:  "A.8 testing a value: success",
+			doc:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:  "A.9 testing a value: error",
+			doc:   `{"baz":"qux"}`,
+			patch: `[{"op":"test","path":"/baz","value":"bar"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			want:  `{"foo":"bar","child":{"grandchild":{}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			want:  `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			name:  "A.12 adding to a nonexistent target",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "A.14 ~ escape ordering",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":10}]`,
+			want:  `{"/":9,"~1":10}`,
+		},
+		{
+			name:  "A.15 comparing strings and numbers",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":"10"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:  `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name:  "unknown operation",
+			doc:   `{}`,
+			patch: `[{"op":"merge","path":"/a","value":1}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "moving a value into itself",
+			doc:   `{"a":{"b":1}}`,
+			patch: `[{"op":"move","from":"/a","path":"/a/c"}]`,
+			err:   ErrInvalidPatch,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Apply([]byte(tc.doc), []byte(tc.patch))
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("err = %v, want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			assertJSON(t, tc.name, got, tc.want)
+		})
+	}
+}
+
+// assertJSON compares JSON documents independent of member order
+func assertJSON(t *testing.T, name string, got []byte, want string) {
+	t.Helper()
+
+	var gotValue, wantValue any
+	if err := decode(got, &gotValue); err != nil {
+		t.Fatalf("%s: decode result %s: %v", name, got, err)
+	}
+	if err := decode([]byte(want), &wantValue); err != nil {
+		t.Fatalf("%s: decode expected %s: %v", name, want, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("%s = %s, want %s", name, got, want)
+	}
+}
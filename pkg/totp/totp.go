@@ -0,0 +1,101 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is the time step in seconds (RFC 6238 default)
+	Period = 30
+	// Digits is the number of digits in a generated code
+	Digits = 6
+	// SecretSize is the size of a generated secret in bytes
+	SecretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret creates a new random base32 encoded secret
+func GenerateSecret() (string, error) {
+	buf := make([]byte, SecretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(buf), nil
+}
+
+// Step returns the time step counter for the given time
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code generates the code for the given secret and time step
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", fmt.Errorf("invalid secret: %w", err)
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226 section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+// Validate checks the code against the secret allowing skew steps of clock drift
+// in either direction. It returns the matched step so callers can reject replays.
+func Validate(secret, code string, t time.Time, skew int) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for i := -skew; i <= skew; i++ {
+		step := current + int64(i)
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URI builds the otpauth:// key URI understood by authenticator apps.
+// The same string is used as the QR code payload.
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprintf("%d", Digits))
+	v.Set("period", fmt.Sprintf("%d", Period))
+
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
@@ -0,0 +1,82 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key "12345678901234567890" of RFC 6238 Appendix B in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8 digit codes, the last 6 digits are the 6 digit codes
+	for _, tc := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	} {
+		got, err := Code(rfcSecret, Step(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatalf("code at %d: %v", tc.unix, err)
+		}
+		if got != tc.want {
+			t.Errorf("code at %d = %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestValidateAllowsSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for _, tc := range []struct {
+		name   string
+		offset int64
+		skew   int
+		valid  bool
+	}{
+		{"current step", 0, 0, true},
+		{"previous step without skew", -1, 0, false},
+		{"previous step", -1, 1, true},
+		{"next step", 1, 1, true},
+		{"two steps behind", -2, 1, false},
+		{"two steps ahead", 2, 1, false},
+		{"two steps behind with skew 2", -2, 2, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, current+tc.offset)
+			if err != nil {
+				t.Fatalf("code: %v", err)
+			}
+			step, ok := Validate(rfcSecret, code, now, tc.skew)
+			if ok != tc.valid {
+				t.Fatalf("valid = %v, want %v", ok, tc.valid)
+			}
+			if ok && step != current+tc.offset {
+				t.Errorf("matched step %d, want %d", step, current+tc.offset)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	if _, ok := Validate("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", " 287082 ", now, 0); !ok {
+		t.Errorf("lower case secret or surrounding spaces were rejected")
+	}
+	for _, code := range []string{"", "28708", "2870820", "94287082", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("code %q was accepted", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "287082", now, 1); ok {
+		t.Errorf("invalid secret was accepted")
+	}
+}
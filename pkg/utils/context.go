@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/luxixing/fx-gin/internal/domain"
+	"github.com/luxixing/fx-gin/pkg/i18n"
 )
 
 // WithContext creates a context with trace information from gin.Context
@@ -15,7 +16,13 @@ func WithContext(c *gin.Context) context.Context {
 	}
 
 	traceInfo := trace.(*domain.TraceInfo)
-	return context.WithValue(context.Background(), domain.TraceKey, traceInfo)
+	ctx := context.WithValue(context.Background(), domain.TraceKey, traceInfo)
+	ctx = i18n.WithLocale(ctx, traceInfo.Locale)
+
+	if principal, exists := c.Get(domain.PrincipalKey); exists {
+		ctx = context.WithValue(ctx, domain.PrincipalKey, principal.(*domain.Principal))
+	}
+	return ctx
 }
 
 // FromContext retrieves trace information from context
@@ -26,3 +33,12 @@ func FromContext(ctx context.Context) *domain.TraceInfo {
 	}
 	return trace
 }
+
+// PrincipalFromContext retrieves the authenticated principal from context
+func PrincipalFromContext(ctx context.Context) *domain.Principal {
+	principal, ok := ctx.Value(domain.PrincipalKey).(*domain.Principal)
+	if !ok {
+		return nil
+	}
+	return principal
+}
@@ -0,0 +1,156 @@
+package validation
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	zhTranslations "github.com/go-playground/validator/v10/translations/zh"
+)
+
+// universal holds the translators of the supported locales, English is the fallback
+var universal = ut.New(en.New(), zh.New())
+
+var (
+	// usernamePattern matches the characters allowed in usernames
+	usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+	// phonePattern matches phone numbers with an optional leading "+", spaces and hyphens
+	phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 -]{4,18}[0-9]$`)
+)
+
+// messages holds the translations of custom rules and binding errors per locale
+var messages = map[string]map[string]string{
+	"en": {
+		"username": "{0} can only contain letters, numbers, dots, underscores and hyphens",
+		"password": "{0} must contain at least one letter and one number",
+		"phone":    "{0} must be a valid phone number",
+		"type":     "{0} must be of type {1}",
+	},
+	"zh": {
+		"username": "{0}只能包含字母、数字、点、下划线和连字符",
+		"password": "{0}必须至少包含一个字母和一个数字",
+		"phone":    "{0}必须是有效的电话号码",
+		"type":     "{0}必须是{1}类型",
+	},
+}
+
+// engine is the validator configured by Setup
+var engine *validator.Validate
+
+// Setup registers custom rules and the English and Chinese message translations on
+// the validator. Fields are reported by their json or form tag names.
+func Setup(v *validator.Validate) error {
+	engine = v
+	v.RegisterTagNameFunc(fieldName)
+
+	if err := v.RegisterValidation("username", validateUsername); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("password", validatePassword); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("phone", validatePhone); err != nil {
+		return err
+	}
+
+	for locale, register := range map[string]func(*validator.Validate, ut.Translator) error{
+		"en": enTranslations.RegisterDefaultTranslations,
+		"zh": zhTranslations.RegisterDefaultTranslations,
+	} {
+		trans, _ := universal.GetTranslator(locale)
+		if err := register(v, trans); err != nil {
+			return err
+		}
+		for key, text := range messages[locale] {
+			if err := trans.Add(key, text, true); err != nil {
+				return err
+			}
+		}
+		for _, tag := range []string{"username", "password", "phone"} {
+			if err := v.RegisterTranslation(tag, trans, noopRegister, translateRule); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Struct validates a struct with its binding rules outside of request binding,
+// e.g. after applying a patch
+func Struct(s any) error {
+	return engine.Struct(s)
+}
+
+// Translator returns the translator for a locale, falling back to English
+func Translator(locale string) ut.Translator {
+	trans, _ := universal.GetTranslator(locale)
+	return trans
+}
+
+// TypeMessage describes a field whose value has the wrong JSON type
+func TypeMessage(trans ut.Translator, field, typ string) string {
+	message, err := trans.T("type", field, typ)
+	if err != nil {
+		return field + " must be of type " + typ
+	}
+	return message
+}
+
+// fieldName reports struct fields by the name clients send
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// validateUsername allows letters, numbers, dots, underscores and hyphens
+func validateUsername(fl validator.FieldLevel) bool {
+	return usernamePattern.MatchString(fl.Field().String())
+}
+
+// validatePassword requires at least one letter and one number
+func validatePassword(fl validator.FieldLevel) bool {
+	var hasLetter, hasDigit bool
+	for _, r := range fl.Field().String() {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	return hasLetter && hasDigit
+}
+
+// validatePhone allows digits with an optional leading "+", spaces and hyphens
+func validatePhone(fl validator.FieldLevel) bool {
+	return phonePattern.MatchString(fl.Field().String())
+}
+
+// noopRegister is used for rules whose messages are added in Setup
+func noopRegister(ut.Translator) error {
+	return nil
+}
+
+// translateRule translates a custom rule message keyed by its tag
+func translateRule(trans ut.Translator, fe validator.FieldError) string {
+	message, err := trans.T(fe.Tag(), fe.Field())
+	if err != nil {
+		return fe.Error()
+	}
+	return message
+}
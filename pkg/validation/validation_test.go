@@ -0,0 +1,79 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// signup uses built-in and custom rules
+type signup struct {
+	Username string `json:"username" binding:"required,username"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6,password"`
+	Phone    string `form:"phone" binding:"omitempty,phone"`
+}
+
+func TestFieldErrorsAreLocalized(t *testing.T) {
+	v := validator.New()
+	v.SetTagName("binding")
+	if err := Setup(v); err != nil {
+		t.Fatalf("set up: %v", err)
+	}
+
+	err := v.Struct(&signup{Username: "bad name", Email: "not-an-email", Password: "letters", Phone: "call me"})
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		t.Fatalf("err = %v, want validation errors", err)
+	}
+
+	want := map[string]map[string]string{
+		"en": {
+			"username": "username can only contain letters, numbers, dots, underscores and hyphens",
+			"email":    "email must be a valid email address",
+			"password": "password must contain at least one letter and one number",
+			"phone":    "phone must be a valid phone number",
+		},
+		"zh": {
+			"username": "username只能包含字母、数字、点、下划线和连字符",
+			"email":    "email必须是一个有效的邮箱",
+			"password": "password必须至少包含一个字母和一个数字",
+			"phone":    "phone必须是有效的电话号码",
+		},
+		// Unsupported locales fall back to English
+		"fr": {
+			"username": "username can only contain letters, numbers, dots, underscores and hyphens",
+		},
+	}
+	for locale, messages := range want {
+		t.Run(locale, func(t *testing.T) {
+			trans := Translator(locale)
+			got := make(map[string]string, len(fieldErrs))
+			for _, fe := range fieldErrs {
+				got[fe.Field()] = fe.Translate(trans)
+			}
+			for field, message := range messages {
+				if got[field] != message {
+					t.Errorf("%s: message = %q, want %q", field, got[field], message)
+				}
+			}
+		})
+	}
+}
+
+func TestTypeMessageIsLocalized(t *testing.T) {
+	for _, tc := range []struct {
+		locale string
+		want   string
+	}{
+		{"en", "age must be of type int"},
+		{"zh", "age必须是int类型"},
+	} {
+		t.Run(tc.locale, func(t *testing.T) {
+			if got := TypeMessage(Translator(tc.locale), "age", "int"); got != tc.want {
+				t.Errorf("message = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}